@@ -0,0 +1,811 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nedpals/bugbuddy/server/logger"
+	"github.com/nedpals/bugbuddy/server/logger/export"
+	"github.com/nedpals/bugbuddy/server/logger/progsnap2"
+	"github.com/spf13/cobra"
+)
+
+var logsCmd = &cobra.Command{
+	Use:   "logs",
+	Short: "Manages the log databases collected by the daemon",
+}
+
+// resolveLogPaths expands the glob patterns from the arguments into a list of
+// existing .db files. The daemon's logs database is used if no arguments were given.
+func resolveLogPaths(args []string) []string {
+	if len(args) == 0 {
+		defaultPath, err := logger.DefaultLogsPath()
+		if err != nil {
+			log.Fatalln(err)
+		}
+		args = []string{defaultPath}
+	}
+
+	paths := []string{}
+	for _, arg := range args {
+		matches, err := filepath.Glob(arg)
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		for _, match := range matches {
+			fi, err := os.Stat(match)
+			if err != nil {
+				log.Fatalln(err)
+			}
+
+			if fi.IsDir() {
+				if !logger.IsJSONLStorage(match) {
+					log.Fatalln("only directories of JSONL logs are supported")
+				}
+			} else if filepath.Ext(match) != ".db" {
+				log.Fatalln("only .db files are supported")
+			}
+
+			realPath, err := filepath.Abs(match)
+			if err != nil {
+				log.Fatalln(err)
+			}
+
+			paths = append(paths, realPath)
+		}
+	}
+
+	if len(paths) == 0 {
+		log.Fatalln("no log files were found")
+	}
+
+	return paths
+}
+
+var logsMigrateCmd = &cobra.Command{
+	Use:   "migrate [db...]",
+	Short: "Upgrades log databases to the latest schema version",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		for _, path := range resolveLogPaths(args) {
+			from, to, err := logger.MigrateFromPath(path)
+			if err != nil {
+				log.Fatalf("%s: %s\n", path, err)
+			}
+
+			if from == to {
+				fmt.Printf("%s: already at version %d\n", path, to)
+			} else {
+				fmt.Printf("%s: migrated from version %d to %d\n", path, from, to)
+			}
+		}
+		return nil
+	},
+}
+
+var logsCompactCmd = &cobra.Command{
+	Use:   "compact [db...]",
+	Short: "Moves file contents into the deduplicated blob store and reclaims unused space",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		useDelta, _ := cmd.Flags().GetBool("delta")
+
+		for _, path := range resolveLogPaths(args) {
+			sizeBefore := fileSize(path)
+
+			lg, err := logger.NewLoggerFromPath(path)
+			if err != nil {
+				log.Fatalf("%s: %s\n", path, err)
+			}
+
+			stats, err := lg.Compact(useDelta)
+			if err != nil {
+				lg.Close()
+				log.Fatalf("%s: %s\n", path, err)
+			}
+
+			if err := lg.Close(); err != nil {
+				log.Fatalln(err)
+			}
+
+			fmt.Printf(
+				"%s: converted %d file version/s, delta-encoded %d blob/s, pruned %d blob/s (%d -> %d bytes)\n",
+				path,
+				stats.ConvertedFiles,
+				stats.DeltaBlobs,
+				stats.PrunedBlobs,
+				sizeBefore,
+				fileSize(path),
+			)
+		}
+		return nil
+	},
+}
+
+var logsExportCmd = &cobra.Command{
+	Use:   "export [db...]",
+	Short: "Exports the raw log entries and file versions of log databases",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		rawFormat, _ := cmd.Flags().GetString("format")
+		outputDir, _ := cmd.Flags().GetString("output")
+		noFiles, _ := cmd.Flags().GetBool("no-files")
+		opts := export.Options{}
+		opts.ParticipantId, _ = cmd.Flags().GetString("participant")
+		opts.FileGlob, _ = cmd.Flags().GetString("files")
+		opts.WithSource, _ = cmd.Flags().GetBool("with-source")
+		afterDate := parseDateFlag(cmd, "after")
+		beforeDate := parseDateFlag(cmd, "before")
+
+		format := export.Format(rawFormat)
+		if !slices.Contains(export.SupportedFormats, format) && format != progsnap2.Format {
+			log.Fatalf("invalid format: %s\n", rawFormat)
+		}
+
+		paths := resolveLogPaths(args)
+
+		if err := os.MkdirAll(outputDir, 0755); err != nil {
+			log.Fatalln(err)
+		}
+
+		var writer export.Writer
+		if format == progsnap2.Format {
+			// the dataset is written into the output directory
+			dataset, err := progsnap2.NewWriter(outputDir)
+			if err != nil {
+				log.Fatalln(err)
+			}
+			dataset.NoCodeStates = noFiles
+			writer = dataset
+		} else {
+			entriesFile, err := os.Create(filepath.Join(outputDir, "logs."+string(format)))
+			if err != nil {
+				log.Fatalln(err)
+			}
+			defer entriesFile.Close()
+
+			var filesOut io.Writer
+			if !noFiles {
+				filesFile, err := os.Create(filepath.Join(outputDir, "files."+string(format)))
+				if err != nil {
+					log.Fatalln(err)
+				}
+				defer filesFile.Close()
+				filesOut = filesFile
+			}
+
+			writer, err = export.NewWriter(format, entriesFile, filesOut, opts.WithSource)
+			if err != nil {
+				log.Fatalln(err)
+			}
+		}
+
+		for _, path := range paths {
+			lg, err := logger.NewLoggerFromPath(path)
+			if err != nil {
+				log.Fatalf("%s: %s\n", path, err)
+			}
+
+			lg.After = afterDate
+			lg.Before = beforeDate
+
+			stats, err := export.Export(lg, writer, opts)
+			lg.Close()
+			if err != nil {
+				log.Fatalf("%s: %s\n", path, err)
+			}
+
+			fmt.Printf("%s: exported %d log entries and %d file versions\n", path, stats.Entries, stats.Files)
+		}
+
+		if err := writer.Close(); err != nil {
+			log.Fatalln(err)
+		}
+		return nil
+	},
+}
+
+var logsMergeCmd = &cobra.Command{
+	Use:   "merge [db...]",
+	Short: "Combines the log databases of multiple participants into a single database",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		outputPath, _ := cmd.Flags().GetString("output")
+		noNormalize, _ := cmd.Flags().GetBool("no-normalize")
+
+		if len(outputPath) == 0 {
+			log.Fatalln("an output database is required")
+		}
+
+		realOutputPath, err := filepath.Abs(outputPath)
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		paths := resolveLogPaths(args)
+		if slices.Contains(paths, realOutputPath) {
+			log.Fatalln("the output database cannot be one of the databases to be merged")
+		}
+
+		study, err := logger.NewLoggerFromPath(realOutputPath)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		defer study.Close()
+
+		opts := logger.MergeOptions{NormalizePaths: !noNormalize}
+
+		for _, path := range paths {
+			src, err := logger.NewLoggerFromPath(path)
+			if err != nil {
+				log.Fatalf("%s: %s\n", path, err)
+			}
+
+			stats, err := study.Merge(src, path, opts)
+			src.Close()
+			if err != nil {
+				log.Fatalf("%s: %s\n", path, err)
+			}
+
+			fmt.Printf(
+				"%s: merged %d log entries, %d file versions and %d events (%d duplicate entries skipped)\n",
+				path,
+				stats.Entries,
+				stats.Files,
+				stats.Events,
+				stats.Duplicates,
+			)
+		}
+		return nil
+	},
+}
+
+var logsImportCmd = &cobra.Command{
+	Use:   "import [dataset...]",
+	Short: "Imports the compile and run events of ProgSnap2 datasets into a log database",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		outputPath, _ := cmd.Flags().GetString("output")
+		opts := progsnap2.ImportOptions{}
+		opts.DefaultFilePath, _ = cmd.Flags().GetString("default-file")
+
+		if len(outputPath) == 0 {
+			log.Fatalln("an output database is required")
+		}
+
+		study, err := logger.NewLoggerFromPath(outputPath)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		defer study.Close()
+
+		// the datasets were collected under the consent of their own studies so
+		// new study databases keep everything unless a level was already set
+		if _, err := study.GetSetting(logger.CollectionLevelSetting); err == sql.ErrNoRows {
+			if err := study.AddSetting(logger.CollectionLevelSetting, string(logger.CollectionFull)); err != nil {
+				log.Fatalln(err)
+			}
+		} else if err != nil {
+			log.Fatalln(err)
+		}
+
+		for _, dir := range args {
+			stats, err := progsnap2.Import(study, dir, opts)
+			if err != nil {
+				log.Fatalf("%s: %s\n", dir, err)
+			}
+
+			fmt.Printf(
+				"%s: imported %d log entries and %d file versions of %d participants (%d of %d events skipped)\n",
+				dir,
+				stats.Entries,
+				stats.Files,
+				stats.Participants,
+				stats.Skipped,
+				stats.Events,
+			)
+		}
+		return nil
+	},
+}
+
+var logsAnonymizeCmd = &cobra.Command{
+	Use:   "anonymize [db...]",
+	Short: "Scrubs home directories, usernames and sensitive text from log databases",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		config := logger.AnonymizerConfig{}
+		config.HashPaths, _ = cmd.Flags().GetBool("hash-paths")
+		config.Salt, _ = cmd.Flags().GetString("salt")
+		config.Usernames, _ = cmd.Flags().GetStringSlice("username")
+		config.Redact, _ = cmd.Flags().GetStringSlice("redact")
+		onWrite, _ := cmd.Flags().GetBool("on-write")
+		disableOnWrite, _ := cmd.Flags().GetBool("disable-on-write")
+
+		for _, path := range resolveLogPaths(args) {
+			lg, err := logger.NewLoggerFromPath(path)
+			if err != nil {
+				log.Fatalf("%s: %s\n", path, err)
+			}
+
+			if onWrite || disableOnWrite {
+				var writeConfig *logger.AnonymizerConfig
+				if onWrite {
+					writeConfig = &config
+				}
+
+				err := lg.SetWriteAnonymizer(writeConfig)
+				lg.Close()
+				if err != nil {
+					log.Fatalf("%s: %s\n", path, err)
+				}
+
+				if onWrite {
+					fmt.Printf("%s: new logs will be anonymized before they are written\n", path)
+				} else {
+					fmt.Printf("%s: new logs will be written as is\n", path)
+				}
+				continue
+			}
+
+			anonymizer, err := logger.NewAnonymizer(config)
+			if err != nil {
+				lg.Close()
+				log.Fatalln(err)
+			}
+
+			stats, err := lg.Anonymize(anonymizer)
+			lg.Close()
+			if err != nil {
+				log.Fatalf("%s: %s\n", path, err)
+			}
+
+			fmt.Printf("%s: anonymized %d log entries and %d file versions\n", path, stats.Entries, stats.Files)
+		}
+		return nil
+	},
+}
+
+var logsQueryCmd = &cobra.Command{
+	Use:   "query [db]",
+	Short: "Lists the log entries matching the filters",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		participantId, _ := cmd.Flags().GetString("participant")
+		filePrefix, _ := cmd.Flags().GetString("file-prefix")
+		errorType, _ := cmd.Flags().GetString("error-type")
+		exitCode, _ := cmd.Flags().GetInt("exit-code")
+		limit, _ := cmd.Flags().GetInt("limit")
+		cursor, _ := cmd.Flags().GetInt("cursor")
+		descending, _ := cmd.Flags().GetBool("desc")
+		asJson, _ := cmd.Flags().GetBool("json")
+
+		path := resolveLogPaths(args)[0]
+		lg, err := logger.NewLoggerFromPath(path)
+		if err != nil {
+			log.Fatalf("%s: %s\n", path, err)
+		}
+		defer lg.Close()
+
+		query := lg.Query().
+			Participant(participantId).
+			FilePathPrefix(filePrefix).
+			ErrorType(errorType).
+			After(parseDateFlag(cmd, "after")).
+			Before(parseDateFlag(cmd, "before")).
+			Limit(limit).
+			Cursor(cursor)
+
+		if cmd.Flags().Changed("exit-code") {
+			query = query.ExitCode(exitCode)
+		}
+
+		if descending {
+			query = query.Descending()
+		}
+
+		iter, err := query.Entries()
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		entries := []export.Entry{}
+		for iter.Next() {
+			entry, err := iter.Value()
+			if err != nil {
+				log.Fatalln(err)
+			}
+			entries = append(entries, export.NewEntry(entry))
+		}
+
+		nextCursor := 0
+		if limit > 0 && len(entries) == limit {
+			nextCursor = entries[len(entries)-1].Id
+		}
+
+		if asJson {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(map[string]any{
+				"entries":     entries,
+				"next_cursor": nextCursor,
+			})
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tPARTICIPANT\tCREATED AT\tEXIT CODE\tERROR TYPE\tLINE\tFILE\tVERSION")
+		for _, entry := range entries {
+			fmt.Fprintf(
+				w,
+				"%d\t%s\t%s\t%d\t%s\t%d\t%s\t%d\n",
+				entry.Id,
+				entry.ParticipantId,
+				entry.CreatedAt,
+				entry.ErrorCode,
+				entry.ErrorType,
+				entry.ErrorLine,
+				entry.FilePath,
+				entry.FileVersion,
+			)
+		}
+		if err := w.Flush(); err != nil {
+			log.Fatalln(err)
+		}
+
+		if nextCursor != 0 {
+			fmt.Printf("\nmore entries available, continue with --cursor %d\n", nextCursor)
+		}
+		return nil
+	},
+}
+
+var logsRekeyCmd = &cobra.Command{
+	Use:   "rekey [db]",
+	Short: "Encrypts the log database with a new passphrase or key file",
+	Long: `Encrypts the log database with a new passphrase or key file.
+
+Encrypted databases are unlocked with the passphrase from the ` + logger.PassphraseEnv + `
+environment variable or with the key file next to the database (eg. logs.key for logs.db).`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		newPassphrase, _ := cmd.Flags().GetString("new-passphrase")
+		newKeyFile, _ := cmd.Flags().GetBool("new-key-file")
+		if (len(newPassphrase) == 0) == !newKeyFile {
+			log.Fatalln("either --new-passphrase or --new-key-file must be specified")
+		}
+
+		path := resolveLogPaths(args)[0]
+		lg, err := logger.NewLoggerFromPath(path)
+		if err != nil {
+			log.Fatalf("%s: %s\n", path, err)
+		}
+		defer lg.Close()
+
+		unlockLogger(cmd, lg, path)
+
+		if len(newPassphrase) != 0 {
+			if err := lg.Rekey(&logger.EncryptionKey{Passphrase: newPassphrase}); err != nil {
+				log.Fatalf("%s: %s\n", path, err)
+			}
+
+			fmt.Printf("%s: encrypted with the new passphrase\n", path)
+			return nil
+		}
+
+		// the key file is only replaced once the database has been rekeyed
+		keyPath := logger.KeyFilePath(path)
+		newKeyPath := keyPath + ".new"
+		if err := logger.GenerateKeyFile(newKeyPath); err != nil {
+			log.Fatalln(err)
+		}
+
+		if err := lg.Rekey(&logger.EncryptionKey{KeyFile: newKeyPath}); err != nil {
+			os.Remove(newKeyPath)
+			log.Fatalf("%s: %s\n", path, err)
+		}
+
+		if err := os.Rename(newKeyPath, keyPath); err != nil {
+			log.Fatalf("%s: unable to replace the key file, the new key is in %s: %s\n", path, newKeyPath, err)
+		}
+
+		fmt.Printf("%s: encrypted with the key file %s\n", path, keyPath)
+		return nil
+	},
+}
+
+var logsDecryptCmd = &cobra.Command{
+	Use:   "decrypt [db]",
+	Short: "Writes a decrypted copy of an encrypted log database",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		outPath, _ := cmd.Flags().GetString("out")
+		if len(outPath) == 0 {
+			log.Fatalln("--out is required")
+		}
+
+		path := resolveLogPaths(args)[0]
+		lg, err := logger.NewLoggerFromPath(path)
+		if err != nil {
+			log.Fatalf("%s: %s\n", path, err)
+		}
+		defer lg.Close()
+
+		if !lg.Encrypted() {
+			log.Fatalf("%s: database is not encrypted\n", path)
+		}
+
+		unlockLogger(cmd, lg, path)
+
+		if err := lg.DecryptTo(outPath); err != nil {
+			log.Fatalf("%s: %s\n", path, err)
+		}
+
+		fmt.Printf("%s: decrypted into %s\n", path, outPath)
+		return nil
+	},
+}
+
+// unlockLogger unlocks the encrypted database with the passphrase or key
+// file from the flags if it could not be unlocked when it was opened
+func unlockLogger(cmd *cobra.Command, lg *logger.Logger, path string) {
+	if !lg.Locked() {
+		return
+	}
+
+	passphrase, _ := cmd.Flags().GetString("passphrase")
+	keyFile, _ := cmd.Flags().GetString("key-file")
+	if len(passphrase) == 0 && len(keyFile) == 0 {
+		log.Fatalf("%s: %s (use --passphrase, --key-file or set %s)\n", path, logger.ErrLocked, logger.PassphraseEnv)
+	}
+
+	if err := lg.Unlock(logger.EncryptionKey{Passphrase: passphrase, KeyFile: keyFile}); err != nil {
+		log.Fatalf("%s: %s\n", path, err)
+	}
+}
+
+// parseDateFlag parses a date flag in the MM/DD/YYYY format
+func parseDateFlag(cmd *cobra.Command, name string) time.Time {
+	rawDate, _ := cmd.Flags().GetString(name)
+	if len(rawDate) == 0 {
+		return time.Time{}
+	}
+
+	date, err := time.Parse("01/02/2006", rawDate)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	return date
+}
+
+var logsBackupCmd = &cobra.Command{
+	Use:   "backup [db]",
+	Short: "Backs up the log database and removes the oldest backups",
+	Long: `Backs up the log database into the backups directory next to it and removes
+the oldest backups. The daemon backs up its logs periodically with the same
+settings, which are changed with --interval and --keep.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path := resolveLogPaths(args)[0]
+		lg, err := logger.NewLoggerFromPath(path)
+		if err != nil {
+			log.Fatalf("%s: %s\n", path, err)
+		}
+		defer lg.Close()
+
+		config := lg.BackupConfig()
+		if cmd.Flags().Changed("interval") || cmd.Flags().Changed("keep") {
+			if cmd.Flags().Changed("interval") {
+				config.Interval, _ = cmd.Flags().GetDuration("interval")
+			}
+			if cmd.Flags().Changed("keep") {
+				config.Keep, _ = cmd.Flags().GetInt("keep")
+			}
+
+			if err := lg.SetBackupConfig(config); err != nil {
+				log.Fatalf("%s: %s\n", path, err)
+			}
+
+			fmt.Printf("%s: backing up every %s, keeping %d backup/s\n", path, config.Interval, config.Keep)
+			if configOnly, _ := cmd.Flags().GetBool("config-only"); configOnly {
+				return nil
+			}
+		}
+
+		dir := lg.BackupDir()
+		if len(dir) == 0 {
+			log.Fatalf("%s: %s\n", path, logger.ErrUnsupportedStorage)
+		}
+
+		backupPath, err := lg.Backup(dir, time.Now())
+		if err != nil {
+			log.Fatalf("%s: %s\n", path, err)
+		}
+
+		removed, err := logger.RotateBackups(dir, config.Keep)
+		if err != nil {
+			log.Fatalf("%s: %s\n", path, err)
+		}
+
+		fmt.Printf("%s: backed up to %s, removed %d old backup/s\n", path, backupPath, len(removed))
+		return nil
+	},
+}
+
+var logsRestoreCmd = &cobra.Command{
+	Use:   "restore [db]",
+	Short: "Restores the logs archived by a reset",
+	Long: `Restores the logs archived by a reset. The latest archive is restored unless
+another one is selected with --archive. Use --list to see the archives.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path := resolveLogPaths(args)[0]
+		lg, err := logger.NewLoggerFromPath(path)
+		if err != nil {
+			log.Fatalf("%s: %s\n", path, err)
+		}
+		defer lg.Close()
+
+		archives, err := lg.Archives()
+		if err != nil {
+			log.Fatalf("%s: %s\n", path, err)
+		}
+
+		if isList, _ := cmd.Flags().GetBool("list"); isList {
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "ARCHIVE\tPARTICIPANT\tARCHIVED AT\tENTRIES\tFILES")
+			for _, archive := range archives {
+				fmt.Fprintf(
+					w,
+					"%s\t%s\t%s\t%d\t%d\n",
+					filepath.Base(archive.Path),
+					archive.ParticipantId,
+					archive.ArchivedAt.Local().Format(time.DateTime),
+					archive.Entries,
+					archive.Files,
+				)
+			}
+			return w.Flush()
+		}
+
+		if len(archives) == 0 {
+			log.Fatalf("%s: no archives were found\n", path)
+		}
+
+		archive := archives[len(archives)-1]
+		if name, _ := cmd.Flags().GetString("archive"); len(name) != 0 {
+			idx := slices.IndexFunc(archives, func(a logger.Archive) bool {
+				return filepath.Base(a.Path) == filepath.Base(name)
+			})
+			if idx == -1 {
+				log.Fatalf("%s: archive %s was not found\n", path, name)
+			}
+			archive = archives[idx]
+		}
+
+		unlockLogger(cmd, lg, path)
+
+		stats, err := lg.Restore(archive.Path)
+		if err != nil {
+			log.Fatalf("%s: %s\n", path, err)
+		}
+
+		fmt.Printf(
+			"%s: restored %d entries, %d file version/s and %d event/s of %s\n",
+			path,
+			stats.Entries,
+			stats.Files,
+			stats.Events,
+			archive.ParticipantId,
+		)
+		return nil
+	},
+}
+
+var logsVerifyCmd = &cobra.Command{
+	Use:   "verify [db...]",
+	Short: "Checks the log databases for corruption and missing references",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		failed := false
+
+		for _, path := range resolveLogPaths(args) {
+			lg, err := logger.NewLoggerFromPath(path)
+			if err != nil {
+				log.Fatalf("%s: %s\n", path, err)
+			}
+
+			problems, err := lg.Verify()
+			lg.Close()
+			if err != nil {
+				log.Fatalf("%s: %s\n", path, err)
+			}
+
+			if len(problems) == 0 {
+				fmt.Printf("%s: ok\n", path)
+				continue
+			}
+
+			failed = true
+			fmt.Printf("%s: %d problem/s found\n", path, len(problems))
+			for _, problem := range problems {
+				fmt.Printf("  [%s] %s\n", problem.Check, problem.Message)
+			}
+		}
+
+		if failed {
+			os.Exit(1)
+		}
+		return nil
+	},
+}
+
+func fileSize(path string) int64 {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return fi.Size()
+}
+
+func init() {
+	rootCmd.AddCommand(logsCmd)
+	logsCmd.AddCommand(logsMigrateCmd)
+	logsCmd.AddCommand(logsCompactCmd)
+	logsCompactCmd.Flags().Bool("delta", false, "store file versions as deltas against their previous version")
+	logsCmd.AddCommand(logsExportCmd)
+	logsExportCmd.Flags().StringP("output", "o", "export", "the directory to save the exported files")
+	logsExportCmd.Flags().StringP("format", "f", string(export.JSONL), "the format of the exported files (jsonl, csv, progsnap2)")
+	logsExportCmd.Flags().String("participant", "", "export only the logs of the participant")
+	logsExportCmd.Flags().String("after", "", "export only the logs created on or after the date (MM/DD/YYYY)")
+	logsExportCmd.Flags().String("before", "", "export only the logs created before the date (MM/DD/YYYY)")
+	logsExportCmd.Flags().String("files", "", "export only the logs of files matching the glob pattern")
+	logsExportCmd.Flags().Bool("with-source", false, "include the file snapshot of each log entry")
+	logsExportCmd.Flags().Bool("no-files", false, "do not export the file versions")
+	logsCmd.AddCommand(logsMergeCmd)
+	logsMergeCmd.Flags().StringP("output", "o", "", "the database to merge the logs into")
+	logsMergeCmd.Flags().Bool("no-normalize", false, "keep the file paths as is instead of making them relative to the project root")
+	logsCmd.AddCommand(logsImportCmd)
+	logsImportCmd.Flags().StringP("output", "o", "", "the database to import the datasets into")
+	logsImportCmd.Flags().String("default-file", progsnap2.DefaultFilePath, "the file path of code states without a section")
+	logsCmd.AddCommand(logsAnonymizeCmd)
+	logsAnonymizeCmd.Flags().Bool("hash-paths", false, "replace file paths with consistent hashes")
+	logsAnonymizeCmd.Flags().String("salt", "", "the salt to be mixed into the file path hashes")
+	logsAnonymizeCmd.Flags().StringSlice("username", []string{}, "additional usernames to be replaced")
+	logsAnonymizeCmd.Flags().StringSlice("redact", []string{}, "regular expressions to be redacted from error messages, outputs and file contents")
+	logsAnonymizeCmd.Flags().Bool("on-write", false, "anonymize new logs before they are written instead of rewriting existing logs")
+	logsAnonymizeCmd.Flags().Bool("disable-on-write", false, "stop anonymizing new logs before they are written")
+	logsCmd.AddCommand(logsQueryCmd)
+	logsQueryCmd.Flags().String("participant", "", "list only the entries of the participant")
+	logsQueryCmd.Flags().String("file-prefix", "", "list only the entries of files under the path prefix")
+	logsQueryCmd.Flags().String("error-type", "", "list only the entries with the error type")
+	logsQueryCmd.Flags().Int("exit-code", 0, "list only the entries with the exit code")
+	logsQueryCmd.Flags().String("after", "", "list only the entries created on or after the date (MM/DD/YYYY)")
+	logsQueryCmd.Flags().String("before", "", "list only the entries created before the date (MM/DD/YYYY)")
+	logsQueryCmd.Flags().Int("limit", 50, "the maximum number of entries to list (0 lists all entries)")
+	logsQueryCmd.Flags().Int("cursor", 0, "list the entries after the entry with the id")
+	logsQueryCmd.Flags().Bool("desc", false, "list the latest entries first")
+	logsQueryCmd.Flags().Bool("json", false, "print the entries as JSON")
+	logsCmd.AddCommand(logsRekeyCmd)
+	logsRekeyCmd.Flags().String("passphrase", "", "the current passphrase of the database")
+	logsRekeyCmd.Flags().String("key-file", "", "the current key file of the database")
+	logsRekeyCmd.Flags().String("new-passphrase", "", "encrypt the database with the passphrase")
+	logsRekeyCmd.Flags().Bool("new-key-file", false, "encrypt the database with a new key file stored next to it")
+	logsCmd.AddCommand(logsBackupCmd)
+	logsBackupCmd.Flags().Duration("interval", logger.DefaultBackupInterval, "the duration between the backups taken by the daemon (0 disables them)")
+	logsBackupCmd.Flags().Int("keep", logger.DefaultBackupKeep, "the number of latest backups to keep (0 keeps all backups)")
+	logsBackupCmd.Flags().Bool("config-only", false, "only change the backup settings without taking a backup")
+	logsCmd.AddCommand(logsVerifyCmd)
+	logsCmd.AddCommand(logsRestoreCmd)
+	logsRestoreCmd.Flags().String("archive", "", "the name of the archive to restore")
+	logsRestoreCmd.Flags().Bool("list", false, "list the archives instead of restoring one")
+	logsRestoreCmd.Flags().String("passphrase", "", "the passphrase of the database")
+	logsRestoreCmd.Flags().String("key-file", "", "the key file of the database")
+	logsCmd.AddCommand(logsDecryptCmd)
+	logsDecryptCmd.Flags().StringP("out", "o", "", "the path of the decrypted copy")
+	logsDecryptCmd.Flags().String("passphrase", "", "the passphrase of the database")
+	logsDecryptCmd.Flags().String("key-file", "", "the key file of the database")
+}
@@ -9,7 +9,6 @@ import (
 	"path/filepath"
 	"regexp"
 	"slices"
-	"sort"
 	"strings"
 	"time"
 
@@ -19,17 +18,18 @@ import (
 	"github.com/nedpals/bugbuddy/server/helpers"
 	"github.com/nedpals/bugbuddy/server/logger"
 	log_analyzer "github.com/nedpals/bugbuddy/server/logger/analyzer"
+	_ "github.com/nedpals/bugbuddy/server/logger/analyzer/error_frequency"
 	errorquotient "github.com/nedpals/bugbuddy/server/logger/analyzer/error_quotient"
-	la_nearest "github.com/nedpals/bugbuddy/server/logger/analyzer/nearest"
-	red "github.com/nedpals/bugbuddy/server/logger/analyzer/repeated_error_density"
+	"github.com/nedpals/bugbuddy/server/logger/analyzer/npsm"
+	_ "github.com/nedpals/bugbuddy/server/logger/analyzer/repeated_error_density"
+	"github.com/nedpals/bugbuddy/server/logger/analyzer/report"
 	timetosolve "github.com/nedpals/bugbuddy/server/logger/analyzer/time_to_solve"
+	_ "github.com/nedpals/bugbuddy/server/logger/analyzer/watwin"
 	"github.com/nedpals/bugbuddy/server/lsp_server"
 	"github.com/nedpals/bugbuddy/server/release"
 	"github.com/nedpals/bugbuddy/server/runner"
 	"github.com/nedpals/errgoengine"
 	"github.com/spf13/cobra"
-	"github.com/tealeg/xlsx/v3"
-	"golang.org/x/exp/maps"
 )
 
 var rootCmd = &cobra.Command{
@@ -151,9 +151,29 @@ var participantIdCmd = &cobra.Command{
 				return err
 			}
 
+			if isList, _ := cmd.Flags().GetBool("list"); isList {
+				participants, err := client.ListParticipants()
+				if err != nil {
+					return err
+				}
+
+				for _, participant := range participants {
+					marker := " "
+					if participant.Active {
+						marker = "*"
+					}
+					fmt.Println(marker, participant.Id)
+				}
+				return nil
+			}
+
 			var participantId string
 
-			if isGenerate {
+			if switchTo, _ := cmd.Flags().GetString("switch"); len(switchTo) != 0 {
+				if participantId, err = client.SwitchParticipant(switchTo, false); err != nil {
+					return err
+				}
+			} else if isGenerate {
 				if participantId, err = client.GenerateParticipantId(); err != nil {
 					return err
 				}
@@ -172,12 +192,46 @@ var participantIdCmd = &cobra.Command{
 	},
 }
 
+// confirm asks the user to answer yes to the question
+func confirm(question string) bool {
+	fmt.Printf("%s [y/N] ", question)
+
+	scanner := bufio.NewScanner(os.Stdin)
+	if !scanner.Scan() {
+		return false
+	}
+
+	answer := strings.ToLower(strings.TrimSpace(scanner.Text()))
+	return answer == "y" || answer == "yes"
+}
+
 var resetCmd = &cobra.Command{
 	Use:   "reset",
-	Short: "Resets the daemon's database",
+	Short: "Archives the participant's logs and generates a new participant ID",
+	Long: `Archives the participant's logs and generates a new participant ID. The
+archived logs can be brought back with "bugbuddy logs restore". Use --purge
+to remove the logs permanently instead.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		purge, _ := cmd.Flags().GetBool("purge")
+		if skipConfirm, _ := cmd.Flags().GetBool("yes"); !skipConfirm {
+			question := "Archive the logs of the participant and generate a new participant ID?"
+			if purge {
+				question = "Permanently delete the logs of the participant and generate a new participant ID?"
+			}
+
+			if !confirm(question) {
+				fmt.Println("cancelled")
+				return nil
+			}
+		}
+
 		err := daemon.Execute(types.MonitorClientType, func(client *daemon.Client) error {
-			if err := client.ResetLogger(); err != nil {
+			reset := client.ResetLogger
+			if purge {
+				reset = client.PurgeLogger
+			}
+
+			if err := reset(); err != nil {
 				return err
 			}
 			_, err := client.GenerateParticipantId()
@@ -210,90 +264,18 @@ var runCommandCmd = &cobra.Command{
 	},
 }
 
-type analyzerResult map[string]*analyzerResultEntry
-
-func (a analyzerResult) Write(name string, pid string, filePath string, value any) {
-	if _, ok := a[pid]; !ok {
-		a[pid] = &analyzerResultEntry{
-			ParticipantId:    pid,
-			FilenameAliases:  map[string]string{},
-			FilenamesIndices: map[string]int{},
-			Filenames:        []string{},
-
-			ErrorQuotient:        map[int]float64{},
-			RepeatedErrorDensity: map[int]float64{},
-			TimeToSolve:          map[int]time.Duration{},
-		}
-	}
-
-	a[pid].Write(name, filePath, value)
-}
-
-type analyzerResultEntry struct {
-	ParticipantId    string
-	FilenameAliases  map[string]string
-	FilenamesIndices map[string]int
-	Filenames        []string
-
-	// map[index of file]type
-	ErrorQuotient        map[int]float64
-	RepeatedErrorDensity map[int]float64
-	TimeToSolve          map[int]time.Duration
-}
-
-func (a *analyzerResultEntry) Write(name string, filePath string, value any) {
-	filePath = strings.TrimSpace(filePath)
-
-	// check if the filePath is already in the list
-	if _, ok := a.FilenamesIndices[filePath]; !ok {
-		if alias, ok := a.FilenameAliases[filePath]; ok {
-			// do not mutate the original file path
-			filePath = alias
-		} else if nearest := la_nearest.FilenameNearest(filePath, a.FilenamesIndices, a.Filenames); nearest != filePath && strings.HasPrefix(filePath, nearest) {
-			// if it is, replace the found path with the file path
-			a.Filenames[a.FilenamesIndices[nearest]] = filePath
-			a.FilenameAliases[nearest] = filePath
-			a.FilenamesIndices[filePath] = a.FilenamesIndices[nearest]
-			delete(a.FilenamesIndices, nearest)
-		} else if _, ok := a.FilenamesIndices[filePath]; !ok {
-			// if it is not, add the file path
-			a.FilenamesIndices[filePath] = len(a.Filenames)
-			a.Filenames = append(a.Filenames, filePath)
-		}
-	}
-
-	// fmt.Printf("error_quotient: Merging %s into %s\n", filePath, found[0].Target)
-	index := a.FilenamesIndices[filePath]
-
-	switch name {
-	case errorquotient.KEY:
-		a.ErrorQuotient[index] = value.(float64)
-	case red.KEY:
-		a.RepeatedErrorDensity[index] = value.(float64)
-	case timetosolve.KEY:
-		a.TimeToSolve[index] = value.(time.Duration)
+// registeredNames lists the names of the registered analyzers
+func registeredNames() []string {
+	names := []string{}
+	for _, r := range log_analyzer.Registered() {
+		names = append(names, r.Name)
 	}
-}
-
-var supportedAnalyzers = map[string]log_analyzer.LoggerAnalyzer{
-	"eq":  log_analyzer.New[*errorquotient.Analyzer](),
-	"red": log_analyzer.New[*red.Analyzer](),
-	"tts": log_analyzer.New[*timetosolve.Analyzer](),
-}
-
-var analyzerCellNames = map[string]string{
-	"eq":  "Error Quotient",
-	"red": "Repeated Error Density",
-	"tts": "Time To Solve",
-}
-
-func adjustToTextWidth(s string) float64 {
-	return float64(len(s))
+	return names
 }
 
 var analyzeLogCmd = &cobra.Command{
 	Use:   "analyze-log",
-	Short: "Analyzes a set of log files. The results will be saved to an excel file.",
+	Short: "Analyzes a set of log files. The results will be saved to an excel file or to the format of --format.",
 	Args:  cobra.MinimumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		rawExcludeFlag, _ := cmd.Flags().GetString("exclude")
@@ -318,15 +300,56 @@ var analyzeLogCmd = &cobra.Command{
 		}
 
 		selectedAnalyzers, _ := cmd.Flags().GetStringSlice("metrics")
+		plugins, _ := cmd.Flags().GetStringSlice("plugin")
+		for _, plugin := range plugins {
+			registration, err := log_analyzer.LoadPlugin(plugin)
+			if err != nil {
+				log.Fatalln(err)
+			} else if _, ok := log_analyzer.Lookup(registration.Name); ok {
+				log.Fatalf("plugin %s: the analyzer %s already exists\n", plugin, registration.Name)
+			}
+
+			log_analyzer.Register(registration)
+			if !slices.Contains(selectedAnalyzers, registration.Name) {
+				selectedAnalyzers = append(selectedAnalyzers, registration.Name)
+			}
+		}
+
+		// the analyzers with the options of the flags
+		configuredAnalyzers := map[string]log_analyzer.LoggerAnalyzer{}
 
+		withTransitions, _ := cmd.Flags().GetBool("npsm-transitions")
+		if withTransitions {
+			configuredAnalyzers["npsm"] = &npsm.Analyzer{Transitions: true}
+		}
+
+		if eqCompat, _ := cmd.Flags().GetBool("eq-compat"); eqCompat {
+			configuredAnalyzers["eq"] = &errorquotient.Analyzer{Compatibility: true}
+		}
+
+		if idleThreshold, _ := cmd.Flags().GetDuration("idle-threshold"); idleThreshold > 0 {
+			configuredAnalyzers["tts"] = &timetosolve.Analyzer{IdleThreshold: idleThreshold}
+		}
+
+		registrations := []log_analyzer.Registration{}
 		for _, analyzerName := range selectedAnalyzers {
-			if _, ok := supportedAnalyzers[analyzerName]; !ok {
-				log.Fatalf("invalid analyzer: %s. only %s were allowed\n", analyzerName, strings.Join(maps.Keys(supportedAnalyzers), ", "))
+			registration, ok := log_analyzer.Lookup(analyzerName)
+			if !ok {
+				log.Fatalf("invalid analyzer: %s. only %s were allowed\n", analyzerName, strings.Join(registeredNames(), ", "))
 			}
+			registrations = append(registrations, registration)
 		}
 
 		loggerLoaders := []log_analyzer.LoggerLoader{}
 		outputPath, _ := cmd.Flags().GetString("output")
+		rawFormat, _ := cmd.Flags().GetString("format")
+
+		format := report.Format(rawFormat)
+		if !slices.Contains(report.SupportedFormats, format) {
+			log.Fatalf("invalid format: %s\n", rawFormat)
+		} else if len(outputPath) == 0 {
+			outputPath = "results." + format.Extension()
+		}
 
 		for _, path := range args {
 			matches, err := filepath.Glob(path)
@@ -348,7 +371,9 @@ var analyzeLogCmd = &cobra.Command{
 				}
 
 				if fi.IsDir() {
-					log.Fatalln("directories are not supported")
+					if !logger.IsJSONLStorage(match) {
+						log.Fatalln("only directories of JSONL logs are supported")
+					}
 				} else if filepath.Ext(match) != ".db" {
 					log.Fatalln("only .db files are supported")
 				}
@@ -370,100 +395,79 @@ var analyzeLogCmd = &cobra.Command{
 			log.Fatalln("no log files were loaded")
 		}
 
-		results := analyzerResult{}
+		results := report.Results{}
 
-		for _, lgLoader := range loggerLoaders {
-			lg, err := lgLoader()
-			if err != nil {
-				log.Fatalln(err)
-			}
-
-			if !afterDate.IsZero() {
-				lg.After = afterDate
-			}
+		// the logs are opened by the workers of the runner once they are
+		// read and closed afterwards, so that only a few logs are open at
+		// the same time
+		loaders := make([]log_analyzer.LoggerLoader, len(loggerLoaders))
+		for i, lgLoader := range loggerLoaders {
+			lgLoader := lgLoader
+			loaders[i] = func() (*logger.Logger, error) {
+				lg, err := lgLoader()
+				if err != nil {
+					return nil, err
+				}
 
-			loader := func() (*logger.Logger, error) {
+				if !afterDate.IsZero() {
+					lg.After = afterDate
+				}
 				return lg, nil
 			}
+		}
 
-			for _, analyzerName := range selectedAnalyzers {
-				analyzer := supportedAnalyzers[analyzerName]
-				if err := analyzer.Analyze(results, loader); err != nil {
-					log.Fatalf("error(%T): %s", analyzer, err)
-				}
+		// each log is read once for all of the selected analyzers
+		workers, _ := cmd.Flags().GetInt("workers")
+		runner := &log_analyzer.Runner{Workers: workers, CloseLogs: true}
+		for _, registration := range registrations {
+			if analyzer, ok := configuredAnalyzers[registration.Name]; ok {
+				runner.Analyzers = append(runner.Analyzers, analyzer)
+			} else {
+				runner.Analyzers = append(runner.Analyzers, registration.New())
 			}
+		}
 
-			if err := lg.Close(); err != nil {
-				log.Fatalln(err)
-			}
+		if err := runner.Run(results, loaders...); err != nil {
+			log.Fatalln(err)
 		}
 
-		// save the results to an excel file
-		wb := xlsx.NewFile()
+		rep := report.New(registrations, results)
 
-		for participantId, result := range results {
-			sheet, err := wb.AddSheet(participantId)
+		if groupsPath, _ := cmd.Flags().GetString("groups"); len(groupsPath) != 0 {
+			groupsFile, err := os.Open(groupsPath)
 			if err != nil {
 				log.Fatalln(err)
 			}
 
-			// write the header
-			row := sheet.AddRow()
-			row.AddCell().SetValue("File Path")
-
-			// analyzer locations
-			analyzerCellLocations := map[string]int{}
-
-			for aCellRow, analyzerName := range selectedAnalyzers {
-				name := analyzerCellNames[analyzerName]
-				aCell := row.AddCell()
-				aCell.SetValue(name)
-				analyzerCellLocations[analyzerName] = aCellRow + 1
-
-				if analyzerName == "tts" {
-					row.AddCell().SetValue("Time To Solve (HH:MM:SS)")
-					sheet.SetColAutoWidth(aCellRow+3, adjustToTextWidth)
-				}
-
-				sheet.SetColAutoWidth(aCellRow+2, adjustToTextWidth)
+			groups, err := report.ReadGroups(groupsFile)
+			groupsFile.Close()
+			if err != nil {
+				log.Fatalln(err)
 			}
 
-			// sort filenames
-			sortedFilenames := slices.Clone(result.Filenames)
-			sort.Slice(sortedFilenames, func(i, j int) bool {
-				return sortedFilenames[i] < sortedFilenames[j]
-			})
-
-			for idx, filePath := range sortedFilenames {
-				if len(strings.TrimSpace(filePath)) == 0 {
-					continue
-				}
-
-				fileIdx := result.FilenamesIndices[filePath]
-				row, _ := sheet.Row(idx + 1)
-				row.AddCell().SetValue(filePath)
-
-				for _, analyzerName := range selectedAnalyzers {
-					cell, _ := sheet.Cell(idx+1, analyzerCellLocations[analyzerName])
+			cohort := rep.CompareGroups(groups)
+			if len(cohort.Ungrouped) != 0 {
+				log.Printf("participants without a group were left out of the comparison: %s\n", strings.Join(cohort.Ungrouped, ", "))
+			}
+		}
 
-					switch analyzerName {
-					case "eq":
-						cell.SetValue(result.ErrorQuotient[fileIdx])
-					case "red":
-						cell.SetValue(result.RepeatedErrorDensity[fileIdx])
-					case "tts":
-						cell.SetValue(result.TimeToSolve[fileIdx].Seconds())
+		if slices.Contains(selectedAnalyzers, "tts") {
+			rep.Tables = append(rep.Tables, timeToSolveTable(results))
+		}
 
-						hhMmSsCell, _ := sheet.Cell(idx+1, analyzerCellLocations[analyzerName]+1)
-						hhMmSsCell.SetValue(formatDuration(result.TimeToSolve[fileIdx]))
-					}
-				}
-			}
+		if withTransitions && slices.Contains(selectedAnalyzers, "npsm") {
+			rep.Tables = append(rep.Tables, transitionsTable(results))
+		}
 
-			sheet.SetColAutoWidth(1, xlsx.DefaultAutoWidth)
+		outputFile, err := os.Create(outputPath)
+		if err != nil {
+			log.Fatalln(err)
 		}
+		defer outputFile.Close()
 
-		if err := wb.Save(outputPath); err != nil {
+		if err := report.Write(format, outputFile, rep); err != nil {
+			log.Fatalln(err)
+		} else if err := outputFile.Close(); err != nil {
 			log.Fatalln(err)
 		}
 
@@ -471,13 +475,63 @@ var analyzeLogCmd = &cobra.Command{
 	},
 }
 
-func formatDuration(d time.Duration) string {
-	h := d / time.Hour
-	d -= h * time.Hour
-	m := d / time.Minute
-	d -= m * time.Minute
-	s := d / time.Second
-	return fmt.Sprintf("%d:%02d:%02d", h, m, s)
+// timeToSolveTable summarizes the error episodes of each participant
+// and of all of the participants
+func timeToSolveTable(results report.Results) report.Table {
+	table := report.Table{
+		Name:    "Time To Solve Summary",
+		Headers: []string{"Participant ID", "Episodes", "Median Time To Solve", "P90 Time To Solve", "Median (HH:MM:SS)", "P90 (HH:MM:SS)"},
+	}
+
+	addRow := func(name string, episodes []timetosolve.Episode) {
+		summary := timetosolve.Summarize(episodes)
+		table.AddRow(
+			name,
+			summary.Count,
+			summary.Median.Seconds(),
+			summary.P90.Seconds(),
+			report.FormatDuration(summary.Median),
+			report.FormatDuration(summary.P90),
+		)
+	}
+
+	allEpisodes := []timetosolve.Episode{}
+	for _, participantId := range results.ParticipantIds() {
+		episodes := []timetosolve.Episode{}
+		for _, fileEpisodes := range results[participantId].Values[timetosolve.EPISODES_KEY] {
+			episodes = append(episodes, fileEpisodes.([]timetosolve.Episode)...)
+		}
+
+		addRow(participantId, episodes)
+		allEpisodes = append(allEpisodes, episodes...)
+	}
+
+	addRow("All Participants", allEpisodes)
+	return table
+}
+
+// transitionsTable lists the NPSM state transitions of each file of each
+// participant
+func transitionsTable(results report.Results) report.Table {
+	table := report.Table{
+		Name:    "NPSM Transitions",
+		Headers: []string{"Participant ID", "File Path", "From", "To", "Count"},
+	}
+
+	for _, participantId := range results.ParticipantIds() {
+		result := results[participantId]
+		for fileIdx, filePath := range result.Filenames {
+			transitions, _ := result.Values[npsm.TRANSITIONS_KEY][fileIdx].(npsm.Transitions)
+			for _, from := range npsm.States {
+				for _, to := range npsm.States {
+					if count := transitions[from][to]; count > 0 {
+						table.AddRow(participantId, filePath, string(from), string(to), count)
+					}
+				}
+			}
+		}
+	}
+	return table
 }
 
 func init() {
@@ -488,12 +542,23 @@ func init() {
 	rootCmd.AddCommand(runCommandCmd)
 	rootCmd.AddCommand(analyzeLogCmd)
 	participantIdCmd.PersistentFlags().Bool("generate", false, "generate a new participant ID")
+	participantIdCmd.PersistentFlags().String("switch", "", "switch the active participant to the participant ID")
+	participantIdCmd.PersistentFlags().Bool("list", false, "list the participants recorded in the logs")
 	rootCmd.AddCommand(resetCmd)
+	resetCmd.Flags().Bool("purge", false, "permanently delete the logs instead of archiving them")
+	resetCmd.Flags().BoolP("yes", "y", false, "reset without asking for confirmation")
 	rootCmd.PersistentFlags().IntP("port", "p", daemon.DEFAULT_PORT, "the port to use for the daemon")
 	rootCmd.PersistentFlags().BoolP("verbose", "v", false, "enable verbose mode")
 	daemonCmd.PersistentFlags().String("data-dir", "", "the directory to use for the daemon. To override the default directory, set the BUGBUDDY_DIR environment variable.")
-	analyzeLogCmd.PersistentFlags().StringP("output", "o", "results.xlsx", "the output file to save the results")
-	analyzeLogCmd.PersistentFlags().StringSliceP("metrics", "m", []string{"eq", "red", "tts"}, "the analyzers to use")
+	analyzeLogCmd.PersistentFlags().StringP("output", "o", "", "the output file to save the results (defaults to results.<extension of the format>)")
+	analyzeLogCmd.PersistentFlags().StringP("format", "f", string(report.XLSX), "the format of the results (xlsx, csv, json, markdown, html)")
+	analyzeLogCmd.PersistentFlags().StringSliceP("metrics", "m", []string{"eq", "red", "tts"}, "the analyzers to use ("+strings.Join(registeredNames(), ", ")+")")
+	analyzeLogCmd.PersistentFlags().StringSlice("plugin", []string{}, "the commands of external analyzers to use (see logger/analyzer/plugin.go)")
+	analyzeLogCmd.PersistentFlags().Bool("npsm-transitions", false, "add a sheet with the NPSM state transitions")
+	analyzeLogCmd.PersistentFlags().Duration("idle-threshold", 0, "leave the gaps between runs longer than the threshold out of the time to solve (e.g. 30m)")
+	analyzeLogCmd.PersistentFlags().Bool("eq-compat", false, "compute the error quotient like the earlier versions of bugbuddy")
+	analyzeLogCmd.PersistentFlags().String("groups", "", "a CSV file of the group of each participant (participant_id,group) to compare the groups")
+	analyzeLogCmd.PersistentFlags().Int("workers", 0, "the number of logs analyzed at the same time (defaults to the number of CPUs)")
 	analyzeLogCmd.PersistentFlags().String("after", "", "the date to start analyzing the logs")
 	analyzeLogCmd.PersistentFlags().String("exclude", "", "exclude directories from the analysis")
 }
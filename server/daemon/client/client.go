@@ -47,6 +47,8 @@ type Client struct {
 	SpawnOnMaxReconnect bool
 	OnReconnect         func(int, error) bool
 	OnSpawnDaemon       func()
+	// Editor is the name of the editor reported to the daemon
+	Editor string
 }
 
 func (c *Client) SupportedFileExts() []string {
@@ -226,10 +228,75 @@ func (c *Client) RetrieveParticipantId() (string, error) {
 	return gotParticipantId, nil
 }
 
+// SwitchParticipant switches to the participant and returns its id. If
+// bind is true, only the participant of this client is switched.
+func (c *Client) SwitchParticipant(participantId string, bind bool) (string, error) {
+	var gotParticipantId string
+	if err := c.Call(types.SwitchParticipantMethod, types.ParticipantSwitchPayload{
+		ParticipantId: participantId,
+		Bind:          bind,
+	}, &gotParticipantId); err != nil {
+		return "", err
+	}
+	return gotParticipantId, nil
+}
+
+func (c *Client) ListParticipants() ([]types.ParticipantPayload, error) {
+	var participants []types.ParticipantPayload
+	if err := c.Call(types.ListParticipantsMethod, nil, &participants); err != nil {
+		return nil, err
+	}
+	return participants, nil
+}
+
+// ResetLogger moves the data of the participant into an archive
 func (c *Client) ResetLogger() error {
 	return c.Call(types.ResetLoggerMethod, nil, nil)
 }
 
+// PurgeLogger permanently removes the data of the participant
+func (c *Client) PurgeLogger() error {
+	return c.Call(types.ResetLoggerMethod, types.ResetPayload{Purge: true}, nil)
+}
+
+func (c *Client) RetrieveConsent() (*types.ConsentPayload, error) {
+	var consent *types.ConsentPayload
+	if err := c.Call(types.RetrieveConsentMethod, nil, &consent); err != nil {
+		return nil, err
+	}
+	return consent, nil
+}
+
+func (c *Client) SetConsent(level string, studyId string) error {
+	return c.Call(types.SetConsentMethod, types.ConsentPayload{
+		Level:   level,
+		StudyId: studyId,
+	}, nil)
+}
+
+func (c *Client) RetrieveEventsConfig() (*types.EventsPayload, error) {
+	var config *types.EventsPayload
+	if err := c.Call(types.RetrieveEventsConfigMethod, nil, &config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+func (c *Client) SetEventsConfig(enabled bool, snapshotInterval string) error {
+	return c.Call(types.SetEventsConfigMethod, types.EventsPayload{
+		Enabled:          enabled,
+		SnapshotInterval: snapshotInterval,
+	}, nil)
+}
+
+func (c *Client) QueryLogs(query types.LogQueryPayload) (*types.LogQueryResult, error) {
+	var result *types.LogQueryResult
+	if err := c.Call(types.QueryLogsMethod, query, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
 func (c *Client) Collect(errCode int, command, workingDir, errMsg string) (*types.CollectResponse, error) {
 	var response *types.CollectResponse
 	err := c.Call(types.CollectMethod, types.CollectPayload{
@@ -289,6 +356,7 @@ func (c *Client) Handshake() (*types.ServerInfo, error) {
 	err := c.Call(types.HandshakeMethod, &types.ClientInfo{
 		ProcessId:  c.processId,
 		ClientType: c.clientType,
+		Editor:     c.Editor,
 	}, &result)
 
 	if err != nil {
@@ -0,0 +1,21 @@
+package server
+
+import (
+	"time"
+)
+
+// backupLogs backs up the logs if the latest backup is older than the
+// backup interval. Backups are skipped while another one is being taken.
+func (d *Server) backupLogs(now time.Time) {
+	if !d.backingUp.CompareAndSwap(false, true) {
+		return
+	}
+	defer d.backingUp.Store(false)
+
+	path, err := d.logger.BackupIfDue(now)
+	if err != nil {
+		d.ServerLog.Printf("unable to back up logs: %s\n", err)
+	} else if len(path) != 0 {
+		d.ServerLog.Printf("backed up logs to %s\n", path)
+	}
+}
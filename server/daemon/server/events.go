@@ -0,0 +1,142 @@
+package server
+
+import (
+	"time"
+
+	"github.com/nedpals/bugbuddy/server/logger"
+)
+
+// pendingSnapshot is a snapshot waiting for the participant to stop
+// editing the file
+type pendingSnapshot struct {
+	timer         *time.Timer
+	sessionId     int
+	participantId string
+}
+
+// recordEvent logs the editor activity of the client. Paths are scrubbed
+// the same way as the collected runs.
+func (d *Server) recordEvent(participantId string, sessionId int, kind logger.EventKind, filePath string, oldContent, newContent string) {
+	if !d.logger.EventsConfig().Enabled {
+		return
+	}
+
+	anonymizer, err := d.writeAnonymizer()
+	if err != nil {
+		d.ServerLog.Printf("unable to record %s event: %s\n", kind, err)
+		return
+	}
+
+	event := logger.Event{
+		ParticipantId: participantId,
+		Kind:          kind,
+		FilePath:      anonymizer.Path(filePath),
+		Size:          len([]rune(newContent)),
+	}
+
+	if sessionId != 0 {
+		event.SessionId = &sessionId
+	}
+
+	if kind == logger.EventEdit {
+		event.CharsInserted, event.CharsDeleted = logger.EditSize(oldContent, newContent)
+	}
+
+	if err := d.logger.LogEvent(event); err != nil {
+		d.ServerLog.Printf("unable to record %s event: %s\n", kind, err)
+	}
+}
+
+// scheduleSnapshot stores the content of the file once it has not been
+// edited for the snapshot interval. Edits made before the interval has
+// passed postpone the snapshot.
+func (d *Server) scheduleSnapshot(participantId string, sessionId int, filePath string) {
+	d.snapshotsMu.Lock()
+	defer d.snapshotsMu.Unlock()
+
+	config := d.logger.EventsConfig()
+	if !config.Snapshots() {
+		return
+	}
+
+	if pending, ok := d.snapshots[filePath]; ok {
+		// the snapshot belongs to the participant who edited the file last
+		pending.sessionId, pending.participantId = sessionId, participantId
+		pending.timer.Reset(config.SnapshotInterval)
+		return
+	}
+
+	pending := &pendingSnapshot{sessionId: sessionId, participantId: participantId}
+	pending.timer = time.AfterFunc(config.SnapshotInterval, func() {
+		// the snapshot is written while holding the lock so that the
+		// logger is not replaced by SetLogger in the meantime
+		d.snapshotsMu.Lock()
+		defer d.snapshotsMu.Unlock()
+
+		if d.snapshots[filePath] != pending {
+			// the snapshot has already been flushed
+			return
+		}
+		delete(d.snapshots, filePath)
+		d.writeSnapshot(pending.participantId, pending.sessionId, filePath)
+	})
+	d.snapshots[filePath] = pending
+}
+
+// flushSnapshot immediately stores the pending snapshot of the file
+func (d *Server) flushSnapshot(filePath string) {
+	d.snapshotsMu.Lock()
+	defer d.snapshotsMu.Unlock()
+	d.flushSnapshotLocked(filePath)
+}
+
+// flushAllSnapshots immediately stores the pending snapshots of all files
+func (d *Server) flushAllSnapshots() {
+	d.snapshotsMu.Lock()
+	defer d.snapshotsMu.Unlock()
+	d.flushAllSnapshotsLocked()
+}
+
+// flushAllSnapshotsLocked is flushAllSnapshots for callers holding snapshotsMu
+func (d *Server) flushAllSnapshotsLocked() {
+	for filePath := range d.snapshots {
+		d.flushSnapshotLocked(filePath)
+	}
+}
+
+// flushSnapshotLocked is flushSnapshot for callers holding snapshotsMu
+func (d *Server) flushSnapshotLocked(filePath string) {
+	pending, ok := d.snapshots[filePath]
+	if !ok {
+		return
+	}
+
+	pending.timer.Stop()
+	delete(d.snapshots, filePath)
+	d.writeSnapshot(pending.participantId, pending.sessionId, filePath)
+}
+
+// writeSnapshot stores the content of the file. It is called while holding
+// snapshotsMu.
+func (d *Server) writeSnapshot(participantId string, sessionId int, filePath string) {
+	content, err := d.FS().ReadFile(filePath)
+	if err != nil {
+		// the file has been closed in the meantime
+		return
+	}
+
+	anonymizer, err := d.writeAnonymizer()
+	if err != nil {
+		d.ServerLog.Printf("unable to store snapshot: %s\n", err)
+		return
+	}
+
+	var sessionIdPtr *int
+	if sessionId != 0 {
+		sessionIdPtr = &sessionId
+	}
+
+	if err := d.logger.LogSnapshotForPID(participantId, sessionIdPtr, anonymizer.Path(filePath), anonymizer.Content(content)); err != nil {
+		d.ServerLog.Printf("unable to store snapshot: %s\n", err)
+	}
+}
@@ -9,7 +9,11 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"os/user"
 	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -17,6 +21,7 @@ import (
 	"github.com/nedpals/bugbuddy/server/daemon/types"
 	"github.com/nedpals/bugbuddy/server/helpers"
 	"github.com/nedpals/bugbuddy/server/logger"
+	"github.com/nedpals/bugbuddy/server/logger/export"
 	"github.com/nedpals/bugbuddy/server/release"
 	"github.com/nedpals/bugbuddy/server/rpc"
 	"github.com/nedpals/bugbuddy/server/runner"
@@ -40,15 +45,56 @@ type Server struct {
 	connectedClients connectedClients
 	logger           *logger.Logger
 	errors           []resultError
+	// sessions maps the process ids of the LSP clients to their sessions
+	sessions   map[int]*clientSession
+	sessionsMu sync.Mutex
+	// snapshots maps the edited files to their pending snapshots
+	snapshots   map[string]*pendingSnapshot
+	snapshotsMu sync.Mutex
+	// SessionIdleTimeout is the duration of inactivity before a session is closed
+	SessionIdleTimeout time.Duration
+	// backingUp is true while the logs are being backed up
+	backingUp atomic.Bool
 }
 
 func (d *Server) SetLogger(l *logger.Logger) error {
+	// End the sessions recorded in the old logger. They will be
+	// reopened in the new logger once the clients become active.
+	d.sessionsMu.Lock()
+	for _, session := range d.sessions {
+		if session.id != 0 {
+			d.logger.EndSession(session.id, time.Now(), logger.SessionEndShutdown)
+			session.id = 0
+		}
+	}
+	d.sessionsMu.Unlock()
+
+	// Store the pending snapshots in the old logger. The snapshots are
+	// locked until the new logger is set so that the timers of the
+	// snapshots do not write to the closed logger.
+	d.snapshotsMu.Lock()
+	d.flushAllSnapshotsLocked()
+
 	// Close the old logger before setting a new one
 	if err := d.logger.Close(); err != nil {
+		d.snapshotsMu.Unlock()
 		return err
 	}
 
 	d.logger = l
+	d.snapshotsMu.Unlock()
+
+	// Register the participants bound to the clients in the new logger
+	d.sessionsMu.Lock()
+	defer d.sessionsMu.Unlock()
+	for _, session := range d.sessions {
+		if len(session.participantId) == 0 {
+			continue
+		}
+		if err := d.logger.AddParticipant(session.participantId, ""); err != nil {
+			d.ServerLog.Printf("unable to register participant: %s\n", err)
+		}
+	}
 	return nil
 }
 
@@ -143,6 +189,7 @@ func (d *Server) Handle(ctx context.Context, c *jsonrpc2.Conn, r *jsonrpc2.Reque
 
 		// Send the existing errors to a newly connected client
 		if info.ClientType == types.LspClientType {
+			d.startSession(info.ProcessId, info.Editor)
 			d.notifyErrors(ctx, d.errors, info.ProcessId)
 		}
 	case types.ShutdownMethod:
@@ -155,6 +202,7 @@ func (d *Server) Handle(ctx context.Context, c *jsonrpc2.Conn, r *jsonrpc2.Reque
 		}
 
 		delete(d.connectedClients, procId)
+		d.endSession(procId, logger.SessionEndShutdown)
 		d.ServerLog.Printf("disconnected: {process_id: %d}\n", procId)
 	case types.CollectMethod:
 		var payload types.CollectPayload
@@ -222,6 +270,20 @@ func (d *Server) Handle(ctx context.Context, c *jsonrpc2.Conn, r *jsonrpc2.Reque
 			d.fileUseCounter[payloadStr.Filepath] = append(d.fileUseCounter[payloadStr.Filepath], procId)
 		}
 
+		sessionId, participantId := d.touchSession(procId)
+		if sessionId != 0 {
+			anonymizer, err := d.writeAnonymizer()
+			if err == nil {
+				err = d.logger.AddSessionFile(sessionId, anonymizer.Path(payloadStr.Filepath))
+			}
+
+			if err != nil {
+				d.ServerLog.Printf("unable to record opened file: %s\n", err)
+			}
+		}
+
+		d.recordEvent(participantId, sessionId, logger.EventOpen, payloadStr.Filepath, "", payloadStr.Content)
+
 		d.ServerLog.Printf("resolved document: %s (len: %d)\n", payloadStr.Filepath, len(payloadStr.Content))
 		c.Reply(ctx, r.ID, "ok")
 	case types.UpdateDocumentMethod:
@@ -255,6 +317,9 @@ func (d *Server) Handle(ctx context.Context, c *jsonrpc2.Conn, r *jsonrpc2.Reque
 			file.Close()
 		}
 
+		// keep the previous content for measuring the size of the edit
+		oldContent, _ := d.FS().ReadFile(payloadStr.Filepath)
+
 		// IDEA: create a dependency tree wherein errors will be removed
 		// once the file is updated
 		if err := d.FS().WriteFile(payloadStr.Filepath, []byte(payloadStr.Content)); err != nil {
@@ -264,6 +329,11 @@ func (d *Server) Handle(ctx context.Context, c *jsonrpc2.Conn, r *jsonrpc2.Reque
 			return
 		}
 
+		procId, _ := d.getProcessId(r)
+		sessionId, participantId := d.touchSession(procId)
+		d.recordEvent(participantId, sessionId, logger.EventEdit, payloadStr.Filepath, string(oldContent), payloadStr.Content)
+		d.scheduleSnapshot(participantId, sessionId, payloadStr.Filepath)
+
 		d.ServerLog.Printf("updated document: %s (len: %d)\n", payloadStr.Filepath, len(payloadStr.Content))
 		c.Reply(ctx, r.ID, "ok")
 	case types.DeleteDocumentMethod:
@@ -291,6 +361,13 @@ func (d *Server) Handle(ctx context.Context, c *jsonrpc2.Conn, r *jsonrpc2.Reque
 
 		// decide if the file will be removed
 		procId, _ := d.getProcessId(r)
+
+		// store the last edits before the file is removed
+		d.flushSnapshot(payload.Filepath)
+		if content, err := d.FS().ReadFile(payload.Filepath); err == nil {
+			sessionId, participantId := d.touchSession(procId)
+			d.recordEvent(participantId, sessionId, logger.EventClose, payload.Filepath, "", string(content))
+		}
 		if idx := d.GetFileUseIdx(payload.Filepath, procId); idx != -1 {
 			// remove the process id from the file use counter
 			d.fileUseCounter[payload.Filepath] = append(
@@ -360,8 +437,29 @@ func (d *Server) Handle(ctx context.Context, c *jsonrpc2.Conn, r *jsonrpc2.Reque
 			Content:            string(fileContents),
 		})
 	case types.RetrieveParticipantIdMethod:
-		c.Reply(ctx, r.ID, d.logger.ParticipantId())
+		procId, _ := d.getProcessId(r)
+		c.Reply(ctx, r.ID, d.participantOf(procId))
 	case types.GenerateParticipantIdMethod:
+		procId, _ := d.getProcessId(r)
+
+		// clients bound to their own participant are bound to the new one
+		if d.isBound(procId) {
+			participantId, err := d.logger.NewParticipantId()
+			if err == nil {
+				err = d.bindParticipant(procId, participantId)
+			}
+
+			if err != nil {
+				c.ReplyWithError(ctx, r.ID, &jsonrpc2.Error{
+					Message: err.Error(),
+				})
+				return
+			}
+
+			c.Reply(ctx, r.ID, participantId)
+			return
+		}
+
 		if err := d.logger.GenerateParticipantId(); err != nil {
 			c.ReplyWithError(ctx, r.ID, &jsonrpc2.Error{
 				Message: err.Error(),
@@ -369,14 +467,196 @@ func (d *Server) Handle(ctx context.Context, c *jsonrpc2.Conn, r *jsonrpc2.Reque
 			return
 		}
 		c.Reply(ctx, r.ID, d.logger.ParticipantId())
+	case types.SwitchParticipantMethod:
+		var payload types.ParticipantSwitchPayload
+		if err := json.Unmarshal(*r.Params, &payload); err != nil {
+			c.ReplyWithError(ctx, r.ID, &jsonrpc2.Error{
+				Message: "Unable to decode params of method " + r.Method,
+			})
+			return
+		}
+
+		participantId := payload.ParticipantId
+		if len(participantId) == 0 {
+			generated, err := d.logger.NewParticipantId()
+			if err != nil {
+				c.ReplyWithError(ctx, r.ID, &jsonrpc2.Error{
+					Message: err.Error(),
+				})
+				return
+			}
+			participantId = generated
+		}
+
+		var err error
+		if payload.Bind {
+			procId, _ := d.getProcessId(r)
+			err = d.bindParticipant(procId, participantId)
+		} else {
+			err = d.logger.SwitchParticipant(participantId)
+		}
+
+		if err != nil {
+			c.ReplyWithError(ctx, r.ID, &jsonrpc2.Error{
+				Message: err.Error(),
+			})
+			return
+		}
+		c.Reply(ctx, r.ID, participantId)
+	case types.ListParticipantsMethod:
+		participants, err := d.logger.Participants()
+		if err != nil {
+			c.ReplyWithError(ctx, r.ID, &jsonrpc2.Error{
+				Message: err.Error(),
+			})
+			return
+		}
+
+		activeId := d.logger.ParticipantId()
+		result := make([]types.ParticipantPayload, 0, len(participants))
+		for _, participant := range participants {
+			payload := types.ParticipantPayload{
+				Id:     participant.Id,
+				Name:   participant.Name,
+				Active: participant.Id == activeId,
+			}
+			if participant.CreatedAt != nil && participant.CreatedAt.Valid {
+				payload.CreatedAt = &participant.CreatedAt.Time
+			}
+			result = append(result, payload)
+		}
+
+		c.Reply(ctx, r.ID, result)
 	case types.ResetLoggerMethod:
-		if err := d.logger.Reset(); err != nil {
+		var payload types.ResetPayload
+		if r.Params != nil {
+			if err := json.Unmarshal(*r.Params, &payload); err != nil {
+				c.ReplyWithError(ctx, r.ID, &jsonrpc2.Error{
+					Message: "Unable to decode params of method " + r.Method,
+				})
+				return
+			}
+		}
+
+		// store the pending snapshots before the data is moved
+		d.flushAllSnapshots()
+
+		procId, _ := d.getProcessId(r)
+		participantId := d.participantOf(procId)
+
+		reset := d.logger.ResetForPID
+		if payload.Purge {
+			reset = d.logger.PurgeForPID
+		}
+
+		if err := reset(participantId); err != nil {
+			c.ReplyWithError(ctx, r.ID, &jsonrpc2.Error{
+				Message: err.Error(),
+			})
+			return
+		}
+
+		d.detachSessions(participantId)
+		c.Reply(ctx, r.ID, "ok")
+	case types.RetrieveConsentMethod:
+		consent, err := d.logger.Consent()
+		if err != nil {
+			c.ReplyWithError(ctx, r.ID, &jsonrpc2.Error{
+				Message: err.Error(),
+			})
+			return
+		}
+
+		c.Reply(ctx, r.ID, types.ConsentPayload{
+			Level:       string(consent.Level),
+			StudyId:     consent.StudyId,
+			ConsentedAt: consent.ConsentedAt,
+		})
+	case types.SetConsentMethod:
+		var payload types.ConsentPayload
+		if err := json.Unmarshal(*r.Params, &payload); err != nil {
+			c.ReplyWithError(ctx, r.ID, &jsonrpc2.Error{
+				Message: "Unable to decode params of method " + r.Method,
+			})
+			return
+		}
+
+		level, err := logger.ParseCollectionLevel(payload.Level)
+		if err != nil {
+			c.ReplyWithError(ctx, r.ID, &jsonrpc2.Error{
+				Message: err.Error(),
+			})
+			return
+		}
+
+		if err := d.logger.SetConsent(level, payload.StudyId); err != nil {
 			c.ReplyWithError(ctx, r.ID, &jsonrpc2.Error{
 				Message: err.Error(),
 			})
 			return
 		}
+
+		d.ServerLog.Printf("collection level set to %s\n", level)
 		c.Reply(ctx, r.ID, "ok")
+	case types.RetrieveEventsConfigMethod:
+		config := d.logger.EventsConfig()
+		payload := types.EventsPayload{Enabled: config.Enabled}
+		if config.SnapshotInterval > 0 {
+			payload.SnapshotInterval = config.SnapshotInterval.String()
+		}
+		c.Reply(ctx, r.ID, payload)
+	case types.SetEventsConfigMethod:
+		var payload types.EventsPayload
+		if err := json.Unmarshal(*r.Params, &payload); err != nil {
+			c.ReplyWithError(ctx, r.ID, &jsonrpc2.Error{
+				Message: "Unable to decode params of method " + r.Method,
+			})
+			return
+		}
+
+		config := logger.EventsConfig{Enabled: payload.Enabled}
+		if len(payload.SnapshotInterval) != 0 {
+			interval, err := time.ParseDuration(payload.SnapshotInterval)
+			if err != nil {
+				c.ReplyWithError(ctx, r.ID, &jsonrpc2.Error{
+					Message: "Invalid snapshot interval: " + err.Error(),
+				})
+				return
+			}
+			config.SnapshotInterval = interval
+		}
+
+		if err := d.logger.SetEventsConfig(config); err != nil {
+			c.ReplyWithError(ctx, r.ID, &jsonrpc2.Error{
+				Message: err.Error(),
+			})
+			return
+		}
+
+		if !config.Snapshots() {
+			d.flushAllSnapshots()
+		}
+
+		d.ServerLog.Printf("editor events recording set to %t\n", config.Enabled)
+		c.Reply(ctx, r.ID, "ok")
+	case types.QueryLogsMethod:
+		var payload types.LogQueryPayload
+		if err := json.Unmarshal(*r.Params, &payload); err != nil {
+			c.ReplyWithError(ctx, r.ID, &jsonrpc2.Error{
+				Message: "Unable to decode params of method " + r.Method,
+			})
+			return
+		}
+
+		result, err := d.queryLogs(payload)
+		if err != nil {
+			c.ReplyWithError(ctx, r.ID, &jsonrpc2.Error{
+				Message: err.Error(),
+			})
+			return
+		}
+
+		c.Reply(ctx, r.ID, result)
 	case types.GetDataDirMethod:
 		dataDir := helpers.GetDataDirPath()
 		c.Reply(ctx, r.ID, dataDir)
@@ -440,6 +720,60 @@ func (d *Server) Handle(ctx context.Context, c *jsonrpc2.Conn, r *jsonrpc2.Reque
 	}
 }
 
+// defaultQueryLimit limits the entries returned by a log query
+// so that the response does not contain the whole database
+const defaultQueryLimit = 100
+
+func (s *Server) queryLogs(payload types.LogQueryPayload) (*types.LogQueryResult, error) {
+	query := s.logger.Query().
+		Participant(payload.ParticipantId).
+		FilePathPrefix(payload.FilePathPrefix).
+		ErrorType(payload.ErrorType).
+		Cursor(payload.Cursor)
+
+	if payload.ExitCode != nil {
+		query = query.ExitCode(*payload.ExitCode)
+	}
+
+	if payload.After != nil {
+		query = query.After(*payload.After)
+	}
+
+	if payload.Before != nil {
+		query = query.Before(*payload.Before)
+	}
+
+	if payload.Descending {
+		query = query.Descending()
+	}
+
+	limit := payload.Limit
+	if limit <= 0 {
+		limit = defaultQueryLimit
+	}
+
+	iter, err := query.Limit(limit).Entries()
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+
+	result := &types.LogQueryResult{Entries: []export.Entry{}}
+	for iter.Next() {
+		entry, err := iter.Value()
+		if err != nil {
+			return nil, err
+		}
+		result.Entries = append(result.Entries, export.NewEntry(entry))
+	}
+
+	if len(result.Entries) == limit {
+		result.NextCursor = result.Entries[len(result.Entries)-1].Id
+	}
+
+	return result, nil
+}
+
 func (s *Server) collect(ctx context.Context, payload types.CollectPayload) (recognized int, processed int, err error) {
 	result := helpers.AnalyzeError(s.engine, payload.WorkingDir, payload.Error)
 	r, p, err := result.Stats()
@@ -484,6 +818,23 @@ func (s *Server) collect(ctx context.Context, payload types.CollectPayload) (rec
 		report.report.Location = result.Data.MainError.Nearest.Location()
 	}
 
+	anonymizer, err := s.writeAnonymizer()
+	if err != nil {
+		s.ServerLog.Printf("collect: unable to load anonymizer: %s\n", err)
+	}
+
+	// do not write anything rather than writing unscrubbed data. runs that
+	// the participant did not agree to be collected are skipped as well.
+	if err != nil || !s.logger.CollectionLevel().StoresEntry(payload.ErrorCode) {
+		s.errors = append(s.errors, report)
+		s.notifyErrors(ctx, []resultError{report})
+		return r, p, nil
+	}
+
+	// the run belongs to the participant of the most recently active client
+	sessionId, participantId := s.activeSession()
+	logPayload.ParticipantId = participantId
+
 	if payload.ErrorCode == 0 || (logPayload.FilePath == "" && logPayload.FileVersion == 0) {
 		// use the provided command and working dir to extract the location of the file
 		_, pathFromArgs := runner.GetIdAndPathFromCommand(payload.Command)
@@ -498,17 +849,17 @@ func (s *Server) collect(ctx context.Context, payload types.CollectPayload) (rec
 			// open the file and get the contents
 			fileContents, err := s.FS().ReadFile(pathFromArgs)
 			if err == nil {
-				err := s.logger.WriteVersionedFile(pathFromArgs, fileContents, -1)
+				err := s.logger.WriteVersionedFileForPID(participantId, anonymizer.Path(pathFromArgs), anonymizer.Content(fileContents), -1)
 
 				// write the file to the logger
 				if err == nil {
-					maxVersion, _ := s.logger.LatestVersionFromFile(pathFromArgs)
+					maxVersion, _ := s.logger.LatestVersionFromFileForPID(participantId, anonymizer.Path(pathFromArgs))
 					if maxVersion >= 0 {
 						logPayload.FilePath = pathFromArgs
 						logPayload.FileVersion = maxVersion
 					}
 				}
-			} else if maxVersion, _ := s.logger.LatestVersionFromFile(pathFromArgs); maxVersion >= 0 {
+			} else if maxVersion, _ := s.logger.LatestVersionFromFileForPID(participantId, anonymizer.Path(pathFromArgs)); maxVersion >= 0 {
 				// ... just get the latest version
 				logPayload.FilePath = pathFromArgs
 				logPayload.FileVersion = maxVersion
@@ -516,20 +867,45 @@ func (s *Server) collect(ctx context.Context, payload types.CollectPayload) (rec
 		}
 	}
 
-	s.logger.Log(logPayload)
+	if sessionId != 0 {
+		logPayload.SessionId = &sessionId
+	}
+
+	s.logger.Log(anonymizer.Entry(logPayload))
 	s.errors = append(s.errors, report)
 	s.notifyErrors(ctx, []resultError{report})
 
 	if result.Data != nil && result.Data.Documents != nil {
 		// write files to the logger
 		for _, file := range result.Data.Documents {
-			s.logger.WriteVersionedFile(file.Path, []byte(file.Contents), file.Version)
+			s.logger.WriteVersionedFileForPID(participantId, anonymizer.Path(file.Path), anonymizer.Content([]byte(file.Contents)), file.Version)
 		}
 	}
 
 	return r, p, nil
 }
 
+// writeAnonymizer returns the anonymizer for scrubbing the collected data
+// before it is logged. It returns nil if write-time anonymization is disabled.
+func (s *Server) writeAnonymizer() (*logger.Anonymizer, error) {
+	anonymizer, err := s.logger.WriteAnonymizer()
+	if err != nil || anonymizer == nil {
+		return nil, err
+	}
+
+	// the daemon runs under the account of the student
+	if currentUser, err := user.Current(); err == nil {
+		username := currentUser.Username
+		if idx := strings.LastIndex(username, "\\"); idx != -1 {
+			// strip the domain of Windows usernames
+			username = username[idx+1:]
+		}
+		anonymizer.AddUsername(username)
+	}
+
+	return anonymizer, nil
+}
+
 func (s *Server) notifyErrors(ctx context.Context, errors []resultError, procIds_ ...int) {
 	s.ServerLog.Printf("report %d error/s to %d clients\n", len(errors), len(s.connectedClients.ProcessIds(types.LspClientType)))
 
@@ -581,10 +957,13 @@ func NewServer() *Server {
 			SharedStore: errgoengine.NewEmptyStore(),
 			OutputGen:   &errgoengine.OutputGenerator{},
 		},
-		connectedClients: connectedClients{},
-		fileUseCounter:   map[string][]int{},
-		errors:           []resultError{},
-		logger:           logger.NewMemoryLoggerPanic(),
+		connectedClients:   connectedClients{},
+		fileUseCounter:     map[string][]int{},
+		errors:             []resultError{},
+		logger:             logger.NewMemoryLoggerPanic(),
+		sessions:           map[int]*clientSession{},
+		snapshots:          map[string]*pendingSnapshot{},
+		SessionIdleTimeout: DefaultSessionIdleTimeout,
 	}
 
 	error_templates.LoadErrorTemplates(&server.engine.ErrorTemplates)
@@ -597,10 +976,15 @@ func Start(server *Server, addr string) error {
 	disconnChan := make(chan int, 1)
 	exitSignal := make(chan os.Signal, 1)
 
-	if err := server.SetLogger(logger.NewLoggerPanic()); err != nil {
+	lg := logger.NewLoggerPanic()
+	if err := server.SetLogger(lg); err != nil {
 		fmt.Printf("logger error: %s\n", err.Error())
+	} else if lg.Locked() {
+		fmt.Printf("logger error: %s. set %s or add the key file to the data dir to collect logs\n", logger.ErrLocked, logger.PassphraseEnv)
 	}
 
+	go server.backupLogs(time.Now())
+
 	go func() {
 		fmt.Println("daemon started on " + addr)
 		errChan <- server.Start(addr)
@@ -617,12 +1001,17 @@ func Start(server *Server, addr string) error {
 		case err := <-errChan:
 			return err
 		case <-time.After(15 * time.Second):
+			server.closeIdleSessions(time.Now())
+			go server.backupLogs(time.Now())
+
 			// Disconnect only if CTRL+C is pressed or is launched
 			// as a background terminal
 			if !isTerminal && len(server.connectedClients) == 0 {
 				disconnChan <- 1
 			}
 		case <-disconnChan:
+			server.flushAllSnapshots()
+			server.endAllSessions(logger.SessionEndShutdown)
 			server.connectedClients.Disconnect()
 			return nil
 		}
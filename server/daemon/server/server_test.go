@@ -5,12 +5,14 @@ import (
 	"io"
 	"log"
 	"net"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/nedpals/bugbuddy/server/daemon/client"
 	"github.com/nedpals/bugbuddy/server/daemon/server"
 	"github.com/nedpals/bugbuddy/server/daemon/types"
+	"github.com/nedpals/bugbuddy/server/logger"
 	"github.com/nedpals/errgoengine"
 	"github.com/nedpals/errgoengine/languages"
 	"github.com/sourcegraph/jsonrpc2"
@@ -643,6 +645,313 @@ func TestResetLogger(t *testing.T) {
 	}
 }
 
+func TestConsent(t *testing.T) {
+	clientId := 1
+	conn, _, client := Setup()
+	defer conn.Close()
+
+	client.SetId(clientId)
+	defer client.Close()
+
+	if err := client.Connect(); err != nil {
+		t.Fatal(err)
+	}
+
+	consent, err := client.RetrieveConsent()
+	if err != nil {
+		t.Fatal(err)
+	} else if consent.Level != "metadata-only" || consent.ConsentedAt != nil {
+		t.Fatalf("expected default collection level without consent, got %+v", consent)
+	}
+
+	if err := client.SetConsent("invalid", ""); err == nil {
+		t.Fatalf("expected error for invalid collection level")
+	}
+
+	if err := client.SetConsent("metadata-only", "cs101-fall"); err != nil {
+		t.Fatal(err)
+	}
+
+	consent, err = client.RetrieveConsent()
+	if err != nil {
+		t.Fatal(err)
+	} else if consent.Level != "metadata-only" || consent.StudyId != "cs101-fall" || consent.ConsentedAt == nil {
+		t.Fatalf("expected consent to be recorded, got %+v", consent)
+	}
+}
+
+func TestQueryLogs(t *testing.T) {
+	jsonlLogger, err := logger.NewLoggerFromPath(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the daemon works the same regardless of the storage of the logger
+	for name, lg := range map[string]*logger.Logger{
+		"sqlite": logger.NewMemoryLoggerPanic(),
+		"jsonl":  jsonlLogger,
+	} {
+		t.Run(name, func(t *testing.T) {
+			clientId := 1
+			conn, srv, client := Setup()
+			defer conn.Close()
+
+			if err := srv.SetLogger(lg); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, errorType := range []string{"NameError", "TypeError", "NameError"} {
+				if err := lg.Log(logger.LogEntry{ErrorCode: 1, ErrorType: errorType}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			client.SetId(clientId)
+			defer client.Close()
+
+			if err := client.Connect(); err != nil {
+				t.Fatal(err)
+			}
+
+			result, err := client.QueryLogs(types.LogQueryPayload{ErrorType: "NameError", Limit: 1})
+			if err != nil {
+				t.Fatal(err)
+			} else if len(result.Entries) != 1 || result.NextCursor == 0 {
+				t.Fatalf("expected first page with a cursor, got %+v", result)
+			}
+
+			result, err = client.QueryLogs(types.LogQueryPayload{ErrorType: "NameError", Limit: 1, Cursor: result.NextCursor})
+			if err != nil {
+				t.Fatal(err)
+			} else if len(result.Entries) != 1 || result.Entries[0].ErrorType != "NameError" {
+				t.Fatalf("expected second NameError entry, got %+v", result)
+			}
+		})
+	}
+}
+
+func TestSessions(t *testing.T) {
+	srv := server.NewServer()
+	srv.ServerLog = log.New(io.Discard, "", log.LstdFlags)
+
+	lg := logger.NewMemoryLoggerPanic()
+	if err := srv.SetLogger(lg); err != nil {
+		t.Fatal(err)
+	}
+
+	serverConn, clientConn := net.Pipe()
+	conn := jsonrpc2.NewConn(
+		context.Background(),
+		jsonrpc2.NewBufferedStream(serverConn, &jsonrpc2.VarintObjectCodec{}),
+		srv,
+	)
+	defer conn.Close()
+
+	lspClient := client.NewClient(context.Background(), defaultAddr, types.LspClientType)
+	lspClient.SetConn(clientConn)
+	lspClient.SetId(2)
+	lspClient.Editor = "vscode 1.85"
+
+	if err := lspClient.Connect(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lspClient.ResolveDocument("main.py", "print(a)"); err != nil {
+		t.Fatal(err)
+	}
+
+	session, err := lg.Session(1)
+	if err != nil {
+		t.Fatal(err)
+	} else if session.Editor != "vscode 1.85" || !session.IsOpen() {
+		t.Fatalf("expected an open session for the editor, got %+v", session)
+	} else if len(session.Files) != 1 || session.Files[0] != "main.py" {
+		t.Fatalf("expected opened file to be recorded, got %v", session.Files)
+	}
+
+	if err := lspClient.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+
+	// shutdown is a notification so wait for the server to process it
+	for i := 0; i < 50; i++ {
+		if session, err = lg.Session(1); err == nil && !session.IsOpen() {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if session.IsOpen() || session.EndReason != logger.SessionEndShutdown {
+		t.Fatalf("expected session to be ended on shutdown, got %+v", session)
+	}
+}
+
+func TestEditorEvents(t *testing.T) {
+	srv := server.NewServer()
+	srv.ServerLog = log.New(io.Discard, "", log.LstdFlags)
+
+	lg := logger.NewMemoryLoggerPanic()
+	if err := lg.SetConsent(logger.CollectionFull, ""); err != nil {
+		t.Fatal(err)
+	} else if err := srv.SetLogger(lg); err != nil {
+		t.Fatal(err)
+	}
+
+	serverConn, clientConn := net.Pipe()
+	conn := jsonrpc2.NewConn(
+		context.Background(),
+		jsonrpc2.NewBufferedStream(serverConn, &jsonrpc2.VarintObjectCodec{}),
+		srv,
+	)
+	defer conn.Close()
+
+	lspClient := client.NewClient(context.Background(), defaultAddr, types.LspClientType)
+	lspClient.SetConn(clientConn)
+	lspClient.SetId(2)
+
+	if err := lspClient.Connect(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the pending snapshot is stored once the file is closed
+	if err := lspClient.SetEventsConfig(true, "1h"); err != nil {
+		t.Fatal(err)
+	}
+
+	if config, err := lspClient.RetrieveEventsConfig(); err != nil {
+		t.Fatal(err)
+	} else if !config.Enabled || config.SnapshotInterval != "1h0m0s" {
+		t.Fatalf("unexpected events config %+v", config)
+	}
+
+	if err := lspClient.ResolveDocument("events.py", "print(a)"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lspClient.UpdateDocument("events.py", "a = 1\nprint(a)"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lspClient.DeleteDocument("events.py"); err != nil {
+		t.Fatal(err)
+	}
+
+	iter, err := lg.AllEvents()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := iter.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []logger.EventKind{logger.EventOpen, logger.EventEdit, logger.EventSnapshot, logger.EventClose}
+	if len(events) != len(expected) {
+		t.Fatalf("expected %d events, got %+v", len(expected), events)
+	}
+
+	for i, event := range events {
+		if event.Kind != expected[i] {
+			t.Errorf("expected event %d to be %s, got %s", i, expected[i], event.Kind)
+		} else if event.SessionId == nil {
+			t.Errorf("expected %s event to belong to the session", event.Kind)
+		}
+	}
+
+	if events[1].CharsInserted != 6 || events[1].CharsDeleted != 0 || events[1].Size != 14 {
+		t.Errorf("unexpected edit size %+v", events[1])
+	}
+
+	content, err := lg.OpenVersionedFile("events.py", *events[2].FileVersion)
+	if err != nil {
+		t.Fatal(err)
+	} else if string(content) != "a = 1\nprint(a)" {
+		t.Errorf("unexpected snapshot content %q", content)
+	}
+}
+
+func TestSetLogger_PendingSnapshots(t *testing.T) {
+	srv := server.NewServer()
+	srv.ServerLog = log.New(io.Discard, "", log.LstdFlags)
+
+	oldPath := filepath.Join(t.TempDir(), "old.db")
+	lg, err := logger.NewLoggerFromPath(oldPath)
+	if err != nil {
+		t.Fatal(err)
+	} else if err := lg.SetConsent(logger.CollectionFull, ""); err != nil {
+		t.Fatal(err)
+	} else if err := srv.SetLogger(lg); err != nil {
+		t.Fatal(err)
+	}
+
+	serverConn, clientConn := net.Pipe()
+	conn := jsonrpc2.NewConn(
+		context.Background(),
+		jsonrpc2.NewBufferedStream(serverConn, &jsonrpc2.VarintObjectCodec{}),
+		srv,
+	)
+	defer conn.Close()
+
+	lspClient := client.NewClient(context.Background(), defaultAddr, types.LspClientType)
+	lspClient.SetConn(clientConn)
+	lspClient.SetId(2)
+
+	if err := lspClient.Connect(); err != nil {
+		t.Fatal(err)
+	} else if err := lspClient.SetEventsConfig(true, "10ms"); err != nil {
+		t.Fatal(err)
+	} else if err := lspClient.ResolveDocument("events.py", "print(a)"); err != nil {
+		t.Fatal(err)
+	} else if err := lspClient.UpdateDocument("events.py", "a = 1\nprint(a)"); err != nil {
+		t.Fatal(err)
+	}
+
+	// replace the logger around the time the snapshot is due
+	time.Sleep(10 * time.Millisecond)
+	newLg := logger.NewMemoryLoggerPanic()
+	defer newLg.Close()
+	if err := srv.SetLogger(newLg); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	countSnapshots := func(lg *logger.Logger) int {
+		iter, err := lg.AllEvents()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		events, err := iter.List()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		count := 0
+		for _, event := range events {
+			if event.Kind == logger.EventSnapshot {
+				count++
+			}
+		}
+		return count
+	}
+
+	// the snapshot is stored in the old logger before it is closed
+	if count := countSnapshots(newLg); count != 0 {
+		t.Errorf("expected no snapshots in the new logger, got %d", count)
+	}
+
+	oldLg, err := logger.NewLoggerFromPath(oldPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer oldLg.Close()
+
+	if count := countSnapshots(oldLg); count != 1 {
+		t.Errorf("expected the snapshot in the old logger, got %d", count)
+	}
+}
+
 func TestCall_NoProcessId(t *testing.T) {
 	clientId := 1
 	conn, _, client := Setup()
@@ -709,3 +1018,163 @@ func TestCall_InvalidProcessId(t *testing.T) {
 		t.Fatalf("expected jsonrpc2.Error, got %T", err)
 	}
 }
+
+func TestParticipantSwitch(t *testing.T) {
+	srv := server.NewServer()
+	srv.ServerLog = log.New(io.Discard, "", log.LstdFlags)
+
+	lg := logger.NewMemoryLoggerPanic()
+	if err := srv.SetLogger(lg); err != nil {
+		t.Fatal(err)
+	}
+
+	connect := func(clientType types.ClientType, id int) *client.Client {
+		serverConn, clientConn := net.Pipe()
+		conn := jsonrpc2.NewConn(
+			context.Background(),
+			jsonrpc2.NewBufferedStream(serverConn, &jsonrpc2.VarintObjectCodec{}),
+			srv,
+		)
+		t.Cleanup(func() { conn.Close() })
+
+		c := client.NewClient(context.Background(), defaultAddr, clientType)
+		c.SetConn(clientConn)
+		c.SetId(id)
+		if err := c.Connect(); err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	lspClient := connect(types.LspClientType, 2)
+	otherLspClient := connect(types.LspClientType, 3)
+	monitorClient := connect(types.MonitorClientType, 4)
+
+	active := lg.ParticipantId()
+
+	// binding only switches the participant of the requesting client
+	if participantId, err := lspClient.SwitchParticipant("student-b", true); err != nil {
+		t.Fatal(err)
+	} else if participantId != "student-b" {
+		t.Fatalf("expected student-b, got %s", participantId)
+	}
+
+	if participantId, err := lspClient.RetrieveParticipantId(); err != nil || participantId != "student-b" {
+		t.Fatalf("expected the bound participant, got %s (%v)", participantId, err)
+	} else if participantId, err := otherLspClient.RetrieveParticipantId(); err != nil || participantId != active {
+		t.Fatalf("expected the other client to keep %s, got %s (%v)", active, participantId, err)
+	} else if lg.ParticipantId() != active {
+		t.Fatalf("expected the active participant to stay %s, got %s", active, lg.ParticipantId())
+	}
+
+	// the session of the client is restarted for the participant
+	if session, err := lg.Session(1); err != nil {
+		t.Fatal(err)
+	} else if session.IsOpen() || session.EndReason != logger.SessionEndSwitch {
+		t.Fatalf("expected the previous session to end, got %+v", session)
+	}
+
+	if err := lspClient.ResolveDocument("main.py", "print(a)"); err != nil {
+		t.Fatal(err)
+	}
+
+	// sessions 1 and 2 were started by the handshakes of the clients
+	if session, err := lg.Session(3); err != nil {
+		t.Fatal(err)
+	} else if session.ParticipantId != "student-b" || !session.IsOpen() {
+		t.Fatalf("expected an open session for student-b, got %+v", session)
+	} else if len(session.Files) != 1 || session.Files[0] != "main.py" {
+		t.Fatalf("expected opened file in the session of student-b, got %v", session.Files)
+	}
+
+	// runs are recorded for the participant of the most recently active client
+	if _, err := lspClient.Collect(1, "cat main.py", ".", "im an error!"); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := lg.EntriesByParticipantId("student-b")
+	if err != nil {
+		t.Fatal(err)
+	} else if list, err := entries.List(); err != nil {
+		t.Fatal(err)
+	} else if len(list) != 1 {
+		t.Fatalf("expected the run to be recorded for student-b, got %+v", list)
+	}
+
+	// switching without binding changes the active participant of the logger
+	if _, err := monitorClient.SwitchParticipant("student-c", false); err != nil {
+		t.Fatal(err)
+	} else if lg.ParticipantId() != "student-c" {
+		t.Fatalf("expected student-c to be active, got %s", lg.ParticipantId())
+	} else if participantId, _ := otherLspClient.RetrieveParticipantId(); participantId != "student-c" {
+		t.Fatalf("expected unbound clients to follow the active participant, got %s", participantId)
+	} else if participantId, _ := lspClient.RetrieveParticipantId(); participantId != "student-b" {
+		t.Fatalf("expected the bound client to keep student-b, got %s", participantId)
+	}
+
+	// binding requires a session
+	if _, err := monitorClient.SwitchParticipant("student-d", true); err == nil {
+		t.Fatal("expected clients without a session to be unable to bind")
+	}
+
+	participants, err := monitorClient.ListParticipants()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids := []string{}
+	for _, participant := range participants {
+		ids = append(ids, participant.Id)
+		if participant.Active != (participant.Id == "student-c") {
+			t.Errorf("unexpected active flag for %+v", participant)
+		}
+	}
+
+	if len(ids) != 3 || ids[0] != active || ids[1] != "student-b" || ids[2] != "student-c" {
+		t.Fatalf("unexpected participants %v", ids)
+	}
+}
+
+func TestResetLogger_ReopensSessions(t *testing.T) {
+	srv := server.NewServer()
+	srv.ServerLog = log.New(io.Discard, "", log.LstdFlags)
+
+	lg := logger.NewMemoryLoggerPanic()
+	if err := srv.SetLogger(lg); err != nil {
+		t.Fatal(err)
+	}
+
+	serverConn, clientConn := net.Pipe()
+	conn := jsonrpc2.NewConn(
+		context.Background(),
+		jsonrpc2.NewBufferedStream(serverConn, &jsonrpc2.VarintObjectCodec{}),
+		srv,
+	)
+	defer conn.Close()
+
+	lspClient := client.NewClient(context.Background(), defaultAddr, types.LspClientType)
+	lspClient.SetConn(clientConn)
+	lspClient.SetId(2)
+
+	if err := lspClient.Connect(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lspClient.PurgeLogger(); err != nil {
+		t.Fatal(err)
+	} else if _, err := lg.Session(1); err == nil {
+		t.Fatal("expected the session to be removed")
+	}
+
+	// the session is reopened once the client becomes active again
+	if err := lspClient.ResolveDocument("main.py", "print(a)"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the id of the removed session is reused by SQLite
+	if session, err := lg.Session(1); err != nil {
+		t.Fatal(err)
+	} else if !session.IsOpen() || len(session.Files) != 1 {
+		t.Fatalf("expected a new session with the opened file, got %+v", session)
+	}
+}
@@ -0,0 +1,210 @@
+package server
+
+import (
+	"errors"
+	"time"
+
+	"github.com/nedpals/bugbuddy/server/logger"
+)
+
+// DefaultSessionIdleTimeout is the duration of inactivity before
+// the session of an LSP client is closed
+const DefaultSessionIdleTimeout = 30 * time.Minute
+
+type clientSession struct {
+	// id is zero if the session was closed due to inactivity
+	id     int
+	editor string
+	// participantId is the participant bound to the client. The client
+	// follows the active participant of the logger if it is empty.
+	participantId string
+	lastActive    time.Time
+}
+
+// participant returns the participant whose activity is recorded
+// in the session
+func (s *clientSession) participant(log *logger.Logger) string {
+	if len(s.participantId) != 0 {
+		return s.participantId
+	}
+	return log.ParticipantId()
+}
+
+// startSession opens a new session for the LSP client
+func (d *Server) startSession(procId int, editor string) {
+	d.sessionsMu.Lock()
+	defer d.sessionsMu.Unlock()
+
+	d.startSessionLocked(procId, editor, "")
+}
+
+func (d *Server) startSessionLocked(procId int, editor string, participantId string) *clientSession {
+	session := &clientSession{editor: editor, participantId: participantId, lastActive: time.Now()}
+
+	id, err := d.logger.StartSessionForPID(session.participant(d.logger), editor)
+	if err != nil {
+		d.ServerLog.Printf("unable to start session: %s\n", err)
+	}
+
+	session.id = id
+	d.sessions[procId] = session
+	return session
+}
+
+// participantOf returns the participant of the client. Clients without
+// a session follow the active participant of the logger.
+func (d *Server) participantOf(procId int) string {
+	d.sessionsMu.Lock()
+	defer d.sessionsMu.Unlock()
+
+	if session, ok := d.sessions[procId]; ok {
+		return session.participant(d.logger)
+	}
+	return d.logger.ParticipantId()
+}
+
+// bindParticipant binds the participant to the client. The session of
+// the client is ended and a new one is started for the participant.
+func (d *Server) bindParticipant(procId int, participantId string) error {
+	d.sessionsMu.Lock()
+	defer d.sessionsMu.Unlock()
+
+	session, ok := d.sessions[procId]
+	if !ok {
+		return errors.New("client has no session")
+	} else if session.participantId == participantId {
+		return nil
+	} else if err := d.logger.AddParticipant(participantId, ""); err != nil {
+		return err
+	}
+
+	if session.id != 0 {
+		if err := d.logger.EndSession(session.id, time.Now(), logger.SessionEndSwitch); err != nil {
+			d.ServerLog.Printf("unable to end session: %s\n", err)
+		}
+	}
+
+	d.startSessionLocked(procId, session.editor, participantId)
+	return nil
+}
+
+// isBound checks if the client is bound to its own participant
+func (d *Server) isBound(procId int) bool {
+	d.sessionsMu.Lock()
+	defer d.sessionsMu.Unlock()
+
+	session, ok := d.sessions[procId]
+	return ok && len(session.participantId) != 0
+}
+
+// endSession closes the session of the client
+func (d *Server) endSession(procId int, reason string) {
+	d.sessionsMu.Lock()
+	defer d.sessionsMu.Unlock()
+
+	session, ok := d.sessions[procId]
+	if !ok {
+		return
+	}
+
+	if session.id != 0 {
+		if err := d.logger.EndSession(session.id, time.Now(), reason); err != nil {
+			d.ServerLog.Printf("unable to end session: %s\n", err)
+		}
+	}
+
+	delete(d.sessions, procId)
+}
+
+// endAllSessions closes the sessions of all clients
+func (d *Server) endAllSessions(reason string) {
+	d.sessionsMu.Lock()
+	procIds := make([]int, 0, len(d.sessions))
+	for procId := range d.sessions {
+		procIds = append(procIds, procId)
+	}
+	d.sessionsMu.Unlock()
+
+	for _, procId := range procIds {
+		d.endSession(procId, reason)
+	}
+}
+
+// touchSession marks the session of the client as active and returns
+// its id and participant. Sessions closed due to inactivity are reopened.
+func (d *Server) touchSession(procId int) (int, string) {
+	d.sessionsMu.Lock()
+	defer d.sessionsMu.Unlock()
+
+	session, ok := d.sessions[procId]
+	if !ok {
+		return 0, d.logger.ParticipantId()
+	}
+
+	return d.touchSessionLocked(procId, session), session.participant(d.logger)
+}
+
+func (d *Server) touchSessionLocked(procId int, session *clientSession) int {
+	if session.id == 0 {
+		session = d.startSessionLocked(procId, session.editor, session.participantId)
+	}
+
+	session.lastActive = time.Now()
+	return session.id
+}
+
+// activeSession returns the id and the participant of the most recently
+// active session since runs are collected from the terminal instead of the
+// editor. The id is zero if there are no sessions.
+func (d *Server) activeSession() (int, string) {
+	d.sessionsMu.Lock()
+	defer d.sessionsMu.Unlock()
+
+	var activeProcId int
+	var active *clientSession
+	for procId, session := range d.sessions {
+		if active == nil || session.lastActive.After(active.lastActive) {
+			activeProcId, active = procId, session
+		}
+	}
+
+	if active == nil {
+		return 0, d.logger.ParticipantId()
+	}
+
+	id := d.touchSessionLocked(activeProcId, active)
+	return id, active.participant(d.logger)
+}
+
+// detachSessions forgets the sessions of the participant after its data
+// has been reset. The sessions are reopened once the clients become active.
+func (d *Server) detachSessions(participantId string) {
+	d.sessionsMu.Lock()
+	defer d.sessionsMu.Unlock()
+
+	for _, session := range d.sessions {
+		if session.participant(d.logger) == participantId {
+			session.id = 0
+		}
+	}
+}
+
+// closeIdleSessions closes the sessions which have been inactive for longer
+// than the idle timeout. The session is ended at the time of its last activity.
+func (d *Server) closeIdleSessions(now time.Time) {
+	d.sessionsMu.Lock()
+	defer d.sessionsMu.Unlock()
+
+	for _, session := range d.sessions {
+		if session.id == 0 || now.Sub(session.lastActive) < d.SessionIdleTimeout {
+			continue
+		}
+
+		if err := d.logger.EndSession(session.id, session.lastActive, logger.SessionEndIdle); err != nil {
+			d.ServerLog.Printf("unable to end idle session: %s\n", err)
+			continue
+		}
+
+		session.id = 0
+	}
+}
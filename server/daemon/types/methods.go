@@ -40,6 +40,13 @@ var (
 	RetrieveParticipantIdMethod = loggerNamespace.methodName("participantId/retrieve")
 	GenerateParticipantIdMethod = loggerNamespace.methodName("participantId/generate")
 	ResetLoggerMethod           = loggerNamespace.methodName("reset")
+	RetrieveConsentMethod       = loggerNamespace.methodName("consent/retrieve")
+	SetConsentMethod            = loggerNamespace.methodName("consent/set")
+	QueryLogsMethod             = loggerNamespace.methodName("query")
+	RetrieveEventsConfigMethod  = loggerNamespace.methodName("events/retrieve")
+	SetEventsConfigMethod       = loggerNamespace.methodName("events/set")
+	SwitchParticipantMethod     = loggerNamespace.methodName("participant/switch")
+	ListParticipantsMethod      = loggerNamespace.methodName("participant/list")
 )
 
 // document methods
@@ -1,6 +1,11 @@
 package types
 
-import "github.com/nedpals/errgoengine"
+import (
+	"time"
+
+	"github.com/nedpals/bugbuddy/server/logger/export"
+	"github.com/nedpals/errgoengine"
+)
 
 type ClientType int
 
@@ -13,6 +18,7 @@ const (
 type ClientInfo struct {
 	ProcessId  int        `json:"processId"`
 	ClientType ClientType `json:"clientType"`
+	Editor     string     `json:"editor,omitempty"`
 }
 
 type CollectPayload struct {
@@ -65,3 +71,56 @@ type CollectResponse struct {
 type SetDataDirRequest struct {
 	NewPath string `json:"new_path"`
 }
+
+type ConsentPayload struct {
+	Level       string     `json:"level"`
+	StudyId     string     `json:"study_id"`
+	ConsentedAt *time.Time `json:"consented_at,omitempty"`
+}
+
+type EventsPayload struct {
+	Enabled bool `json:"enabled"`
+	// SnapshotInterval is a duration such as "30s". Empty or zero disables the snapshots.
+	SnapshotInterval string `json:"snapshot_interval,omitempty"`
+}
+
+type ResetPayload struct {
+	// Purge permanently removes the data instead of archiving it
+	Purge bool `json:"purge,omitempty"`
+}
+
+type ParticipantSwitchPayload struct {
+	// ParticipantId is the participant to switch to. A new participant
+	// is generated if it is empty.
+	ParticipantId string `json:"participant_id,omitempty"`
+	// Bind switches the participant of the requesting client only
+	// instead of the active participant of the logger.
+	Bind bool `json:"bind,omitempty"`
+}
+
+type ParticipantPayload struct {
+	Id        string     `json:"id"`
+	Name      string     `json:"name,omitempty"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	// Active is true for the active participant of the logger
+	Active bool `json:"active"`
+}
+
+type LogQueryPayload struct {
+	ParticipantId  string     `json:"participant_id,omitempty"`
+	FilePathPrefix string     `json:"file_path_prefix,omitempty"`
+	ErrorType      string     `json:"error_type,omitempty"`
+	ExitCode       *int       `json:"exit_code,omitempty"`
+	After          *time.Time `json:"after,omitempty"`
+	Before         *time.Time `json:"before,omitempty"`
+	Limit          int        `json:"limit,omitempty"`
+	Cursor         int        `json:"cursor,omitempty"`
+	Descending     bool       `json:"descending,omitempty"`
+}
+
+type LogQueryResult struct {
+	Entries []export.Entry `json:"entries"`
+	// NextCursor is the cursor for the next page. It is
+	// zero if there are no more entries.
+	NextCursor int `json:"next_cursor"`
+}
@@ -0,0 +1,157 @@
+package analyzer
+
+import (
+	"time"
+
+	"github.com/nedpals/bugbuddy/server/logger"
+)
+
+// Activity is either a program run or an editor event of a participant
+type Activity struct {
+	// Entry is set if the activity is a program run
+	Entry *logger.LogEntry
+	// Event is set if the activity is an editor event
+	Event *logger.Event
+}
+
+// IsRun checks if the activity is a program run
+func (a Activity) IsRun() bool {
+	return a.Entry != nil
+}
+
+func (a Activity) ParticipantId() string {
+	if a.Entry != nil {
+		return a.Entry.ParticipantId
+	}
+	return a.Event.ParticipantId
+}
+
+func (a Activity) FilePath() string {
+	if a.Entry != nil {
+		return a.Entry.FilePath
+	}
+	return a.Event.FilePath
+}
+
+func (a Activity) CreatedAt() time.Time {
+	if a.Entry != nil && a.Entry.CreatedAt != nil {
+		return a.Entry.CreatedAt.Time
+	} else if a.Event != nil && a.Event.CreatedAt != nil {
+		return a.Event.CreatedAt.Time
+	}
+	return time.Time{}
+}
+
+// ActivityIterator interleaves the runs with the editor events of each
+// participant in chronological order. Events recorded at the same time
+// as a run come first since the file is edited before it is run.
+type ActivityIterator struct {
+	entries *logger.LogEntryIterator
+	events  *logger.EventIterator
+
+	entry *logger.LogEntry
+	event *logger.Event
+
+	current Activity
+	err     error
+	// reported is set once the error has been returned by Value
+	reported bool
+}
+
+// NewActivityIterator creates an iterator over the runs and events of
+// all participants in the logger
+func NewActivityIterator(log *logger.Logger) (*ActivityIterator, error) {
+	entries, err := log.AllEntries()
+	if err != nil {
+		return nil, err
+	}
+
+	events, err := log.AllEvents()
+	if err != nil {
+		// drain the entries to release the connection
+		for entries.Next() {
+		}
+		return nil, err
+	}
+
+	it := &ActivityIterator{entries: entries, events: events}
+	it.advanceEntry()
+	it.advanceEvent()
+	return it, nil
+}
+
+func (it *ActivityIterator) advanceEntry() {
+	it.entry = nil
+	if it.err != nil || it.entries == nil || !it.entries.Next() {
+		it.entries = nil
+		return
+	}
+
+	entry, err := it.entries.Value()
+	if err != nil {
+		it.err = err
+		return
+	}
+	it.entry = &entry
+}
+
+func (it *ActivityIterator) advanceEvent() {
+	it.event = nil
+	if it.err != nil || it.events == nil || !it.events.Next() {
+		it.events = nil
+		return
+	}
+
+	event, err := it.events.Value()
+	if err != nil {
+		it.err = err
+		return
+	}
+	it.event = &event
+}
+
+// eventFirst checks if the pending event comes before the pending run
+func (it *ActivityIterator) eventFirst() bool {
+	if it.entry == nil {
+		return true
+	} else if it.event == nil {
+		return false
+	}
+
+	entry, event := Activity{Entry: it.entry}, Activity{Event: it.event}
+	if entry.ParticipantId() != event.ParticipantId() {
+		return event.ParticipantId() < entry.ParticipantId()
+	}
+	return !event.CreatedAt().After(entry.CreatedAt())
+}
+
+func (it *ActivityIterator) Next() bool {
+	it.current = Activity{}
+	if it.err != nil {
+		// stop after the error has been reported
+		if it.reported {
+			return false
+		}
+		it.reported = true
+		return true
+	} else if it.entry == nil && it.event == nil {
+		return false
+	}
+
+	if it.eventFirst() {
+		it.current.Event = it.event
+		it.advanceEvent()
+	} else {
+		it.current.Entry = it.entry
+		it.advanceEntry()
+	}
+
+	return true
+}
+
+func (it *ActivityIterator) Value() (Activity, error) {
+	if it.reported {
+		return Activity{}, it.err
+	}
+	return it.current, nil
+}
@@ -0,0 +1,75 @@
+package analyzer_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nedpals/bugbuddy/server/logger"
+	"github.com/nedpals/bugbuddy/server/logger/analyzer"
+)
+
+func TestActivityIterator(t *testing.T) {
+	log := logger.NewMemoryLoggerPanic()
+	defer log.Close()
+
+	if err := log.SetEventsConfig(logger.EventsConfig{Enabled: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2023, 9, 1, 8, 0, 0, 0, time.UTC)
+	at := func(minutes int) *logger.NullTime {
+		return &logger.NullTime{Time: start.Add(time.Duration(minutes) * time.Minute), Valid: true}
+	}
+
+	for _, entry := range []logger.LogEntry{
+		{ParticipantId: "b", ErrorCode: 1, FilePath: "main.py", CreatedAt: at(0)},
+		{ParticipantId: "a", ErrorCode: 1, FilePath: "main.py", CreatedAt: at(2)},
+		{ParticipantId: "a", ErrorCode: 0, FilePath: "main.py", CreatedAt: at(5)},
+	} {
+		if err := log.Log(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, event := range []logger.Event{
+		{ParticipantId: "a", Kind: logger.EventOpen, FilePath: "main.py", CreatedAt: at(1)},
+		{ParticipantId: "a", Kind: logger.EventEdit, FilePath: "main.py", CreatedAt: at(3)},
+		// recorded at the same time as the run
+		{ParticipantId: "a", Kind: logger.EventEdit, FilePath: "main.py", CreatedAt: at(5)},
+		{ParticipantId: "b", Kind: logger.EventClose, FilePath: "main.py", CreatedAt: at(1)},
+	} {
+		if err := log.LogEvent(event); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	iter, err := analyzer.NewActivityIterator(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"a:open", "a:run", "a:edit", "a:edit", "a:run", "b:run", "b:close"}
+	got := []string{}
+	for iter.Next() {
+		activity, err := iter.Value()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		kind := "run"
+		if !activity.IsRun() {
+			kind = string(activity.Event.Kind)
+		}
+		got = append(got, activity.ParticipantId()+":"+kind)
+	}
+
+	if len(got) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Fatalf("expected %v, got %v", expected, got)
+		}
+	}
+}
@@ -9,6 +9,46 @@ type KVWriter interface {
 	Write(name string, pid string, file string, value interface{})
 }
 
+// Dimension is a category which an analyzer can break its values down by
+type Dimension string
+
+const (
+	ErrorTypeDimension Dimension = "error_type"
+	TemplateDimension  Dimension = "template"
+	LanguageDimension  Dimension = "language"
+)
+
+// DimensionKVWriter is a KVWriter which also accepts values broken down by
+// a dimension, such as the value of each error type of a file. Writers
+// which do not implement it only receive the overall values.
+type DimensionKVWriter interface {
+	KVWriter
+	WriteDimension(name string, pid string, file string, dimension Dimension, category string, value interface{})
+}
+
+// WriteDimension writes the value of the category if the writer accepts
+// values broken down by a dimension
+func WriteDimension(writer KVWriter, name string, pid string, file string, dimension Dimension, category string, value interface{}) {
+	if dw, ok := writer.(DimensionKVWriter); ok {
+		dw.WriteDimension(name, pid, file, dimension, category, value)
+	}
+}
+
+// DimensionKey is the name under which DefaultKVWriter stores the values
+// of the analyzer broken down by the dimension
+func DimensionKey(name string, dimension Dimension) string {
+	return name + ":" + string(dimension)
+}
+
+// ErrorTypeCategory is the category of the error type in the values broken
+// down by error type. Errors without a type are grouped as UnknownError.
+func ErrorTypeCategory(errorType string) string {
+	if len(errorType) == 0 {
+		return "UnknownError"
+	}
+	return errorType
+}
+
 type DefaultKVWriter map[string]map[string]map[string]any
 
 func (d DefaultKVWriter) Write(name string, pid string, key string, value interface{}) {
@@ -23,6 +63,19 @@ func (d DefaultKVWriter) Write(name string, pid string, key string, value interf
 	d[name][pid][key] = value
 }
 
+// WriteDimension stores the values of the categories of the file as a
+// map[string]any under DimensionKey(name, dimension)
+func (d DefaultKVWriter) WriteDimension(name string, pid string, file string, dimension Dimension, category string, value interface{}) {
+	key := DimensionKey(name, dimension)
+	categories, ok := d[key][pid][file].(map[string]any)
+	if !ok {
+		categories = map[string]any{}
+		d.Write(key, pid, file, categories)
+	}
+
+	categories[category] = value
+}
+
 func NewDefaultKV() DefaultKVWriter {
 	return make(DefaultKVWriter)
 }
@@ -0,0 +1,81 @@
+package errorfrequency
+
+import (
+	"strings"
+
+	"github.com/nedpals/bugbuddy/server/logger"
+	"github.com/nedpals/bugbuddy/server/logger/analyzer"
+)
+
+const KEY = "error_frequency"
+
+func init() {
+	analyzer.Register(analyzer.Registration{
+		Name:        "freq",
+		DisplayName: "Error Frequency",
+		Metrics: []analyzer.Metric{
+			{Key: KEY, DisplayName: "Error Frequency", Type: analyzer.CountValue, ByErrorType: true},
+		},
+		New: func() analyzer.LoggerAnalyzer { return &Analyzer{} },
+	})
+}
+
+// fileKey identifies the runs of a file of a participant
+type fileKey struct {
+	participantId string
+	filePath      string
+}
+
+// Analyzer counts the failed runs of each file of each participant. The
+// counts are broken down by error type for writers which accept them.
+type Analyzer struct{}
+
+func (a *Analyzer) Analyze(writer analyzer.KVWriter, loaders ...analyzer.LoggerLoader) error {
+	return analyzer.AnalyzeStreams(a, writer, loaders...)
+}
+
+func (a *Analyzer) NewStream(log *logger.Logger) analyzer.Stream {
+	return &stream{
+		counts:       map[fileKey]int{},
+		countsByType: map[fileKey]map[string]int{},
+		keys:         []fileKey{},
+	}
+}
+
+type stream struct {
+	counts map[fileKey]int
+	// map[participantId, filePath]map[errorType]count
+	countsByType map[fileKey]map[string]int
+	keys         []fileKey
+}
+
+func (s *stream) Add(entry logger.LogEntry) error {
+	// skip if the error message is "file not found". This is not the programmers fault.
+	if strings.Contains(entry.ErrorMessage, "error: file not found:") {
+		return nil
+	}
+
+	key := fileKey{participantId: entry.ParticipantId, filePath: entry.FilePath}
+	if _, ok := s.counts[key]; !ok {
+		s.counts[key] = 0
+		s.countsByType[key] = map[string]int{}
+		s.keys = append(s.keys, key)
+	}
+
+	if entry.ErrorCode != 0 {
+		s.counts[key]++
+		s.countsByType[key][analyzer.ErrorTypeCategory(entry.ErrorType)]++
+	}
+	return nil
+}
+
+func (s *stream) Close(writer analyzer.KVWriter) error {
+	for _, key := range s.keys {
+		writer.Write(KEY, key.participantId, key.filePath, s.counts[key])
+
+		for errorType, count := range s.countsByType[key] {
+			analyzer.WriteDimension(writer, KEY, key.participantId, key.filePath, analyzer.ErrorTypeDimension, errorType, count)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package errorfrequency_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nedpals/bugbuddy/server/logger"
+	"github.com/nedpals/bugbuddy/server/logger/analyzer"
+	errorfrequency "github.com/nedpals/bugbuddy/server/logger/analyzer/error_frequency"
+	red "github.com/nedpals/bugbuddy/server/logger/analyzer/repeated_error_density"
+	timetosolve "github.com/nedpals/bugbuddy/server/logger/analyzer/time_to_solve"
+)
+
+func TestErrorFrequencyAnalyzer(t *testing.T) {
+	log := logger.NewMemoryLoggerPanic()
+	defer log.Close()
+
+	filePath := "/test/Main.java"
+	start := time.Date(2024, 4, 1, 8, 0, 0, 0, time.UTC)
+
+	mockEvents := []struct {
+		errorType string
+		minutes   int
+	}{
+		{"NullPointerException", 0},
+		{"NullPointerException", 2},
+		{"NullPointerException", 3},
+		{"", 5},
+		{"SymbolNotFoundError", 6},
+		{"", 10},
+		{"SymbolNotFoundError", 12},
+		{"NullPointerException", 13},
+		{"", 15},
+	}
+
+	for _, e := range mockEvents {
+		entry := logger.LogEntry{
+			ErrorType: e.errorType,
+			FilePath:  filePath,
+			CreatedAt: &logger.NullTime{Time: start.Add(time.Duration(e.minutes) * time.Minute), Valid: true},
+		}
+		if len(e.errorType) != 0 {
+			entry.ErrorCode = 1
+		}
+
+		if err := log.Log(entry); err != nil {
+			t.Fatalf("Failed to log entry: %v", err)
+		}
+	}
+
+	kv := analyzer.NewDefaultKV()
+	for _, a := range []analyzer.LoggerAnalyzer{
+		analyzer.New[*errorfrequency.Analyzer](),
+		analyzer.New[*red.Analyzer](),
+		analyzer.New[*timetosolve.Analyzer](),
+	} {
+		if err := a.Analyze(kv, analyzer.LoadFromExistingLogger(log)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pId := log.ParticipantId()
+	if count := kv[errorfrequency.KEY][pId][filePath]; count != 6 {
+		t.Errorf("Expected 6 errors, got %v", count)
+	}
+
+	byType := func(name string) map[string]any {
+		values, ok := kv[analyzer.DimensionKey(name, analyzer.ErrorTypeDimension)][pId][filePath].(map[string]any)
+		if !ok {
+			t.Fatalf("No values by error type found for %s", name)
+		}
+		return values
+	}
+
+	counts := byType(errorfrequency.KEY)
+	if counts["NullPointerException"] != 4 || counts["SymbolNotFoundError"] != 2 || len(counts) != 2 {
+		t.Errorf("Unexpected error counts %v", counts)
+	}
+
+	// the three NullPointerExceptions in a row are the only repeated errors
+	densities := byType(red.KEY)
+	if densities["NullPointerException"] != 4.0/3.0 || densities["SymbolNotFoundError"] != 0.0 {
+		t.Errorf("Unexpected RED by error type %v", densities)
+	} else if total := kv[red.KEY][pId][filePath]; total != 4.0/3.0 {
+		t.Errorf("Expected the RED by error type to add up to %v, got %v", 4.0/3.0, total)
+	}
+
+	// the episodes are grouped by the error which started them
+	// NullPointerException: 5 minutes
+	// SymbolNotFoundError: 4 minutes + 3 minutes
+	tts := byType(timetosolve.KEY)
+	if tts["NullPointerException"] != 5*time.Minute || tts["SymbolNotFoundError"] != 7*time.Minute || len(tts) != 2 {
+		t.Errorf("Unexpected TTS by error type %v", tts)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"fmt"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/nedpals/bugbuddy/server/logger"
 	"github.com/nedpals/bugbuddy/server/logger/analyzer"
@@ -13,6 +14,99 @@ import (
 
 const KEY = "error_quotient"
 
+func init() {
+	analyzer.Register(analyzer.Registration{
+		Name:        "eq",
+		DisplayName: "Error Quotient",
+		Metrics: []analyzer.Metric{
+			{Key: KEY, DisplayName: "Error Quotient", Type: analyzer.FloatValue},
+		},
+		New: func() analyzer.LoggerAnalyzer { return &Analyzer{} },
+	})
+}
+
+// ScoringTable is the number of points a pair of consecutive compilations
+// gets for each of the rules of the error quotient. The score of each pair
+// is divided by Normalizer.
+type ScoringTable struct {
+	// BothErrors is given if both compilations ended in an error
+	BothErrors int
+	// SameErrorType is given if both errors have the same type
+	SameErrorType int
+	// SameLocation is given if both errors are on the same line
+	SameLocation int
+	// SameEditLocation is given if the code was changed in the same line
+	// before both compilations
+	SameEditLocation int
+	// OneError is given if only one of the compilations ended in an error
+	OneError   int
+	Normalizer float64
+}
+
+// JadudScoring is the scoring table of Jadud's error quotient (2006)
+var JadudScoring = ScoringTable{
+	BothErrors:       2,
+	SameErrorType:    3,
+	SameLocation:     3,
+	SameEditLocation: 1,
+	Normalizer:       9,
+}
+
+// CompatibilityScoring is the scoring table used before the error types and
+// locations were compared. It is used in compatibility mode.
+var CompatibilityScoring = ScoringTable{
+	BothErrors:    2,
+	SameErrorType: 3,
+	SameLocation:  3,
+	OneError:      1,
+	Normalizer:    9,
+}
+
+// PairComparison is the result of comparing a pair of consecutive compilations
+type PairComparison struct {
+	BothErrors       bool
+	OneError         bool
+	SameErrorType    bool
+	SameLocation     bool
+	SameEditLocation bool
+}
+
+// Score returns the points of the pair according to the table
+func (t ScoringTable) Score(pair PairComparison) int {
+	score := 0
+	if pair.BothErrors {
+		score += t.BothErrors
+		if pair.SameErrorType {
+			score += t.SameErrorType
+		}
+		if pair.SameLocation {
+			score += t.SameLocation
+		}
+		if pair.SameEditLocation {
+			score += t.SameEditLocation
+		}
+	} else if pair.OneError {
+		score += t.OneError
+	}
+	return score
+}
+
+// Calculate returns the error quotient of the compared pairs, which is the
+// average of the normalized scores of the pairs
+func (t ScoringTable) Calculate(pairs []PairComparison) float64 {
+	if len(pairs) == 0 || t.Normalizer == 0 {
+		return 0
+	}
+
+	var totalScore float64
+	for _, pair := range pairs {
+		totalScore += float64(t.Score(pair)) / t.Normalizer
+	}
+	return totalScore / float64(len(pairs))
+}
+
+// CompilationEvent is a compilation in compatibility mode. Every error has
+// the same type and the location is the diff between the compiled versions.
 type CompilationEvent struct {
 	ErrorType int
 	TimeDelta int // This is the 'T' from your description.
@@ -20,52 +114,114 @@ type CompilationEvent struct {
 	Location  string
 }
 
-func scoreEventPair(event1, event2 CompilationEvent) int {
-	score := 0
+// compareEventPair compares the compilations the way the scores were
+// computed before the error types and locations were compared
+func compareEventPair(event1, event2 CompilationEvent) PairComparison {
+	pair := PairComparison{}
 	// Check if both events have errors.
 	if event1.ErrorType != 0 && event2.ErrorType != 0 {
-		score += 2 // Both have errors, add 2.
+		pair.BothErrors = true
 
 		// Check if both events have the SAME error type.
 		if event1.ErrorType == event2.ErrorType {
-			score += 3 // Same error type, add 3.
+			pair.SameErrorType = true
 
 			// Check if both events have errors at the SAME location.
-			if event1.Location == event2.Location {
-				score += 3 // Same location, add 3.
-			}
+			pair.SameLocation = event1.Location == event2.Location
 		}
 	} else if event1.ErrorType != 0 || event2.ErrorType != 0 {
-		// If ONLY ONE of the events is an error, it seems you want to add 1 to the score.
-		// However, if you're consistently getting 1 for pairs that should possibly score higher,
-		// it might be worth revisiting how ErrorType and Location are being determined and compared.
-		// As per your description, if they always return 1, it indicates they never match in type and location for scoring 8.
-		// For this rule, ensure ErrorType and Location accurately reflect the intended comparisons.
-		score += 1 // Only one event is an error, add 1.
+		pair.OneError = true
 	}
-	return score
+	return pair
 }
 
-func normalizeScore(score int) float64 {
-	return float64(score) / 9.0
+// linesToRunes encodes each distinct line of the contents as a rune so
+// that the contents can be diffed line by line
+func linesToRunes(oldContent, newContent string) ([]rune, []rune) {
+	lines := map[string]rune{}
+	encode := func(content string) []rune {
+		encoded := []rune{}
+		for _, line := range strings.SplitAfter(content, "\n") {
+			if len(line) == 0 {
+				continue
+			}
+			if _, ok := lines[line]; !ok {
+				lines[line] = rune(len(lines) + 1)
+			}
+			encoded = append(encoded, lines[line])
+		}
+		return encoded
+	}
+	return encode(oldContent), encode(newContent)
 }
 
-func calculateEQ(events []CompilationEvent) float64 {
-	var totalScore float64
-	pairCount := len(events) - 1
-
-	if pairCount <= 0 {
+// MapLine returns the line in the new content which the line in the old
+// content was moved to by the edits. Lines which were edited in place,
+// where the removed lines are replaced by inserted lines, are mapped by
+// their position in the edit. It returns 0 if the line was removed.
+func MapLine(oldContent, newContent string, line int) int {
+	if line <= 0 {
 		return 0
+	} else if oldContent == newContent {
+		return line
+	}
+
+	oldLines, newLines := linesToRunes(oldContent, newContent)
+	diffs := diffmatchpatch.New().DiffMainRunes(oldLines, newLines, false)
+
+	// each character of the diffs is a line
+	oldLine, newLine := 1, 1
+	for i, diff := range diffs {
+		lines := utf8.RuneCountInString(diff.Text)
+		switch diff.Type {
+		case diffmatchpatch.DiffEqual:
+			if line < oldLine+lines {
+				return newLine + line - oldLine
+			}
+			oldLine += lines
+			newLine += lines
+		case diffmatchpatch.DiffDelete:
+			if line < oldLine+lines {
+				// the lines replacing the deleted lines come right
+				// before or after them
+				inserted, insertedLine := 0, newLine
+				if i+1 < len(diffs) && diffs[i+1].Type == diffmatchpatch.DiffInsert {
+					inserted = utf8.RuneCountInString(diffs[i+1].Text)
+				} else if i > 0 && diffs[i-1].Type == diffmatchpatch.DiffInsert {
+					inserted = utf8.RuneCountInString(diffs[i-1].Text)
+					insertedLine = newLine - inserted
+				}
+
+				if offset := line - oldLine; offset < inserted {
+					return insertedLine + offset
+				}
+				return 0
+			}
+			oldLine += lines
+		case diffmatchpatch.DiffInsert:
+			newLine += lines
+		}
 	}
+	return 0
+}
 
-	for i := 0; i < pairCount; i++ {
-		pairScore := scoreEventPair(events[i], events[i+1])
-		normalizedScore := normalizeScore(pairScore)
-		totalScore += normalizedScore
+// EditLocation returns the first line of the new content which differs
+// from the old content. It returns 0 if the contents are the same.
+func EditLocation(oldContent, newContent string) int {
+	if oldContent == newContent {
+		return 0
 	}
 
-	eq := totalScore / float64(pairCount)
-	return eq
+	oldLines, newLines := linesToRunes(oldContent, newContent)
+
+	newLine := 1
+	for _, diff := range diffmatchpatch.New().DiffMainRunes(oldLines, newLines, false) {
+		if diff.Type != diffmatchpatch.DiffEqual {
+			return newLine
+		}
+		newLine += utf8.RuneCountInString(diff.Text)
+	}
+	return 0
 }
 
 // ErrorTypeConversion would convert the ErrorCode to the ErrType used in the EQ calculation.
@@ -161,134 +317,247 @@ func CalculateCharDeltaAndLocation(log *logger.Logger, filepath string, version1
 	return
 }
 
-type ErrorQuotientAnalysisResult struct {
-	// errorEntries is a map of error types to the log entries
-	// format: map[filePath][]logEntry
-	compilationEvents *internal.ResultStore[[]CompilationEvent]
+// Analyzer computes Jadud's error quotient of each file of each participant.
+// The errors of a pair of compilations are on the same location if the
+// line of the first error was moved to the line of the second error by the
+// edits between the compiled versions.
+type Analyzer struct {
+	// Scoring replaces the scoring table if it is not nil
+	Scoring *ScoringTable
+	// Compatibility reproduces the scores of earlier versions, which
+	// treated every error as the same type and compared the diffs between
+	// the versions instead of the error locations
+	Compatibility bool
 }
 
-type Analyzer struct {
-	ErrorsByParticipant map[string]ErrorQuotientAnalysisResult
+func (e *Analyzer) Analyze(writer analyzer.KVWriter, loaders ...analyzer.LoggerLoader) error {
+	return analyzer.AnalyzeStreams(e, writer, loaders...)
 }
 
-func getLastVersionNumberFromIdx(entries []logger.LogEntry, filePath string, idx int) int {
-	for i := idx; i >= 0; i-- {
-		if entries[i].FilePath == filePath && entries[i].FileVersion != 0 {
-			return entries[i].FileVersion
-		}
+func (e *Analyzer) NewStream(log *logger.Logger) analyzer.Stream {
+	// the analyzer may be a nil pointer created with analyzer.New
+	compatibility := e != nil && e.Compatibility
+	table := JadudScoring
+	if compatibility {
+		table = CompatibilityScoring
+	}
+	if e != nil && e.Scoring != nil {
+		table = *e.Scoring
+	}
+
+	return &stream{
+		log:           log,
+		table:         table,
+		compatibility: compatibility,
+		files:         map[string]*internal.ResultStore[*fileStream]{},
 	}
-	return 0
 }
 
-func (e *Analyzer) Analyze(writer analyzer.KVWriter, loaders ...analyzer.LoggerLoader) error {
-	results := map[string]ErrorQuotientAnalysisResult{}
+// fileStream compares each compilation of a file with the previous one
+type fileStream struct {
+	participantId string
+	filePath      string
 
-	for _, loader := range loaders {
-		// Read the log file in a goroutine
-		log, err := loader()
-		if err != nil {
-			continue
-		}
+	// lastVersion is the last version number logged for the file. Entries
+	// of files with a similar name may have no version number.
+	lastVersion int
 
-		// map[participantId]map[filePath][]logEntry
-		logEntries := map[string]*internal.ResultStore[[]logger.LogEntry]{}
+	// previous is the last compilation of the file
+	previous *logger.LogEntry
+	// previousLastVersion is the lastVersion when previous was logged
+	previousLastVersion int
 
-		// Get all the iter from the logger
-		iter, err := log.Entries()
-		if err != nil {
-			continue
-		}
+	// previousVersion, previousContent and previousEditLocation are the
+	// version, the content and the first edited line of previous
+	previousVersion      int
+	previousContent      *string
+	previousEditLocation int
 
-		// Count the number of times each error occurred
-		for iter.Next() {
-			entry, err := iter.Value()
-			if err != nil {
-				// break the loop if sql no rows error
-				if err.Error() == "sql: no rows in result set" {
-					break
-				}
+	// previousEvent is the last event in compatibility mode
+	previousEvent *CompilationEvent
 
-				continue
-			}
+	// score is the sum of the normalized scores of the pairs
+	score float64
+	pairs int
+}
 
-			// Skip if the error message is "file not found". This is not the programmers fault.
-			if strings.Contains(entry.ErrorMessage, "error: file not found:") {
-				continue
-			}
+func (f *fileStream) addPair(table ScoringTable, pair PairComparison) {
+	if table.Normalizer != 0 {
+		f.score += float64(table.Score(pair)) / table.Normalizer
+	}
+	f.pairs++
+}
 
-			participantId := entry.ParticipantId
-			if _, ok := logEntries[participantId]; !ok {
-				logEntries[participantId] = internal.NewResultStore[[]logger.LogEntry]()
-			}
+func (f *fileStream) errorQuotient() float64 {
+	if f.pairs == 0 {
+		return 0
+	}
+	return f.score / float64(f.pairs)
+}
+
+// content returns the content of the version. The content is nil if the
+// version is not stored.
+func (f *fileStream) content(log *logger.Logger, version int) *string {
+	if version == f.previousVersion && f.previous != nil {
+		return f.previousContent
+	} else if version <= 0 {
+		return nil
+	}
 
-			filePath := logEntries[participantId].FilenameNearest(entry.FilePath)
-			existing := logEntries[participantId].GetOr(filePath, []logger.LogEntry{})
-			logEntries[participantId].Set(filePath, append(existing, entry))
+	raw, err := log.OpenVersionedFileFromPID(f.participantId, f.filePath, version)
+	if err != nil {
+		return nil
+	}
+
+	content := string(raw)
+	return &content
+}
+
+// compare compares the compilation with the previous one using their real
+// error types and locations
+func (f *fileStream) compare(log *logger.Logger, table ScoringTable, entry logger.LogEntry) {
+	version := entry.FileVersion
+	if version == 0 {
+		version = f.lastVersion
+	}
+
+	content := f.content(log, version)
+
+	// the first line changed before the compilation
+	editLocation := 0
+	if f.previous != nil && f.previousContent != nil && content != nil {
+		editLocation = EditLocation(*f.previousContent, *content)
+	}
+
+	if f.previous != nil {
+		isError1, isError2 := f.previous.ErrorCode != 0, entry.ErrorCode != 0
+
+		pair := PairComparison{
+			BothErrors: isError1 && isError2,
+			OneError:   isError1 != isError2,
 		}
 
-		for participantId, logEntries := range logEntries {
-			// map[filePath][]CompilationEvent
-			compilationEvents := internal.NewResultStore[[]CompilationEvent]()
-
-			for filePathIdx, entries := range logEntries.Values {
-				filePath := logEntries.FilenameNearest(logEntries.Filenames[filePathIdx])
-
-				for i := 0; i < len(entries)-1; i++ {
-					entry1 := entries[i]
-
-					// Because the filePath uses the nearestFilename, some entries may have the wrong version number
-					// because the original file path is not found in the logEntries.
-					if entry1.FileVersion == 0 {
-						entry1.FileVersion = getLastVersionNumberFromIdx(entries, filePath, i)
-					}
-
-					entry2 := entries[i+1]
-
-					// Same as above, but for the second entry
-					if entry2.FileVersion == 0 {
-						if entry1.FileVersion != 0 {
-							entry2.FileVersion = entry1.FileVersion
-						} else {
-							entry2.FileVersion = getLastVersionNumberFromIdx(entries, filePath, i+1)
-						}
-					}
-
-					// Calculate CharDelta between file versions
-					charDelta, location, err := CalculateCharDeltaAndLocation(log, filePath, entry1, entry2)
-					if err != nil {
-						// TODO: replace it with proper error handling
-						fmt.Printf("Error calculating char delta: %v\n", err)
-						continue
-					}
-
-					compilationEvent := CompilationEvent{
-						ErrorType: ErrorTypeConversion(entry1.ErrorCode),
-						TimeDelta: int(entry2.CreatedAt.Time.Sub(entry1.CreatedAt.Time).Seconds()),
-						CharDelta: charDelta,
-						Location:  location,
-					}
-
-					compilationEvents.Set(
-						filePath,
-						append(
-							compilationEvents.GetOr(filePath, []CompilationEvent{}),
-							compilationEvent))
-				}
-			}
+		if pair.BothErrors {
+			pair.SameErrorType = analyzer.ErrorTypeCategory(f.previous.ErrorType) == analyzer.ErrorTypeCategory(entry.ErrorType)
 
-			// store the compilation events
-			results[participantId] = ErrorQuotientAnalysisResult{
-				compilationEvents: compilationEvents,
+			// follow the line of the first error through the edits
+			line := f.previous.ErrorLine
+			if f.previousVersion != version {
+				line = 0
+				if f.previousContent != nil && content != nil {
+					line = MapLine(*f.previousContent, *content, f.previous.ErrorLine)
+				}
 			}
+			pair.SameLocation = line > 0 && line == entry.ErrorLine
+			pair.SameEditLocation = f.previousEditLocation > 0 && f.previousEditLocation == editLocation
 		}
+
+		f.addPair(table, pair)
+	}
+
+	f.previousVersion = version
+	f.previousContent = content
+	f.previousEditLocation = editLocation
+}
+
+// compareCompatible compares the compilations the way earlier versions
+// did. Each pair of compilations is an event, and the events are compared
+// with each other.
+func (f *fileStream) compareCompatible(log *logger.Logger, table ScoringTable, entry logger.LogEntry) {
+	if f.previous == nil {
+		return
+	}
+
+	// Because the filePath uses the nearestFilename, some entries may have the wrong version number
+	// because the original file path is not found in the logEntries.
+	entry1 := *f.previous
+	if entry1.FileVersion == 0 {
+		entry1.FileVersion = f.previousLastVersion
 	}
 
-	for participantId, result := range results {
-		for filePathIdx, events := range result.compilationEvents.Values {
-			filePath := result.compilationEvents.Filenames[filePathIdx]
-			writer.Write(KEY, participantId, filePath, calculateEQ(events))
+	// Same as above, but for the second entry
+	entry2 := entry
+	if entry2.FileVersion == 0 {
+		if entry1.FileVersion != 0 {
+			entry2.FileVersion = entry1.FileVersion
+		} else {
+			entry2.FileVersion = f.lastVersion
 		}
 	}
 
+	// Calculate CharDelta between file versions
+	charDelta, location, err := CalculateCharDeltaAndLocation(log, f.filePath, entry1, entry2)
+	if err != nil {
+		// TODO: replace it with proper error handling
+		fmt.Printf("Error calculating char delta: %v\n", err)
+		return
+	}
+
+	event := CompilationEvent{
+		ErrorType: ErrorTypeConversion(entry1.ErrorCode),
+		TimeDelta: int(entry2.CreatedAt.Time.Sub(entry1.CreatedAt.Time).Seconds()),
+		CharDelta: charDelta,
+		Location:  location,
+	}
+
+	if f.previousEvent != nil {
+		f.addPair(table, compareEventPair(*f.previousEvent, event))
+	}
+	f.previousEvent = &event
+}
+
+type stream struct {
+	log           *logger.Logger
+	table         ScoringTable
+	compatibility bool
+
+	// map[participantId]map[filePath]*fileStream
+	files map[string]*internal.ResultStore[*fileStream]
+	// participantIds keeps the order in which the participants were found
+	participantIds []string
+}
+
+func (s *stream) Add(entry logger.LogEntry) error {
+	// Skip if the error message is "file not found". This is not the programmers fault.
+	if strings.Contains(entry.ErrorMessage, "error: file not found:") {
+		return nil
+	}
+
+	participantId := entry.ParticipantId
+	if _, ok := s.files[participantId]; !ok {
+		s.files[participantId] = internal.NewResultStore[*fileStream]()
+		s.participantIds = append(s.participantIds, participantId)
+	}
+
+	// the entries of files with similar names are compared with each other
+	filePath := s.files[participantId].FilenameNearest(entry.FilePath)
+	file := s.files[participantId].GetOr(filePath, nil)
+	if file == nil {
+		file = &fileStream{participantId: participantId, filePath: filePath}
+		s.files[participantId].Set(filePath, file)
+	}
+
+	if entry.FilePath == file.filePath && entry.FileVersion != 0 {
+		file.lastVersion = entry.FileVersion
+	}
+
+	if s.compatibility {
+		file.compareCompatible(s.log, s.table, entry)
+	} else {
+		file.compare(s.log, s.table, entry)
+	}
+
+	file.previous = &entry
+	file.previousLastVersion = file.lastVersion
+	return nil
+}
+
+func (s *stream) Close(writer analyzer.KVWriter) error {
+	for _, participantId := range s.participantIds {
+		files := s.files[participantId]
+		for filePathIdx, filePath := range files.Filenames {
+			writer.Write(KEY, participantId, filePath, files.Values[filePathIdx].errorQuotient())
+		}
+	}
 	return nil
 }
@@ -1,7 +1,9 @@
 package errorquotient_test
 
 import (
+	"math"
 	"testing"
+	"time"
 
 	"github.com/nedpals/bugbuddy/server/logger"
 	"github.com/nedpals/bugbuddy/server/logger/analyzer"
@@ -13,6 +15,8 @@ func TestErrorQuotientAnalyzer(t *testing.T) {
 	log, err := logger.NewMemoryLogger()
 	if err != nil {
 		t.Fatal(err)
+	} else if err := log.SetConsent(logger.CollectionFull, ""); err != nil {
+		t.Fatal(err)
 	}
 
 	participantId := log.ParticipantId()
@@ -70,8 +74,9 @@ func TestErrorQuotientAnalyzer(t *testing.T) {
 		t.Fatalf("Expected %d entries, got %d", len(mockEvents), len(entries))
 	}
 
-	// Create a new ErrorQuotientAnalyzer
-	eqa := analyzer.New[*errorquotient.Analyzer]()
+	// Create a new ErrorQuotientAnalyzer which scores the pairs like
+	// the earlier versions
+	eqa := &errorquotient.Analyzer{Compatibility: true}
 	logg := analyzer.LoadFromExistingLogger(log)
 	kvs := analyzer.NewDefaultKV()
 
@@ -100,3 +105,132 @@ func TestErrorQuotientAnalyzer(t *testing.T) {
 		t.Errorf("Expected EQ of %f for participant %s and file %s, but got %f", expectedEQ, participantId, filePath, eq)
 	}
 }
+
+type mockCompilation struct {
+	content   string
+	errorType string
+	line      int
+}
+
+func newMockLogger(t *testing.T, filePath string, compilations []mockCompilation) *logger.Logger {
+	t.Helper()
+
+	log, err := logger.NewMemoryLogger()
+	if err != nil {
+		t.Fatal(err)
+	} else if err := log.SetConsent(logger.CollectionFull, ""); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { log.Close() })
+
+	start := time.Date(2024, 2, 12, 9, 0, 0, 0, time.UTC)
+	for i, c := range compilations {
+		if err := log.WriteVersionedFile(filePath, []byte(c.content), i+1); err != nil {
+			t.Fatal(err)
+		}
+
+		entry := logger.LogEntry{
+			FilePath:    filePath,
+			FileVersion: i + 1,
+			ErrorType:   c.errorType,
+			ErrorLine:   c.line,
+			CreatedAt:   &logger.NullTime{Time: start.Add(time.Duration(i) * time.Minute), Valid: true},
+		}
+		if len(c.errorType) != 0 {
+			entry.ErrorCode = 1
+		}
+
+		if err := log.Log(entry); err != nil {
+			t.Fatalf("Failed to log compilation event: %v", err)
+		}
+	}
+	return log
+}
+
+func TestErrorQuotientAnalyzer_Jadud(t *testing.T) {
+	filePath := "/path/to/main.py"
+	log := newMockLogger(t, filePath, []mockCompilation{
+		{content: "x = 1\nprint(y)", errorType: "NameError", line: 2},
+		{content: "# comment\nx = 1\nprint(y)", errorType: "NameError", line: 3},
+		{content: "# comment\nx = 1\nprint(x", errorType: "SyntaxError", line: 3},
+		{content: "# comment\nx = 1\nprint(x))", errorType: "SyntaxError", line: 3},
+		{content: "# comment\nx = 1\nprint(x)"},
+	})
+
+	kvs := analyzer.NewDefaultKV()
+	if err := analyzer.New[*errorquotient.Analyzer]().Analyze(kvs, analyzer.LoadFromExistingLogger(log)); err != nil {
+		t.Fatalf("EQ analysis failed: %v", err)
+	}
+
+	// - the NameError is moved to line 3 by the comment: 2 + 3 + 3 = 8
+	// - the NameError is replaced by a SyntaxError on the edited line: 2 + 3 = 5
+	// - the SyntaxError stays on the line which was edited again: 2 + 3 + 3 + 1 = 9
+	// - the program compiles: 0
+	// eq = (8/9 + 5/9 + 9/9 + 0/9) / 4 = 11/18
+	expectedEQ := 11.0 / 18.0
+	if eq, ok := kvs[errorquotient.KEY][log.ParticipantId()][filePath].(float64); !ok || math.Abs(eq-expectedEQ) > 1e-9 {
+		t.Errorf("Expected EQ of %f, but got %v", expectedEQ, kvs[errorquotient.KEY][log.ParticipantId()][filePath])
+	}
+
+	// the same compilations with the scores of the earlier versions
+	kvs = analyzer.NewDefaultKV()
+	eqa := &errorquotient.Analyzer{Compatibility: true}
+	if err := eqa.Analyze(kvs, analyzer.LoadFromExistingLogger(log)); err != nil {
+		t.Fatalf("EQ analysis failed: %v", err)
+	}
+
+	// the last compilation is not paired, so there are three events left
+	// which are all errors on different diffs: (5/9 + 5/9) / 2
+	expectedEQ = 5.0 / 9.0
+	if eq, ok := kvs[errorquotient.KEY][log.ParticipantId()][filePath].(float64); !ok || math.Abs(eq-expectedEQ) > 1e-9 {
+		t.Errorf("Expected compatible EQ of %f, but got %v", expectedEQ, kvs[errorquotient.KEY][log.ParticipantId()][filePath])
+	}
+}
+
+func TestErrorQuotientAnalyzer_Scoring(t *testing.T) {
+	filePath := "/path/to/Main.java"
+	log := newMockLogger(t, filePath, []mockCompilation{
+		{content: "class Main {", errorType: "ParseError", line: 1},
+		{content: "class Main {}"},
+		{content: "class Main { int x = y; }", errorType: "SymbolNotFoundError", line: 1},
+	})
+
+	// only count the pairs with one error
+	scoring := errorquotient.ScoringTable{OneError: 1, Normalizer: 1}
+	eqa := &errorquotient.Analyzer{Scoring: &scoring}
+
+	kvs := analyzer.NewDefaultKV()
+	if err := eqa.Analyze(kvs, analyzer.LoadFromExistingLogger(log)); err != nil {
+		t.Fatalf("EQ analysis failed: %v", err)
+	}
+
+	if eq := kvs[errorquotient.KEY][log.ParticipantId()][filePath]; eq != 1.0 {
+		t.Errorf("Expected EQ of 1, but got %v", eq)
+	}
+}
+
+func TestMapLine(t *testing.T) {
+	oldContent := "a\nb\nc\nd"
+	newContent := "z\na\nc\nd!"
+
+	for _, tc := range []struct {
+		line     int
+		expected int
+	}{
+		{line: 1, expected: 2},
+		// the line was removed
+		{line: 2, expected: 0},
+		{line: 3, expected: 3},
+		// the line was edited in place
+		{line: 4, expected: 4},
+		{line: 5, expected: 0},
+	} {
+		if line := errorquotient.MapLine(oldContent, newContent, tc.line); line != tc.expected {
+			t.Errorf("Expected line %d to be moved to line %d, but got %d", tc.line, tc.expected, line)
+		}
+	}
+
+	if line := errorquotient.EditLocation(oldContent, newContent); line != 1 {
+		t.Errorf("Expected the first edit on line 1, but got %d", line)
+	}
+}
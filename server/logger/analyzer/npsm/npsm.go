@@ -0,0 +1,224 @@
+package npsm
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nedpals/bugbuddy/server/logger"
+	"github.com/nedpals/bugbuddy/server/logger/analyzer"
+	errorquotient "github.com/nedpals/bugbuddy/server/logger/analyzer/error_quotient"
+)
+
+const (
+	KEY = "npsm"
+	// TRANSITIONS_KEY is the key of the state transition matrices
+	TRANSITIONS_KEY = "npsm_transitions"
+)
+
+// State is a state of the Normalized Programming State Model (Carter,
+// Hundhausen and Adesope, 2015). Each interval between two runs of a file
+// is classified by:
+//
+//   - the activity: Editing if the file was changed before the next run,
+//     or Debugging if it was run again without changes.
+//   - the correctness which is being worked on: Syntax if the program did
+//     not compile or parse, or Semantic if it got past the syntax check.
+//   - whether the participant knows the state of the program: Known if the
+//     run reported an error, or Unknown if it succeeded (the semantics of
+//     the program are not established) or failed without a recognized error.
+type State string
+
+const (
+	EditingSyntaxUnknown     State = "Editing-Syntax-Unknown"
+	EditingSyntaxKnown       State = "Editing-Syntax-Known"
+	EditingSemanticUnknown   State = "Editing-Semantic-Unknown"
+	EditingSemanticKnown     State = "Editing-Semantic-Known"
+	DebuggingSyntaxUnknown   State = "Debugging-Syntax-Unknown"
+	DebuggingSyntaxKnown     State = "Debugging-Syntax-Known"
+	DebuggingSemanticUnknown State = "Debugging-Semantic-Unknown"
+	DebuggingSemanticKnown   State = "Debugging-Semantic-Known"
+)
+
+// States lists the states in a stable order for reports
+var States = []State{
+	EditingSyntaxUnknown,
+	EditingSyntaxKnown,
+	EditingSemanticUnknown,
+	EditingSemanticKnown,
+	DebuggingSyntaxUnknown,
+	DebuggingSyntaxKnown,
+	DebuggingSemanticUnknown,
+	DebuggingSemanticKnown,
+}
+
+func init() {
+	columns := make([]string, len(States))
+	for i, state := range States {
+		columns[i] = string(state)
+	}
+
+	analyzer.Register(analyzer.Registration{
+		Name:        "npsm",
+		DisplayName: "NPSM",
+		Metrics: []analyzer.Metric{
+			{Key: KEY, DisplayName: "NPSM", Type: analyzer.DurationValue, Columns: columns},
+		},
+		New: func() analyzer.LoggerAnalyzer { return &Analyzer{} },
+	})
+}
+
+// StateDurations is the time spent in each state
+type StateDurations map[State]time.Duration
+
+// ColumnValue returns the time spent in the state
+func (d StateDurations) ColumnValue(column string) any {
+	return d[State(column)]
+}
+
+// Transitions counts the transitions from a state to the next state
+type Transitions map[State]map[State]int
+
+// pythonSyntaxErrors are the errors Python reports before running the program
+var pythonSyntaxErrors = map[string]bool{
+	"SyntaxError":      true,
+	"IndentationError": true,
+	"TabError":         true,
+}
+
+// IsSyntaxError checks if the error of the entry was reported before the
+// program ran. Python only reports its syntax errors before running, while
+// the errors of compiled languages are compile errors unless they are
+// exceptions. Compilations imported from other datasets are always compile
+// errors.
+func IsSyntaxError(entry logger.LogEntry) bool {
+	if entry.ExecutedCommand == "Compile" {
+		return true
+	} else if pythonSyntaxErrors[entry.ErrorType] {
+		return true
+	} else if filepath.Ext(entry.FilePath) == ".py" {
+		return false
+	}
+	return !strings.HasSuffix(entry.ErrorType, "Exception") && entry.ErrorType != "RuntimeError"
+}
+
+// Classify returns the state of the interval which starts with the run.
+// edited tells if the file was changed before the next run.
+func Classify(run logger.LogEntry, edited bool) State {
+	activity := "Debugging"
+	if edited {
+		activity = "Editing"
+	}
+
+	correctness, knowledge := "Semantic", "Unknown"
+	if run.ErrorCode != 0 {
+		if len(run.ErrorType) == 0 || run.ErrorType == "UnknownError" {
+			// even the syntax of the program is not known to be correct
+			correctness = "Syntax"
+		} else {
+			knowledge = "Known"
+			if IsSyntaxError(run) {
+				correctness = "Syntax"
+			}
+		}
+	}
+
+	return State(activity + "-" + correctness + "-" + knowledge)
+}
+
+// fileKey identifies the runs of a file of a participant
+type fileKey struct {
+	participantId string
+	filePath      string
+}
+
+// Analyzer computes the time each participant spent in each state for each
+// file. The state transition matrices are written as well if Transitions
+// is true.
+type Analyzer struct {
+	Transitions bool
+}
+
+func (a *Analyzer) Analyze(writer analyzer.KVWriter, loaders ...analyzer.LoggerLoader) error {
+	return analyzer.AnalyzeStreams(a, writer, loaders...)
+}
+
+func (a *Analyzer) NewStream(log *logger.Logger) analyzer.Stream {
+	return &stream{
+		log:             log,
+		withTransitions: a != nil && a.Transitions,
+		files:           map[fileKey]*fileStates{},
+	}
+}
+
+// fileStates are the states of a file so far
+type fileStates struct {
+	// previousRun is the last run of the file. The state which starts with
+	// it is known once the next run of the file is found.
+	previousRun   logger.LogEntry
+	previousState State
+	durations     StateDurations
+	transitions   Transitions
+}
+
+type stream struct {
+	log             *logger.Logger
+	withTransitions bool
+
+	files map[fileKey]*fileStates
+	// keys keeps the order in which the files were found
+	keys []fileKey
+}
+
+func (s *stream) Add(entry logger.LogEntry) error {
+	// skip if the error message is "file not found". This is not the programmers fault.
+	if strings.Contains(entry.ErrorMessage, "error: file not found:") {
+		return nil
+	}
+
+	key := fileKey{participantId: entry.ParticipantId, filePath: entry.FilePath}
+	file, ok := s.files[key]
+	if !ok {
+		s.files[key] = &fileStates{
+			previousRun: entry,
+			durations:   StateDurations{},
+			transitions: Transitions{},
+		}
+		s.keys = append(s.keys, key)
+		return nil
+	}
+
+	start, next := file.previousRun, entry
+
+	// the same version has no changes, so its contents are not compared
+	edited := start.FileVersion != next.FileVersion
+	if edited {
+		if charDelta, _, err := errorquotient.CalculateCharDeltaAndLocation(s.log, key.filePath, start, next); err == nil {
+			edited = charDelta > 0
+		}
+	}
+
+	state := Classify(start, edited)
+	file.durations[state] += next.CreatedAt.Time.Sub(start.CreatedAt.Time)
+
+	if len(file.previousState) != 0 {
+		if _, ok := file.transitions[file.previousState]; !ok {
+			file.transitions[file.previousState] = map[State]int{}
+		}
+		file.transitions[file.previousState][state]++
+	}
+
+	file.previousState = state
+	file.previousRun = next
+	return nil
+}
+
+func (s *stream) Close(writer analyzer.KVWriter) error {
+	for _, key := range s.keys {
+		writer.Write(KEY, key.participantId, key.filePath, s.files[key].durations)
+		if s.withTransitions {
+			writer.Write(TRANSITIONS_KEY, key.participantId, key.filePath, s.files[key].transitions)
+		}
+	}
+	return nil
+}
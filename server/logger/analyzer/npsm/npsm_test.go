@@ -0,0 +1,137 @@
+package npsm_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nedpals/bugbuddy/server/logger"
+	"github.com/nedpals/bugbuddy/server/logger/analyzer"
+	"github.com/nedpals/bugbuddy/server/logger/analyzer/npsm"
+)
+
+func TestNPSMAnalyzer(t *testing.T) {
+	log, err := logger.NewMemoryLogger()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+
+	participantId := log.ParticipantId()
+	filePath := "/path/to/main.py"
+	start := time.Date(2024, 2, 5, 10, 0, 0, 0, time.UTC)
+
+	versions := []string{"print(x", "print(x)", "x = 1\nprint(x)"}
+	for i, content := range versions {
+		if err := log.WriteVersionedFile(filePath, []byte(content), i+1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mockRuns := []struct {
+		errorType   string
+		fileVersion int
+		seconds     int
+	}{
+		{errorType: "SyntaxError", fileVersion: 1, seconds: 0},
+		{errorType: "NameError", fileVersion: 2, seconds: 60},
+		{errorType: "NameError", fileVersion: 2, seconds: 90},
+		{fileVersion: 3, seconds: 150},
+		{fileVersion: 3, seconds: 200},
+	}
+
+	for _, run := range mockRuns {
+		entry := logger.LogEntry{
+			ErrorType:   run.errorType,
+			FilePath:    filePath,
+			FileVersion: run.fileVersion,
+			CreatedAt:   &logger.NullTime{Time: start.Add(time.Duration(run.seconds) * time.Second), Valid: true},
+		}
+		if len(run.errorType) != 0 {
+			entry.ErrorCode = 1
+		}
+
+		if err := log.Log(entry); err != nil {
+			t.Fatalf("Failed to log run: %v", err)
+		}
+	}
+
+	kvs := analyzer.NewDefaultKV()
+	na := &npsm.Analyzer{Transitions: true}
+	if err := na.Analyze(kvs, analyzer.LoadFromExistingLogger(log)); err != nil {
+		t.Fatalf("NPSM analysis failed: %v", err)
+	}
+
+	durations, ok := kvs[npsm.KEY][participantId][filePath].(npsm.StateDurations)
+	if !ok {
+		t.Fatal("No NPSM durations found")
+	}
+
+	// - the syntax error is fixed in 60 seconds
+	// - the NameError is run again without changes for 30 seconds
+	// - the NameError is fixed in 60 seconds
+	// - the working program is run again after 50 seconds
+	expected := npsm.StateDurations{
+		npsm.EditingSyntaxKnown:       60 * time.Second,
+		npsm.DebuggingSemanticKnown:   30 * time.Second,
+		npsm.EditingSemanticKnown:     60 * time.Second,
+		npsm.DebuggingSemanticUnknown: 50 * time.Second,
+	}
+
+	for _, state := range npsm.States {
+		if durations[state] != expected[state] {
+			t.Errorf("Expected %s to take %s, but got %s", state, expected[state], durations[state])
+		}
+	}
+
+	transitions, ok := kvs[npsm.TRANSITIONS_KEY][participantId][filePath].(npsm.Transitions)
+	if !ok {
+		t.Fatal("No NPSM transitions found")
+	}
+
+	if transitions[npsm.EditingSyntaxKnown][npsm.DebuggingSemanticKnown] != 1 ||
+		transitions[npsm.DebuggingSemanticKnown][npsm.EditingSemanticKnown] != 1 ||
+		transitions[npsm.EditingSemanticKnown][npsm.DebuggingSemanticUnknown] != 1 ||
+		len(transitions) != 3 {
+		t.Errorf("Unexpected transitions %v", transitions)
+	}
+}
+
+func TestNPSMAnalyzer_WithoutTransitions(t *testing.T) {
+	log := logger.NewMemoryLoggerPanic()
+	defer log.Close()
+
+	for i := 0; i < 2; i++ {
+		if err := log.Log(logger.LogEntry{ErrorCode: 1, FilePath: "Main.java"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	kvs := analyzer.NewDefaultKV()
+	if err := analyzer.New[*npsm.Analyzer]().Analyze(kvs, analyzer.LoadFromExistingLogger(log)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := kvs[npsm.TRANSITIONS_KEY]; ok {
+		t.Error("Expected no transitions to be written")
+	} else if _, ok := kvs[npsm.KEY][log.ParticipantId()]["Main.java"]; !ok {
+		t.Error("Expected the durations to be written")
+	}
+}
+
+func TestClassify(t *testing.T) {
+	for _, tc := range []struct {
+		entry    logger.LogEntry
+		edited   bool
+		expected npsm.State
+	}{
+		{logger.LogEntry{ErrorCode: 1, ErrorType: "MissingReturnError", FilePath: "Main.java"}, true, npsm.EditingSyntaxKnown},
+		{logger.LogEntry{ErrorCode: 1, ErrorType: "NullPointerException", FilePath: "Main.java"}, false, npsm.DebuggingSemanticKnown},
+		{logger.LogEntry{ErrorCode: 1, ErrorType: "IndentationError", FilePath: "main.py"}, false, npsm.DebuggingSyntaxKnown},
+		{logger.LogEntry{ErrorCode: 1, FilePath: "main.py"}, true, npsm.EditingSyntaxUnknown},
+		{logger.LogEntry{FilePath: "main.py"}, true, npsm.EditingSemanticUnknown},
+	} {
+		if state := npsm.Classify(tc.entry, tc.edited); state != tc.expected {
+			t.Errorf("Expected %+v to be %s, but got %s", tc.entry, tc.expected, state)
+		}
+	}
+}
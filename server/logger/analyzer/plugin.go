@@ -0,0 +1,230 @@
+package analyzer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/nedpals/bugbuddy/server/logger"
+	"github.com/nedpals/bugbuddy/server/logger/export"
+)
+
+// Plugin is an analyzer which runs in an external process, so that
+// analyzers can be written in any language. The process is started with
+// the command, its arguments and one of the following subcommands:
+//
+//   - describe: the plugin prints its Registration as JSON to stdout.
+//   - analyze: the plugin reads the entries of a log as JSON lines from
+//     stdin, in the format of the jsonl export and in the order of
+//     logger.AllEntries, until stdin is closed. It writes its results as
+//     JSON lines (PluginResult) to stdout.
+//
+// A new process is started for each log. The plugin fails if the process
+// exits with a non-zero status.
+type Plugin struct {
+	Command string
+	Args    []string
+	// Metrics converts the values of the results to the types of the metrics
+	Metrics []Metric
+}
+
+// PluginResult is a value written by a plugin. Values of duration metrics
+// are written in seconds. The value is broken down by error type if
+// ErrorType is set.
+type PluginResult struct {
+	Key           string  `json:"key"`
+	ParticipantId string  `json:"participant_id"`
+	FilePath      string  `json:"file_path"`
+	ErrorType     string  `json:"error_type,omitempty"`
+	Value         float64 `json:"value"`
+}
+
+// LoadPlugin describes the plugin and returns its registration
+func LoadPlugin(command string, args ...string) (Registration, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(command, append(args, "describe")...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return Registration{}, pluginError(command, err, stderr.String())
+	}
+
+	var r Registration
+	if err := json.Unmarshal(stdout.Bytes(), &r); err != nil {
+		return Registration{}, fmt.Errorf("plugin %s: invalid description: %w", command, err)
+	} else if len(r.Name) == 0 {
+		return Registration{}, fmt.Errorf("plugin %s: the description has no name", command)
+	}
+
+	for _, metric := range r.Metrics {
+		switch metric.Type {
+		case FloatValue, DurationValue, CountValue:
+		default:
+			return Registration{}, fmt.Errorf("plugin %s: unsupported type %q of metric %s", command, metric.Type, metric.Key)
+		}
+	}
+
+	if len(r.DisplayName) == 0 {
+		r.DisplayName = r.Name
+	}
+
+	r.New = func() LoggerAnalyzer {
+		return &Plugin{Command: command, Args: args, Metrics: r.Metrics}
+	}
+	return r, nil
+}
+
+func pluginError(command string, err error, stderr string) error {
+	if stderr = strings.TrimSpace(stderr); len(stderr) != 0 {
+		return fmt.Errorf("plugin %s: %w: %s", command, err, stderr)
+	}
+	return fmt.Errorf("plugin %s: %w", command, err)
+}
+
+func (p *Plugin) Analyze(writer KVWriter, loaders ...LoggerLoader) error {
+	return AnalyzeStreams(p, writer, loaders...)
+}
+
+func (p *Plugin) NewStream(log *logger.Logger) Stream {
+	s := &pluginStream{plugin: p, done: make(chan struct{})}
+
+	s.cmd = exec.Command(p.Command, append(p.Args, "analyze")...)
+	s.cmd.Stderr = &s.stderr
+
+	stdin, err := s.cmd.StdinPipe()
+	if err != nil {
+		s.err = err
+		return s
+	}
+
+	stdout, err := s.cmd.StdoutPipe()
+	if err != nil {
+		stdin.Close()
+		s.err = err
+		return s
+	}
+
+	if err := s.cmd.Start(); err != nil {
+		s.err = pluginError(p.Command, err, "")
+		return s
+	}
+
+	s.stdin = stdin
+	s.input = bufio.NewWriter(stdin)
+	s.encoder = json.NewEncoder(s.input)
+
+	// the results are read while the entries are written so that the
+	// plugin does not block on a full stdout
+	go s.readResults(stdout)
+	return s
+}
+
+type pluginStream struct {
+	plugin *Plugin
+	cmd    *exec.Cmd
+	stderr bytes.Buffer
+
+	stdin   io.WriteCloser
+	input   *bufio.Writer
+	encoder *json.Encoder
+
+	// results and readErr are set before done is closed
+	done    chan struct{}
+	results []PluginResult
+	readErr error
+
+	err error
+}
+
+func (s *pluginStream) readResults(stdout io.Reader) {
+	defer close(s.done)
+
+	decoder := json.NewDecoder(stdout)
+	for {
+		var result PluginResult
+		if err := decoder.Decode(&result); err == io.EOF {
+			return
+		} else if err != nil {
+			s.readErr = fmt.Errorf("plugin %s: invalid result: %w", s.plugin.Command, err)
+			// drain the output so that the process can exit
+			io.Copy(io.Discard, stdout)
+			return
+		}
+		s.results = append(s.results, result)
+	}
+}
+
+func (s *pluginStream) Add(entry logger.LogEntry) error {
+	if s.err != nil {
+		return s.err
+	}
+
+	if err := s.encoder.Encode(export.NewEntry(entry)); err != nil {
+		s.err = s.wait(err)
+	}
+	return s.err
+}
+
+// wait stops the process and returns the first error of the stream
+func (s *pluginStream) wait(err error) error {
+	if closeErr := s.stdin.Close(); err == nil {
+		err = closeErr
+	}
+
+	<-s.done
+	if waitErr := s.cmd.Wait(); waitErr != nil {
+		return pluginError(s.plugin.Command, waitErr, s.stderr.String())
+	} else if err != nil {
+		return pluginError(s.plugin.Command, err, s.stderr.String())
+	}
+	return s.readErr
+}
+
+func (s *pluginStream) Close(writer KVWriter) error {
+	if s.err != nil {
+		return s.err
+	}
+
+	if err := s.wait(s.input.Flush()); err != nil {
+		return err
+	}
+
+	for _, result := range s.results {
+		value, err := s.plugin.value(result)
+		if err != nil {
+			return err
+		}
+
+		if len(result.ErrorType) != 0 {
+			WriteDimension(writer, result.Key, result.ParticipantId, result.FilePath, ErrorTypeDimension, result.ErrorType, value)
+		} else {
+			writer.Write(result.Key, result.ParticipantId, result.FilePath, value)
+		}
+	}
+	return nil
+}
+
+// value converts the value of the result to the type of its metric
+func (p *Plugin) value(result PluginResult) (any, error) {
+	for _, metric := range p.Metrics {
+		if metric.Key != result.Key {
+			continue
+		}
+
+		switch metric.Type {
+		case DurationValue:
+			return time.Duration(result.Value * float64(time.Second)), nil
+		case CountValue:
+			return int(result.Value), nil
+		default:
+			return result.Value, nil
+		}
+	}
+	return nil, fmt.Errorf("plugin %s: unknown metric %s", p.Command, result.Key)
+}
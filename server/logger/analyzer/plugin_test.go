@@ -0,0 +1,190 @@
+package analyzer_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nedpals/bugbuddy/server/logger"
+	"github.com/nedpals/bugbuddy/server/logger/analyzer"
+	"github.com/nedpals/bugbuddy/server/logger/export"
+)
+
+// pluginEnv makes the test binary act as a plugin
+const pluginEnv = "BUGBUDDY_TEST_PLUGIN"
+
+func TestMain(m *testing.M) {
+	if mode := os.Getenv(pluginEnv); len(mode) != 0 {
+		if err := runTestPlugin(mode, os.Args[len(os.Args)-1]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	os.Exit(m.Run())
+}
+
+// runTestPlugin counts the runs of each file and the time between the
+// first and the last run
+func runTestPlugin(mode string, subcommand string) error {
+	if subcommand == "describe" {
+		return json.NewEncoder(os.Stdout).Encode(analyzer.Registration{
+			Name: "runs",
+			Metrics: []analyzer.Metric{
+				{Key: "runs", DisplayName: "Runs", Type: analyzer.CountValue, ByErrorType: true},
+				{Key: "span", DisplayName: "Span", Type: analyzer.DurationValue},
+			},
+		})
+	} else if mode == "fail" {
+		return fmt.Errorf("something went wrong")
+	}
+
+	type file struct {
+		participantId, filePath string
+	}
+
+	runs := map[file]int{}
+	runsByType := map[file]map[string]int{}
+	first, last := map[file]time.Time{}, map[file]time.Time{}
+	files := []file{}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		var entry export.Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return err
+		}
+
+		createdAt, err := time.Parse(time.RFC3339Nano, entry.CreatedAt)
+		if err != nil {
+			return err
+		}
+
+		key := file{entry.ParticipantId, entry.FilePath}
+		if _, ok := runs[key]; !ok {
+			files = append(files, key)
+			runsByType[key] = map[string]int{}
+			first[key] = createdAt
+		}
+
+		runs[key]++
+		if len(entry.ErrorType) != 0 {
+			runsByType[key][entry.ErrorType]++
+		}
+		last[key] = createdAt
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	for _, key := range files {
+		results := []analyzer.PluginResult{
+			{Key: "runs", ParticipantId: key.participantId, FilePath: key.filePath, Value: float64(runs[key])},
+			{Key: "span", ParticipantId: key.participantId, FilePath: key.filePath, Value: last[key].Sub(first[key]).Seconds()},
+		}
+
+		for errorType, count := range runsByType[key] {
+			results = append(results, analyzer.PluginResult{Key: "runs", ParticipantId: key.participantId, FilePath: key.filePath, ErrorType: errorType, Value: float64(count)})
+		}
+
+		for _, result := range results {
+			if err := encoder.Encode(result); err != nil {
+				return err
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+func TestPlugin(t *testing.T) {
+	t.Setenv(pluginEnv, "ok")
+
+	registration, err := analyzer.LoadPlugin(os.Args[0])
+	if err != nil {
+		t.Fatal(err)
+	} else if registration.Name != "runs" || registration.DisplayName != "runs" || len(registration.Metrics) != 2 {
+		t.Fatalf("Unexpected registration %+v", registration)
+	}
+
+	log := logger.NewMemoryLoggerPanic()
+	defer log.Close()
+
+	start := time.Date(2024, 7, 1, 9, 0, 0, 0, time.UTC)
+	for i, errorType := range []string{"NameError", "NameError", ""} {
+		entry := logger.LogEntry{
+			ErrorType: errorType,
+			FilePath:  "main.py",
+			CreatedAt: &logger.NullTime{Time: start.Add(time.Duration(i) * time.Minute), Valid: true},
+		}
+		if err := log.Log(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	kv := analyzer.NewDefaultKV()
+	if err := registration.New().Analyze(kv, analyzer.LoadFromExistingLogger(log)); err != nil {
+		t.Fatal(err)
+	}
+
+	pId := log.ParticipantId()
+	if runs := kv["runs"][pId]["main.py"]; runs != 3 {
+		t.Errorf("Expected 3 runs, got %v", runs)
+	} else if span := kv["span"][pId]["main.py"]; span != 2*time.Minute {
+		t.Errorf("Expected a span of 2m, got %v", span)
+	}
+
+	if byType, ok := kv[analyzer.DimensionKey("runs", analyzer.ErrorTypeDimension)][pId]["main.py"].(map[string]any); !ok || byType["NameError"] != 2 {
+		t.Errorf("Expected 2 runs with a NameError, got %v", kv[analyzer.DimensionKey("runs", analyzer.ErrorTypeDimension)][pId])
+	}
+}
+
+func TestPlugin_Error(t *testing.T) {
+	t.Setenv(pluginEnv, "fail")
+
+	registration, err := analyzer.LoadPlugin(os.Args[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log := logger.NewMemoryLoggerPanic()
+	defer log.Close()
+
+	if err := log.Log(logger.LogEntry{FilePath: "main.py"}); err != nil {
+		t.Fatal(err)
+	}
+
+	err = registration.New().Analyze(analyzer.NewDefaultKV(), analyzer.LoadFromExistingLogger(log))
+	if err == nil || !strings.Contains(err.Error(), "something went wrong") {
+		t.Errorf("Expected the error of the plugin, got %v", err)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	// the analyzers imported by the tests register themselves
+	for _, name := range []string{"eq", "freq", "npsm", "red", "tts", "watwin"} {
+		registration, ok := analyzer.Lookup(name)
+		if !ok {
+			t.Errorf("Expected %s to be registered", name)
+		} else if len(registration.Metrics) == 0 || registration.New() == nil {
+			t.Errorf("Expected %s to have metrics and an analyzer", name)
+		}
+	}
+
+	registered := analyzer.Registered()
+	for i := 1; i < len(registered); i++ {
+		if registered[i-1].Name > registered[i].Name {
+			t.Fatalf("Expected the registrations to be sorted by name")
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected registering eq twice to panic")
+		}
+	}()
+
+	analyzer.Register(analyzer.Registration{Name: "eq", New: func() analyzer.LoggerAnalyzer { return nil }})
+}
@@ -0,0 +1,96 @@
+package analyzer
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// ValueType is the type of the values of a metric
+type ValueType string
+
+const (
+	// FloatValue metrics write float64 values
+	FloatValue ValueType = "float"
+	// DurationValue metrics write time.Duration values
+	DurationValue ValueType = "duration"
+	// CountValue metrics write int values
+	CountValue ValueType = "count"
+)
+
+// Metric is a value which an analyzer writes for each file of each
+// participant under Key
+type Metric struct {
+	Key         string    `json:"key"`
+	DisplayName string    `json:"display_name"`
+	Type        ValueType `json:"type"`
+	// Columns splits the value into several values of the same type, such
+	// as the time spent in each NPSM state. The values of metrics with
+	// columns implement ColumnValues.
+	Columns []string `json:"columns,omitempty"`
+	// ByErrorType is set if the metric is also written broken down by
+	// error type
+	ByErrorType bool `json:"by_error_type,omitempty"`
+}
+
+// ColumnValues is implemented by the values of metrics with columns
+type ColumnValues interface {
+	ColumnValue(column string) any
+}
+
+// Registration describes an analyzer which can be selected in analyze-log
+type Registration struct {
+	// Name selects the analyzer, such as "eq"
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+	// Metrics are the values written by the analyzer, in the order in
+	// which they are reported
+	Metrics []Metric `json:"metrics"`
+	// New creates the analyzer with its default options
+	New func() LoggerAnalyzer `json:"-"`
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Registration{}
+)
+
+// Register makes the analyzer available under its name. Analyzers usually
+// register themselves in the init function of their package. It panics if
+// the name is already registered.
+func Register(r Registration) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if len(r.Name) == 0 || r.New == nil {
+		panic("analyzer: Register needs a name and a constructor")
+	} else if _, ok := registry[r.Name]; ok {
+		panic(fmt.Sprintf("analyzer: Register called twice for %s", r.Name))
+	}
+	registry[r.Name] = r
+}
+
+// Lookup returns the registration of the analyzer with the name
+func Lookup(name string) (Registration, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	r, ok := registry[name]
+	return r, ok
+}
+
+// Registered returns the registered analyzers sorted by name
+func Registered() []Registration {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	registrations := make([]Registration, 0, len(registry))
+	for _, r := range registry {
+		registrations = append(registrations, r)
+	}
+
+	sort.Slice(registrations, func(i, j int) bool {
+		return registrations[i].Name < registrations[j].Name
+	})
+	return registrations
+}
@@ -1,104 +1,133 @@
 package repeatederrordensity
 
 import (
-	"fmt"
-	"os"
 	"strings"
 
+	"github.com/nedpals/bugbuddy/server/logger"
 	"github.com/nedpals/bugbuddy/server/logger/analyzer"
 )
 
 const KEY = "repeated_error_density"
 
+func init() {
+	analyzer.Register(analyzer.Registration{
+		Name:        "red",
+		DisplayName: "Repeated Error Density",
+		Metrics: []analyzer.Metric{
+			{Key: KEY, DisplayName: "Repeated Error Density", Type: analyzer.FloatValue, ByErrorType: true},
+		},
+		New: func() analyzer.LoggerAnalyzer { return &Analyzer{} },
+	})
+}
+
 // ErrorEvent represents a compilation attempt and whether it was an error.
 type ErrorEvent struct {
 	IsError   bool
 	ErrorType string // This can be an error code or message to identify error types.
 }
 
+// fileKey identifies the runs of a file of a participant
+type fileKey struct {
+	participantId string
+	filePath      string
+}
+
+// fileDensity is the repeated error density of a file so far
+type fileDensity struct {
+	currentErrorType string
+	repeatedCount    int
+	red              float64
+	// map[errorType]red
+	redByType map[string]float64
+}
+
+// addRepeats adds the streak of repeated errors which just ended
+func (f *fileDensity) addRepeats() {
+	if f.repeatedCount > 0 {
+		typeRed := float64(f.repeatedCount*f.repeatedCount) / float64(f.repeatedCount+1)
+		f.red += typeRed
+		f.redByType[analyzer.ErrorTypeCategory(f.currentErrorType)] += typeRed
+	}
+}
+
+func (f *fileDensity) add(event ErrorEvent) {
+	if event.IsError {
+		if _, ok := f.redByType[analyzer.ErrorTypeCategory(event.ErrorType)]; !ok {
+			f.redByType[analyzer.ErrorTypeCategory(event.ErrorType)] = 0
+		}
+	}
+
+	if event.IsError && event.ErrorType == f.currentErrorType {
+		// Increase the count if the current error is the same as the last one.
+		f.repeatedCount++
+		return
+	}
+
+	// Fallback if not the same or not an error.
+
+	// Calculate RED for the previous error string and reset the count.
+	f.addRepeats()
+
+	if !event.IsError {
+		f.currentErrorType = ""
+	} else if event.ErrorType != f.currentErrorType {
+		f.currentErrorType = event.ErrorType
+	}
+
+	// Reset the count.
+	f.repeatedCount = 0
+}
+
 type Analyzer struct{}
 
 func (e *Analyzer) Analyze(writer analyzer.KVWriter, loaders ...analyzer.LoggerLoader) error {
-	for _, loader := range loaders {
-		log, err := loader()
-		if err != nil {
-			continue
-		}
+	return analyzer.AnalyzeStreams(e, writer, loaders...)
+}
 
-		iter, err := log.Entries()
-		if err != nil {
-			continue
-		}
+func (e *Analyzer) NewStream(log *logger.Logger) analyzer.Stream {
+	return &stream{densities: map[fileKey]*fileDensity{}}
+}
 
-		// map[participantId]map[filePath][]ErrorEvent
-		errorEvents := map[string]map[string][]ErrorEvent{}
-
-		for iter.Next() {
-			entry, err := iter.Value()
-			if err != nil {
-				fmt.Fprintln(os.Stderr, err)
-			}
-
-			// skip if the error message is "file not found". This is not the programmers fault.
-			if strings.Contains(entry.ErrorMessage, "error: file not found:") {
-				continue
-			}
-
-			if _, ok := errorEvents[entry.ParticipantId]; !ok {
-				errorEvents[entry.ParticipantId] = map[string][]ErrorEvent{}
-			}
-
-			if _, ok := errorEvents[entry.ParticipantId][entry.FilePath]; !ok {
-				errorEvents[entry.ParticipantId][entry.FilePath] = []ErrorEvent{}
-			}
-
-			errorType := entry.ErrorType
-			if entry.ErrorCode != 0 && len(errorType) == 0 && strings.Contains(entry.GeneratedOutput, "# UnknownError") {
-				errorType = "UnknownError"
-			}
-
-			errorEvents[entry.ParticipantId][entry.FilePath] = append(errorEvents[entry.ParticipantId][entry.FilePath], ErrorEvent{
-				IsError:   entry.ErrorCode != 0,
-				ErrorType: errorType,
-			})
-		}
+type stream struct {
+	densities map[fileKey]*fileDensity
+	// keys keeps the order in which the files were found
+	keys []fileKey
+}
 
-		for participantId, eventsByFilepath := range errorEvents {
-			for filePath, events := range eventsByFilepath {
-				currentErrorType := ""
-				repeatedCount := 0
-				red := 0.0
-
-				for _, event := range events {
-					if event.IsError && event.ErrorType == currentErrorType {
-						// Increase the count if the current error is the same as the last one.
-						repeatedCount++
-						continue
-					} else if !event.IsError {
-						currentErrorType = ""
-					} else if event.ErrorType != currentErrorType {
-						currentErrorType = event.ErrorType
-					}
-
-					// Fallback if not the same or not an error.
-
-					// Calculate RED for the previous error string and reset the count.
-					if repeatedCount > 0 {
-						red += float64(repeatedCount*repeatedCount) / float64(repeatedCount+1)
-					}
-
-					// Reset the count.
-					repeatedCount = 0
-				}
-
-				if repeatedCount > 0 {
-					red += float64(repeatedCount*repeatedCount) / float64(repeatedCount+1)
-				}
-
-				writer.Write(KEY, participantId, filePath, red)
-			}
-		}
+func (s *stream) Add(entry logger.LogEntry) error {
+	// skip if the error message is "file not found". This is not the programmers fault.
+	if strings.Contains(entry.ErrorMessage, "error: file not found:") {
+		return nil
+	}
+
+	key := fileKey{participantId: entry.ParticipantId, filePath: entry.FilePath}
+	if _, ok := s.densities[key]; !ok {
+		s.densities[key] = &fileDensity{redByType: map[string]float64{}}
+		s.keys = append(s.keys, key)
 	}
 
+	errorType := entry.ErrorType
+	if entry.ErrorCode != 0 && len(errorType) == 0 && strings.Contains(entry.GeneratedOutput, "# UnknownError") {
+		errorType = "UnknownError"
+	}
+
+	s.densities[key].add(ErrorEvent{
+		IsError:   entry.ErrorCode != 0,
+		ErrorType: errorType,
+	})
+	return nil
+}
+
+func (s *stream) Close(writer analyzer.KVWriter) error {
+	for _, key := range s.keys {
+		density := s.densities[key]
+		density.addRepeats()
+
+		for errorType, typeRed := range density.redByType {
+			analyzer.WriteDimension(writer, KEY, key.participantId, key.filePath, analyzer.ErrorTypeDimension, errorType, typeRed)
+		}
+
+		writer.Write(KEY, key.participantId, key.filePath, density.red)
+	}
 	return nil
 }
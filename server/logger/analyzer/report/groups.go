@@ -0,0 +1,220 @@
+package report
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/nedpals/bugbuddy/server/logger/analyzer"
+	"github.com/nedpals/bugbuddy/server/logger/analyzer/stats"
+)
+
+// ReadGroups reads the group of each participant from a CSV file with the
+// participant ID in the first column and the group in the second. The
+// header row (participant_id,group) is optional.
+func ReadGroups(r io.Reader) (map[string]string, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	groups := map[string]string{}
+	for i, record := range records {
+		if i == 0 && len(record) != 0 && strings.EqualFold(strings.TrimSpace(record[0]), "participant_id") {
+			continue
+		} else if len(record) < 2 {
+			return nil, fmt.Errorf("groups: line %d: expected a participant ID and a group", i+1)
+		}
+
+		participantId, group := strings.TrimSpace(record[0]), strings.TrimSpace(record[1])
+		if len(participantId) == 0 {
+			continue
+		} else if len(group) == 0 {
+			return nil, fmt.Errorf("groups: line %d: %s has no group", i+1, participantId)
+		} else if existing, ok := groups[participantId]; ok && existing != group {
+			return nil, fmt.Errorf("groups: line %d: %s is already in %s", i+1, participantId, existing)
+		}
+
+		groups[participantId] = group
+	}
+	return groups, nil
+}
+
+// Cohort compares the metrics of the groups of participants. Each
+// participant contributes the average of the values of their files.
+type Cohort struct {
+	Summaries   []GroupSummary    `json:"summaries"`
+	Comparisons []GroupComparison `json:"comparisons"`
+	// Ungrouped lists the participants of the results without a group.
+	// They are left out of the comparison.
+	Ungrouped []string `json:"ungrouped,omitempty"`
+}
+
+// GroupSummary describes the values of a metric of a group
+type GroupSummary struct {
+	Metric string `json:"metric"`
+	Group  string `json:"group"`
+	stats.Summary
+}
+
+// GroupComparison compares the values of a metric of two groups. The
+// tests are nil if the groups do not have enough values.
+type GroupComparison struct {
+	Metric      string             `json:"metric"`
+	GroupA      string             `json:"group_a"`
+	GroupB      string             `json:"group_b"`
+	MannWhitney *stats.MannWhitney `json:"mann_whitney,omitempty"`
+	Welch       *stats.Welch       `json:"welch,omitempty"`
+}
+
+// cohortMetric is a metric or a column of a metric
+type cohortMetric struct {
+	// key is the key of the metric followed by the column
+	key         string
+	displayName string
+	metricKey   string
+	// value returns the number of the value of a file and false if the
+	// file has no value for the metric or its column
+	value func(value any) (float64, bool)
+}
+
+func (r *Report) cohortMetrics() []cohortMetric {
+	number := func(valueType analyzer.ValueType, value any) (float64, bool) {
+		if value == nil {
+			return 0, false
+		}
+
+		switch v := cellValue(valueType, value).(type) {
+		case int:
+			return float64(v), true
+		case float64:
+			return v, true
+		default:
+			return 0, false
+		}
+	}
+
+	metrics := []cohortMetric{}
+	for _, metric := range r.metrics() {
+		metric := metric
+		if len(metric.Columns) == 0 {
+			metrics = append(metrics, cohortMetric{
+				key:         metric.Key,
+				displayName: metric.DisplayName,
+				metricKey:   metric.Key,
+				value:       func(value any) (float64, bool) { return number(metric.Type, value) },
+			})
+			continue
+		}
+
+		for _, column := range metric.Columns {
+			column := column
+			metrics = append(metrics, cohortMetric{
+				key:         metric.Key + "." + column,
+				displayName: fmt.Sprintf("%s (%s)", metric.DisplayName, column),
+				metricKey:   metric.Key,
+				value:       func(value any) (float64, bool) { return number(metric.Type, columnValue(value, column)) },
+			})
+		}
+	}
+	return metrics
+}
+
+// CompareGroups summarizes the metrics of each group and compares each
+// pair of groups with the Mann-Whitney U test and Welch's t-test. It sets
+// the cohort of the report and puts the "Group Summary" and "Group
+// Comparison" tables before the other tables.
+func (r *Report) CompareGroups(groups map[string]string) *Cohort {
+	cohort := &Cohort{Summaries: []GroupSummary{}, Comparisons: []GroupComparison{}}
+
+	groupNames := []string{}
+	for _, group := range groups {
+		if !slices.Contains(groupNames, group) {
+			groupNames = append(groupNames, group)
+		}
+	}
+	sort.Strings(groupNames)
+
+	// map[group]participant results
+	members := map[string][]*ParticipantResult{}
+	for _, participantId := range r.Results.ParticipantIds() {
+		group, ok := groups[participantId]
+		if !ok {
+			cohort.Ungrouped = append(cohort.Ungrouped, participantId)
+			continue
+		}
+		members[group] = append(members[group], r.Results[participantId])
+	}
+
+	summaryTable := Table{Name: "Group Summary", Headers: []string{"Metric", "Group", "N", "Mean", "Median", "SD"}}
+	comparisonTable := Table{
+		Name: "Group Comparison",
+		Headers: []string{
+			"Metric", "Group A", "Group B",
+			"Mann-Whitney U", "Z", "p (Mann-Whitney)", "Rank-Biserial r",
+			"Welch t", "df", "p (Welch)", "Cohen's d", "Hedges' g",
+		},
+	}
+
+	for _, metric := range r.cohortMetrics() {
+		// map[group]the average of each participant over the files which
+		// have a value for the metric. Participants without any values
+		// are left out of the samples.
+		samples := map[string][]float64{}
+		for _, group := range groupNames {
+			samples[group] = []float64{}
+			for _, result := range members[group] {
+				sum, count := 0.0, 0
+				for _, filePath := range result.SortedFilenames() {
+					if value, ok := metric.value(result.Value(metric.metricKey, filePath)); ok {
+						sum += value
+						count++
+					}
+				}
+
+				if count != 0 {
+					samples[group] = append(samples[group], sum/float64(count))
+				}
+			}
+
+			summary := GroupSummary{Metric: metric.key, Group: group, Summary: stats.Describe(samples[group])}
+			cohort.Summaries = append(cohort.Summaries, summary)
+			summaryTable.AddRow(metric.displayName, group, summary.N, summary.Mean, summary.Median, summary.SD)
+		}
+
+		for i, groupA := range groupNames {
+			for _, groupB := range groupNames[i+1:] {
+				comparison := GroupComparison{Metric: metric.key, GroupA: groupA, GroupB: groupB}
+				row := []any{metric.displayName, groupA, groupB}
+
+				if result, err := stats.MannWhitneyU(samples[groupA], samples[groupB]); err == nil {
+					comparison.MannWhitney = &result
+					row = append(row, result.U, result.Z, result.P, result.RankBiserial)
+				} else {
+					row = append(row, nil, nil, nil, nil)
+				}
+
+				if result, err := stats.WelchTTest(samples[groupA], samples[groupB]); err == nil {
+					comparison.Welch = &result
+					row = append(row, result.T, result.DF, result.P, result.CohensD, result.HedgesG)
+				} else {
+					row = append(row, nil, nil, nil, nil, nil)
+				}
+
+				cohort.Comparisons = append(cohort.Comparisons, comparison)
+				comparisonTable.AddRow(row...)
+			}
+		}
+	}
+
+	r.Cohort = cohort
+	r.Tables = append([]Table{summaryTable, comparisonTable}, r.Tables...)
+	return cohort
+}
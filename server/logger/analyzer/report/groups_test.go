@@ -0,0 +1,196 @@
+package report_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nedpals/bugbuddy/server/logger/analyzer"
+	"github.com/nedpals/bugbuddy/server/logger/analyzer/report"
+)
+
+func TestReadGroups(t *testing.T) {
+	groups, err := report.ReadGroups(strings.NewReader("participant_id,group\nstudent-a, bugbuddy\nstudent-b,control\n\n"))
+	if err != nil {
+		t.Fatal(err)
+	} else if len(groups) != 2 || groups["student-a"] != "bugbuddy" || groups["student-b"] != "control" {
+		t.Errorf("Unexpected groups %v", groups)
+	}
+
+	// the header is optional
+	groups, err = report.ReadGroups(strings.NewReader("student-a,bugbuddy\n"))
+	if err != nil {
+		t.Fatal(err)
+	} else if groups["student-a"] != "bugbuddy" {
+		t.Errorf("Unexpected groups %v", groups)
+	}
+
+	for _, input := range []string{
+		"student-a\n",
+		"student-a,\n",
+		"student-a,bugbuddy\nstudent-a,control\n",
+	} {
+		if _, err := report.ReadGroups(strings.NewReader(input)); err == nil {
+			t.Errorf("Expected an error for %q", input)
+		}
+	}
+}
+
+func setupCohortReport() *report.Report {
+	results := report.Results{}
+	values := map[string][]float64{
+		"student-1": {0.2, 0.4},
+		"student-2": {0.1},
+		"student-3": {0.5},
+		"student-4": {0.7, 0.9},
+		"student-5": {0.8},
+		"student-6": {0.3},
+	}
+
+	for participantId, fileValues := range values {
+		for i, value := range fileValues {
+			filePath := []string{"a.py", "b.py"}[i]
+			results.Write("eq", participantId, filePath, value)
+			results.Write("tts", participantId, filePath, time.Duration(value*float64(time.Minute)))
+		}
+	}
+
+	return report.New(registrations, results)
+}
+
+func TestCompareGroups(t *testing.T) {
+	r := setupCohortReport()
+	cohort := r.CompareGroups(map[string]string{
+		"student-1": "bugbuddy",
+		"student-2": "bugbuddy",
+		"student-3": "bugbuddy",
+		"student-4": "control",
+		"student-5": "control",
+		"unknown":   "control",
+	})
+
+	if strings.Join(cohort.Ungrouped, ",") != "student-6" {
+		t.Errorf("Expected student-6 to be ungrouped, got %v", cohort.Ungrouped)
+	}
+
+	// one summary per metric and group
+	if len(cohort.Summaries) != 4 {
+		t.Fatalf("Expected 4 summaries, got %+v", cohort.Summaries)
+	}
+
+	bugbuddy := cohort.Summaries[0]
+	if bugbuddy.Metric != "eq" || bugbuddy.Group != "bugbuddy" || bugbuddy.N != 3 {
+		t.Errorf("Unexpected summary %+v", bugbuddy)
+	} else if math.Abs(bugbuddy.Mean-0.3) > 1e-9 || math.Abs(bugbuddy.Median-0.3) > 1e-9 {
+		// student-1 contributes the average of their files
+		t.Errorf("Expected a mean and a median of 0.3, got %+v", bugbuddy)
+	}
+
+	if tts := cohort.Summaries[3]; tts.Metric != "tts" || tts.Group != "control" || math.Abs(tts.Mean-48) > 1e-9 {
+		t.Errorf("Expected the time to solve in seconds, got %+v", tts)
+	}
+
+	if len(cohort.Comparisons) != 2 {
+		t.Fatalf("Expected a comparison per metric, got %+v", cohort.Comparisons)
+	}
+
+	comparison := cohort.Comparisons[0]
+	if comparison.GroupA != "bugbuddy" || comparison.GroupB != "control" {
+		t.Errorf("Unexpected groups %s and %s", comparison.GroupA, comparison.GroupB)
+	} else if comparison.MannWhitney == nil || comparison.MannWhitney.U != 0 || comparison.MannWhitney.RankBiserial != -1 {
+		t.Errorf("Expected all of the values of bugbuddy to be lower, got %+v", comparison.MannWhitney)
+	} else if comparison.Welch == nil || comparison.Welch.T >= 0 {
+		t.Errorf("Expected a negative t statistic, got %+v", comparison.Welch)
+	}
+
+	if r.Tables[0].Name != "Group Summary" || r.Tables[1].Name != "Group Comparison" {
+		t.Errorf("Expected the group tables to come first, got %s and %s", r.Tables[0].Name, r.Tables[1].Name)
+	} else if len(r.Tables[0].Rows) != 4 || len(r.Tables[1].Rows) != 2 {
+		t.Errorf("Unexpected rows %v %v", r.Tables[0].Rows, r.Tables[1].Rows)
+	}
+}
+
+func TestCompareGroups_NotEnoughValues(t *testing.T) {
+	r := setupCohortReport()
+	cohort := r.CompareGroups(map[string]string{"student-1": "bugbuddy", "student-4": "control"})
+
+	comparison := cohort.Comparisons[0]
+	if comparison.MannWhitney == nil || comparison.Welch != nil {
+		t.Errorf("Expected only the Mann-Whitney U test for groups of one participant, got %+v", comparison)
+	}
+
+	if row := r.Tables[1].Rows[0]; row[3] == nil || row[7] != nil {
+		t.Errorf("Expected the cells of the t-test to be empty, got %v", row)
+	}
+}
+
+func TestCompareGroups_MissingValues(t *testing.T) {
+	results := report.Results{}
+	results.Write("eq", "student-1", "a.py", 0.4)
+	results.Write("tts", "student-1", "b.py", time.Minute)
+	// student-2 has no value for eq
+	results.Write("tts", "student-2", "a.py", 2*time.Minute)
+	results.Write("eq", "student-3", "a.py", 0.6)
+
+	r := report.New(registrations, results)
+	cohort := r.CompareGroups(map[string]string{"student-1": "a", "student-2": "a", "student-3": "b"})
+
+	// the files and the participants without a value are not averaged
+	if eq := cohort.Summaries[0]; eq.Metric != "eq" || eq.N != 1 || math.Abs(eq.Mean-0.4) > 1e-9 {
+		t.Errorf("Expected only the value of student-1, got %+v", eq)
+	} else if tts := cohort.Summaries[2]; tts.Metric != "tts" || tts.N != 2 || math.Abs(tts.Mean-90) > 1e-9 {
+		t.Errorf("Expected the time to solve of both participants, got %+v", tts)
+	}
+}
+
+func TestCompareGroups_JSON(t *testing.T) {
+	r := setupCohortReport()
+	r.CompareGroups(map[string]string{"student-1": "bugbuddy", "student-4": "control"})
+
+	var out bytes.Buffer
+	if err := report.Write(report.JSON, &out, r); err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded struct {
+		Cohort report.Cohort `json:"cohort"`
+	}
+
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	} else if len(decoded.Cohort.Summaries) != 4 || decoded.Cohort.Summaries[0].N != 1 {
+		t.Errorf("Expected the cohort in the report, got %+v", decoded.Cohort)
+	}
+}
+
+func TestCompareGroups_Columns(t *testing.T) {
+	results := report.Results{}
+	results.Write("states", "student-1", "a.py", columns{"editing": 2})
+	results.Write("states", "student-2", "a.py", columns{"editing": 4, "debugging": 1})
+
+	r := report.New([]analyzer.Registration{{
+		Name:    "states",
+		Metrics: []analyzer.Metric{{Key: "states", DisplayName: "States", Type: analyzer.CountValue, Columns: []string{"editing", "debugging"}}},
+	}}, results)
+
+	cohort := r.CompareGroups(map[string]string{"student-1": "a", "student-2": "b"})
+	metrics := []string{}
+	for _, summary := range cohort.Summaries {
+		metrics = append(metrics, summary.Metric)
+	}
+
+	if strings.Join(metrics, ",") != "states.editing,states.editing,states.debugging,states.debugging" {
+		t.Errorf("Expected a summary for each column, got %v", metrics)
+	} else if cohort.Summaries[1].Mean != 4 || cohort.Summaries[3].Mean != 1 {
+		t.Errorf("Unexpected summaries %+v", cohort.Summaries)
+	}
+}
+
+type columns map[string]int
+
+func (c columns) ColumnValue(column string) any {
+	return c[column]
+}
@@ -0,0 +1,174 @@
+package report
+
+import (
+	"html/template"
+	"io"
+	"math"
+	"time"
+
+	"github.com/nedpals/bugbuddy/server/logger/analyzer"
+)
+
+// chart is a bar chart of the average value of a metric of each participant
+type chart struct {
+	Title  string
+	Height int
+	Bars   []bar
+}
+
+type bar struct {
+	Label string
+	Value string
+	Y     int
+	Width float64
+}
+
+const (
+	chartBarHeight = 22
+	chartBarWidth  = 400
+)
+
+// charts returns a chart for each metric without columns. The average is
+// taken over the files of the participant.
+func (r *Report) charts() []chart {
+	charts := []chart{}
+
+	for _, metric := range r.metrics() {
+		if len(metric.Columns) != 0 {
+			continue
+		}
+
+		averages := []float64{}
+		participantIds := r.Results.ParticipantIds()
+		for _, participantId := range participantIds {
+			result := r.Results[participantId]
+			filenames := result.SortedFilenames()
+
+			sum := 0.0
+			for _, filePath := range filenames {
+				switch value := cellValue(metric.Type, result.Value(metric.Key, filePath)).(type) {
+				case int:
+					sum += float64(value)
+				case float64:
+					sum += value
+				}
+			}
+
+			average := 0.0
+			if len(filenames) != 0 {
+				average = sum / float64(len(filenames))
+			}
+			averages = append(averages, average)
+		}
+
+		maxValue := 0.0
+		for _, average := range averages {
+			maxValue = math.Max(maxValue, math.Abs(average))
+		}
+
+		c := chart{Title: metric.DisplayName, Height: len(averages) * chartBarHeight}
+		for i, average := range averages {
+			b := bar{Label: participantIds[i], Y: i * chartBarHeight, Value: formatCell(average)}
+			if metric.Type == analyzer.DurationValue {
+				b.Value = FormatDuration(time.Duration(average * float64(time.Second)))
+			}
+
+			if maxValue > 0 {
+				b.Width = math.Abs(average) / maxValue * chartBarWidth
+			}
+			c.Bars = append(c.Bars, b)
+		}
+		charts = append(charts, c)
+	}
+	return charts
+}
+
+var htmlTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"cell": formatCell,
+	"numeric": func(value any) bool {
+		switch value.(type) {
+		case int, float64:
+			return true
+		default:
+			return false
+		}
+	},
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Analysis Results</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; }
+th { background: #f0f0f0; cursor: pointer; user-select: none; }
+th[data-order="asc"]::after { content: " \25B2"; }
+th[data-order="desc"]::after { content: " \25BC"; }
+td[data-value] { text-align: right; }
+svg text { font-size: 12px; }
+.bar { fill: #4a7bd0; }
+</style>
+</head>
+<body>
+<h1>Analysis Results</h1>
+<p>Analyzers: {{range $i, $a := .Report.Analyzers}}{{if $i}}, {{end}}{{$a.DisplayName}}{{end}}</p>
+{{if .Charts}}<h2>Averages per File</h2>
+{{range .Charts}}<h3>{{.Title}}</h3>
+<svg width="{{$.ChartWidth}}" height="{{.Height}}" role="img" aria-label="{{.Title}}">
+{{range .Bars}}<g transform="translate(0,{{.Y}})">
+<text x="0" y="15">{{.Label}}</text>
+<rect class="bar" x="160" y="3" height="16" width="{{printf "%.2f" .Width}}"></rect>
+<text x="{{printf "%.2f" .Width}}" dx="166" y="15">{{.Value}}</text>
+</g>
+{{end}}</svg>
+{{end}}{{end}}
+{{range .Report.Tables}}<h2>{{.Name}}</h2>
+<table class="sortable">
+<thead><tr>{{range .Headers}}<th>{{.}}</th>{{end}}</tr></thead>
+<tbody>
+{{range .Rows}}<tr>{{range .}}{{if numeric .}}<td data-value="{{.}}">{{cell .}}</td>{{else}}<td>{{cell .}}</td>{{end}}{{end}}</tr>
+{{end}}</tbody>
+</table>
+{{end}}<script>
+document.querySelectorAll("table.sortable th").forEach(function (th) {
+  th.addEventListener("click", function () {
+    var column = Array.prototype.indexOf.call(th.parentNode.children, th);
+    var tbody = th.closest("table").querySelector("tbody");
+    var order = th.dataset.order === "asc" ? "desc" : "asc";
+    th.parentNode.querySelectorAll("th").forEach(function (other) { delete other.dataset.order; });
+    th.dataset.order = order;
+
+    var key = function (row) {
+      var cell = row.children[column];
+      if (!cell) return "";
+      return cell.dataset.value !== undefined ? parseFloat(cell.dataset.value) : cell.textContent;
+    };
+
+    var rows = Array.prototype.slice.call(tbody.rows);
+    rows.sort(function (a, b) {
+      var x = key(a), y = key(b);
+      var result = typeof x === "number" && typeof y === "number" ? x - y : String(x).localeCompare(String(y));
+      return order === "asc" ? result : -result;
+    });
+    rows.forEach(function (row) { tbody.appendChild(row); });
+  });
+});
+</script>
+</body>
+</html>
+`))
+
+// writeHTML writes a self-contained page with the tables, which can be
+// sorted by clicking on their headers, and a chart of each metric
+func writeHTML(w io.Writer, r *Report) error {
+	return htmlTemplate.Execute(w, struct {
+		Report     *Report
+		Charts     []chart
+		ChartWidth int
+	}{
+		Report:     r,
+		Charts:     r.charts(),
+		ChartWidth: 160 + chartBarWidth + 120,
+	})
+}
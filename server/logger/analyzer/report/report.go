@@ -0,0 +1,598 @@
+package report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nedpals/bugbuddy/server/logger/analyzer"
+	"github.com/nedpals/bugbuddy/server/logger/analyzer/nearest"
+	"github.com/tealeg/xlsx/v3"
+	"golang.org/x/exp/maps"
+)
+
+// Format is the file format of the report
+type Format string
+
+const (
+	XLSX     Format = "xlsx"
+	CSV      Format = "csv"
+	JSON     Format = "json"
+	Markdown Format = "markdown"
+	HTML     Format = "html"
+)
+
+// SupportedFormats lists the formats accepted by Write
+var SupportedFormats = []Format{XLSX, CSV, JSON, Markdown, HTML}
+
+// Extension returns the file extension of the format
+func (f Format) Extension() string {
+	if f == Markdown {
+		return "md"
+	}
+	return string(f)
+}
+
+// Results collects the values written by the analyzers for each
+// participant. It merges the paths of the same file which were recorded
+// differently, such as a relative and an absolute path.
+type Results map[string]*ParticipantResult
+
+func (r Results) participant(pid string) *ParticipantResult {
+	if _, ok := r[pid]; !ok {
+		r[pid] = &ParticipantResult{
+			ParticipantId:    pid,
+			FilenameAliases:  map[string]string{},
+			FilenamesIndices: map[string]int{},
+			Filenames:        []string{},
+
+			Values:      map[string]map[int]any{},
+			ByErrorType: map[int]map[string]map[string]any{},
+		}
+	}
+
+	return r[pid]
+}
+
+func (r Results) Write(name string, pid string, filePath string, value any) {
+	r.participant(pid).Write(name, filePath, value)
+}
+
+func (r Results) WriteDimension(name string, pid string, filePath string, dimension analyzer.Dimension, category string, value any) {
+	if dimension != analyzer.ErrorTypeDimension {
+		return
+	}
+
+	r.participant(pid).WriteErrorType(name, filePath, category, value)
+}
+
+// ParticipantIds returns the participants sorted by ID
+func (r Results) ParticipantIds() []string {
+	participantIds := maps.Keys(r)
+	sort.Strings(participantIds)
+	return participantIds
+}
+
+// ParticipantResult is the values of each file of a participant
+type ParticipantResult struct {
+	ParticipantId    string
+	FilenameAliases  map[string]string
+	FilenamesIndices map[string]int
+	Filenames        []string
+
+	// map[analyzer key]map[index of file]value
+	Values map[string]map[int]any
+
+	// map[index of file]map[error type]map[analyzer key]value
+	ByErrorType map[int]map[string]map[string]any
+}
+
+func (p *ParticipantResult) fileIndex(filePath string) int {
+	filePath = strings.TrimSpace(filePath)
+
+	// check if the filePath is already in the list
+	if _, ok := p.FilenamesIndices[filePath]; !ok {
+		if alias, ok := p.FilenameAliases[filePath]; ok {
+			// do not mutate the original file path
+			filePath = alias
+		} else if nearest := nearest.FilenameNearest(filePath, p.FilenamesIndices, p.Filenames); nearest != filePath && strings.HasPrefix(filePath, nearest) {
+			// if it is, replace the found path with the file path
+			p.Filenames[p.FilenamesIndices[nearest]] = filePath
+			p.FilenameAliases[nearest] = filePath
+			p.FilenamesIndices[filePath] = p.FilenamesIndices[nearest]
+			delete(p.FilenamesIndices, nearest)
+		} else if _, ok := p.FilenamesIndices[filePath]; !ok {
+			// if it is not, add the file path
+			p.FilenamesIndices[filePath] = len(p.Filenames)
+			p.Filenames = append(p.Filenames, filePath)
+		}
+	}
+
+	return p.FilenamesIndices[filePath]
+}
+
+func (p *ParticipantResult) Write(name string, filePath string, value any) {
+	index := p.fileIndex(filePath)
+
+	if _, ok := p.Values[name]; !ok {
+		p.Values[name] = map[int]any{}
+	}
+
+	p.Values[name][index] = value
+}
+
+func (p *ParticipantResult) WriteErrorType(name string, filePath string, errorType string, value any) {
+	index := p.fileIndex(filePath)
+
+	if _, ok := p.ByErrorType[index]; !ok {
+		p.ByErrorType[index] = map[string]map[string]any{}
+	}
+
+	if _, ok := p.ByErrorType[index][errorType]; !ok {
+		p.ByErrorType[index][errorType] = map[string]any{}
+	}
+
+	p.ByErrorType[index][errorType][name] = value
+}
+
+// SortedFilenames returns the file paths sorted without the empty ones
+func (p *ParticipantResult) SortedFilenames() []string {
+	filenames := []string{}
+	for _, filePath := range p.Filenames {
+		if len(strings.TrimSpace(filePath)) != 0 {
+			filenames = append(filenames, filePath)
+		}
+	}
+	sort.Strings(filenames)
+	return filenames
+}
+
+// Value returns the value of the metric of the file
+func (p *ParticipantResult) Value(key string, filePath string) any {
+	return p.Values[key][p.FilenamesIndices[filePath]]
+}
+
+// Table is a named table of cells. The cells are strings, ints or
+// float64s, and nil for missing values.
+type Table struct {
+	Name    string
+	Headers []string
+	Rows    [][]any
+}
+
+// AddRow appends a row of cells to the table
+func (t *Table) AddRow(cells ...any) {
+	t.Rows = append(t.Rows, cells)
+}
+
+// Report is the results of the analyzers along with their tabular form
+type Report struct {
+	// Analyzers are the analyzers which produced the results
+	Analyzers []analyzer.Registration
+	Results   Results
+	// Tables are the tables of the participants followed by the tables
+	// added by the caller, except for the tables of CompareGroups which
+	// come first
+	Tables []Table
+	// Cohort is set by CompareGroups
+	Cohort *Cohort
+}
+
+// New creates the report of the results. It adds a table with the values
+// of each file of each participant, and a table with the values broken
+// down by error type if any of the analyzers supports it.
+func New(registrations []analyzer.Registration, results Results) *Report {
+	r := &Report{Analyzers: registrations, Results: results}
+
+	for _, participantId := range results.ParticipantIds() {
+		r.Tables = append(r.Tables, r.participantTable(results[participantId]))
+		if table, ok := r.errorTypeTable(results[participantId]); ok {
+			r.Tables = append(r.Tables, table)
+		}
+	}
+	return r
+}
+
+// metrics returns the metrics of the analyzers in order
+func (r *Report) metrics() []analyzer.Metric {
+	metrics := []analyzer.Metric{}
+	for _, registration := range r.Analyzers {
+		metrics = append(metrics, registration.Metrics...)
+	}
+	return metrics
+}
+
+func (r *Report) participantTable(result *ParticipantResult) Table {
+	table := Table{Name: result.ParticipantId, Headers: []string{"File Path"}}
+	for _, metric := range r.metrics() {
+		table.Headers = append(table.Headers, metricHeaders(metric)...)
+	}
+
+	for _, filePath := range result.SortedFilenames() {
+		row := []any{filePath}
+		for _, metric := range r.metrics() {
+			row = append(row, metricCells(metric, result.Value(metric.Key, filePath))...)
+		}
+		table.AddRow(row...)
+	}
+	return table
+}
+
+// errorTypeTableName returns the name of the table of the values of the
+// participant broken down by error type. Sheet names are limited to 31
+// characters.
+func errorTypeTableName(participantId string) string {
+	const suffix = " (errors)"
+	if len(participantId)+len(suffix) > maxSheetName {
+		participantId = participantId[:maxSheetName-len(suffix)]
+	}
+	return participantId + suffix
+}
+
+func (r *Report) errorTypeTable(result *ParticipantResult) (Table, bool) {
+	metrics := []analyzer.Metric{}
+	for _, metric := range r.metrics() {
+		if metric.ByErrorType {
+			metrics = append(metrics, metric)
+		}
+	}
+
+	if len(metrics) == 0 || len(result.ByErrorType) == 0 {
+		return Table{}, false
+	}
+
+	table := Table{Name: errorTypeTableName(result.ParticipantId), Headers: []string{"File Path", "Error Type"}}
+	for _, metric := range metrics {
+		table.Headers = append(table.Headers, metric.DisplayName)
+	}
+
+	filenames := slices.Clone(result.Filenames)
+	sort.Strings(filenames)
+
+	for _, filePath := range filenames {
+		values := result.ByErrorType[result.FilenamesIndices[filePath]]
+
+		errorTypes := maps.Keys(values)
+		sort.Strings(errorTypes)
+
+		for _, errorType := range errorTypes {
+			row := []any{filePath, errorType}
+			for _, metric := range metrics {
+				// the analyzer may have no value for the error type
+				if value, ok := values[errorType][metric.Key]; ok {
+					row = append(row, cellValue(metric.Type, value))
+				} else {
+					row = append(row, nil)
+				}
+			}
+			table.AddRow(row...)
+		}
+	}
+	return table, true
+}
+
+// metricHeaders returns the headers of the columns of the metric. The
+// durations are also written as HH:MM:SS.
+func metricHeaders(metric analyzer.Metric) []string {
+	if len(metric.Columns) != 0 {
+		return metric.Columns
+	} else if metric.Type == analyzer.DurationValue {
+		return []string{metric.DisplayName, metric.DisplayName + " (HH:MM:SS)"}
+	}
+	return []string{metric.DisplayName}
+}
+
+// metricCells returns the values of the columns of the metric
+func metricCells(metric analyzer.Metric, value any) []any {
+	if len(metric.Columns) != 0 {
+		cells := make([]any, len(metric.Columns))
+		for i, column := range metric.Columns {
+			cells[i] = cellValue(metric.Type, columnValue(value, column))
+		}
+		return cells
+	} else if metric.Type == analyzer.DurationValue {
+		duration, _ := value.(time.Duration)
+		return []any{duration.Seconds(), FormatDuration(duration)}
+	}
+	return []any{cellValue(metric.Type, value)}
+}
+
+func columnValue(value any, column string) any {
+	if columnValues, ok := value.(analyzer.ColumnValues); ok {
+		return columnValues.ColumnValue(column)
+	}
+	return nil
+}
+
+// cellValue converts the value to the value of its cell. Durations are
+// written in seconds and missing values as zero.
+func cellValue(valueType analyzer.ValueType, value any) any {
+	switch valueType {
+	case analyzer.DurationValue:
+		duration, _ := value.(time.Duration)
+		return duration.Seconds()
+	case analyzer.CountValue:
+		count, _ := value.(int)
+		return count
+	default:
+		number, _ := value.(float64)
+		return number
+	}
+}
+
+// FormatDuration formats the duration as HH:MM:SS
+func FormatDuration(d time.Duration) string {
+	h := d / time.Hour
+	d -= h * time.Hour
+	m := d / time.Minute
+	d -= m * time.Minute
+	s := d / time.Second
+	return fmt.Sprintf("%d:%02d:%02d", h, m, s)
+}
+
+// Write writes the report to w in the format
+func Write(format Format, w io.Writer, r *Report) error {
+	switch format {
+	case XLSX:
+		return writeXLSX(w, r)
+	case CSV:
+		return writeCSV(w, r)
+	case JSON:
+		return writeJSON(w, r)
+	case Markdown:
+		return writeMarkdown(w, r)
+	case HTML:
+		return writeHTML(w, r)
+	default:
+		return fmt.Errorf("unsupported report format: %s", format)
+	}
+}
+
+// maxSheetName is the maximum length of the name of a sheet
+const maxSheetName = 31
+
+func adjustToTextWidth(s string) float64 {
+	return float64(len(s))
+}
+
+// writeXLSX writes each table to its own sheet
+func writeXLSX(w io.Writer, r *Report) error {
+	wb := xlsx.NewFile()
+
+	for _, table := range r.Tables {
+		name := table.Name
+		if len(name) > maxSheetName {
+			name = name[:maxSheetName]
+		}
+
+		sheet, err := wb.AddSheet(name)
+		if err != nil {
+			return err
+		}
+
+		header := sheet.AddRow()
+		for _, name := range table.Headers {
+			header.AddCell().SetValue(name)
+		}
+
+		for _, cells := range table.Rows {
+			row := sheet.AddRow()
+			for _, value := range cells {
+				cell := row.AddCell()
+				if value != nil {
+					cell.SetValue(value)
+				}
+			}
+		}
+
+		for c := 1; c <= len(table.Headers); c++ {
+			sheet.SetColAutoWidth(c, adjustToTextWidth)
+		}
+	}
+
+	return wb.Write(w)
+}
+
+var csvColumns = []string{"participant_id", "file_path", "metric", "error_type", "value"}
+
+// writeCSV writes a row for each value of each metric of each file. The
+// values of metrics with columns are written as <key>.<column>, and the
+// values broken down by error type have the error type set.
+func writeCSV(w io.Writer, r *Report) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvColumns); err != nil {
+		return err
+	}
+
+	metrics := r.metrics()
+	for _, participantId := range r.Results.ParticipantIds() {
+		result := r.Results[participantId]
+
+		for _, filePath := range result.SortedFilenames() {
+			for _, metric := range metrics {
+				value := result.Value(metric.Key, filePath)
+				if len(metric.Columns) == 0 {
+					if err := cw.Write([]string{participantId, filePath, metric.Key, "", formatCSVValue(cellValue(metric.Type, value))}); err != nil {
+						return err
+					}
+					continue
+				}
+
+				for _, column := range metric.Columns {
+					cell := cellValue(metric.Type, columnValue(value, column))
+					if err := cw.Write([]string{participantId, filePath, metric.Key + "." + column, "", formatCSVValue(cell)}); err != nil {
+						return err
+					}
+				}
+			}
+
+			values := result.ByErrorType[result.FilenamesIndices[filePath]]
+			errorTypes := maps.Keys(values)
+			sort.Strings(errorTypes)
+
+			for _, errorType := range errorTypes {
+				for _, metric := range metrics {
+					value, ok := values[errorType][metric.Key]
+					if !ok || !metric.ByErrorType {
+						continue
+					}
+
+					if err := cw.Write([]string{participantId, filePath, metric.Key, errorType, formatCSVValue(cellValue(metric.Type, value))}); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+func formatCSVValue(value any) string {
+	switch v := value.(type) {
+	case int:
+		return strconv.Itoa(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+type jsonReport struct {
+	Analyzers    []analyzer.Registration `json:"analyzers"`
+	Participants []jsonParticipant       `json:"participants"`
+	Cohort       *Cohort                 `json:"cohort,omitempty"`
+}
+
+type jsonParticipant struct {
+	ParticipantId string     `json:"participant_id"`
+	Files         []jsonFile `json:"files"`
+}
+
+type jsonFile struct {
+	FilePath    string                    `json:"file_path"`
+	Values      map[string]any            `json:"values"`
+	ByErrorType map[string]map[string]any `json:"by_error_type,omitempty"`
+}
+
+// writeJSON writes all of the values of each file, including the values
+// which are not metrics such as the NPSM transitions. The values of the
+// metrics are converted like the cells of the tables.
+func writeJSON(w io.Writer, r *Report) error {
+	metrics := map[string]analyzer.Metric{}
+	for _, metric := range r.metrics() {
+		metrics[metric.Key] = metric
+	}
+
+	jsonValue := func(key string, value any) any {
+		metric, ok := metrics[key]
+		if !ok {
+			if duration, ok := value.(time.Duration); ok {
+				return duration.Seconds()
+			}
+			return value
+		} else if len(metric.Columns) == 0 {
+			return cellValue(metric.Type, value)
+		}
+
+		columns := map[string]any{}
+		for _, column := range metric.Columns {
+			columns[column] = cellValue(metric.Type, columnValue(value, column))
+		}
+		return columns
+	}
+
+	out := jsonReport{Analyzers: r.Analyzers, Participants: []jsonParticipant{}, Cohort: r.Cohort}
+	for _, participantId := range r.Results.ParticipantIds() {
+		result := r.Results[participantId]
+		participant := jsonParticipant{ParticipantId: participantId, Files: []jsonFile{}}
+
+		for _, filePath := range result.SortedFilenames() {
+			fileIdx := result.FilenamesIndices[filePath]
+			file := jsonFile{FilePath: filePath, Values: map[string]any{}}
+
+			for key, values := range result.Values {
+				if value, ok := values[fileIdx]; ok {
+					file.Values[key] = jsonValue(key, value)
+				}
+			}
+
+			for errorType, values := range result.ByErrorType[fileIdx] {
+				if file.ByErrorType == nil {
+					file.ByErrorType = map[string]map[string]any{}
+				}
+
+				file.ByErrorType[errorType] = map[string]any{}
+				for key, value := range values {
+					file.ByErrorType[errorType][key] = jsonValue(key, value)
+				}
+			}
+
+			participant.Files = append(participant.Files, file)
+		}
+		out.Participants = append(out.Participants, participant)
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(out)
+}
+
+// formatCell formats the cell for the markdown and HTML reports
+func formatCell(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case float64:
+		s := strconv.FormatFloat(v, 'f', 4, 64)
+		s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+		if s == "-0" {
+			return "0"
+		}
+		return s
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+var markdownEscaper = strings.NewReplacer("|", `\|`, "\n", " ")
+
+// writeMarkdown writes each table under its own heading
+func writeMarkdown(w io.Writer, r *Report) error {
+	var sb strings.Builder
+	sb.WriteString("# Analysis Results\n")
+
+	for _, table := range r.Tables {
+		fmt.Fprintf(&sb, "\n## %s\n\n", table.Name)
+
+		sb.WriteString("|")
+		for _, header := range table.Headers {
+			fmt.Fprintf(&sb, " %s |", markdownEscaper.Replace(header))
+		}
+
+		sb.WriteString("\n|")
+		for range table.Headers {
+			sb.WriteString(" --- |")
+		}
+		sb.WriteString("\n")
+
+		for _, row := range table.Rows {
+			sb.WriteString("|")
+			for _, value := range row {
+				fmt.Fprintf(&sb, " %s |", markdownEscaper.Replace(formatCell(value)))
+			}
+			sb.WriteString("\n")
+		}
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
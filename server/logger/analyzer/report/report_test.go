@@ -0,0 +1,192 @@
+package report_test
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nedpals/bugbuddy/server/logger/analyzer"
+	"github.com/nedpals/bugbuddy/server/logger/analyzer/report"
+	"github.com/tealeg/xlsx/v3"
+)
+
+var registrations = []analyzer.Registration{
+	{
+		Name:        "eq",
+		DisplayName: "Error Quotient",
+		Metrics:     []analyzer.Metric{{Key: "eq", DisplayName: "Error Quotient", Type: analyzer.FloatValue}},
+	},
+	{
+		Name:        "tts",
+		DisplayName: "Time To Solve",
+		Metrics:     []analyzer.Metric{{Key: "tts", DisplayName: "Time To Solve", Type: analyzer.DurationValue, ByErrorType: true}},
+	},
+}
+
+func setupReport() *report.Report {
+	results := report.Results{}
+	results.Write("eq", "student-b", "main.py", 0.5)
+	results.Write("tts", "student-b", "main.py", 90*time.Second)
+	analyzer.WriteDimension(results, "tts", "student-b", "main.py", analyzer.ErrorTypeDimension, "NameError", 90*time.Second)
+	results.Write("eq", "student-a", "/lab/hello.py", 0.25)
+	results.Write("tts", "student-a", "/lab/hello.py", time.Minute)
+	results.Write("episodes", "student-a", "/lab/hello.py", []string{"not a metric"})
+
+	return report.New(registrations, results)
+}
+
+func TestNew(t *testing.T) {
+	r := setupReport()
+
+	names := []string{}
+	for _, table := range r.Tables {
+		names = append(names, table.Name)
+	}
+
+	if strings.Join(names, ",") != "student-a,student-b,student-b (errors)" {
+		t.Fatalf("Unexpected tables %v", names)
+	}
+
+	expectedHeaders := []string{"File Path", "Error Quotient", "Time To Solve", "Time To Solve (HH:MM:SS)"}
+	if strings.Join(r.Tables[0].Headers, ",") != strings.Join(expectedHeaders, ",") {
+		t.Errorf("Unexpected headers %v", r.Tables[0].Headers)
+	}
+
+	if len(r.Tables[0].Rows) != 1 {
+		t.Fatalf("Expected a row for hello.py, got %v", r.Tables[0].Rows)
+	} else if row := r.Tables[0].Rows[0]; row[1] != 0.25 || row[2] != 60.0 || row[3] != "0:01:00" {
+		t.Errorf("Unexpected row %v", row)
+	}
+}
+
+func TestWrite_CSV(t *testing.T) {
+	var out bytes.Buffer
+	if err := report.Write(report.CSV, &out, setupReport()); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := csv.NewReader(&out).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := [][]string{
+		{"participant_id", "file_path", "metric", "error_type", "value"},
+		{"student-a", "/lab/hello.py", "eq", "", "0.25"},
+		{"student-a", "/lab/hello.py", "tts", "", "60"},
+		{"student-b", "main.py", "eq", "", "0.5"},
+		{"student-b", "main.py", "tts", "", "90"},
+		{"student-b", "main.py", "tts", "NameError", "90"},
+	}
+
+	if len(records) != len(expected) {
+		t.Fatalf("Expected %d records, got %v", len(expected), records)
+	}
+
+	for i, record := range records {
+		if strings.Join(record, ",") != strings.Join(expected[i], ",") {
+			t.Errorf("Expected record %d to be %v, got %v", i, expected[i], record)
+		}
+	}
+}
+
+func TestWrite_JSON(t *testing.T) {
+	var out bytes.Buffer
+	if err := report.Write(report.JSON, &out, setupReport()); err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded struct {
+		Analyzers    []analyzer.Registration `json:"analyzers"`
+		Participants []struct {
+			ParticipantId string `json:"participant_id"`
+			Files         []struct {
+				FilePath    string                    `json:"file_path"`
+				Values      map[string]any            `json:"values"`
+				ByErrorType map[string]map[string]any `json:"by_error_type"`
+			} `json:"files"`
+		} `json:"participants"`
+	}
+
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(decoded.Analyzers) != 2 || len(decoded.Participants) != 2 {
+		t.Fatalf("Unexpected report %s", out.String())
+	}
+
+	// the values which are not metrics are kept
+	hello := decoded.Participants[0].Files[0]
+	if hello.Values["tts"] != 60.0 || hello.Values["episodes"] == nil {
+		t.Errorf("Unexpected values %v", hello.Values)
+	}
+
+	if main := decoded.Participants[1].Files[0]; main.ByErrorType["NameError"]["tts"] != 90.0 {
+		t.Errorf("Unexpected values by error type %v", main.ByErrorType)
+	}
+}
+
+func TestWrite_XLSX(t *testing.T) {
+	var out bytes.Buffer
+	if err := report.Write(report.XLSX, &out, setupReport()); err != nil {
+		t.Fatal(err)
+	}
+
+	wb, err := xlsx.OpenBinary(out.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(wb.Sheets) != 3 || wb.Sheets[2].Name != "student-b (errors)" {
+		t.Fatalf("Unexpected sheets %v", wb.Sheet)
+	}
+
+	cell, err := wb.Sheets[1].Cell(1, 2)
+	if err != nil {
+		t.Fatal(err)
+	} else if cell.Value != "90" {
+		t.Errorf("Expected the time to solve to be 90, got %s", cell.Value)
+	}
+}
+
+func TestWrite_Markdown(t *testing.T) {
+	var out bytes.Buffer
+	if err := report.Write(report.Markdown, &out, setupReport()); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "## student-b\n\n" +
+		"| File Path | Error Quotient | Time To Solve | Time To Solve (HH:MM:SS) |\n" +
+		"| --- | --- | --- | --- |\n" +
+		"| main.py | 0.5 | 90 | 0:01:30 |\n"
+
+	if !strings.Contains(out.String(), expected) {
+		t.Errorf("Expected the table of student-b, got\n%s", out.String())
+	}
+}
+
+func TestWrite_HTML(t *testing.T) {
+	var out bytes.Buffer
+	if err := report.Write(report.HTML, &out, setupReport()); err != nil {
+		t.Fatal(err)
+	}
+
+	html := out.String()
+	if count := strings.Count(html, "<svg"); count != 2 {
+		t.Errorf("Expected a chart for each metric, got %d", count)
+	} else if count := strings.Count(html, `<table class="sortable">`); count != 3 {
+		t.Errorf("Expected a table for each table of the report, got %d", count)
+	} else if !strings.Contains(html, `<td data-value="90">90</td>`) {
+		t.Errorf("Expected the numeric cells to have a sort value")
+	}
+}
+
+func TestWrite_UnsupportedFormat(t *testing.T) {
+	if err := report.Write("pdf", &bytes.Buffer{}, setupReport()); err == nil {
+		t.Error("Expected an error for an unsupported format")
+	}
+}
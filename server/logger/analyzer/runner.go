@@ -0,0 +1,201 @@
+package analyzer
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"sync"
+)
+
+// Runner runs a set of analyzers over a set of logs. Each log is read once
+// and its entries are passed to the streams of all of the streaming
+// analyzers. The logs are read at the same time by a pool of workers.
+//
+// The results of each log are kept until all of the logs are read and are
+// then written in the order of the analyzers and the loaders, so that the
+// output does not depend on which log finished first. Analyzers which do
+// not support streaming are run afterwards with all of the loaders.
+type Runner struct {
+	Analyzers []LoggerAnalyzer
+	// Workers is the number of logs read at the same time. It defaults to
+	// the number of CPUs.
+	Workers int
+	// CloseLogs closes each log once it is read, so that only the logs
+	// being read are open. It is set when the loaders open new loggers,
+	// such as the ones of NewLoaderFromPaths, and not when they return
+	// loggers which are still used afterwards.
+	CloseLogs bool
+}
+
+// logResult is the result of the streaming analyzers for a log
+type logResult struct {
+	// streams and outputs are indexed like Runner.Analyzers. They are nil
+	// for analyzers which do not support streaming.
+	streams []Stream
+	outputs []*bufferedKVWriter
+	err     error
+}
+
+func (r *Runner) Run(writer KVWriter, loaders ...LoggerLoader) error {
+	workers := r.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	results := make([]logResult, len(loaders))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < min(workers, len(loaders)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range jobs {
+				results[idx] = r.read(loaders[idx])
+			}
+		}()
+	}
+
+	for idx := range loaders {
+		jobs <- idx
+	}
+	close(jobs)
+	wg.Wait()
+
+	for _, result := range results {
+		if result.err != nil {
+			return result.err
+		}
+	}
+
+	for aIdx, a := range r.Analyzers {
+		if _, ok := a.(StreamingAnalyzer); !ok {
+			if err := a.Analyze(writer, loaders...); err != nil {
+				return err
+			}
+			continue
+		}
+
+		streams := make([]Stream, len(results))
+		for lIdx, result := range results {
+			result.outputs[aIdx].replay(writer)
+			streams[lIdx] = result.streams[aIdx]
+		}
+
+		if finisher, ok := a.(Finisher); ok {
+			if err := finisher.Finish(writer, streams); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// read feeds the entries of the log to new streams of the analyzers
+func (r *Runner) read(loader LoggerLoader) (result logResult) {
+	result = logResult{
+		streams: make([]Stream, len(r.Analyzers)),
+		outputs: make([]*bufferedKVWriter, len(r.Analyzers)),
+	}
+
+	log, err := loader()
+	if err != nil {
+		result.err = err
+		return result
+	}
+
+	if r.CloseLogs {
+		defer func() {
+			if err := log.Close(); err != nil && result.err == nil {
+				result.err = err
+			}
+		}()
+	}
+
+	streams := []Stream{}
+	for i, a := range r.Analyzers {
+		if sa, ok := a.(StreamingAnalyzer); ok {
+			result.streams[i] = sa.NewStream(log)
+			result.outputs[i] = &bufferedKVWriter{}
+			streams = append(streams, result.streams[i])
+		}
+	}
+
+	if len(streams) == 0 {
+		return result
+	}
+
+	iter, err := log.AllEntries()
+	if err != nil {
+		result.abort(err)
+		return result
+	}
+	defer iter.Close()
+
+	for iter.Next() {
+		entry, err := iter.Value()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			continue
+		}
+
+		for _, stream := range streams {
+			if err := stream.Add(entry); err != nil {
+				result.abort(err)
+				return result
+			}
+		}
+	}
+
+	result.err = result.close()
+	return result
+}
+
+// close closes all of the streams, even if one of them fails, and returns
+// the first error
+func (result *logResult) close() error {
+	var firstErr error
+	for i, stream := range result.streams {
+		if stream == nil {
+			continue
+		}
+
+		if err := stream.Close(result.outputs[i]); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// abort closes the streams after the log could not be read, so that they
+// can release their resources such as the processes of the plugins. Their
+// results are not used.
+func (result *logResult) abort(err error) {
+	result.close()
+	result.err = err
+}
+
+// bufferedKVWriter records the values written to it so that they can be
+// written to another writer later in the same order
+type bufferedKVWriter struct {
+	writes []func(writer KVWriter)
+}
+
+func (b *bufferedKVWriter) Write(name string, pid string, file string, value interface{}) {
+	b.writes = append(b.writes, func(writer KVWriter) {
+		writer.Write(name, pid, file, value)
+	})
+}
+
+func (b *bufferedKVWriter) WriteDimension(name string, pid string, file string, dimension Dimension, category string, value interface{}) {
+	b.writes = append(b.writes, func(writer KVWriter) {
+		WriteDimension(writer, name, pid, file, dimension, category, value)
+	})
+}
+
+func (b *bufferedKVWriter) replay(writer KVWriter) {
+	for _, write := range b.writes {
+		write(writer)
+	}
+}
@@ -0,0 +1,365 @@
+package analyzer_test
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/nedpals/bugbuddy/server/logger"
+	"github.com/nedpals/bugbuddy/server/logger/analyzer"
+	errorfrequency "github.com/nedpals/bugbuddy/server/logger/analyzer/error_frequency"
+	errorquotient "github.com/nedpals/bugbuddy/server/logger/analyzer/error_quotient"
+	"github.com/nedpals/bugbuddy/server/logger/analyzer/npsm"
+	red "github.com/nedpals/bugbuddy/server/logger/analyzer/repeated_error_density"
+	timetosolve "github.com/nedpals/bugbuddy/server/logger/analyzer/time_to_solve"
+	"github.com/nedpals/bugbuddy/server/logger/analyzer/watwin"
+)
+
+var benchEntries = flag.Int("bench-entries", 1_000_000, "the number of entries of the synthetic database of the benchmarks")
+
+var errorTypes = []string{"", "NameError", "TypeError", "SyntaxError", "NullPointerException", "SymbolNotFoundError"}
+
+func allAnalyzers() []analyzer.LoggerAnalyzer {
+	return []analyzer.LoggerAnalyzer{
+		analyzer.New[*errorquotient.Analyzer](),
+		analyzer.New[*red.Analyzer](),
+		analyzer.New[*timetosolve.Analyzer](),
+		analyzer.New[*watwin.Analyzer](),
+		&npsm.Analyzer{Transitions: true},
+		analyzer.New[*errorfrequency.Analyzer](),
+	}
+}
+
+// generateEntries returns runs of the participants with random errors
+func generateEntries(seed int64, participants int, count int) []logger.LogEntry {
+	rng := rand.New(rand.NewSource(seed))
+	start := time.Date(2024, 6, 3, 8, 0, 0, 0, time.UTC)
+
+	entries := make([]logger.LogEntry, count)
+	for i := range entries {
+		errorType := errorTypes[rng.Intn(len(errorTypes))]
+		entry := logger.LogEntry{
+			ParticipantId:   fmt.Sprintf("student-%d", i%participants),
+			ExecutedCommand: "python3 main.py",
+			ErrorType:       errorType,
+			FilePath:        fmt.Sprintf("/lab/problem%d.py", rng.Intn(3)),
+			CreatedAt:       &logger.NullTime{Time: start.Add(time.Duration(i) * 17 * time.Second), Valid: true},
+		}
+
+		if len(errorType) != 0 {
+			entry.ErrorCode = 1
+			entry.ErrorMessage = errorType + ": oops"
+			entry.ErrorLine = rng.Intn(20) + 1
+		}
+		entries[i] = entry
+	}
+	return entries
+}
+
+type countingAnalyzer struct {
+	calls   int
+	loaders int
+}
+
+func (c *countingAnalyzer) Analyze(writer analyzer.KVWriter, loaders ...analyzer.LoggerLoader) error {
+	c.calls++
+	c.loaders = len(loaders)
+	writer.Write("counting", "student-0", "/lab/problem0.py", c.calls)
+	return nil
+}
+
+func TestRunner(t *testing.T) {
+	loaders := []analyzer.LoggerLoader{}
+	// opened counts the number of times the logs were loaded
+	var opened atomic.Int64
+
+	for i := 0; i < 4; i++ {
+		log := logger.NewMemoryLoggerPanic()
+		t.Cleanup(func() { log.Close() })
+
+		for _, entry := range generateEntries(int64(i), 3, 200) {
+			entry.ParticipantId += fmt.Sprintf("-%d", i%2)
+			if err := log.Log(entry); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		loader := analyzer.LoadFromExistingLogger(log)
+		loaders = append(loaders, func() (*logger.Logger, error) {
+			opened.Add(1)
+			return loader()
+		})
+	}
+
+	expected := analyzer.NewDefaultKV()
+	for _, a := range allAnalyzers() {
+		if err := a.Analyze(expected, loaders...); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	opened.Store(0)
+	counting := &countingAnalyzer{}
+
+	got := analyzer.NewDefaultKV()
+	runner := &analyzer.Runner{Analyzers: append(allAnalyzers(), counting), Workers: 3}
+	if err := runner.Run(got, loaders...); err != nil {
+		t.Fatal(err)
+	}
+
+	// each log is read once for all of the streaming analyzers, while the
+	// analyzer which does not support streaming gets the loaders
+	if count := opened.Load(); count != 4 {
+		t.Errorf("Expected the logs to be loaded 4 times, got %d", count)
+	} else if counting.calls != 1 || counting.loaders != 4 {
+		t.Errorf("Expected the analyzer to be called once with all of the logs, got %d calls with %d logs", counting.calls, counting.loaders)
+	}
+
+	delete(got, "counting")
+	if !reflect.DeepEqual(expected, got) {
+		t.Errorf("Expected the runner to produce the same results as the analyzers")
+	}
+}
+
+func TestRunner_LoaderError(t *testing.T) {
+	loadErr := errors.New("cannot open the log")
+	loaders := []analyzer.LoggerLoader{
+		analyzer.LoadFromExistingLogger(logger.NewMemoryLoggerPanic()),
+		func() (*logger.Logger, error) { return nil, loadErr },
+	}
+
+	runner := &analyzer.Runner{Analyzers: allAnalyzers()}
+	if err := runner.Run(analyzer.NewDefaultKV(), loaders...); err != loadErr {
+		t.Errorf("Expected the error of the loader, got %v", err)
+	}
+}
+
+func TestRunner_CloseLogs(t *testing.T) {
+	var mu sync.Mutex
+	loggers := []*logger.Logger{}
+	maxOpen := 0
+
+	// isOpen reports whether the logger has not been closed yet
+	isOpen := func(lg *logger.Logger) bool {
+		_, err := lg.GetSetting("participant_id")
+		return err == nil || err == sql.ErrNoRows
+	}
+
+	loaders := make([]analyzer.LoggerLoader, 8)
+	for i := range loaders {
+		seed := int64(i)
+		loaders[i] = func() (*logger.Logger, error) {
+			lg, err := logger.NewMemoryLogger()
+			if err != nil {
+				return nil, err
+			}
+
+			for _, entry := range generateEntries(seed, 2, 50) {
+				if err := lg.Log(entry); err != nil {
+					return nil, err
+				}
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			loggers = append(loggers, lg)
+			open := 0
+			for _, other := range loggers {
+				if isOpen(other) {
+					open++
+				}
+			}
+			maxOpen = max(maxOpen, open)
+			return lg, nil
+		}
+	}
+
+	runner := &analyzer.Runner{Analyzers: allAnalyzers(), Workers: 2, CloseLogs: true}
+	if err := runner.Run(analyzer.NewDefaultKV(), loaders...); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(loggers) != len(loaders) {
+		t.Fatalf("Expected each log to be opened once, got %d", len(loggers))
+	} else if maxOpen > runner.Workers {
+		t.Errorf("Expected at most %d logs to be open at the same time, got %d", runner.Workers, maxOpen)
+	}
+
+	closed := 0
+	for _, lg := range loggers {
+		if !isOpen(lg) {
+			closed++
+		}
+	}
+
+	if closed != len(loaders) {
+		t.Errorf("Expected all of the %d logs to be closed, got %d", len(loaders), closed)
+	}
+}
+
+// closingAnalyzer records whether its streams were closed and fails after
+// the number of entries given by failAfter, if set
+type closingAnalyzer struct {
+	failAfter int
+	closed    atomic.Int64
+}
+
+func (c *closingAnalyzer) Analyze(writer analyzer.KVWriter, loaders ...analyzer.LoggerLoader) error {
+	return analyzer.AnalyzeStreams(c, writer, loaders...)
+}
+
+func (c *closingAnalyzer) NewStream(log *logger.Logger) analyzer.Stream {
+	return &closingStream{analyzer: c}
+}
+
+type closingStream struct {
+	analyzer *closingAnalyzer
+	entries  int
+}
+
+var errStream = errors.New("cannot analyze the entry")
+
+func (s *closingStream) Add(entry logger.LogEntry) error {
+	s.entries++
+	if s.analyzer.failAfter != 0 && s.entries >= s.analyzer.failAfter {
+		return errStream
+	}
+	return nil
+}
+
+func (s *closingStream) Close(writer analyzer.KVWriter) error {
+	s.analyzer.closed.Add(1)
+	return nil
+}
+
+func TestRunner_StreamError(t *testing.T) {
+	log := logger.NewMemoryLoggerPanic()
+	defer log.Close()
+
+	for _, entry := range generateEntries(1, 1, 10) {
+		if err := log.Log(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	closing := &closingAnalyzer{}
+	failing := &closingAnalyzer{failAfter: 2}
+
+	runner := &analyzer.Runner{Analyzers: []analyzer.LoggerAnalyzer{closing, failing}}
+	if err := runner.Run(analyzer.NewDefaultKV(), analyzer.LoadFromExistingLogger(log)); err != errStream {
+		t.Fatalf("Expected the error of the stream, got %v", err)
+	}
+
+	// the streams are closed when another stream fails
+	if count := closing.closed.Load(); count != 1 {
+		t.Errorf("Expected the stream to be closed once, got %d", count)
+	} else if count := failing.closed.Load(); count != 1 {
+		t.Errorf("Expected the failing stream to be closed once, got %d", count)
+	}
+}
+
+// createSyntheticDatabase stores the entries in a new database. The
+// entries are inserted in a single transaction since logging them one at
+// a time takes too long for the benchmarks.
+func createSyntheticDatabase(b *testing.B, entries []logger.LogEntry) string {
+	b.Helper()
+
+	dbPath := filepath.Join(b.TempDir(), "logs.db")
+	log, err := logger.NewLoggerFromPath(dbPath)
+	if err != nil {
+		b.Fatal(err)
+	} else if err := log.Close(); err != nil {
+		b.Fatal(err)
+	}
+
+	db, err := sqlx.Open("sqlite", dbPath)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer db.Close()
+
+	tx, err := db.Beginx()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	stmt, err := tx.PrepareNamed(`INSERT INTO logs (
+	participant_id, executed_command, error_code, error_line, error_column, error_type,
+	error_message, generated_output, file_path, file_version, created_at
+) VALUES (
+	:participant_id, :executed_command, :error_code, :error_line, :error_column, :error_type,
+	:error_message, :generated_output, :file_path, :file_version, :created_at
+)`)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for _, entry := range entries {
+		if _, err := stmt.Exec(&entry); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		b.Fatal(err)
+	}
+	return dbPath
+}
+
+func BenchmarkRunner(b *testing.B) {
+	entries := *benchEntries
+	const databases = 4
+
+	paths := make([]string, databases)
+	for i := range paths {
+		paths[i] = createSyntheticDatabase(b, generateEntries(int64(i), 100, entries/databases))
+	}
+
+	openAll := func(b *testing.B) []analyzer.LoggerLoader {
+		loaders := []analyzer.LoggerLoader{}
+		for _, path := range paths {
+			log, err := logger.NewLoggerFromPath(path)
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.Cleanup(func() { log.Close() })
+			loaders = append(loaders, analyzer.LoadFromExistingLogger(log))
+		}
+		return loaders
+	}
+
+	b.Run("Sequential", func(b *testing.B) {
+		loaders := openAll(b)
+		b.ResetTimer()
+
+		for i := 0; i < b.N; i++ {
+			for _, a := range allAnalyzers() {
+				if err := a.Analyze(analyzer.NewDefaultKV(), loaders...); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+
+	b.Run("Runner", func(b *testing.B) {
+		loaders := openAll(b)
+		b.ResetTimer()
+
+		for i := 0; i < b.N; i++ {
+			runner := &analyzer.Runner{Analyzers: allAnalyzers()}
+			if err := runner.Run(analyzer.NewDefaultKV(), loaders...); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
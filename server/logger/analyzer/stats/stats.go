@@ -0,0 +1,243 @@
+package stats
+
+import (
+	"errors"
+	"math"
+	"slices"
+	"sort"
+)
+
+// ErrNotEnoughValues is returned when a test cannot be computed from the
+// values, such as a t-test of a group with a single value
+var ErrNotEnoughValues = errors.New("not enough values")
+
+// Summary describes a sample
+type Summary struct {
+	N      int     `json:"n"`
+	Mean   float64 `json:"mean"`
+	Median float64 `json:"median"`
+	// SD is the sample standard deviation. It is zero for less than two
+	// values.
+	SD float64 `json:"sd"`
+}
+
+// Describe returns the summary of the values
+func Describe(values []float64) Summary {
+	s := Summary{N: len(values)}
+	if len(values) == 0 {
+		return s
+	}
+
+	s.Mean = mean(values)
+	s.SD = math.Sqrt(variance(values, s.Mean))
+
+	sorted := slices.Clone(values)
+	sort.Float64s(sorted)
+	if middle := len(sorted) / 2; len(sorted)%2 == 0 {
+		s.Median = (sorted[middle-1] + sorted[middle]) / 2
+	} else {
+		s.Median = sorted[middle]
+	}
+	return s
+}
+
+func mean(values []float64) float64 {
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+// variance returns the sample variance of the values
+func variance(values []float64, mean float64) float64 {
+	if len(values) < 2 {
+		return 0
+	}
+
+	sum := 0.0
+	for _, v := range values {
+		sum += (v - mean) * (v - mean)
+	}
+	return sum / float64(len(values)-1)
+}
+
+// MannWhitney is the result of a Mann-Whitney U test
+type MannWhitney struct {
+	// U is the statistic of the first sample
+	U float64 `json:"u"`
+	Z float64 `json:"z"`
+	// P is the two-sided p-value
+	P float64 `json:"p"`
+	// RankBiserial is the effect size, from -1 to 1. It is positive if the
+	// values of the first sample tend to be larger.
+	RankBiserial float64 `json:"rank_biserial"`
+}
+
+// MannWhitneyU compares the samples with the Mann-Whitney U test. The
+// p-value uses the normal approximation with tie and continuity
+// corrections.
+func MannWhitneyU(a, b []float64) (MannWhitney, error) {
+	if len(a) == 0 || len(b) == 0 {
+		return MannWhitney{}, ErrNotEnoughValues
+	}
+
+	type rankedValue struct {
+		value float64
+		first bool
+	}
+
+	values := make([]rankedValue, 0, len(a)+len(b))
+	for _, v := range a {
+		values = append(values, rankedValue{v, true})
+	}
+	for _, v := range b {
+		values = append(values, rankedValue{v, false})
+	}
+	sort.SliceStable(values, func(i, j int) bool { return values[i].value < values[j].value })
+
+	// tied values share the average of their ranks
+	rankSumA, tieSum := 0.0, 0.0
+	for i := 0; i < len(values); {
+		j := i
+		for j < len(values) && values[j].value == values[i].value {
+			j++
+		}
+
+		rank := float64(i+j+1) / 2
+		for k := i; k < j; k++ {
+			if values[k].first {
+				rankSumA += rank
+			}
+		}
+
+		ties := float64(j - i)
+		tieSum += ties*ties*ties - ties
+		i = j
+	}
+
+	n1, n2 := float64(len(a)), float64(len(b))
+	n := n1 + n2
+
+	result := MannWhitney{U: rankSumA - n1*(n1+1)/2, P: 1}
+	result.RankBiserial = 2*result.U/(n1*n2) - 1
+
+	sigma := math.Sqrt(n1 * n2 / 12 * ((n + 1) - tieSum/(n*(n-1))))
+	if sigma == 0 {
+		// all of the values are tied
+		return result, nil
+	}
+
+	delta := result.U - n1*n2/2
+	result.Z = math.Copysign(math.Max(math.Abs(delta)-0.5, 0), delta) / sigma
+	result.P = math.Erfc(math.Abs(result.Z) / math.Sqrt2)
+	return result, nil
+}
+
+// Welch is the result of Welch's t-test
+type Welch struct {
+	T  float64 `json:"t"`
+	DF float64 `json:"df"`
+	// P is the two-sided p-value
+	P float64 `json:"p"`
+	// CohensD is the difference of the means divided by the pooled
+	// standard deviation
+	CohensD float64 `json:"cohens_d"`
+	// HedgesG is Cohen's d corrected for small samples
+	HedgesG float64 `json:"hedges_g"`
+}
+
+// WelchTTest compares the means of the samples with Welch's t-test, which
+// does not assume equal variances
+func WelchTTest(a, b []float64) (Welch, error) {
+	if len(a) < 2 || len(b) < 2 {
+		return Welch{}, ErrNotEnoughValues
+	}
+
+	n1, n2 := float64(len(a)), float64(len(b))
+	mean1, mean2 := mean(a), mean(b)
+	var1, var2 := variance(a, mean1), variance(b, mean2)
+
+	se1, se2 := var1/n1, var2/n2
+	if se1+se2 == 0 {
+		// the t statistic is undefined if both samples are constant
+		return Welch{}, ErrNotEnoughValues
+	}
+
+	result := Welch{T: (mean1 - mean2) / math.Sqrt(se1+se2)}
+	result.DF = (se1 + se2) * (se1 + se2) / (se1*se1/(n1-1) + se2*se2/(n2-1))
+	result.P = studentTwoSidedP(result.T, result.DF)
+
+	pooledSD := math.Sqrt(((n1-1)*var1 + (n2-1)*var2) / (n1 + n2 - 2))
+	result.CohensD = (mean1 - mean2) / pooledSD
+	result.HedgesG = result.CohensD * (1 - 3/(4*(n1+n2)-9))
+	return result, nil
+}
+
+// studentTwoSidedP returns P(|T| >= |t|) of Student's t distribution
+func studentTwoSidedP(t float64, df float64) float64 {
+	return regularizedIncompleteBeta(df/(df+t*t), df/2, 0.5)
+}
+
+// regularizedIncompleteBeta returns I_x(a, b)
+func regularizedIncompleteBeta(x, a, b float64) float64 {
+	if x <= 0 {
+		return 0
+	} else if x >= 1 {
+		return 1
+	}
+
+	lga, _ := math.Lgamma(a)
+	lgb, _ := math.Lgamma(b)
+	lgab, _ := math.Lgamma(a + b)
+	front := math.Exp(lgab - lga - lgb + a*math.Log(x) + b*math.Log(1-x))
+
+	// the continued fraction converges quickly below the mean of the
+	// distribution, otherwise the symmetry I_x(a, b) = 1 - I_{1-x}(b, a)
+	// is used
+	if x < (a+1)/(a+b+2) {
+		return front * betaContinuedFraction(x, a, b) / a
+	}
+	return 1 - front*betaContinuedFraction(1-x, b, a)/b
+}
+
+// betaContinuedFraction evaluates the continued fraction of the incomplete
+// beta function with the modified Lentz's method
+func betaContinuedFraction(x, a, b float64) float64 {
+	const (
+		maxIterations = 300
+		epsilon       = 1e-15
+		tiny          = 1e-300
+	)
+
+	c, d := 1.0, 1-(a+b)*x/(a+1)
+	if math.Abs(d) < tiny {
+		d = tiny
+	}
+	d = 1 / d
+	h := d
+
+	for m := 1; m <= maxIterations; m++ {
+		fm := float64(m)
+		for _, numerator := range []float64{
+			fm * (b - fm) * x / ((a + 2*fm - 1) * (a + 2*fm)),
+			-(a + fm) * (a + b + fm) * x / ((a + 2*fm) * (a + 2*fm + 1)),
+		} {
+			d = 1 + numerator*d
+			if math.Abs(d) < tiny {
+				d = tiny
+			}
+			c = 1 + numerator/c
+			if math.Abs(c) < tiny {
+				c = tiny
+			}
+			d = 1 / d
+			h *= d * c
+		}
+
+		if math.Abs(d*c-1) < epsilon {
+			break
+		}
+	}
+	return h
+}
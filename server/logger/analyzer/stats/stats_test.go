@@ -0,0 +1,86 @@
+package stats_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/nedpals/bugbuddy/server/logger/analyzer/stats"
+)
+
+func assertClose(t *testing.T, name string, expected float64, got float64) {
+	t.Helper()
+	if math.Abs(expected-got) > 1e-6 {
+		t.Errorf("Expected %s to be %f, got %f", name, expected, got)
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	summary := stats.Describe([]float64{4, 1, 3, 2})
+	if summary.N != 4 {
+		t.Errorf("Expected 4 values, got %d", summary.N)
+	}
+
+	assertClose(t, "mean", 2.5, summary.Mean)
+	assertClose(t, "median", 2.5, summary.Median)
+	assertClose(t, "sd", 1.290994, summary.SD)
+
+	single := stats.Describe([]float64{7})
+	assertClose(t, "median", 7, single.Median)
+	assertClose(t, "sd", 0, single.SD)
+
+	if empty := stats.Describe(nil); empty != (stats.Summary{}) {
+		t.Errorf("Expected an empty summary, got %+v", empty)
+	}
+}
+
+func TestMannWhitneyU(t *testing.T) {
+	// same as wilcox.test(a, b, exact = FALSE, correct = TRUE) in R
+	result, err := stats.MannWhitneyU([]float64{1, 2, 2, 3, 5}, []float64{2, 4, 6, 6, 7, 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertClose(t, "U", 4, result.U)
+	assertClose(t, "z", -1.939192, result.Z)
+	assertClose(t, "p", 0.052478, result.P)
+	assertClose(t, "rank-biserial correlation", -0.733333, result.RankBiserial)
+
+	tied, err := stats.MannWhitneyU([]float64{1, 1}, []float64{1, 1, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertClose(t, "p of tied values", 1, tied.P)
+
+	if _, err := stats.MannWhitneyU([]float64{1}, nil); err != stats.ErrNotEnoughValues {
+		t.Errorf("Expected ErrNotEnoughValues, got %v", err)
+	}
+}
+
+func TestWelchTTest(t *testing.T) {
+	result, err := stats.WelchTTest([]float64{1, 2, 3, 4, 5}, []float64{2, 4, 6, 8, 10, 12})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertClose(t, "t", -2.376354, result.T)
+	assertClose(t, "df", 6.972256, result.DF)
+	assertClose(t, "p", 0.049284, result.P)
+	assertClose(t, "Cohen's d", -1.341641, result.CohensD)
+	assertClose(t, "Hedges' g", -1.226643, result.HedgesG)
+
+	equal, err := stats.WelchTTest([]float64{0, 2, 4, 6, 8, 10}, []float64{0, 2, 4, 6, 8, 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertClose(t, "t of equal samples", 0, equal.T)
+	assertClose(t, "p of equal samples", 1, equal.P)
+
+	for _, samples := range [][2][]float64{
+		{{1}, {1, 2}},
+		{{3, 3}, {3, 3, 3}},
+	} {
+		if _, err := stats.WelchTTest(samples[0], samples[1]); err != stats.ErrNotEnoughValues {
+			t.Errorf("Expected ErrNotEnoughValues for %v, got %v", samples, err)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package analyzer
+
+import (
+	"github.com/nedpals/bugbuddy/server/logger"
+)
+
+// Stream receives the entries of a log one at a time, in the order of
+// logger.AllEntries, so that the analyzer does not have to keep all of the
+// entries in memory
+type Stream interface {
+	Add(entry logger.LogEntry) error
+	// Close writes the results of the log after its last entry was added.
+	// It is also called when the log could not be read, in which case the
+	// results are discarded.
+	Close(writer KVWriter) error
+}
+
+// StreamingAnalyzer is an analyzer which can be fed by a Runner. The
+// Runner reads each log once and passes its entries to the streams of all
+// of the analyzers.
+type StreamingAnalyzer interface {
+	LoggerAnalyzer
+	// NewStream starts the analysis of the log. The streams of different
+	// logs may be used at the same time.
+	NewStream(log *logger.Logger) Stream
+}
+
+// Finisher is implemented by streaming analyzers which compare the logs
+// with each other, such as the population statistics of watwin. Finish is
+// called once all of the logs are read with the closed streams of the logs
+// in the order of the loaders.
+type Finisher interface {
+	Finish(writer KVWriter, streams []Stream) error
+}
+
+// AnalyzeStreams reads the logs one after another and feeds them to the
+// streams of the analyzer. Streaming analyzers use it to implement
+// LoggerAnalyzer.
+func AnalyzeStreams(a StreamingAnalyzer, writer KVWriter, loaders ...LoggerLoader) error {
+	runner := &Runner{Analyzers: []LoggerAnalyzer{a}, Workers: 1}
+	return runner.Run(writer, loaders...)
+}
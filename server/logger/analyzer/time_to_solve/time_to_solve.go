@@ -1,60 +1,206 @@
 package timetosolve
 
 import (
+	"encoding/json"
+	"math"
+	"slices"
 	"time"
 
+	"github.com/nedpals/bugbuddy/server/logger"
 	"github.com/nedpals/bugbuddy/server/logger/analyzer"
-	"github.com/nedpals/bugbuddy/server/logger/analyzer/internal"
 )
 
-const KEY = "time_to_solve"
+const (
+	KEY = "time_to_solve"
+	// EPISODES_KEY is the key of the error episodes of each file
+	EPISODES_KEY = "time_to_solve_episodes"
+	// the keys of the Summary of the episodes of each file
+	EPISODE_COUNT_KEY = "time_to_solve_episode_count"
+	MEDIAN_KEY        = "time_to_solve_median"
+	P90_KEY           = "time_to_solve_p90"
+)
+
+func init() {
+	analyzer.Register(analyzer.Registration{
+		Name:        "tts",
+		DisplayName: "Time To Solve",
+		Metrics: []analyzer.Metric{
+			{Key: KEY, DisplayName: "Time To Solve", Type: analyzer.DurationValue, ByErrorType: true},
+			{Key: EPISODE_COUNT_KEY, DisplayName: "Episodes", Type: analyzer.CountValue},
+			{Key: MEDIAN_KEY, DisplayName: "Median Time To Solve", Type: analyzer.DurationValue},
+			{Key: P90_KEY, DisplayName: "P90 Time To Solve", Type: analyzer.DurationValue},
+		},
+		New: func() analyzer.LoggerAnalyzer { return &Analyzer{} },
+	})
+}
+
+// Episode is the time from a failed run of a file to the next successful
+// run of the same file
+type Episode struct {
+	// ErrorType is the error type of the failed run which started the episode
+	ErrorType string
+	StartedAt time.Time
+	SolvedAt  time.Time
+	// Duration is the time spent solving the error without the idle gaps
+	Duration time.Duration
+}
+
+// MarshalJSON writes the duration of the episode in seconds
+func (e Episode) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		ErrorType string    `json:"error_type"`
+		StartedAt time.Time `json:"started_at"`
+		SolvedAt  time.Time `json:"solved_at"`
+		Duration  float64   `json:"duration"`
+	}{e.ErrorType, e.StartedAt, e.SolvedAt, e.Duration.Seconds()})
+}
+
+// Summary describes the durations of a set of episodes
+type Summary struct {
+	Count  int
+	Median time.Duration
+	P90    time.Duration
+}
+
+// Summarize returns the number of episodes and the median and the 90th
+// percentile of their durations
+func Summarize(episodes []Episode) Summary {
+	durations := make([]time.Duration, len(episodes))
+	for i, episode := range episodes {
+		durations[i] = episode.Duration
+	}
+	slices.Sort(durations)
 
-type Analyzer struct{}
+	return Summary{
+		Count:  len(durations),
+		Median: percentile(durations, 0.5),
+		P90:    percentile(durations, 0.9),
+	}
+}
+
+// percentile interpolates linearly between the closest ranks of the
+// sorted durations
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	rank := p * float64(len(sorted)-1)
+	lower, upper := int(math.Floor(rank)), int(math.Ceil(rank))
+	fraction := rank - float64(lower)
+	return sorted[lower] + time.Duration(fraction*float64(sorted[upper]-sorted[lower]))
+}
+
+// fileKey identifies the runs of a file of a participant
+type fileKey struct {
+	participantId string
+	filePath      string
+}
+
+// Analyzer segments the runs of each file into error episodes. Each
+// episode starts with a failed run and ends with the next successful run
+// of the same file. Episodes which are not solved by the end of the log are
+// left out.
+//
+// The time to solve of a file is the sum of the durations of its episodes.
+// Gaps between two runs of a participant longer than IdleThreshold are not
+// counted towards the episodes. The gaps are always counted if the
+// threshold is zero.
+type Analyzer struct {
+	IdleThreshold time.Duration
+}
 
 func (t *Analyzer) Analyze(writer analyzer.KVWriter, loaders ...analyzer.LoggerLoader) error {
-	for _, loader := range loaders {
-		log, err := loader()
-		if err != nil {
-			return err
-		}
+	return analyzer.AnalyzeStreams(t, writer, loaders...)
+}
 
-		iter, err := log.Entries()
-		if err != nil {
-			return err
-		}
+func (t *Analyzer) NewStream(log *logger.Logger) analyzer.Stream {
+	s := &stream{
+		openEpisodes: map[fileKey]*Episode{},
+		episodes:     map[fileKey][]Episode{},
+		keys:         []fileKey{},
+		lastRuns:     map[string]time.Time{},
+	}
 
-		// map[participantId]map[filePath]time.Time
-		startTimes := map[string]*internal.ResultStore[time.Time]{}
+	// the analyzer may be a nil pointer created with analyzer.New
+	if t != nil {
+		s.idleThreshold = t.IdleThreshold
+	}
+	return s
+}
 
-		for iter.Next() {
-			entry, err := iter.Value()
-			if err != nil {
-				continue
-			}
+type stream struct {
+	idleThreshold time.Duration
 
-			filePath := entry.FilePath
+	// the episode of each file which is not solved yet
+	openEpisodes map[fileKey]*Episode
+	episodes     map[fileKey][]Episode
+	// keys keeps the order in which the files were found
+	keys []fileKey
 
-			if _, ok := startTimes[entry.ParticipantId]; !ok {
-				startTimes[entry.ParticipantId] = internal.NewResultStore[time.Time]()
-			}
+	// the time of the last run of each participant
+	lastRuns map[string]time.Time
+}
+
+func (s *stream) Add(entry logger.LogEntry) error {
+	key := fileKey{participantId: entry.ParticipantId, filePath: entry.FilePath}
+	if _, ok := s.episodes[key]; !ok {
+		s.episodes[key] = []Episode{}
+		s.keys = append(s.keys, key)
+	}
 
-			if !startTimes[entry.ParticipantId].Has(filePath) {
-				startTime := startTimes[entry.ParticipantId].GetOr(filePath, time.Time{})
+	createdAt := entry.CreatedAt.Time
 
-				// if startTime is zero or startTime is greater than entry.CreatedAt.Time
-				// set the startTime to entry.CreatedAt.Time
-				if startTime.IsZero() || startTime.Compare(entry.CreatedAt.Time) > 0 {
-					startTimes[entry.ParticipantId].Set(filePath, entry.CreatedAt.Time)
+	// the participant was away from all of the files
+	if lastRun, ok := s.lastRuns[entry.ParticipantId]; ok && s.idleThreshold > 0 {
+		if gap := createdAt.Sub(lastRun); gap > s.idleThreshold {
+			for openKey, episode := range s.openEpisodes {
+				if openKey.participantId == entry.ParticipantId {
+					episode.Duration -= gap
 				}
 			}
+		}
+	}
+	s.lastRuns[entry.ParticipantId] = createdAt
 
-			// If this entry represents a successful compilation, update the TTS
-			if entry.ErrorCode == 0 {
-				startTime := startTimes[entry.ParticipantId].Get(filePath)
-				writer.Write(KEY, entry.ParticipantId, filePath, entry.CreatedAt.Time.Sub(startTime))
+	episode, isOpen := s.openEpisodes[key]
+	if entry.ErrorCode != 0 {
+		if !isOpen {
+			s.openEpisodes[key] = &Episode{
+				ErrorType: analyzer.ErrorTypeCategory(entry.ErrorType),
+				StartedAt: createdAt,
 			}
 		}
+	} else if isOpen {
+		// the successful run solves the episode
+		episode.SolvedAt = createdAt
+		episode.Duration += createdAt.Sub(episode.StartedAt)
+		s.episodes[key] = append(s.episodes[key], *episode)
+		delete(s.openEpisodes, key)
 	}
+	return nil
+}
+
+func (s *stream) Close(writer analyzer.KVWriter) error {
+	for _, key := range s.keys {
+		var tts time.Duration
+		typeTTS := map[string]time.Duration{}
+		for _, episode := range s.episodes[key] {
+			tts += episode.Duration
+			typeTTS[episode.ErrorType] += episode.Duration
+		}
+
+		writer.Write(KEY, key.participantId, key.filePath, tts)
+		writer.Write(EPISODES_KEY, key.participantId, key.filePath, s.episodes[key])
+
+		summary := Summarize(s.episodes[key])
+		writer.Write(EPISODE_COUNT_KEY, key.participantId, key.filePath, summary.Count)
+		writer.Write(MEDIAN_KEY, key.participantId, key.filePath, summary.Median)
+		writer.Write(P90_KEY, key.participantId, key.filePath, summary.P90)
 
+		for errorType, duration := range typeTTS {
+			analyzer.WriteDimension(writer, KEY, key.participantId, key.filePath, analyzer.ErrorTypeDimension, errorType, duration)
+		}
+	}
 	return nil
 }
@@ -1,6 +1,7 @@
 package timetosolve_test
 
 import (
+	"encoding/json"
 	"testing"
 	"time"
 
@@ -59,3 +60,119 @@ func TestTTSAnalyzer(t *testing.T) {
 		t.Errorf("Incorrect TTS for participant: got %v, want %v", tts, expectedTTS)
 	}
 }
+
+func TestTTSAnalyzer_Episodes(t *testing.T) {
+	log := logger.NewMemoryLoggerPanic()
+	defer log.Close()
+
+	start := time.Date(2024, 5, 6, 14, 0, 0, 0, time.UTC)
+	mockEvents := []struct {
+		errorType string
+		filePath  string
+		minutes   int
+	}{
+		{"", "/test/main.py", 0},
+		{"NameError", "/test/main.py", 5},
+		{"TypeError", "/test/main.py", 8},
+		{"", "/test/main.py", 10},
+		{"SyntaxError", "/test/main.py", 12},
+		// the participant takes a break and works on another file
+		{"", "/test/other.py", 72},
+		{"", "/test/main.py", 75},
+		{"ValueError", "/test/main.py", 80},
+	}
+
+	for _, e := range mockEvents {
+		entry := logger.LogEntry{
+			ErrorType: e.errorType,
+			FilePath:  e.filePath,
+			CreatedAt: &logger.NullTime{Time: start.Add(time.Duration(e.minutes) * time.Minute), Valid: true},
+		}
+		if len(e.errorType) != 0 {
+			entry.ErrorCode = 1
+		}
+
+		if err := log.Log(entry); err != nil {
+			t.Fatalf("Failed to log entry: %v", err)
+		}
+	}
+
+	for _, tc := range []struct {
+		idleThreshold time.Duration
+		// the durations of the two solved episodes
+		expected []time.Duration
+	}{
+		{0, []time.Duration{5 * time.Minute, 63 * time.Minute}},
+		// the hour between the runs is not counted
+		{30 * time.Minute, []time.Duration{5 * time.Minute, 3 * time.Minute}},
+	} {
+		kv := analyzer.NewDefaultKV()
+		ttsa := &timetosolve.Analyzer{IdleThreshold: tc.idleThreshold}
+		if err := ttsa.Analyze(kv, analyzer.LoadFromExistingLogger(log)); err != nil {
+			t.Fatalf("TTS Analyzer failed: %v", err)
+		}
+
+		episodes, ok := kv[timetosolve.EPISODES_KEY][log.ParticipantId()]["/test/main.py"].([]timetosolve.Episode)
+		if !ok || len(episodes) != 2 {
+			t.Fatalf("Expected 2 episodes, got %v", kv[timetosolve.EPISODES_KEY][log.ParticipantId()]["/test/main.py"])
+		}
+
+		// the unsolved ValueError is left out
+		if episodes[0].ErrorType != "NameError" || episodes[1].ErrorType != "SyntaxError" {
+			t.Errorf("Unexpected error types of the episodes %v", episodes)
+		}
+
+		for i, episode := range episodes {
+			if episode.Duration != tc.expected[i] {
+				t.Errorf("Expected episode %d to take %v with an idle threshold of %v, got %v", i, tc.expected[i], tc.idleThreshold, episode.Duration)
+			}
+		}
+
+		if tts := kv[timetosolve.KEY][log.ParticipantId()]["/test/main.py"]; tts != tc.expected[0]+tc.expected[1] {
+			t.Errorf("Expected a TTS of %v, got %v", tc.expected[0]+tc.expected[1], tts)
+		} else if tts := kv[timetosolve.KEY][log.ParticipantId()]["/test/other.py"]; tts != time.Duration(0) {
+			t.Errorf("Expected no TTS for a file without errors, got %v", tts)
+		}
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	episodes := []timetosolve.Episode{}
+	for _, minutes := range []int{10, 1, 4, 2, 3} {
+		episodes = append(episodes, timetosolve.Episode{Duration: time.Duration(minutes) * time.Minute})
+	}
+
+	// the 90th percentile is between 4 and 10 minutes: 4 + 0.6 * 6
+	summary := timetosolve.Summarize(episodes)
+	if summary.Count != 5 || summary.Median != 3*time.Minute || summary.P90 != 7*time.Minute+36*time.Second {
+		t.Errorf("Unexpected summary %+v", summary)
+	}
+
+	if summary := timetosolve.Summarize(episodes[:2]); summary.Median != 5*time.Minute+30*time.Second {
+		t.Errorf("Expected the median of two episodes to be their mean, got %v", summary.Median)
+	}
+
+	if summary := timetosolve.Summarize(nil); summary != (timetosolve.Summary{}) {
+		t.Errorf("Expected an empty summary, got %+v", summary)
+	}
+}
+
+func TestEpisode_MarshalJSON(t *testing.T) {
+	startedAt := time.Date(2024, 6, 3, 8, 0, 0, 0, time.UTC)
+	episode := timetosolve.Episode{
+		ErrorType: "NameError",
+		StartedAt: startedAt,
+		SolvedAt:  startedAt.Add(90 * time.Second),
+		Duration:  90 * time.Second,
+	}
+
+	encoded, err := json.Marshal(episode)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"error_type":"NameError","started_at":"2024-06-03T08:00:00Z","solved_at":"2024-06-03T08:01:30Z","duration":90}`
+	if string(encoded) != expected {
+		t.Errorf("Expected %s, got %s", expected, encoded)
+	}
+}
@@ -0,0 +1,245 @@
+package watwin
+
+import (
+	"math"
+	"strings"
+
+	"github.com/nedpals/bugbuddy/server/logger"
+	"github.com/nedpals/bugbuddy/server/logger/analyzer"
+)
+
+const KEY = "watwin"
+
+func init() {
+	analyzer.Register(analyzer.Registration{
+		Name:        "watwin",
+		DisplayName: "Watwin Score",
+		Metrics: []analyzer.Metric{
+			{Key: KEY, DisplayName: "Watwin Score", Type: analyzer.FloatValue},
+		},
+		New: func() analyzer.LoggerAnalyzer { return &Analyzer{} },
+	})
+}
+
+// Scores of the Watwin algorithm (Watson, Li and Godwin, 2013). The score
+// of a pair of compilations is the sum of the matching penalties and the
+// time penalty, normalized by MaxPairScore.
+const (
+	SameMessageScore = 4
+	SameTypeScore    = 4
+	SameLineScore    = 2
+	FastFixScore     = 1
+	AverageFixScore  = 15
+	SlowFixScore     = 25
+	MaxPairScore     = SameMessageScore + SameTypeScore + SameLineScore + SlowFixScore
+)
+
+// unknownErrorType is the error type of errors without a type
+const unknownErrorType = "UnknownError"
+
+// CompilationPair is a failed compilation followed by the next compilation
+// of the same file
+type CompilationPair struct {
+	ErrorType string
+	Message   string
+	Line      int
+	// NextIsError is true if the next compilation failed as well
+	NextIsError   bool
+	NextErrorType string
+	NextMessage   string
+	NextLine      int
+	// TimeToFix is the number of seconds between the compilations
+	TimeToFix float64
+}
+
+// ErrorTypeStats is the time to fix the errors of a type across the population
+type ErrorTypeStats struct {
+	Count int
+	Mean  float64
+	// SD is the population standard deviation of the time to fix
+	SD    float64
+	sum   float64
+	sumSq float64
+}
+
+func (s *ErrorTypeStats) add(timeToFix float64) {
+	s.Count++
+	s.sum += timeToFix
+	s.sumSq += timeToFix * timeToFix
+}
+
+func (s *ErrorTypeStats) finish() {
+	if s.Count == 0 {
+		return
+	}
+
+	s.Mean = s.sum / float64(s.Count)
+	s.SD = math.Sqrt(math.Max(0, s.sumSq/float64(s.Count)-s.Mean*s.Mean))
+}
+
+// ScorePair scores the pair of compilations. The time penalty compares the
+// time to fix the pair with the population statistics of its error type.
+func ScorePair(pair CompilationPair, stats ErrorTypeStats) int {
+	score := 0
+	if pair.NextIsError {
+		if pair.Message == pair.NextMessage {
+			score += SameMessageScore
+		}
+		if pair.ErrorType == pair.NextErrorType {
+			score += SameTypeScore
+		}
+		if pair.Line == pair.NextLine {
+			score += SameLineScore
+		}
+	}
+
+	switch {
+	case pair.TimeToFix < stats.Mean-stats.SD:
+		score += FastFixScore
+	case pair.TimeToFix > stats.Mean+stats.SD:
+		score += SlowFixScore
+	default:
+		score += AverageFixScore
+	}
+	return score
+}
+
+// Score is the average of the normalized scores of the pairs. It ranges
+// from 0 to 1 and is 0 if there are no pairs.
+func Score(pairs []CompilationPair, stats map[string]ErrorTypeStats) float64 {
+	if len(pairs) == 0 {
+		return 0
+	}
+
+	total := 0.0
+	for _, pair := range pairs {
+		total += float64(ScorePair(pair, stats[pair.ErrorType])) / MaxPairScore
+	}
+	return total / float64(len(pairs))
+}
+
+// compilation is the part of a log entry used for pairing the compilations
+type compilation struct {
+	isError   bool
+	errorType string
+	message   string
+	line      int
+}
+
+// fileKey identifies the compilations of a file of a participant
+type fileKey struct {
+	participantId string
+	filePath      string
+}
+
+// Analyzer computes the Watwin score of each file of each participant.
+// Since the time penalty depends on the whole population, the compilation
+// pairs of all of the loaded logs are collected before they are scored.
+type Analyzer struct{}
+
+func (a *Analyzer) Analyze(writer analyzer.KVWriter, loaders ...analyzer.LoggerLoader) error {
+	return analyzer.AnalyzeStreams(a, writer, loaders...)
+}
+
+func (a *Analyzer) NewStream(log *logger.Logger) analyzer.Stream {
+	return &stream{
+		pairs:    map[fileKey][]CompilationPair{},
+		last:     map[fileKey]compilation{},
+		lastTime: map[fileKey]float64{},
+	}
+}
+
+// stream pairs the compilations of each file of a log
+type stream struct {
+	pairs map[fileKey][]CompilationPair
+	// keys keeps the order in which the files were found
+	keys []fileKey
+
+	last     map[fileKey]compilation
+	lastTime map[fileKey]float64
+}
+
+func (s *stream) Add(entry logger.LogEntry) error {
+	// skip if the error message is "file not found". This is not the programmers fault.
+	if strings.Contains(entry.ErrorMessage, "error: file not found:") {
+		return nil
+	}
+
+	key := fileKey{participantId: entry.ParticipantId, filePath: entry.FilePath}
+	if _, ok := s.pairs[key]; !ok {
+		s.pairs[key] = []CompilationPair{}
+		s.keys = append(s.keys, key)
+	}
+
+	current := compilation{isError: entry.ErrorCode != 0}
+	if current.isError {
+		current.errorType = entry.ErrorType
+		if len(current.errorType) == 0 {
+			current.errorType = unknownErrorType
+		}
+		current.message = entry.ErrorMessage
+		current.line = entry.ErrorLine
+	}
+
+	createdAt := float64(entry.CreatedAt.Time.UnixNano()) / 1e9
+	if previous, ok := s.last[key]; ok && previous.isError {
+		s.pairs[key] = append(s.pairs[key], CompilationPair{
+			ErrorType:     previous.errorType,
+			Message:       previous.message,
+			Line:          previous.line,
+			NextIsError:   current.isError,
+			NextErrorType: current.errorType,
+			NextMessage:   current.message,
+			NextLine:      current.line,
+			TimeToFix:     createdAt - s.lastTime[key],
+		})
+	}
+
+	s.last[key] = current
+	s.lastTime[key] = createdAt
+	return nil
+}
+
+// Close writes nothing since the pairs are scored against all of the logs
+func (s *stream) Close(writer analyzer.KVWriter) error {
+	return nil
+}
+
+// Finish scores the pairs of all of the logs against the population
+func (a *Analyzer) Finish(writer analyzer.KVWriter, streams []analyzer.Stream) error {
+	pairs := map[fileKey][]CompilationPair{}
+	// keys keeps the order in which the files were found
+	keys := []fileKey{}
+
+	for _, st := range streams {
+		s := st.(*stream)
+		for _, key := range s.keys {
+			if _, ok := pairs[key]; !ok {
+				keys = append(keys, key)
+			}
+			pairs[key] = append(pairs[key], s.pairs[key]...)
+		}
+	}
+
+	// the population statistics of each error type. The pairs are added in
+	// the order of the files so that the sums do not change between runs.
+	stats := map[string]ErrorTypeStats{}
+	for _, key := range keys {
+		for _, pair := range pairs[key] {
+			typeStats := stats[pair.ErrorType]
+			typeStats.add(pair.TimeToFix)
+			stats[pair.ErrorType] = typeStats
+		}
+	}
+
+	for errorType, typeStats := range stats {
+		typeStats.finish()
+		stats[errorType] = typeStats
+	}
+
+	for _, key := range keys {
+		writer.Write(KEY, key.participantId, key.filePath, Score(pairs[key], stats))
+	}
+
+	return nil
+}
@@ -0,0 +1,143 @@
+package watwin_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/nedpals/bugbuddy/server/logger"
+	"github.com/nedpals/bugbuddy/server/logger/analyzer"
+	"github.com/nedpals/bugbuddy/server/logger/analyzer/watwin"
+)
+
+type mockCompilation struct {
+	errorType string
+	message   string
+	line      int
+	seconds   int
+}
+
+func newMockLogger(t *testing.T, participantId string, filePath string, compilations []mockCompilation) *logger.Logger {
+	t.Helper()
+
+	log, err := logger.NewMemoryLogger()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { log.Close() })
+
+	start := time.Date(2024, 1, 8, 13, 0, 0, 0, time.UTC)
+	for _, c := range compilations {
+		entry := logger.LogEntry{
+			ParticipantId: participantId,
+			FilePath:      filePath,
+			ErrorType:     c.errorType,
+			ErrorMessage:  c.message,
+			ErrorLine:     c.line,
+			CreatedAt:     &logger.NullTime{Time: start.Add(time.Duration(c.seconds) * time.Second), Valid: true},
+		}
+		if len(c.errorType) != 0 {
+			entry.ErrorCode = 1
+		}
+
+		if err := log.Log(entry); err != nil {
+			t.Fatalf("Failed to log compilation event: %v", err)
+		}
+	}
+	return log
+}
+
+func TestWatwinAnalyzer(t *testing.T) {
+	filePath := "/path/to/main.py"
+
+	// the participants are stored in separate logs but share the
+	// population statistics of the error types
+	logA := newMockLogger(t, "student-a", filePath, []mockCompilation{
+		{errorType: "NameError", message: "name 'x' is not defined", line: 3, seconds: 0},
+		{errorType: "NameError", message: "name 'x' is not defined", line: 3, seconds: 60},
+		{seconds: 120},
+	})
+
+	logB := newMockLogger(t, "student-b", filePath, []mockCompilation{
+		{errorType: "SyntaxError", message: "invalid syntax", line: 1, seconds: 0},
+		{seconds: 600},
+		{errorType: "NameError", message: "name 'y' is not defined", line: 5, seconds: 660},
+		{seconds: 690},
+	})
+
+	wa := analyzer.New[*watwin.Analyzer]()
+	kvs := analyzer.NewDefaultKV()
+
+	if err := wa.Analyze(kvs, analyzer.LoadFromExistingLogger(logA), analyzer.LoadFromExistingLogger(logB)); err != nil {
+		t.Fatalf("Watwin analysis failed: %v", err)
+	}
+
+	// The times to fix the NameErrors are 60, 60 and 30 seconds, so their
+	// mean is 50 seconds with a standard deviation of about 14.14 seconds.
+	//
+	// student-a:
+	// - the repeated NameError matches the message, type and line, and is
+	//   fixed in an average time: (4 + 4 + 2 + 15) / 35
+	// - the NameError is fixed in an average time: 15 / 35
+	// watwin = (25/35 + 15/35) / 2 = 4/7
+	//
+	// student-b:
+	// - the SyntaxError is the only one of its type: 15 / 35
+	// - the NameError is fixed faster than the mean minus the SD: 1 / 35
+	// watwin = (15/35 + 1/35) / 2 = 8/35
+	expected := map[string]float64{
+		"student-a": 4.0 / 7.0,
+		"student-b": 8.0 / 35.0,
+	}
+
+	for participantId, expectedScore := range expected {
+		score, ok := kvs[watwin.KEY][participantId][filePath].(float64)
+		if !ok {
+			t.Fatalf("No Watwin score found for participant %s", participantId)
+		} else if math.Abs(score-expectedScore) > 1e-9 {
+			t.Errorf("Expected Watwin score of %f for participant %s, but got %f", expectedScore, participantId, score)
+		}
+	}
+}
+
+func TestWatwinAnalyzer_NoErrors(t *testing.T) {
+	log := newMockLogger(t, "student-a", "/path/to/main.py", []mockCompilation{
+		{seconds: 0},
+		{seconds: 30},
+	})
+
+	kvs := analyzer.NewDefaultKV()
+	if err := analyzer.New[*watwin.Analyzer]().Analyze(kvs, analyzer.LoadFromExistingLogger(log)); err != nil {
+		t.Fatal(err)
+	}
+
+	if score := kvs[watwin.KEY]["student-a"]["/path/to/main.py"]; score != 0.0 {
+		t.Errorf("Expected a Watwin score of 0 without errors, but got %v", score)
+	}
+}
+
+func TestScorePair(t *testing.T) {
+	stats := watwin.ErrorTypeStats{Count: 10, Mean: 100, SD: 20}
+
+	pair := watwin.CompilationPair{
+		ErrorType:     "TypeError",
+		Message:       "unsupported operand",
+		Line:          4,
+		NextIsError:   true,
+		NextErrorType: "TypeError",
+		NextMessage:   "unsupported operand type",
+		NextLine:      4,
+		TimeToFix:     150,
+	}
+
+	// same type and line but a different message, fixed slowly
+	if score := watwin.ScorePair(pair, stats); score != watwin.SameTypeScore+watwin.SameLineScore+watwin.SlowFixScore {
+		t.Errorf("Expected a score of 31, got %d", score)
+	}
+
+	pair.NextIsError = false
+	pair.TimeToFix = 50
+	if score := watwin.ScorePair(pair, stats); score != watwin.FastFixScore {
+		t.Errorf("Expected a score of 1, got %d", score)
+	}
+}
@@ -0,0 +1,442 @@
+package logger
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	// AnonymizeSetting stores the anonymizer config used for scrubbing
+	// the logs and files before they are written into the database
+	AnonymizeSetting = "privacy.anonymize"
+
+	// HomePlaceholder replaces the home directories found in the logs
+	HomePlaceholder = "~"
+	// UserPlaceholder replaces the usernames found in the logs
+	UserPlaceholder = "<user>"
+	// RedactedPlaceholder replaces the matches of the redaction patterns
+	RedactedPlaceholder = "<redacted>"
+
+	// minUsernameLength avoids replacing very short usernames
+	// which are likely to appear in unrelated words
+	minUsernameLength = 3
+)
+
+// homeDirPattern matches the home directories of Linux, macOS and Windows
+// along with the username of the owner
+var homeDirPattern = regexp.MustCompile(`(?i)(?:\b[a-z]:)?[\\/](?:home|users)[\\/]([^\\/\s"':]+)|/root\b`)
+
+// AnonymizerConfig is the serializable configuration of an Anonymizer
+type AnonymizerConfig struct {
+	// HashPaths replaces each file path with a hash of it. The same path
+	// always produces the same hash so entries of a file can still be grouped.
+	HashPaths bool `json:"hash_paths"`
+	// Salt is mixed into the path hashes
+	Salt string `json:"salt,omitempty"`
+	// Usernames are replaced in addition to the ones found in home directories
+	Usernames []string `json:"usernames,omitempty"`
+	// Redact lists the regular expressions to be redacted from the error
+	// messages, generated outputs and file contents
+	Redact []string `json:"redact,omitempty"`
+}
+
+// Anonymizer scrubs the personal information found in the log entries and
+// files. A nil Anonymizer returns the values as is.
+type Anonymizer struct {
+	config    AnonymizerConfig
+	usernames []string
+	redact    []*regexp.Regexp
+}
+
+// NewAnonymizer creates an anonymizer from the config
+func NewAnonymizer(config AnonymizerConfig) (*Anonymizer, error) {
+	a := &Anonymizer{config: config}
+	for _, username := range config.Usernames {
+		a.AddUsername(username)
+	}
+
+	for _, rawPattern := range config.Redact {
+		pattern, err := regexp.Compile(rawPattern)
+		if err != nil {
+			return nil, err
+		}
+		a.redact = append(a.redact, pattern)
+	}
+
+	return a, nil
+}
+
+// Config returns the config of the anonymizer
+func (a *Anonymizer) Config() AnonymizerConfig {
+	return a.config
+}
+
+// AddUsername adds a username to be replaced with UserPlaceholder
+func (a *Anonymizer) AddUsername(username string) {
+	if len(username) < minUsernameLength || slices.Contains(a.usernames, username) {
+		return
+	}
+	a.usernames = append(a.usernames, username)
+}
+
+// discoverUsernames adds the owners of the home directories found in the text
+func (a *Anonymizer) discoverUsernames(text string) {
+	for _, match := range homeDirPattern.FindAllStringSubmatch(text, -1) {
+		a.AddUsername(match[1])
+	}
+}
+
+func (a *Anonymizer) scrubUser(text string) string {
+	text = homeDirPattern.ReplaceAllString(text, HomePlaceholder)
+	for _, username := range a.usernames {
+		text = strings.ReplaceAll(text, username, UserPlaceholder)
+	}
+	return text
+}
+
+// Path returns the anonymized form of the file path
+func (a *Anonymizer) Path(filePath string) string {
+	if a == nil || len(filePath) == 0 {
+		return filePath
+	}
+
+	filePath = a.scrubUser(filePath)
+	if !a.config.HashPaths {
+		return filePath
+	}
+
+	sum := sha256.Sum256([]byte(a.config.Salt + toSlash(filePath)))
+	return "file-" + hex.EncodeToString(sum[:6]) + path.Ext(toSlash(filePath))
+}
+
+// Text returns the text with the home directories, usernames and
+// matches of the redaction patterns replaced with placeholders
+func (a *Anonymizer) Text(text string) string {
+	if a == nil || len(text) == 0 {
+		return text
+	}
+
+	for _, pattern := range a.redact {
+		text = pattern.ReplaceAllString(text, RedactedPlaceholder)
+	}
+	return a.scrubUser(text)
+}
+
+// Content returns the anonymized content of a file
+func (a *Anonymizer) Content(content []byte) []byte {
+	if a == nil {
+		return content
+	}
+	return []byte(a.Text(string(content)))
+}
+
+// Entry returns the anonymized copy of the log entry. Occurrences of the
+// file path in the texts are replaced with the anonymized path.
+func (a *Anonymizer) Entry(entry LogEntry) LogEntry {
+	if a == nil {
+		return entry
+	}
+
+	anonPath := a.Path(entry.FilePath)
+	replacePath := func(text string) string {
+		if len(entry.FilePath) == 0 {
+			return text
+		}
+		return strings.ReplaceAll(text, entry.FilePath, anonPath)
+	}
+
+	entry.ExecutedCommand = a.Text(replacePath(entry.ExecutedCommand))
+	entry.ErrorMessage = a.Text(replacePath(entry.ErrorMessage))
+	entry.GeneratedOutput = a.Text(replacePath(entry.GeneratedOutput))
+	entry.FilePath = anonPath
+	return entry
+}
+
+// WriteAnonymizer returns the anonymizer used for scrubbing the data before
+// it is written into the database. It returns nil if it is not enabled.
+func (log *Logger) WriteAnonymizer() (*Anonymizer, error) {
+	rawConfig, err := log.GetSetting(AnonymizeSetting)
+	if err == sql.ErrNoRows || (err == nil && len(rawConfig) == 0) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var config AnonymizerConfig
+	if err := json.Unmarshal([]byte(rawConfig), &config); err != nil {
+		return nil, err
+	}
+	return NewAnonymizer(config)
+}
+
+// SetWriteAnonymizer enables scrubbing the data before it is written into
+// the database. Passing a nil config disables it.
+func (log *Logger) SetWriteAnonymizer(config *AnonymizerConfig) error {
+	if config == nil {
+		return log.DeleteSetting(AnonymizeSetting)
+	}
+
+	if _, err := NewAnonymizer(*config); err != nil {
+		return err
+	}
+
+	rawConfig, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	return log.AddSetting(AnonymizeSetting, string(rawConfig))
+}
+
+// AnonymizeStats reports the rows rewritten by Anonymize
+type AnonymizeStats struct {
+	Entries int
+	Files   int
+}
+
+// Anonymize rewrites the log entries and files already stored in the
+// database with the anonymizer. Usernames found in the home directories
+// of the stored paths and commands are added to the anonymizer.
+func (log *Logger) Anonymize(a *Anonymizer) (AnonymizeStats, error) {
+	stats := AnonymizeStats{}
+	if log.db == nil {
+		return stats, ErrUnsupportedStorage
+	}
+
+	c, err := log.sealer()
+	if err != nil {
+		return stats, err
+	}
+
+	var texts []string
+	if err := log.db.Select(
+		&texts,
+		"SELECT file_path FROM logs UNION SELECT executed_command FROM logs UNION SELECT file_path FROM files",
+	); err != nil {
+		return stats, err
+	}
+
+	for _, text := range texts {
+		text, err := c.openString(text)
+		if err != nil {
+			return stats, err
+		}
+		a.discoverUsernames(text)
+	}
+
+	var entryIds []int
+	if err := log.db.Select(&entryIds, "SELECT id FROM logs ORDER BY id"); err != nil {
+		return stats, err
+	}
+
+	type storedFile struct {
+		Id            int            `db:"id"`
+		ParticipantId string         `db:"participant_id"`
+		FilePath      string         `db:"file_path"`
+		ContentHash   sql.NullString `db:"content_hash"`
+	}
+
+	// versions are ordered so that each file is stored right after its previous version
+	var files []storedFile
+	if err := log.db.Select(
+		&files,
+		"SELECT id, participant_id, file_path, content_hash FROM files ORDER BY participant_id, file_path, file_version",
+	); err != nil {
+		return stats, err
+	}
+
+	tx, err := log.db.Beginx()
+	if err != nil {
+		return stats, err
+	}
+
+	for _, id := range entryIds {
+		var entry LogEntry
+		if err := tx.QueryRowx("SELECT * FROM logs WHERE id = ?", id).StructScan(&entry); err != nil {
+			tx.Rollback()
+			return stats, err
+		} else if err := c.openEntry(&entry); err != nil {
+			tx.Rollback()
+			return stats, err
+		}
+
+		anonEntry := a.Entry(entry)
+		if anonEntry == entry {
+			continue
+		}
+		anonEntry = c.sealEntry(anonEntry)
+
+		if _, err := tx.NamedExec(`UPDATE logs SET
+	executed_command = :executed_command, error_message = :error_message,
+	generated_output = :generated_output, file_path = :file_path
+WHERE id = :id`, &anonEntry); err != nil {
+			tx.Rollback()
+			return stats, err
+		}
+		stats.Entries++
+	}
+
+	// the contents are scrubbed before any blob is rewritten since the
+	// blobs of the original versions are removed below
+	anonContents := make([][]byte, len(files))
+	for i, file := range files {
+		var inlineContent []byte
+		if err := tx.QueryRow("SELECT content FROM files WHERE id = ?", file.Id).Scan(&inlineContent); err != nil {
+			tx.Rollback()
+			return stats, err
+		}
+
+		content, err := fileContent(tx, c, inlineContent, file.ContentHash)
+		if err != nil {
+			tx.Rollback()
+			return stats, err
+		}
+		anonContents[i] = a.Content(content)
+	}
+
+	// the blob store is rebuilt from the scrubbed contents. Reusing the
+	// existing blobs would keep the original versions alive as the bases
+	// of their deltas.
+	if _, err := tx.Exec("DELETE FROM blobs"); err != nil {
+		tx.Rollback()
+		return stats, err
+	}
+
+	useDelta := deltaStorageEnabled(tx)
+	prevKey, prevHash := "", ""
+
+	for i, file := range files {
+		baseHash := ""
+		if key := file.ParticipantId + "\x00" + file.FilePath; useDelta && key == prevKey {
+			baseHash = prevHash
+		} else {
+			prevKey = key
+		}
+
+		anonPath := a.Path(file.FilePath)
+		hash, err := storeBlob(tx, c, anonContents[i], baseHash)
+		if err != nil {
+			tx.Rollback()
+			return stats, err
+		}
+		prevHash = hash
+
+		if _, err := tx.Exec(
+			"UPDATE files SET file_path = ?, content = NULL, content_hash = ? WHERE id = ?",
+			anonPath,
+			hash,
+			file.Id,
+		); err != nil {
+			tx.Rollback()
+			return stats, err
+		}
+
+		if anonPath != file.FilePath || file.ContentHash.String != hash {
+			stats.Files++
+		}
+	}
+
+	if err := anonymizeSessionFiles(tx, a); err != nil {
+		tx.Rollback()
+		return stats, err
+	}
+
+	if err := anonymizeEvents(tx, a); err != nil {
+		tx.Rollback()
+		return stats, err
+	}
+
+	// the project roots of merged databases contain home directories as well
+	if err := anonymizeProjectRoots(tx, a); err != nil {
+		tx.Rollback()
+		return stats, err
+	}
+
+	if _, err := pruneBlobs(tx); err != nil {
+		tx.Rollback()
+		return stats, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return stats, err
+	}
+
+	// make sure the original data does not linger in the free pages
+	_, err = log.db.Exec("VACUUM")
+	return stats, err
+}
+
+func anonymizeProjectRoots(tx *sqlx.Tx, a *Anonymizer) error {
+	type source struct {
+		Id           int    `db:"id"`
+		ProjectRoots string `db:"project_roots"`
+	}
+
+	var sources []source
+	if err := tx.Select(&sources, "SELECT id, project_roots FROM sources"); err != nil {
+		return err
+	}
+
+	for _, src := range sources {
+		roots := map[string]string{}
+		if err := json.Unmarshal([]byte(src.ProjectRoots), &roots); err != nil {
+			return err
+		}
+
+		for participantId, root := range roots {
+			roots[participantId] = a.scrubUser(root)
+		}
+
+		rawRoots, err := json.Marshal(roots)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec("UPDATE sources SET project_roots = ? WHERE id = ?", string(rawRoots), src.Id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func anonymizeSessionFiles(tx *sqlx.Tx, a *Anonymizer) error {
+	var paths []string
+	if err := tx.Select(&paths, "SELECT DISTINCT file_path FROM session_files"); err != nil {
+		return err
+	}
+
+	for _, filePath := range paths {
+		if anonPath := a.Path(filePath); anonPath != filePath {
+			if _, err := tx.Exec("UPDATE OR REPLACE session_files SET file_path = ? WHERE file_path = ?", anonPath, filePath); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func anonymizeEvents(tx *sqlx.Tx, a *Anonymizer) error {
+	var paths []string
+	if err := tx.Select(&paths, "SELECT DISTINCT file_path FROM events"); err != nil {
+		return err
+	}
+
+	for _, filePath := range paths {
+		if anonPath := a.Path(filePath); anonPath != filePath {
+			if _, err := tx.Exec("UPDATE events SET file_path = ? WHERE file_path = ?", anonPath, filePath); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
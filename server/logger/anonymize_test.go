@@ -0,0 +1,309 @@
+package logger_test
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/nedpals/bugbuddy/server/logger"
+	"github.com/nedpals/bugbuddy/server/logger/analyzer"
+	errorquotient "github.com/nedpals/bugbuddy/server/logger/analyzer/error_quotient"
+	repeatederrordensity "github.com/nedpals/bugbuddy/server/logger/analyzer/repeated_error_density"
+	timetosolve "github.com/nedpals/bugbuddy/server/logger/analyzer/time_to_solve"
+)
+
+func TestAnonymizer(t *testing.T) {
+	a, err := logger.NewAnonymizer(logger.AnonymizerConfig{
+		Usernames: []string{"jdelacruz"},
+		Redact:    []string{`\b20\d{7}\b`},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		input    string
+		expected string
+	}{
+		{input: "/home/alice/cs101/main.py", expected: "~/cs101/main.py"},
+		{input: "/Users/bob/Desktop/main.py", expected: "~/Desktop/main.py"},
+		{input: "C:\\Users\\carol\\Documents\\main.py", expected: "~\\Documents\\main.py"},
+		{input: "/root/main.py", expected: "~/main.py"},
+		{input: "/srv/jdelacruz/main.py", expected: "/srv/<user>/main.py"},
+		{input: "/opt/project/main.py", expected: "/opt/project/main.py"},
+	}
+
+	for _, tc := range cases {
+		if got := a.Path(tc.input); got != tc.expected {
+			t.Errorf("expected %q to be anonymized into %q, got %q", tc.input, tc.expected, got)
+		}
+	}
+
+	if got := a.Text("student 202312345 at /home/alice"); got != "student <redacted> at ~" {
+		t.Errorf("unexpected anonymized text %q", got)
+	}
+
+	var disabled *logger.Anonymizer
+	if got := disabled.Path("/home/alice/main.py"); got != "/home/alice/main.py" {
+		t.Errorf("expected nil anonymizer to keep the path, got %q", got)
+	}
+}
+
+func TestAnonymizer_HashPaths(t *testing.T) {
+	a, err := logger.NewAnonymizer(logger.AnonymizerConfig{HashPaths: true, Salt: "study"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := a.Path("/home/alice/cs101/main.py")
+	if first != a.Path("/home/alice/cs101/main.py") {
+		t.Error("expected the same path to produce the same hash")
+	} else if first == a.Path("/home/alice/cs101/other.py") {
+		t.Error("expected different paths to produce different hashes")
+	} else if strings.Contains(first, "main") || filepath.Ext(first) != ".py" {
+		t.Errorf("expected hashed path to only keep the extension, got %q", first)
+	}
+
+	entry := a.Entry(logger.LogEntry{
+		ExecutedCommand: "python3 /home/alice/cs101/main.py",
+		ErrorMessage:    "File \"/home/alice/cs101/main.py\", line 1",
+		FilePath:        "/home/alice/cs101/main.py",
+	})
+
+	if entry.FilePath != first {
+		t.Errorf("expected entry path %q, got %q", first, entry.FilePath)
+	} else if entry.ExecutedCommand != "python3 "+first {
+		t.Errorf("expected command to use the hashed path, got %q", entry.ExecutedCommand)
+	} else if strings.Contains(entry.ErrorMessage, "alice") {
+		t.Errorf("expected error message to be anonymized, got %q", entry.ErrorMessage)
+	}
+}
+
+func TestLogger_WriteAnonymizer(t *testing.T) {
+	log := logger.NewMemoryLoggerPanic()
+	defer log.Close()
+
+	if a, err := log.WriteAnonymizer(); err != nil {
+		t.Fatal(err)
+	} else if a != nil {
+		t.Fatal("expected write-time anonymization to be disabled by default")
+	}
+
+	if err := log.SetWriteAnonymizer(&logger.AnonymizerConfig{Redact: []string{"("}}); err == nil {
+		t.Error("expected invalid redaction pattern to be rejected")
+	}
+
+	if err := log.SetWriteAnonymizer(&logger.AnonymizerConfig{HashPaths: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	if a, err := log.WriteAnonymizer(); err != nil {
+		t.Fatal(err)
+	} else if a == nil || !a.Config().HashPaths {
+		t.Fatal("expected the saved config to be loaded")
+	}
+
+	if err := log.SetWriteAnonymizer(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if a, _ := log.WriteAnonymizer(); a != nil {
+		t.Error("expected write-time anonymization to be disabled")
+	}
+}
+
+func analyzeMetrics(t *testing.T, log *logger.Logger) analyzer.DefaultKVWriter {
+	t.Helper()
+
+	kv := analyzer.NewDefaultKV()
+	for _, a := range []analyzer.LoggerAnalyzer{
+		analyzer.New[*errorquotient.Analyzer](),
+		analyzer.New[*repeatederrordensity.Analyzer](),
+		analyzer.New[*timetosolve.Analyzer](),
+	} {
+		if err := a.Analyze(kv, analyzer.LoadFromExistingLogger(log)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return kv
+}
+
+func TestLogger_Anonymize_PreservesMetrics(t *testing.T) {
+	log, err := logger.NewLoggerFromPath(filepath.Join(t.TempDir(), "logs.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+	collectEverything(t, log)
+
+	start := time.Date(2023, 9, 1, 8, 0, 0, 0, time.UTC)
+	filePath := "/home/alice/cs101/hello.py"
+	events := []struct {
+		errorCode   int
+		errorType   string
+		errorLine   int
+		fileVersion int
+		content     string
+	}{
+		{errorCode: 1, errorType: "NameError", errorLine: 1, fileVersion: 1, content: "print(a)"},
+		{errorCode: 1, errorType: "NameError", errorLine: 1, fileVersion: 2, content: "print(ab)"},
+		{errorCode: 1, errorType: "TypeError", errorLine: 2, fileVersion: 3, content: "a = 1\nprint(a + 'b')"},
+		{errorCode: 0, fileVersion: 4, content: "a = 1\nprint(a)"},
+	}
+
+	for i, event := range events {
+		if err := log.WriteVersionedFile(filePath, []byte(event.content), event.fileVersion); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := log.Log(logger.LogEntry{
+			ExecutedCommand: "python3 " + filePath,
+			ErrorType:       event.errorType,
+			ErrorCode:       event.errorCode,
+			ErrorMessage:    "Traceback: File \"" + filePath + "\" (student 202312345)",
+			ErrorLine:       event.errorLine,
+			FilePath:        filePath,
+			FileVersion:     event.fileVersion,
+			CreatedAt:       &logger.NullTime{Time: start.Add(time.Duration(i) * time.Minute), Valid: true},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	before := analyzeMetrics(t, log)
+
+	a, err := logger.NewAnonymizer(logger.AnonymizerConfig{
+		HashPaths: true,
+		Redact:    []string{`\b20\d{7}\b`},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := log.Anonymize(a)
+	if err != nil {
+		t.Fatal(err)
+	} else if stats.Entries != len(events) || stats.Files != len(events) {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	iter, err := log.AllEntries()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := iter.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, entry := range entries {
+		for _, text := range []string{entry.ExecutedCommand, entry.ErrorMessage, entry.FilePath} {
+			if strings.Contains(text, "alice") || strings.Contains(text, "202312345") {
+				t.Errorf("expected %q to be anonymized", text)
+			}
+		}
+	}
+
+	after := analyzeMetrics(t, log)
+	anonPath := a.Path(filePath)
+
+	for _, key := range []string{errorquotient.KEY, repeatederrordensity.KEY, timetosolve.KEY} {
+		if len(before[key]) == 0 {
+			t.Fatalf("%s: no results before anonymization", key)
+		}
+
+		for participantId, results := range before[key] {
+			expected, ok := results[filePath]
+			if !ok {
+				t.Fatalf("%s: no result for %s before anonymization", key, filePath)
+			}
+
+			if got := after[key][participantId][anonPath]; got != expected {
+				t.Errorf("%s: expected %v after anonymization, got %v", key, expected, got)
+			}
+		}
+	}
+}
+
+func TestLogger_Anonymize_DeltaBlobs(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "logs.db")
+	log, err := logger.NewLoggerFromPath(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+	collectEverything(t, log)
+
+	if _, err := log.Compact(true); err != nil {
+		t.Fatal(err)
+	}
+
+	// the second version is stored as a delta against the first one and
+	// is left unchanged by the anonymizer
+	body := strings.Repeat("print('line')\n", 40)
+	versions := []string{
+		body + "token = 'secret-token-123'\n",
+		body + "token = None\n",
+	}
+
+	for i, content := range versions {
+		if err := log.WriteVersionedFile("/lab/hello.py", []byte(content), i+1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if count := countRows(t, dbPath, "SELECT COUNT(*) FROM blobs WHERE encoding = 'delta'"); count != 1 {
+		t.Fatalf("expected the second version to be a delta, got %d deltas", count)
+	}
+
+	a, err := logger.NewAnonymizer(logger.AnonymizerConfig{Redact: []string{`secret-token-\d+`}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := log.Anonymize(a); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sqlx.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var blobs [][]byte
+	if err := db.Select(&blobs, "SELECT data FROM blobs"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, data := range blobs {
+		r, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		payload, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if bytes.Contains(payload, []byte("secret-token-123")) {
+			t.Errorf("expected the redacted text to be removed from all of the blobs, got %q", payload)
+		}
+	}
+
+	for i, content := range versions {
+		got, err := log.OpenVersionedFile("/lab/hello.py", i+1)
+		if err != nil {
+			t.Fatal(err)
+		} else if expected := a.Text(content); string(got) != expected {
+			t.Errorf("expected version %d to be %q, got %q", i+1, expected, got)
+		}
+	}
+}
@@ -0,0 +1,639 @@
+package logger
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const (
+	ArchiveParticipantSetting = "archive.participant_id"
+	ArchiveAfterSetting       = "archive.after"
+	ArchivedAtSetting         = "archive.archived_at"
+)
+
+const (
+	archivePrefix     = "archive-"
+	archiveSuffix     = ".db"
+	archiveTimeLayout = "20060102T150405.000Z"
+)
+
+// Archive is a database holding the data of a participant removed by
+// Reset. The data is moved back into the logs with Restore.
+type Archive struct {
+	Path          string
+	ParticipantId string
+	// After is the time from which the data was archived. It is zero if
+	// all of the data of the participant was archived.
+	After      time.Time
+	ArchivedAt time.Time
+	Entries    int
+	Files      int
+	Events     int
+}
+
+// ArchiveDir returns the directory of the archives of the logs. It is
+// empty for loggers which are not stored on disk. The archives are SQLite
+// databases regardless of the storage of the logs.
+func (log *Logger) ArchiveDir() string {
+	if len(log.path) == 0 {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(log.path), "archives")
+}
+
+// openArchive opens the archive in the path. The archive is encrypted
+// with the same key as the logs it was archived from.
+func (log *Logger) openArchive(path string) (*Logger, error) {
+	storage, err := openSQLiteStorage(path)
+	if err != nil {
+		return nil, err
+	}
+
+	storage.cipher = log.cipher
+	return &Logger{storage: storage, db: storage.db, path: path, cipher: log.cipher}, nil
+}
+
+// archiveInfo returns the details of the archive
+func (archive *Logger) archiveInfo() (Archive, error) {
+	info := Archive{Path: archive.path}
+
+	var err error
+	if info.ParticipantId, err = archive.GetSetting(ArchiveParticipantSetting); err != nil {
+		return info, fmt.Errorf("%s is not an archive: %w", archive.path, err)
+	}
+
+	if rawAfter, err := archive.GetSetting(ArchiveAfterSetting); err == nil && len(rawAfter) != 0 {
+		info.After, _ = time.Parse(time.RFC3339Nano, rawAfter)
+	}
+
+	if rawArchivedAt, err := archive.GetSetting(ArchivedAtSetting); err == nil {
+		info.ArchivedAt, _ = time.Parse(time.RFC3339Nano, rawArchivedAt)
+	}
+
+	if err := archive.db.QueryRow("SELECT COUNT(*) FROM logs").Scan(&info.Entries); err != nil {
+		return info, err
+	} else if err := archive.db.QueryRow("SELECT COUNT(*) FROM files").Scan(&info.Files); err != nil {
+		return info, err
+	} else if err := archive.db.QueryRow("SELECT COUNT(*) FROM events").Scan(&info.Events); err != nil {
+		return info, err
+	}
+	return info, nil
+}
+
+// Archives returns the archives of the logs from the oldest to the latest
+func (log *Logger) Archives() ([]Archive, error) {
+	dir := log.ArchiveDir()
+	if len(dir) == 0 {
+		return nil, ErrUnsupportedStorage
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, archivePrefix+"*"+archiveSuffix))
+	if err != nil {
+		return nil, err
+	}
+
+	// the timestamps in the names sort in chronological order
+	sort.Strings(paths)
+
+	archives := make([]Archive, 0, len(paths))
+	for _, path := range paths {
+		archive, err := log.openArchive(path)
+		if err != nil {
+			return nil, err
+		}
+
+		info, err := archive.archiveInfo()
+		archive.Close()
+		if err != nil {
+			return nil, err
+		}
+		archives = append(archives, info)
+	}
+	return archives, nil
+}
+
+// ArchiveForPID moves the data of the participant created since log.After
+// into a new archive. The returned archive has an empty path if the
+// participant had no data to archive.
+func (log *Logger) ArchiveForPID(participantId string) (Archive, error) {
+	dir := log.ArchiveDir()
+	if len(dir) == 0 {
+		return Archive{}, ErrUnsupportedStorage
+	} else if err := os.MkdirAll(dir, 0755); err != nil {
+		return Archive{}, err
+	}
+
+	archivedAt := time.Now()
+	path := filepath.Join(dir, archivePrefix+archivedAt.UTC().Format(archiveTimeLayout)+archiveSuffix)
+	if _, err := os.Stat(path); err == nil {
+		return Archive{}, fmt.Errorf("%s already exists", path)
+	}
+
+	var info Archive
+	var err error
+	if log.db != nil {
+		// the archive starts as a copy of the logs and the data of the other
+		// participants is removed from it afterwards
+		if _, err := log.db.Exec("VACUUM INTO ?", path); err != nil {
+			os.Remove(path)
+			return Archive{}, err
+		}
+		info, err = log.trimArchive(path, participantId, archivedAt)
+	} else {
+		info, err = log.copyToArchive(path, participantId, archivedAt)
+	}
+
+	if err != nil {
+		os.Remove(path)
+		return Archive{}, err
+	}
+
+	if info.Entries == 0 && info.Files == 0 && info.Events == 0 {
+		os.Remove(path)
+		info.Path = ""
+	}
+
+	if err := log.PurgeForPID(participantId); err != nil {
+		return info, err
+	}
+	return info, nil
+}
+
+// trimArchive removes the rows of the copied logs which are not archived
+// and records the details of the archive in its settings
+func (log *Logger) trimArchive(path string, participantId string, archivedAt time.Time) (Archive, error) {
+	archive, err := log.openArchive(path)
+	if err != nil {
+		return Archive{}, err
+	}
+	defer archive.Close()
+
+	tx, err := archive.db.Beginx()
+	if err != nil {
+		return Archive{}, err
+	}
+
+	for _, table := range []struct {
+		name   string
+		column string
+	}{
+		{"logs", "created_at"},
+		{"files", "created_at"},
+		{"events", "created_at"},
+		{"sessions", "started_at"},
+	} {
+		archived := "participant_id = ?"
+		args := []any{participantId}
+		if !log.After.IsZero() {
+			archived += " AND julianday(" + table.column + ") >= julianday(?)"
+			args = append(args, log.After.Format(time.RFC3339Nano))
+		}
+
+		query := "DELETE FROM " + table.name + " WHERE NOT (" + archived + ")"
+		if table.name == "sessions" {
+			// keep the sessions of the archived runs and events
+			query += " AND id NOT IN (SELECT session_id FROM logs WHERE session_id IS NOT NULL UNION SELECT session_id FROM events WHERE session_id IS NOT NULL)"
+		}
+
+		if _, err := tx.Exec(query, args...); err != nil {
+			tx.Rollback()
+			return Archive{}, err
+		}
+	}
+
+	if _, err := tx.Exec("DELETE FROM session_files WHERE session_id NOT IN (SELECT id FROM sessions)"); err != nil {
+		tx.Rollback()
+		return Archive{}, err
+	} else if _, err := tx.Exec("DELETE FROM participants WHERE id != ?", participantId); err != nil {
+		tx.Rollback()
+		return Archive{}, err
+	}
+
+	if _, err := pruneBlobs(tx); err != nil {
+		tx.Rollback()
+		return Archive{}, err
+	}
+
+	for name, value := range log.archiveSettings(participantId, archivedAt) {
+		if _, err := tx.Exec("INSERT OR REPLACE INTO settings (name, value) VALUES (?, ?)", name, value); err != nil {
+			tx.Rollback()
+			return Archive{}, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Archive{}, err
+	}
+
+	// reclaim the space of the removed rows
+	if _, err := archive.db.Exec("VACUUM"); err != nil {
+		return Archive{}, err
+	}
+	return archive.archiveInfo()
+}
+
+// archiveSettings returns the settings which describe the archive
+func (log *Logger) archiveSettings(participantId string, archivedAt time.Time) map[string]string {
+	after := ""
+	if !log.After.IsZero() {
+		after = log.After.Format(time.RFC3339Nano)
+	}
+
+	return map[string]string{
+		ArchiveParticipantSetting: participantId,
+		ArchiveAfterSetting:       after,
+		ArchivedAtSetting:         archivedAt.Format(time.RFC3339Nano),
+	}
+}
+
+// copyToArchive creates the archive of the logs which are not stored in
+// SQLite by copying the data of the participant through the storage
+func (log *Logger) copyToArchive(path string, participantId string, archivedAt time.Time) (Archive, error) {
+	archive, err := log.openArchive(path)
+	if err != nil {
+		return Archive{}, err
+	}
+	defer archive.Close()
+
+	if _, err := copyParticipantData(archive.storage, log.storage, participantId, log.After); err != nil {
+		return Archive{}, err
+	} else if err := archive.storage.SetSettings(log.archiveSettings(participantId, archivedAt)); err != nil {
+		return Archive{}, err
+	}
+	return archive.archiveInfo()
+}
+
+// copyParticipantData copies the data of the participant created since
+// after from src into dst through the storage interface. Like Merge,
+// entries and events which are already in dst are skipped and file
+// versions which conflict with the existing ones are stored as newer
+// versions. The files opened during a session are recorded as opened at
+// the start of the session.
+func copyParticipantData(dst Storage, src Storage, participantId string, after time.Time) (MergeStats, error) {
+	stats := MergeStats{}
+
+	participants, err := src.Participants()
+	if err != nil {
+		return stats, err
+	}
+
+	for _, participant := range participants {
+		if participant.Id == participantId {
+			if err := dst.AddParticipant(participant); err != nil {
+				return stats, err
+			}
+		}
+	}
+
+	// versionMap maps the file versions of src to the copied versions
+	versionMap, err := copyFiles(dst, src, participantId, after, &stats)
+	if err != nil {
+		return stats, err
+	}
+
+	entries, err := listEntries(src, EntryFilter{ParticipantId: participantId, After: after})
+	if err != nil {
+		return stats, err
+	}
+
+	events, err := listEvents(src, participantId, after)
+	if err != nil {
+		return stats, err
+	}
+
+	// sessionMap maps the session ids of src to the copied session ids
+	sessionMap, err := copySessions(dst, src, participantId, after, entries, events)
+	if err != nil {
+		return stats, err
+	}
+
+	existingEntries, err := listEntries(dst, EntryFilter{ParticipantId: participantId})
+	if err != nil {
+		return stats, err
+	}
+
+	seenEntries := map[string]bool{}
+	for _, entry := range existingEntries {
+		seenEntries[copiedEntryKey(entry)] = true
+	}
+
+	for _, entry := range entries {
+		if version, ok := versionMap[fileVersionKey(entry.ParticipantId, entry.FilePath, entry.FileVersion)]; ok {
+			entry.FileVersion = version
+		}
+
+		if key := copiedEntryKey(entry); seenEntries[key] {
+			stats.Duplicates++
+			continue
+		} else {
+			seenEntries[key] = true
+		}
+
+		entry.SessionId = mappedSession(sessionMap, entry.SessionId)
+		if err := dst.InsertEntry(entry); err != nil {
+			return stats, err
+		}
+		stats.Entries++
+	}
+
+	existingEvents, err := listEvents(dst, participantId, time.Time{})
+	if err != nil {
+		return stats, err
+	}
+
+	seenEvents := map[string]bool{}
+	for _, event := range existingEvents {
+		seenEvents[copiedEventKey(event)] = true
+	}
+
+	for _, event := range events {
+		if key := copiedEventKey(event); seenEvents[key] {
+			continue
+		} else {
+			seenEvents[key] = true
+		}
+
+		if event.FileVersion != nil {
+			if version, ok := versionMap[fileVersionKey(event.ParticipantId, event.FilePath, *event.FileVersion)]; ok {
+				event.FileVersion = &version
+			}
+		}
+
+		event.SessionId = mappedSession(sessionMap, event.SessionId)
+		if err := dst.InsertEvent(event); err != nil {
+			return stats, err
+		}
+		stats.Events++
+	}
+
+	return stats, nil
+}
+
+func copyFiles(dst Storage, src Storage, participantId string, after time.Time, stats *MergeStats) (map[string]int, error) {
+	versionMap := map[string]int{}
+
+	files, err := src.FileVersions(FileFilter{ParticipantId: participantId, After: after})
+	if err != nil {
+		return nil, err
+	}
+	defer files.Close()
+
+	for files.Next() {
+		var file FileVersion
+		if err := files.Scan(&file); err != nil {
+			return nil, err
+		}
+
+		content, err := files.Content(file)
+		if err != nil {
+			return nil, err
+		}
+
+		version, exists, err := copiedFileVersion(dst, file.ParticipantId, file.FilePath, file.FileVersion, content)
+		if err != nil {
+			return nil, err
+		}
+
+		versionMap[fileVersionKey(file.ParticipantId, file.FilePath, file.FileVersion)] = version
+		if exists {
+			continue
+		}
+
+		file.FileVersion = version
+		if err := dst.WriteFile(file, content); err != nil {
+			return nil, err
+		}
+		stats.Files++
+	}
+
+	return versionMap, nil
+}
+
+// copiedFileVersion returns the version of dst to be used for the copied
+// file version the same way as mergedFileVersion
+func copiedFileVersion(dst Storage, participantId, filePath string, version int, content []byte) (int, bool, error) {
+	existing, err := dst.ReadFile(participantId, filePath, version)
+	if err == sql.ErrNoRows {
+		return version, false, nil
+	} else if err != nil {
+		return 0, false, err
+	} else if bytes.Equal(existing, content) {
+		return version, true, nil
+	}
+
+	latest, err := dst.LatestFileVersion(participantId, filePath)
+	if err != nil {
+		return 0, false, err
+	}
+
+	for v := 1; v <= latest; v++ {
+		existing, err := dst.ReadFile(participantId, filePath, v)
+		if err == sql.ErrNoRows {
+			continue
+		} else if err != nil {
+			return 0, false, err
+		} else if bytes.Equal(existing, content) {
+			return v, true, nil
+		}
+	}
+	return latest + 1, false, nil
+}
+
+// copySessions copies the sessions started since after along with the
+// sessions of the copied entries and events. Sessions which are already
+// in dst are reused.
+func copySessions(dst Storage, src Storage, participantId string, after time.Time, entries []LogEntry, events []Event) (map[int]int, error) {
+	referenced := map[int]bool{}
+	for _, entry := range entries {
+		if entry.SessionId != nil {
+			referenced[*entry.SessionId] = true
+		}
+	}
+	for _, event := range events {
+		if event.SessionId != nil {
+			referenced[*event.SessionId] = true
+		}
+	}
+
+	sessions, err := src.Sessions(participantId)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := dst.Sessions(participantId)
+	if err != nil {
+		return nil, err
+	}
+
+	sessionMap := map[int]int{}
+	for _, session := range sessions {
+		if !referenced[session.Id] && !matchesCreatedAt(session.StartedAt, after, time.Time{}) {
+			continue
+		}
+
+		for _, other := range existing {
+			if other.Editor == session.Editor && other.StartedAt.Time.Equal(session.StartedAt.Time) {
+				sessionMap[session.Id] = other.Id
+				break
+			}
+		}
+
+		if _, ok := sessionMap[session.Id]; ok {
+			continue
+		}
+
+		id, err := dst.StartSession(session)
+		if err != nil {
+			return nil, err
+		}
+		sessionMap[session.Id] = id
+
+		for _, filePath := range session.Files {
+			if err := dst.AddSessionFile(id, filePath, session.StartedAt.Time); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return sessionMap, nil
+}
+
+func mappedSession(sessionMap map[int]int, sessionId *int) *int {
+	if sessionId == nil {
+		return nil
+	} else if id, ok := sessionMap[*sessionId]; ok {
+		return &id
+	}
+	return nil
+}
+
+func listEntries(storage Storage, filter EntryFilter) ([]LogEntry, error) {
+	cursor, err := storage.Entries(filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close()
+
+	entries := []LogEntry{}
+	for cursor.Next() {
+		var entry LogEntry
+		if err := cursor.Scan(&entry); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// listEvents returns the events of the participant created since after
+func listEvents(storage Storage, participantId string, after time.Time) ([]Event, error) {
+	cursor, err := storage.Events(EventFilter{After: after})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close()
+
+	events := []Event{}
+	for cursor.Next() {
+		var event Event
+		if err := cursor.Scan(&event); err != nil {
+			return nil, err
+		} else if event.ParticipantId == participantId {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+// copiedEntryKey identifies the entry with the same columns as mergeEntries
+func copiedEntryKey(entry LogEntry) string {
+	createdAt := ""
+	if entry.CreatedAt != nil {
+		createdAt = entry.CreatedAt.Time.UTC().Format(time.RFC3339Nano)
+	}
+
+	return fmt.Sprintf(
+		"%s\x00%s\x00%d\x00%s\x00%s\x00%d\x00%d\x00%s\x00%d\x00%s",
+		entry.ParticipantId, entry.ExecutedCommand, entry.ErrorCode, entry.ErrorType, entry.ErrorMessage,
+		entry.ErrorLine, entry.ErrorColumn, entry.FilePath, entry.FileVersion, createdAt,
+	)
+}
+
+// copiedEventKey identifies the event with the same columns as mergeEvents
+func copiedEventKey(event Event) string {
+	createdAt := ""
+	if event.CreatedAt != nil {
+		createdAt = event.CreatedAt.Time.UTC().Format(time.RFC3339Nano)
+	}
+	return fmt.Sprintf("%s\x00%s\x00%s\x00%s", event.ParticipantId, event.Kind, event.FilePath, createdAt)
+}
+
+// Restore moves the data of the archive back into the logs and removes
+// the archive. Entries which are already in the logs are skipped, and file
+// versions written since the archive was made are kept as newer versions.
+// Since the archive is removed, the restored rows are attributed to the
+// name and the checksum of the archive instead of its path.
+func (log *Logger) Restore(path string) (MergeStats, error) {
+	source, err := archiveSource(path)
+	if err != nil {
+		return MergeStats{}, err
+	}
+
+	archive, err := log.openArchive(path)
+	if err != nil {
+		return MergeStats{}, err
+	}
+
+	info, err := archive.archiveInfo()
+	if err != nil {
+		archive.Close()
+		return MergeStats{}, err
+	}
+
+	var stats MergeStats
+	if log.db != nil {
+		stats, err = log.Merge(archive, source, MergeOptions{})
+	} else {
+		stats, err = copyParticipantData(log.storage, archive.storage, info.ParticipantId, time.Time{})
+	}
+	archive.Close()
+	if err != nil {
+		return stats, err
+	}
+	return stats, os.Remove(path)
+}
+
+// archiveSource identifies the archive by its name and the SHA-256
+// checksum of its contents, such as "archive-x.db@sha256:abcd..."
+func archiveSource(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return filepath.Base(path) + "@sha256:" + hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// PurgeForPID permanently removes the data of the participant created
+// since log.After without archiving it
+func (log *Logger) PurgeForPID(participantId string) error {
+	return log.storage.Reset(participantId, log.After)
+}
+
+// Purge permanently removes the data of the active participant
+func (log *Logger) Purge() error {
+	return log.PurgeForPID(log.ParticipantId())
+}
@@ -0,0 +1,245 @@
+package logger_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/nedpals/bugbuddy/server/logger"
+)
+
+func countEntries(t *testing.T, log *logger.Logger, participantId string) int {
+	t.Helper()
+
+	iter, err := log.EntriesByParticipantId(participantId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := iter.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(entries)
+}
+
+func TestLogger_Reset_Archive(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "logs.db")
+	log := newParticipantLogger(t, dbPath, "student-a")
+	defer log.Close()
+
+	sessionId, err := log.StartSession("vscode")
+	if err != nil {
+		t.Fatal(err)
+	} else if err := log.WriteVersionedFile("main.py", []byte("print(a)"), 1); err != nil {
+		t.Fatal(err)
+	} else if err := log.Log(logger.LogEntry{ErrorCode: 1, ErrorType: "NameError", FilePath: "main.py", FileVersion: 1, SessionId: &sessionId}); err != nil {
+		t.Fatal(err)
+	} else if err := log.Log(logger.LogEntry{ParticipantId: "student-b", ErrorCode: 1, ErrorType: "TypeError"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := log.Reset(); err != nil {
+		t.Fatal(err)
+	}
+
+	// only the data of the participant is moved into the archive
+	if count := countEntries(t, log, "student-a"); count != 0 {
+		t.Fatalf("expected the entries to be removed, got %d", count)
+	} else if count := countEntries(t, log, "student-b"); count != 1 {
+		t.Fatalf("expected the entries of student-b to stay, got %d", count)
+	}
+
+	archives, err := log.Archives()
+	if err != nil {
+		t.Fatal(err)
+	} else if len(archives) != 1 {
+		t.Fatalf("expected 1 archive, got %+v", archives)
+	}
+
+	archive := archives[0]
+	if archive.ParticipantId != "student-a" || archive.Entries != 1 || archive.Files != 1 || !archive.After.IsZero() {
+		t.Fatalf("unexpected archive %+v", archive)
+	} else if filepath.Dir(archive.Path) != log.ArchiveDir() {
+		t.Fatalf("expected the archive to be in %s, got %s", log.ArchiveDir(), archive.Path)
+	}
+
+	// a different first version is written after the reset
+	if err := log.WriteVersionedFile("main.py", []byte("print(b)"), 1); err != nil {
+		t.Fatal(err)
+	} else if err := log.Log(logger.LogEntry{ErrorCode: 0, FilePath: "main.py", FileVersion: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := log.Restore(archive.Path)
+	if err != nil {
+		t.Fatal(err)
+	} else if stats.Entries != 1 || stats.Files != 1 {
+		t.Fatalf("unexpected restore stats %+v", stats)
+	} else if _, err := os.Stat(archive.Path); !os.IsNotExist(err) {
+		t.Fatalf("expected the archive to be removed, got %v", err)
+	}
+
+	// the source does not refer to the removed archive
+	db, err := sqlx.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var source string
+	if err := db.Get(&source, "SELECT path FROM sources"); err != nil {
+		t.Fatal(err)
+	} else if !strings.HasPrefix(source, filepath.Base(archive.Path)+"@sha256:") {
+		t.Errorf("expected the source to be the name and the checksum of the archive, got %q", source)
+	}
+
+	iter, err := log.Query().Participant("student-a").ErrorType("NameError").Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := iter.List()
+	if err != nil {
+		t.Fatal(err)
+	} else if len(entries) != 1 {
+		t.Fatalf("expected the archived entry to be restored, got %+v", entries)
+	}
+
+	// the restored file version is kept as a newer version of the file
+	if content, err := log.OpenVersionedFile("main.py", entries[0].FileVersion); err != nil || string(content) != "print(a)" {
+		t.Fatalf("expected the restored file of the entry, got %q (%v)", content, err)
+	} else if content, err := log.OpenVersionedFile("main.py", 1); err != nil || string(content) != "print(b)" {
+		t.Fatalf("expected the file written after the reset to stay, got %q (%v)", content, err)
+	}
+
+	if session, err := log.Session(*entries[0].SessionId); err != nil || session.Editor != "vscode" {
+		t.Fatalf("expected the session to be restored, got %+v (%v)", session, err)
+	}
+
+	if problems, err := log.Verify(); err != nil || len(problems) != 0 {
+		t.Fatalf("expected the restored logs to be valid, got %v (%v)", problems, err)
+	}
+}
+
+func TestLogger_Reset_ArchiveAfter(t *testing.T) {
+	start := time.Date(2023, 9, 1, 8, 0, 0, 0, time.UTC)
+
+	log := newParticipantLogger(t, filepath.Join(t.TempDir(), "logs.db"), "student-a")
+	defer log.Close()
+
+	for i, errorType := range []string{"NameError", "TypeError"} {
+		logAt(t, log, "main.py", 0, errorType, start.Add(time.Duration(i)*time.Hour))
+	}
+
+	log.After = start.Add(30 * time.Minute)
+	if err := log.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	log.After = time.Time{}
+
+	archives, err := log.Archives()
+	if err != nil {
+		t.Fatal(err)
+	} else if len(archives) != 1 || archives[0].Entries != 1 || !archives[0].After.Equal(start.Add(30*time.Minute)) {
+		t.Fatalf("expected the entries after the time to be archived, got %+v", archives)
+	} else if count := countEntries(t, log, "student-a"); count != 1 {
+		t.Fatalf("expected the earlier entry to stay, got %d", count)
+	}
+
+	// nothing is archived when the data is purged
+	if err := log.Purge(); err != nil {
+		t.Fatal(err)
+	} else if count := countEntries(t, log, "student-a"); count != 0 {
+		t.Fatalf("expected the entries to be purged, got %d", count)
+	} else if archives, err := log.Archives(); err != nil || len(archives) != 1 {
+		t.Fatalf("expected no new archive, got %+v (%v)", archives, err)
+	}
+
+	// resetting a participant without data does not create an archive
+	if archive, err := log.ArchiveForPID("student-a"); err != nil || len(archive.Path) != 0 {
+		t.Fatalf("expected no archive, got %+v (%v)", archive, err)
+	}
+}
+
+func TestLogger_Reset_ArchiveJSONL(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "logs")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	log := newParticipantLogger(t, dir, "student-a")
+	defer log.Close()
+
+	sessionId, err := log.StartSession("vscode")
+	if err != nil {
+		t.Fatal(err)
+	} else if err := log.AddSessionFile(sessionId, "main.py"); err != nil {
+		t.Fatal(err)
+	} else if err := log.WriteVersionedFile("main.py", []byte("print(a)"), 1); err != nil {
+		t.Fatal(err)
+	} else if err := log.Log(logger.LogEntry{ErrorCode: 1, ErrorType: "NameError", FilePath: "main.py", FileVersion: 1, SessionId: &sessionId}); err != nil {
+		t.Fatal(err)
+	} else if err := log.Log(logger.LogEntry{ParticipantId: "student-b", ErrorCode: 1, ErrorType: "TypeError"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := log.Reset(); err != nil {
+		t.Fatal(err)
+	} else if count := countEntries(t, log, "student-a"); count != 0 {
+		t.Fatalf("expected the entries to be removed, got %d", count)
+	} else if count := countEntries(t, log, "student-b"); count != 1 {
+		t.Fatalf("expected the entries of student-b to stay, got %d", count)
+	}
+
+	archives, err := log.Archives()
+	if err != nil {
+		t.Fatal(err)
+	} else if len(archives) != 1 {
+		t.Fatalf("expected 1 archive, got %+v", archives)
+	}
+
+	archive := archives[0]
+	if archive.ParticipantId != "student-a" || archive.Entries != 1 || archive.Files != 1 {
+		t.Fatalf("unexpected archive %+v", archive)
+	}
+
+	// a different first version is written after the reset
+	if err := log.WriteVersionedFile("main.py", []byte("print(b)"), 1); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := log.Restore(archive.Path)
+	if err != nil {
+		t.Fatal(err)
+	} else if stats.Entries != 1 || stats.Files != 1 {
+		t.Fatalf("unexpected restore stats %+v", stats)
+	} else if _, err := os.Stat(archive.Path); !os.IsNotExist(err) {
+		t.Fatalf("expected the archive to be removed, got %v", err)
+	}
+
+	iter, err := log.Query().Participant("student-a").ErrorType("NameError").Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := iter.List()
+	if err != nil {
+		t.Fatal(err)
+	} else if len(entries) != 1 || entries[0].SessionId == nil {
+		t.Fatalf("expected the archived entry to be restored, got %+v", entries)
+	}
+
+	if content, err := log.OpenVersionedFile("main.py", entries[0].FileVersion); err != nil || string(content) != "print(a)" {
+		t.Fatalf("expected the restored file of the entry, got %q (%v)", content, err)
+	} else if content, err := log.OpenVersionedFile("main.py", 1); err != nil || string(content) != "print(b)" {
+		t.Fatalf("expected the file written after the reset to stay, got %q (%v)", content, err)
+	}
+
+	if session, err := log.Session(*entries[0].SessionId); err != nil || session.Editor != "vscode" || len(session.Files) != 1 {
+		t.Fatalf("expected the session to be restored, got %+v (%v)", session, err)
+	}
+}
@@ -0,0 +1,174 @@
+package logger
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	BackupIntervalSetting = "backup.interval"
+	BackupKeepSetting     = "backup.keep"
+)
+
+const (
+	// DefaultBackupInterval is the duration between the backups taken by the daemon
+	DefaultBackupInterval = 6 * time.Hour
+	// DefaultBackupKeep is the number of backups kept after rotating them
+	DefaultBackupKeep = 14
+)
+
+const (
+	backupPrefix     = "logs-"
+	backupSuffix     = ".db"
+	backupTimeLayout = "20060102T150405.000Z"
+)
+
+// BackupConfig determines how often the logs are backed up and how many
+// of the backups are kept.
+type BackupConfig struct {
+	// Interval is the minimum duration between backups. Zero disables them.
+	Interval time.Duration `json:"interval"`
+	// Keep is the number of latest backups kept. Zero keeps all of them.
+	Keep int `json:"keep"`
+}
+
+// BackupConfig returns the backup settings of the logs
+func (log *Logger) BackupConfig() BackupConfig {
+	config := BackupConfig{Interval: DefaultBackupInterval, Keep: DefaultBackupKeep}
+
+	if rawInterval, err := log.GetSetting(BackupIntervalSetting); err == nil {
+		if interval, err := time.ParseDuration(rawInterval); err == nil && interval >= 0 {
+			config.Interval = interval
+		}
+	}
+
+	if rawKeep, err := log.GetSetting(BackupKeepSetting); err == nil {
+		if keep, err := strconv.Atoi(rawKeep); err == nil && keep >= 0 {
+			config.Keep = keep
+		}
+	}
+
+	return config
+}
+
+// SetBackupConfig changes the backup settings of the logs
+func (log *Logger) SetBackupConfig(config BackupConfig) error {
+	if config.Interval < 0 || config.Keep < 0 {
+		return fmt.Errorf("backup interval and number of kept backups must not be negative")
+	}
+
+	return log.storage.SetSettings(map[string]string{
+		BackupIntervalSetting: config.Interval.String(),
+		BackupKeepSetting:     strconv.Itoa(config.Keep),
+	})
+}
+
+// BackupDir returns the directory of the backups of the database. It
+// is empty for loggers which are not stored in a database file.
+func (log *Logger) BackupDir() string {
+	if log.db == nil || len(log.path) == 0 {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(log.path), "backups")
+}
+
+// Backups returns the paths of the backups in the directory
+// from the oldest to the latest
+func Backups(dir string) ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, backupPrefix+"*"+backupSuffix))
+	if err != nil {
+		return nil, err
+	}
+
+	// the timestamps in the names sort in chronological order
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// backupTime returns the time when the backup in the path was taken
+func backupTime(path string) (time.Time, error) {
+	name := filepath.Base(path)
+	return time.Parse(backupTimeLayout, name[len(backupPrefix):len(name)-len(backupSuffix)])
+}
+
+// Backup writes a consistent snapshot of the database into the directory
+// and returns its path. The snapshot is taken with VACUUM INTO so the
+// logs can still be written while it is being taken. Encrypted databases
+// stay encrypted in the backup.
+func (log *Logger) Backup(dir string, now time.Time) (string, error) {
+	if log.db == nil {
+		return "", ErrUnsupportedStorage
+	} else if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(dir, backupPrefix+now.UTC().Format(backupTimeLayout)+backupSuffix)
+	if _, err := os.Stat(path); err == nil {
+		return "", fmt.Errorf("%s already exists", path)
+	}
+
+	if _, err := log.db.Exec("VACUUM INTO ?", path); err != nil {
+		os.Remove(path)
+		return "", err
+	}
+	return path, nil
+}
+
+// RotateBackups removes the oldest backups in the directory so that only
+// the latest ones are kept. It returns the paths of the removed backups.
+func RotateBackups(dir string, keep int) ([]string, error) {
+	if keep <= 0 {
+		return nil, nil
+	}
+
+	paths, err := Backups(dir)
+	if err != nil || len(paths) <= keep {
+		return nil, err
+	}
+
+	removed := paths[:len(paths)-keep]
+	for _, path := range removed {
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	return removed, nil
+}
+
+// BackupIfDue backs up the database into its backup directory if the
+// latest backup is older than the backup interval and rotates the
+// backups afterwards. It returns an empty path if no backup was taken.
+func (log *Logger) BackupIfDue(now time.Time) (string, error) {
+	dir := log.BackupDir()
+	config := log.BackupConfig()
+	if len(dir) == 0 || config.Interval == 0 {
+		return "", nil
+	}
+
+	paths, err := Backups(dir)
+	if err != nil {
+		return "", err
+	}
+
+	if len(paths) != 0 {
+		if takenAt, err := backupTime(paths[len(paths)-1]); err != nil {
+			return "", err
+		} else if now.Sub(takenAt) < config.Interval {
+			return "", nil
+		}
+	}
+
+	path, err := log.Backup(dir, now)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := RotateBackups(dir, config.Keep); err != nil {
+		return path, err
+	}
+	return path, nil
+}
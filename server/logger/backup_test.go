@@ -0,0 +1,145 @@
+package logger_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/nedpals/bugbuddy/server/logger"
+)
+
+func TestLogger_BackupIfDue(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "logs.db")
+	log := newParticipantLogger(t, dbPath, "student-a")
+	defer log.Close()
+
+	if err := log.Log(logger.LogEntry{ErrorCode: 1, ErrorType: "NameError"}); err != nil {
+		t.Fatal(err)
+	} else if err := log.SetBackupConfig(logger.BackupConfig{Interval: time.Hour, Keep: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := log.BackupDir()
+	if dir != filepath.Join(filepath.Dir(dbPath), "backups") {
+		t.Fatalf("unexpected backup dir %s", dir)
+	}
+
+	start := time.Date(2023, 9, 1, 8, 0, 0, 0, time.UTC)
+	taken := []string{}
+	for _, minutes := range []int{0, 30, 60, 90, 120, 180} {
+		path, err := log.BackupIfDue(start.Add(time.Duration(minutes) * time.Minute))
+		if err != nil {
+			t.Fatal(err)
+		} else if len(path) != 0 {
+			taken = append(taken, path)
+		}
+	}
+
+	// backups are skipped until the interval has passed
+	if len(taken) != 4 {
+		t.Fatalf("expected 4 backups, got %v", taken)
+	}
+
+	// only the latest backups are kept
+	backups, err := logger.Backups(dir)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(backups) != 2 || backups[0] != taken[2] || backups[1] != taken[3] {
+		t.Fatalf("expected the latest 2 backups to be kept, got %v", backups)
+	}
+
+	// the backup is a complete database
+	backup, err := logger.NewLoggerFromPath(backups[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backup.Close()
+
+	if backup.ParticipantId() != "student-a" {
+		t.Errorf("expected the participant of the backup to be student-a, got %s", backup.ParticipantId())
+	} else if problems, err := backup.Verify(); err != nil || len(problems) != 0 {
+		t.Errorf("expected a valid backup, got %v (%v)", problems, err)
+	}
+
+	if config := backup.BackupConfig(); config.Interval != time.Hour || config.Keep != 2 {
+		t.Errorf("unexpected backup config %+v", config)
+	}
+}
+
+func TestLogger_BackupIfDue_Disabled(t *testing.T) {
+	memory := logger.NewMemoryLoggerPanic()
+	defer memory.Close()
+
+	// loggers without a database file are not backed up
+	if path, err := memory.BackupIfDue(time.Now()); err != nil || len(path) != 0 {
+		t.Fatalf("expected no backup, got %s (%v)", path, err)
+	}
+
+	log := newParticipantLogger(t, filepath.Join(t.TempDir(), "logs.db"), "student-a")
+	defer log.Close()
+
+	if err := log.SetBackupConfig(logger.BackupConfig{Interval: 0, Keep: 2}); err != nil {
+		t.Fatal(err)
+	} else if path, err := log.BackupIfDue(time.Now()); err != nil || len(path) != 0 {
+		t.Fatalf("expected no backup, got %s (%v)", path, err)
+	}
+}
+
+func TestLogger_Verify(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "logs.db")
+	log := newParticipantLogger(t, dbPath, "student-a")
+	defer log.Close()
+
+	if err := log.WriteVersionedFile("main.py", []byte("print(a)"), 1); err != nil {
+		t.Fatal(err)
+	} else if err := log.WriteVersionedFile("other.py", []byte("print(b)"), 1); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, entry := range []logger.LogEntry{
+		{ErrorCode: 1, FilePath: "main.py", FileVersion: 1},
+		{ErrorCode: 1, FilePath: "other.py", FileVersion: 1},
+		// entries without a file are not checked
+		{ErrorCode: 1},
+	} {
+		if err := log.Log(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if problems, err := log.Verify(); err != nil {
+		t.Fatal(err)
+	} else if len(problems) != 0 {
+		t.Fatalf("expected no problems, got %v", problems)
+	}
+
+	// remove the rows behind the back of the logger
+	db, err := sqlx.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if _, err := db.Exec("DELETE FROM files WHERE file_path = 'other.py'"); err != nil {
+		t.Fatal(err)
+	} else if _, err := db.Exec("DELETE FROM blobs WHERE hash = ?", logger.HashContent([]byte("print(a)"))); err != nil {
+		t.Fatal(err)
+	}
+
+	problems, err := log.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checks := []string{}
+	for _, problem := range problems {
+		checks = append(checks, problem.Check)
+	}
+
+	if len(checks) != 2 || checks[0] != "log_files" || checks[1] != "file_blobs" {
+		t.Fatalf("expected a missing file and a missing blob, got %v", problems)
+	} else if problems[0].Message != "log entry 2 refers to missing file other.py (version 1) of student-a" {
+		t.Errorf("unexpected message %q", problems[0].Message)
+	}
+}
@@ -0,0 +1,398 @@
+package logger
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+const (
+	// blobEncodingZlib stores the zlib-compressed content of the file
+	blobEncodingZlib = "zlib"
+	// blobEncodingDelta stores a zlib-compressed delta against the base blob
+	blobEncodingDelta = "delta"
+
+	// maxDeltaDepth limits the length of delta chains so that reading a
+	// file does not require resolving too many blobs
+	maxDeltaDepth = 16
+
+	// DeltaStorageSetting enables storing file versions as a delta
+	// against the previous version of the same file
+	DeltaStorageSetting = "storage.delta"
+)
+
+// HashContent returns the hash used for addressing the blob of the content
+// in unencrypted logs
+func HashContent(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+func compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decompress(data []byte) ([]byte, error) {
+	r, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+func deltaStorageEnabled(q sqlx.Queryer) bool {
+	var val string
+	err := q.QueryRowx("SELECT value FROM settings WHERE name = ?", DeltaStorageSetting).Scan(&val)
+	return err == nil && val == "true"
+}
+
+// hasBlob checks if a blob with the specified hash is already stored
+func hasBlob(q sqlx.Queryer, hash string) (bool, error) {
+	var exists bool
+	err := q.QueryRowx("SELECT COUNT(*) > 0 FROM blobs WHERE hash = ?", hash).Scan(&exists)
+	return exists, err
+}
+
+// storeBlob stores the content into the blobs table and returns its hash. If
+// baseHash is not empty, the content may be stored as a delta against it.
+// The size of the blobs of encrypted logs is the size of the sealed data
+// so that it does not reveal the size of the content.
+func storeBlob(q sqlx.Ext, c *fieldCipher, content []byte, baseHash string) (string, error) {
+	hash := c.hashContent(content)
+	if exists, err := hasBlob(q, hash); err != nil {
+		return "", err
+	} else if exists {
+		return hash, nil
+	}
+
+	encoding := blobEncodingZlib
+	payload := content
+	depth := 0
+
+	if len(baseHash) != 0 && baseHash != hash {
+		if delta, baseDepth, ok := deltaFromBase(q, c, baseHash, content); ok && baseDepth+1 <= maxDeltaDepth {
+			encoding = blobEncodingDelta
+			payload = delta
+			depth = baseDepth + 1
+		}
+	}
+
+	data, err := compress(payload)
+	if err != nil {
+		return "", err
+	}
+
+	var base any
+	if encoding == blobEncodingDelta {
+		base = baseHash
+	}
+
+	sealed := c.seal(data)
+	if _, err := q.Exec(
+		"INSERT INTO blobs (hash, encoding, base_hash, depth, size, data) VALUES (?, ?, ?, ?, ?, ?)",
+		hash,
+		encoding,
+		base,
+		depth,
+		blobSize(c, content, sealed),
+		sealed,
+	); err != nil {
+		return "", err
+	}
+
+	return hash, nil
+}
+
+// blobSize returns the size stored for the blob of the content
+func blobSize(c *fieldCipher, content []byte, sealed []byte) int {
+	if c != nil {
+		return len(sealed)
+	}
+	return len(content)
+}
+
+// deltaEncodeBlob stores an existing zlib blob as a delta against the base
+// blob instead. Blobs which are the base of other blobs are left unchanged
+// so that the depths of their chains stay valid and no cycles are created.
+func deltaEncodeBlob(q sqlx.Ext, c *fieldCipher, hash string, baseHash string) (bool, error) {
+	if hash == baseHash {
+		return false, nil
+	}
+
+	var encoding string
+	var dependents int
+	if err := q.QueryRowx(
+		"SELECT encoding, (SELECT COUNT(*) FROM blobs WHERE base_hash = ?) FROM blobs WHERE hash = ?",
+		hash,
+		hash,
+	).Scan(&encoding, &dependents); err != nil {
+		return false, err
+	} else if encoding != blobEncodingZlib || dependents != 0 {
+		return false, nil
+	}
+
+	content, err := readBlob(q, c, hash)
+	if err != nil {
+		return false, err
+	}
+
+	delta, baseDepth, ok := deltaFromBase(q, c, baseHash, content)
+	if !ok || baseDepth+1 > maxDeltaDepth {
+		return false, nil
+	}
+
+	data, err := compress(delta)
+	if err != nil {
+		return false, err
+	}
+
+	sealed := c.seal(data)
+	if _, err := q.Exec(
+		"UPDATE blobs SET encoding = ?, base_hash = ?, depth = ?, size = ?, data = ? WHERE hash = ?",
+		blobEncodingDelta,
+		baseHash,
+		baseDepth+1,
+		blobSize(c, content, sealed),
+		sealed,
+		hash,
+	); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// deltaFromBase computes the delta of the content against the base blob. It
+// only succeeds if the delta is smaller than the content and applying it back
+// reproduces the content exactly.
+func deltaFromBase(q sqlx.Queryer, c *fieldCipher, baseHash string, content []byte) ([]byte, int, bool) {
+	base, err := readBlob(q, c, baseHash)
+	if err != nil {
+		return nil, 0, false
+	}
+
+	var baseDepth int
+	if err := q.QueryRowx("SELECT depth FROM blobs WHERE hash = ?", baseHash).Scan(&baseDepth); err != nil {
+		return nil, 0, false
+	}
+
+	dmp := diffmatchpatch.New()
+	delta := dmp.DiffToDelta(dmp.DiffMain(string(base), string(content), true))
+	if len(delta) >= len(content) {
+		return nil, 0, false
+	}
+
+	// make sure the delta is lossless (eg. for contents that are not valid UTF-8)
+	if restored, err := applyDelta(base, []byte(delta)); err != nil || !bytes.Equal(restored, content) {
+		return nil, 0, false
+	}
+
+	return []byte(delta), baseDepth, true
+}
+
+func applyDelta(base []byte, delta []byte) ([]byte, error) {
+	dmp := diffmatchpatch.New()
+	diffs, err := dmp.DiffFromDelta(string(base), string(delta))
+	if err != nil {
+		return nil, err
+	}
+	return []byte(dmp.DiffText2(diffs)), nil
+}
+
+// readBlob returns the content of the blob with the specified hash
+func readBlob(q sqlx.Queryer, c *fieldCipher, hash string) ([]byte, error) {
+	var encoding string
+	var baseHash sql.NullString
+	var data []byte
+
+	if err := q.QueryRowx(
+		"SELECT encoding, base_hash, data FROM blobs WHERE hash = ?",
+		hash,
+	).Scan(&encoding, &baseHash, &data); err != nil {
+		return nil, err
+	}
+
+	data, err := c.open(data)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decrypt blob %s: %w", hash, err)
+	}
+
+	payload, err := decompress(data)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decompress blob %s: %w", hash, err)
+	}
+
+	switch encoding {
+	case blobEncodingZlib:
+		return payload, nil
+	case blobEncodingDelta:
+		base, err := readBlob(q, c, baseHash.String)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read base of blob %s: %w", hash, err)
+		}
+		return applyDelta(base, payload)
+	default:
+		return nil, fmt.Errorf("unknown encoding %q for blob %s", encoding, hash)
+	}
+}
+
+// fileContent resolves the content of a files row which is either stored
+// inline (legacy rows) or as a reference to a blob
+func fileContent(q sqlx.Queryer, c *fieldCipher, content []byte, contentHash sql.NullString) ([]byte, error) {
+	if !contentHash.Valid || len(contentHash.String) == 0 {
+		return c.open(content)
+	}
+	return readBlob(q, c, contentHash.String)
+}
+
+// pruneBlobs removes blobs which are no longer referenced by any file
+// or by other blobs as their delta base
+func pruneBlobs(q sqlx.Execer) (int64, error) {
+	res, err := q.Exec(`WITH RECURSIVE live(hash) AS (
+	SELECT content_hash FROM files WHERE content_hash IS NOT NULL
+	UNION
+	SELECT blobs.base_hash FROM blobs JOIN live ON blobs.hash = live.hash WHERE blobs.base_hash IS NOT NULL
+)
+DELETE FROM blobs WHERE hash NOT IN (SELECT hash FROM live)`)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// CompactStats reports the changes made by Compact
+type CompactStats struct {
+	// ConvertedFiles is the number of file versions moved into the blob store
+	ConvertedFiles int
+	// DeltaBlobs is the number of blobs already in the blob store which
+	// were re-encoded as deltas
+	DeltaBlobs int
+	// PrunedBlobs is the number of unreferenced blobs removed
+	PrunedBlobs int
+}
+
+// Compact moves inline file contents into the blob store, removes unused
+// blobs and reclaims the free space of the database. If delta is true,
+// file versions are stored as deltas against their previous version,
+// including the versions already in the blob store, and newly written
+// files will use delta storage as well.
+func (log *Logger) Compact(delta bool) (CompactStats, error) {
+	stats := CompactStats{}
+	if log.db == nil {
+		return stats, ErrUnsupportedStorage
+	}
+
+	if delta {
+		if err := log.AddSetting(DeltaStorageSetting, "true"); err != nil {
+			return stats, err
+		}
+	}
+
+	type compactedFile struct {
+		Id            int            `db:"id"`
+		ParticipantId string         `db:"participant_id"`
+		FilePath      string         `db:"file_path"`
+		Content       []byte         `db:"content"`
+		ContentHash   sql.NullString `db:"content_hash"`
+	}
+
+	// the files already in the blob store are only needed as the bases
+	// of the deltas
+	where := "WHERE content_hash IS NULL"
+	if delta {
+		where = ""
+	}
+
+	// versions are ordered so that each file is stored right after its previous version
+	var files []compactedFile
+	if err := log.db.Select(
+		&files,
+		"SELECT id, participant_id, file_path, content, content_hash FROM files "+where+" ORDER BY participant_id, file_path, file_version",
+	); err != nil {
+		return stats, err
+	}
+
+	c, err := log.sealer()
+	if err != nil {
+		return stats, err
+	}
+
+	tx, err := log.db.Beginx()
+	if err != nil {
+		return stats, err
+	}
+
+	prevKey, prevHash := "", ""
+	for _, file := range files {
+		baseHash := ""
+		if key := file.ParticipantId + "\x00" + file.FilePath; delta && key == prevKey {
+			baseHash = prevHash
+		} else {
+			prevKey = key
+		}
+
+		if file.ContentHash.Valid && len(file.ContentHash.String) != 0 {
+			if len(baseHash) != 0 {
+				reencoded, err := deltaEncodeBlob(tx, c, file.ContentHash.String, baseHash)
+				if err != nil {
+					tx.Rollback()
+					return stats, err
+				} else if reencoded {
+					stats.DeltaBlobs++
+				}
+			}
+
+			prevHash = file.ContentHash.String
+			continue
+		}
+
+		content, err := c.open(file.Content)
+		if err != nil {
+			tx.Rollback()
+			return stats, err
+		}
+
+		hash, err := storeBlob(tx, c, content, baseHash)
+		if err != nil {
+			tx.Rollback()
+			return stats, err
+		}
+
+		if _, err := tx.Exec("UPDATE files SET content = NULL, content_hash = ? WHERE id = ?", hash, file.Id); err != nil {
+			tx.Rollback()
+			return stats, err
+		}
+
+		prevHash = hash
+		stats.ConvertedFiles++
+	}
+
+	pruned, err := pruneBlobs(tx)
+	if err != nil {
+		tx.Rollback()
+		return stats, err
+	}
+	stats.PrunedBlobs = int(pruned)
+
+	if err := tx.Commit(); err != nil {
+		return stats, err
+	}
+
+	_, err = log.db.Exec("VACUUM")
+	return stats, err
+}
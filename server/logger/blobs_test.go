@@ -0,0 +1,221 @@
+package logger_test
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/nedpals/bugbuddy/server/logger"
+)
+
+func countRows(t *testing.T, dbPath string, query string) int {
+	t.Helper()
+
+	db, err := sqlx.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var count int
+	if err := db.QueryRow(query).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+func TestLogger_WriteVersionedFile_Deduplicates(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "logs.db")
+	log, err := logger.NewLoggerFromPath(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+	collectEverything(t, log)
+
+	content := []byte("print('hello')")
+	for version := 1; version <= 3; version++ {
+		if err := log.WriteVersionedFile("/path/to/a.py", content, version); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := log.WriteVersionedFile("/path/to/b.py", content, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if count := countRows(t, dbPath, "SELECT COUNT(*) FROM files"); count != 4 {
+		t.Errorf("expected 4 file versions, got %d", count)
+	}
+
+	if count := countRows(t, dbPath, "SELECT COUNT(*) FROM blobs"); count != 1 {
+		t.Errorf("expected identical contents to share 1 blob, got %d", count)
+	}
+
+	for version := 1; version <= 3; version++ {
+		got, err := log.OpenVersionedFile("/path/to/a.py", version)
+		if err != nil {
+			t.Fatal(err)
+		} else if !bytes.Equal(got, content) {
+			t.Errorf("expected version %d to be %q, got %q", version, content, got)
+		}
+	}
+}
+
+func TestLogger_WriteVersionedFile_Delta(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "logs.db")
+	log, err := logger.NewLoggerFromPath(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+	collectEverything(t, log)
+
+	if err := log.AddSetting(logger.DeltaStorageSetting, "true"); err != nil {
+		t.Fatal(err)
+	}
+
+	// a long file with a small change on every version
+	lines := []string{}
+	for i := 0; i < 200; i++ {
+		lines = append(lines, fmt.Sprintf("print('line %d')", i))
+	}
+
+	versions := [][]byte{}
+	for version := 1; version <= 40; version++ {
+		lines[version] = fmt.Sprintf("print('changed in version %d')", version)
+		content := []byte(strings.Join(lines, "\n"))
+		versions = append(versions, content)
+
+		if err := log.WriteVersionedFile("/path/to/long.py", content, version); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if count := countRows(t, dbPath, "SELECT COUNT(*) FROM blobs WHERE encoding = 'delta'"); count == 0 {
+		t.Error("expected versions to be stored as deltas")
+	}
+
+	if depth := countRows(t, dbPath, "SELECT MAX(depth) FROM blobs"); depth > 16 {
+		t.Errorf("expected delta chains to be limited, got depth %d", depth)
+	}
+
+	for i, expected := range versions {
+		got, err := log.OpenVersionedFile("/path/to/long.py", i+1)
+		if err != nil {
+			t.Fatal(err)
+		} else if !bytes.Equal(got, expected) {
+			t.Errorf("version %d does not match the written content", i+1)
+		}
+	}
+}
+
+func TestLogger_Compact(t *testing.T) {
+	dbPath := loadFixture(t, filepath.Join("testdata", "schemas", "v0.sql"))
+
+	log, err := logger.NewLoggerFromPath(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+	collectEverything(t, log)
+
+	before, err := log.OpenVersionedFile("/home/student/hello.py", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := log.Compact(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.ConvertedFiles != 2 {
+		t.Errorf("expected 2 converted files, got %d", stats.ConvertedFiles)
+	}
+
+	if count := countRows(t, dbPath, "SELECT COUNT(*) FROM files WHERE content IS NOT NULL"); count != 0 {
+		t.Errorf("expected no inline contents after compacting, got %d", count)
+	}
+
+	after, err := log.OpenVersionedFile("/home/student/hello.py", 2)
+	if err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(before, after) {
+		t.Errorf("expected compacted content to be %q, got %q", before, after)
+	}
+}
+
+func TestLogger_Compact_DeltaBlobs(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "logs.db")
+	log, err := logger.NewLoggerFromPath(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+	collectEverything(t, log)
+
+	// the versions are written to the blob store before delta storage is enabled
+	body := strings.Repeat("print('line')\n", 40)
+	versions := []string{body, body + "x = 1\n", body + "x = 2\n", body}
+	for i, content := range versions {
+		if err := log.WriteVersionedFile("/lab/hello.py", []byte(content), i+1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if count := countRows(t, dbPath, "SELECT COUNT(*) FROM blobs WHERE encoding = 'delta'"); count != 0 {
+		t.Fatalf("expected no deltas before compacting, got %d", count)
+	}
+
+	stats, err := log.Compact(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the last version is the same blob as the first one, which is now the
+	// base of the second version
+	if stats.ConvertedFiles != 0 || stats.DeltaBlobs != 2 {
+		t.Errorf("expected 2 blobs to be delta-encoded, got %+v", stats)
+	} else if count := countRows(t, dbPath, "SELECT COUNT(*) FROM blobs WHERE encoding = 'delta'"); count != 2 {
+		t.Errorf("expected 2 deltas after compacting, got %d", count)
+	}
+
+	for i, expected := range versions {
+		got, err := log.OpenVersionedFile("/lab/hello.py", i+1)
+		if err != nil {
+			t.Fatal(err)
+		} else if string(got) != expected {
+			t.Errorf("version %d does not match the written content", i+1)
+		}
+	}
+
+	if problems, err := log.Verify(); err != nil || len(problems) != 0 {
+		t.Errorf("expected a valid database, got %v (%v)", problems, err)
+	}
+}
+
+func TestLogger_DeleteFile_PrunesBlobs(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "logs.db")
+	log, err := logger.NewLoggerFromPath(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+	collectEverything(t, log)
+
+	if err := log.WriteVersionedFile("/path/to/a.py", []byte("a = 1"), 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := log.DeleteFile("/path/to/a.py"); err != nil {
+		t.Fatal(err)
+	}
+
+	if count := countRows(t, dbPath, "SELECT COUNT(*) FROM blobs"); count != 0 {
+		t.Errorf("expected blobs of deleted files to be removed, got %d", count)
+	}
+}
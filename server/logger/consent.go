@@ -0,0 +1,129 @@
+package logger
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// CollectionLevel determines which data is stored by the logger
+type CollectionLevel string
+
+const (
+	// CollectionOff does not store anything
+	CollectionOff CollectionLevel = "off"
+	// CollectionMetadataOnly stores the log entries without the error
+	// messages, generated outputs and file contents
+	CollectionMetadataOnly CollectionLevel = "metadata-only"
+	// CollectionErrorsOnly stores only the runs which resulted in an error
+	CollectionErrorsOnly CollectionLevel = "errors-only"
+	// CollectionFull stores everything
+	CollectionFull CollectionLevel = "full"
+
+	// DefaultCollectionLevel is used until the participant has given their
+	// consent. The logs created before collection levels are migrated to
+	// CollectionFull.
+	DefaultCollectionLevel = CollectionMetadataOnly
+)
+
+const (
+	CollectionLevelSetting = "collection.level"
+	ConsentedAtSetting     = "collection.consented_at"
+	StudyIdSetting         = "collection.study_id"
+)
+
+// CollectionLevels lists the supported collection levels
+var CollectionLevels = []CollectionLevel{
+	CollectionOff,
+	CollectionMetadataOnly,
+	CollectionErrorsOnly,
+	CollectionFull,
+}
+
+// ParseCollectionLevel validates the collection level
+func ParseCollectionLevel(level string) (CollectionLevel, error) {
+	for _, l := range CollectionLevels {
+		if string(l) == level {
+			return l, nil
+		}
+	}
+	return "", fmt.Errorf("unknown collection level: %s", level)
+}
+
+// StoresEntry checks if a run with the exit code should be logged
+func (l CollectionLevel) StoresEntry(errorCode int) bool {
+	switch l {
+	case CollectionOff:
+		return false
+	case CollectionErrorsOnly:
+		return errorCode != 0
+	default:
+		return true
+	}
+}
+
+// StoresContent checks if the error messages, outputs and
+// file contents should be stored
+func (l CollectionLevel) StoresContent() bool {
+	return l == CollectionErrorsOnly || l == CollectionFull
+}
+
+// Consent is the data collection agreement of the participant
+type Consent struct {
+	Level       CollectionLevel `json:"level"`
+	StudyId     string          `json:"study_id"`
+	ConsentedAt *time.Time      `json:"consented_at"`
+}
+
+// CollectionLevel returns the current collection level of the logger
+func (log *Logger) CollectionLevel() CollectionLevel {
+	rawLevel, err := log.GetSetting(CollectionLevelSetting)
+	if err != nil {
+		return DefaultCollectionLevel
+	}
+
+	level, err := ParseCollectionLevel(rawLevel)
+	if err != nil {
+		// refuse to store anything if the setting is corrupted
+		return CollectionOff
+	}
+	return level
+}
+
+// Consent returns the collection level, the study id and the
+// time when the participant has given their consent
+func (log *Logger) Consent() (Consent, error) {
+	consent := Consent{Level: log.CollectionLevel()}
+
+	if studyId, err := log.GetSetting(StudyIdSetting); err == nil {
+		consent.StudyId = studyId
+	} else if err != sql.ErrNoRows {
+		return consent, err
+	}
+
+	if rawConsentedAt, err := log.GetSetting(ConsentedAtSetting); err == nil {
+		consentedAt, err := time.Parse(time.RFC3339Nano, rawConsentedAt)
+		if err != nil {
+			return consent, err
+		}
+		consent.ConsentedAt = &consentedAt
+	} else if err != sql.ErrNoRows {
+		return consent, err
+	}
+
+	return consent, nil
+}
+
+// SetConsent records the collection level agreed by the participant
+// for the study along with the time of the agreement
+func (log *Logger) SetConsent(level CollectionLevel, studyId string) error {
+	if _, err := ParseCollectionLevel(string(level)); err != nil {
+		return err
+	}
+
+	return log.storage.SetSettings(map[string]string{
+		CollectionLevelSetting: string(level),
+		StudyIdSetting:         studyId,
+		ConsentedAtSetting:     time.Now().Format(time.RFC3339Nano),
+	})
+}
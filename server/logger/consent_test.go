@@ -0,0 +1,107 @@
+package logger_test
+
+import (
+	"testing"
+
+	"github.com/nedpals/bugbuddy/server/logger"
+)
+
+// collectEverything records the consent to the full collection, which new
+// logs do not have by default
+func collectEverything(t *testing.T, log *logger.Logger) {
+	t.Helper()
+
+	if err := log.SetConsent(logger.CollectionFull, ""); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLogger_CollectionLevel(t *testing.T) {
+	cases := []struct {
+		level           logger.CollectionLevel
+		expectedEntries int
+		expectedMessage string
+		expectFile      bool
+	}{
+		{level: logger.CollectionOff, expectedEntries: 0},
+		{level: logger.CollectionMetadataOnly, expectedEntries: 2, expectedMessage: ""},
+		{level: logger.CollectionErrorsOnly, expectedEntries: 1, expectedMessage: "NameError: name 'a' is not defined", expectFile: true},
+		{level: logger.CollectionFull, expectedEntries: 2, expectedMessage: "NameError: name 'a' is not defined", expectFile: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(string(tc.level), func(t *testing.T) {
+			log := logger.NewMemoryLoggerPanic()
+			defer log.Close()
+
+			if err := log.SetConsent(tc.level, "study"); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := log.WriteVersionedFile("/path/to/a.py", []byte("print(a)"), 1); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, errorCode := range []int{1, 0} {
+				if err := log.Log(logger.LogEntry{
+					ErrorCode:    errorCode,
+					ErrorMessage: "NameError: name 'a' is not defined",
+					FilePath:     "/path/to/a.py",
+					FileVersion:  1,
+				}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			iter, err := log.Entries()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			entries, err := iter.List()
+			if err != nil {
+				t.Fatal(err)
+			} else if len(entries) != tc.expectedEntries {
+				t.Fatalf("expected %d entries, got %d", tc.expectedEntries, len(entries))
+			}
+
+			if len(entries) != 0 && entries[0].ErrorMessage != tc.expectedMessage {
+				t.Errorf("expected error message %q, got %q", tc.expectedMessage, entries[0].ErrorMessage)
+			}
+
+			_, err = log.OpenVersionedFile("/path/to/a.py", 1)
+			if tc.expectFile && err != nil {
+				t.Errorf("expected file to be stored, got %v", err)
+			} else if !tc.expectFile && err == nil {
+				t.Error("expected file not to be stored")
+			}
+		})
+	}
+}
+
+func TestLogger_Consent(t *testing.T) {
+	log := logger.NewMemoryLoggerPanic()
+	defer log.Close()
+
+	consent, err := log.Consent()
+	if err != nil {
+		t.Fatal(err)
+	} else if consent.Level != logger.DefaultCollectionLevel || consent.ConsentedAt != nil {
+		t.Fatalf("expected no consent by default, got %+v", consent)
+	}
+
+	if err := log.SetConsent("everything", ""); err == nil {
+		t.Error("expected unknown collection level to be rejected")
+	}
+
+	if err := log.SetConsent(logger.CollectionErrorsOnly, "cs101-fall"); err != nil {
+		t.Fatal(err)
+	}
+
+	consent, err = log.Consent()
+	if err != nil {
+		t.Fatal(err)
+	} else if consent.Level != logger.CollectionErrorsOnly || consent.StudyId != "cs101-fall" || consent.ConsentedAt == nil {
+		t.Errorf("expected consent to be recorded, got %+v", consent)
+	}
+}
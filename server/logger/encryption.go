@@ -0,0 +1,615 @@
+package logger
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// EncryptionMode is the source of the key of an encrypted database
+type EncryptionMode string
+
+const (
+	// EncryptionPassphrase derives the key from a passphrase
+	EncryptionPassphrase EncryptionMode = "passphrase"
+	// EncryptionKeyFile reads the key from a file in the data dir
+	EncryptionKeyFile EncryptionMode = "keyfile"
+)
+
+const (
+	EncryptionModeSetting  = "encryption.mode"
+	EncryptionSaltSetting  = "encryption.salt"
+	encryptionCheckSetting = "encryption.check"
+
+	// PassphraseEnv is the environment variable used for unlocking
+	// databases encrypted with a passphrase
+	PassphraseEnv = "BUGBUDDY_LOGS_PASSPHRASE"
+
+	// encryptionCheckValue is stored encrypted for verifying the key
+	encryptionCheckValue = "bugbuddy"
+	// encryptedPrefix marks the values which are encrypted
+	encryptedPrefix = "bbenc1:"
+
+	keySize          = 32
+	saltSize         = 16
+	pbkdf2Iterations = 210000
+)
+
+var (
+	// ErrLocked is returned when reading or writing encrypted data without the key
+	ErrLocked = errors.New("logs database is encrypted and has not been unlocked")
+	// ErrWrongKey is returned when the key does not decrypt the database
+	ErrWrongKey = errors.New("key does not match the logs database")
+)
+
+// EncryptionKey is the source of the key for encrypting the logs.
+// Either the passphrase or the key file must be set.
+type EncryptionKey struct {
+	Passphrase string
+	// KeyFile is the path of the file containing the key
+	KeyFile string
+}
+
+// KeyFilePath returns the path of the key file of the database,
+// which is stored next to it (eg. logs.db uses logs.key)
+func KeyFilePath(dbPath string) string {
+	return strings.TrimSuffix(dbPath, filepath.Ext(dbPath)) + ".key"
+}
+
+// GenerateKeyFile writes a new random key into the path. Existing
+// key files are never overwritten.
+func GenerateKeyFile(path string) error {
+	key := make([]byte, keySize)
+	if _, err := rand.Read(key); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.WriteString(hex.EncodeToString(key) + "\n"); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func readKeyFile(path string) ([]byte, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := hex.DecodeString(strings.TrimSpace(string(raw)))
+	if err != nil || len(key) != keySize {
+		return nil, fmt.Errorf("invalid key file %s", path)
+	}
+	return key, nil
+}
+
+func hmacSum(key []byte, data []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+// pbkdf2Key derives a key from the passphrase with PBKDF2-HMAC-SHA256
+func pbkdf2Key(passphrase []byte, salt []byte, iterations int, keyLen int) []byte {
+	prf := hmac.New(sha256.New, passphrase)
+	key := make([]byte, 0, keyLen)
+	block := make([]byte, 4)
+
+	for i := uint32(1); len(key) < keyLen; i++ {
+		binary.BigEndian.PutUint32(block, i)
+		prf.Reset()
+		prf.Write(salt)
+		prf.Write(block)
+		u := prf.Sum(nil)
+
+		t := make([]byte, len(u))
+		copy(t, u)
+		for n := 1; n < iterations; n++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+
+	return key[:keyLen]
+}
+
+// fieldCipher encrypts the values of the encrypted columns. A nil
+// cipher leaves the values as is.
+type fieldCipher struct {
+	aead     cipher.AEAD
+	nonceKey []byte
+	// hashKey keys the hashes of the stored file contents so that they
+	// cannot be used for checking guesses of the contents
+	hashKey []byte
+}
+
+func newFieldCipher(masterKey []byte) (*fieldCipher, error) {
+	block, err := aes.NewCipher(hmacSum(masterKey, []byte("bugbuddy logs encryption")))
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &fieldCipher{
+		aead:     aead,
+		nonceKey: hmacSum(masterKey, []byte("bugbuddy logs nonce")),
+		hashKey:  hmacSum(masterKey, []byte("bugbuddy logs content hash")),
+	}, nil
+}
+
+// hashContent returns the hash addressing the blob of the content. It is
+// an HMAC-SHA256 of the content if the cipher is set and HashContent
+// otherwise.
+func (c *fieldCipher) hashContent(content []byte) string {
+	if c == nil {
+		return HashContent(content)
+	}
+	return hex.EncodeToString(hmacSum(c.hashKey, content))
+}
+
+// seal encrypts the data. The nonce is derived from the data so that equal
+// values have equal ciphertexts, which keeps the duplicate checks of Merge
+// working at the cost of revealing which values are equal.
+func (c *fieldCipher) seal(data []byte) []byte {
+	if c == nil {
+		return data
+	}
+
+	nonce := hmacSum(c.nonceKey, data)[:c.aead.NonceSize()]
+	out := append([]byte(encryptedPrefix), nonce...)
+	return c.aead.Seal(out, nonce, data, nil)
+}
+
+// open decrypts the data. Data which is not encrypted is returned as is.
+func (c *fieldCipher) open(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, []byte(encryptedPrefix)) {
+		return data, nil
+	} else if c == nil {
+		return nil, ErrLocked
+	}
+
+	payload := data[len(encryptedPrefix):]
+	if len(payload) < c.aead.NonceSize() {
+		return nil, ErrWrongKey
+	}
+
+	nonceSize := c.aead.NonceSize()
+	plaintext, err := c.aead.Open(nil, payload[:nonceSize], payload[nonceSize:], nil)
+	if err != nil {
+		return nil, ErrWrongKey
+	}
+	return plaintext, nil
+}
+
+// sealString encrypts the text into a base64 string. Empty strings are
+// kept empty so that successful runs can still be told apart.
+func (c *fieldCipher) sealString(text string) string {
+	if c == nil || len(text) == 0 {
+		return text
+	}
+
+	sealed := c.seal([]byte(text))
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed[len(encryptedPrefix):])
+}
+
+func (c *fieldCipher) openString(text string) (string, error) {
+	if !strings.HasPrefix(text, encryptedPrefix) {
+		return text, nil
+	} else if c == nil {
+		return "", ErrLocked
+	}
+
+	payload, err := base64.StdEncoding.DecodeString(text[len(encryptedPrefix):])
+	if err != nil {
+		return "", ErrWrongKey
+	}
+
+	plaintext, err := c.open(append([]byte(encryptedPrefix), payload...))
+	return string(plaintext), err
+}
+
+// sealEntry encrypts the text columns of the entry. The file path and the
+// error type are left as is since they are used for filtering the logs.
+func (c *fieldCipher) sealEntry(entry LogEntry) LogEntry {
+	entry.ExecutedCommand = c.sealString(entry.ExecutedCommand)
+	entry.ErrorMessage = c.sealString(entry.ErrorMessage)
+	entry.GeneratedOutput = c.sealString(entry.GeneratedOutput)
+	return entry
+}
+
+func (c *fieldCipher) openEntry(entry *LogEntry) error {
+	var err error
+	if entry.ExecutedCommand, err = c.openString(entry.ExecutedCommand); err != nil {
+		return err
+	}
+	if entry.ErrorMessage, err = c.openString(entry.ErrorMessage); err != nil {
+		return err
+	}
+	entry.GeneratedOutput, err = c.openString(entry.GeneratedOutput)
+	return err
+}
+
+// Encrypted checks if the logs database is encrypted
+func (log *Logger) Encrypted() bool {
+	_, err := log.GetSetting(EncryptionModeSetting)
+	return err == nil
+}
+
+// Locked checks if the database is encrypted and the key has not been provided
+func (log *Logger) Locked() bool {
+	return log.cipher == nil && log.Encrypted()
+}
+
+// sealer returns the cipher for writing into the database
+func (log *Logger) sealer() (*fieldCipher, error) {
+	if log.Locked() {
+		return nil, ErrLocked
+	}
+	return log.cipher, nil
+}
+
+// deriveKey returns the master key of the source
+func deriveKey(key EncryptionKey, salt []byte) (EncryptionMode, []byte, error) {
+	if len(key.Passphrase) != 0 {
+		return EncryptionPassphrase, pbkdf2Key([]byte(key.Passphrase), salt, pbkdf2Iterations, keySize), nil
+	} else if len(key.KeyFile) != 0 {
+		masterKey, err := readKeyFile(key.KeyFile)
+		return EncryptionKeyFile, masterKey, err
+	}
+	return "", nil, errors.New("no passphrase or key file provided")
+}
+
+// Unlock provides the key for reading and writing the encrypted database.
+// The key file defaults to the one next to the database.
+func (log *Logger) Unlock(key EncryptionKey) error {
+	rawMode, err := log.GetSetting(EncryptionModeSetting)
+	if err != nil {
+		// nothing to unlock
+		return nil
+	}
+
+	var salt []byte
+	switch EncryptionMode(rawMode) {
+	case EncryptionPassphrase:
+		key.KeyFile = ""
+		rawSalt, err := log.GetSetting(EncryptionSaltSetting)
+		if err != nil {
+			return err
+		}
+		if salt, err = hex.DecodeString(rawSalt); err != nil {
+			return err
+		}
+	case EncryptionKeyFile:
+		key.Passphrase = ""
+		if len(key.KeyFile) == 0 && len(log.path) != 0 {
+			key.KeyFile = KeyFilePath(log.path)
+		}
+	default:
+		return fmt.Errorf("unknown encryption mode: %s", rawMode)
+	}
+
+	_, masterKey, err := deriveKey(key, salt)
+	if err != nil {
+		return err
+	}
+
+	c, err := newFieldCipher(masterKey)
+	if err != nil {
+		return err
+	}
+
+	check, err := log.GetSetting(encryptionCheckSetting)
+	if err != nil {
+		return err
+	} else if value, err := c.openString(check); err != nil || value != encryptionCheckValue {
+		return ErrWrongKey
+	}
+
+	log.setCipher(c)
+	return nil
+}
+
+// autoUnlock unlocks the database with the passphrase from the environment
+// or with the key file next to the database. The database stays locked if
+// neither is available.
+func (log *Logger) autoUnlock() {
+	if !log.Encrypted() {
+		return
+	}
+	log.Unlock(EncryptionKey{Passphrase: os.Getenv(PassphraseEnv)})
+}
+
+// Rekey encrypts the database with the new key. Encrypted databases must be
+// unlocked first. Passing nil decrypts the database.
+func (log *Logger) Rekey(key *EncryptionKey) error {
+	if log.db == nil {
+		return ErrUnsupportedStorage
+	} else if log.Locked() {
+		return ErrLocked
+	}
+
+	var newCipher *fieldCipher
+	newSettings := map[string]string{}
+
+	if key != nil {
+		salt := make([]byte, saltSize)
+		if _, err := rand.Read(salt); err != nil {
+			return err
+		}
+
+		mode, masterKey, err := deriveKey(*key, salt)
+		if err != nil {
+			return err
+		}
+
+		if newCipher, err = newFieldCipher(masterKey); err != nil {
+			return err
+		}
+
+		newSettings[EncryptionModeSetting] = string(mode)
+		newSettings[encryptionCheckSetting] = newCipher.sealString(encryptionCheckValue)
+		if mode == EncryptionPassphrase {
+			newSettings[EncryptionSaltSetting] = hex.EncodeToString(salt)
+		}
+	}
+
+	tx, err := log.db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	if err := recryptRows(tx, log.cipher, newCipher); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if _, err := tx.Exec(
+		"DELETE FROM settings WHERE name IN (?, ?, ?)",
+		EncryptionModeSetting,
+		EncryptionSaltSetting,
+		encryptionCheckSetting,
+	); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	for name, value := range newSettings {
+		if _, err := tx.Exec("INSERT INTO settings (name, value) VALUES (?, ?)", name, value); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	log.setCipher(newCipher)
+
+	// make sure the data encrypted with the old key does not linger in the free pages
+	_, err = log.db.Exec("VACUUM")
+	return err
+}
+
+// recryptBatchSize is the number of rows loaded at a time by recryptRows
+const recryptBatchSize = 500
+
+// recryptRows decrypts the encrypted columns with the old cipher
+// and encrypts them again with the new one
+func recryptRows(tx *sqlx.Tx, oldCipher, newCipher *fieldCipher) error {
+	type logRow struct {
+		Id              int    `db:"id"`
+		ExecutedCommand string `db:"executed_command"`
+		ErrorMessage    string `db:"error_message"`
+		GeneratedOutput string `db:"generated_output"`
+	}
+
+	for lastId := 0; ; {
+		var rows []logRow
+		if err := tx.Select(
+			&rows,
+			"SELECT id, executed_command, error_message, generated_output FROM logs WHERE id > ? ORDER BY id LIMIT ?",
+			lastId,
+			recryptBatchSize,
+		); err != nil {
+			return err
+		} else if len(rows) == 0 {
+			break
+		}
+
+		for _, row := range rows {
+			entry := LogEntry{
+				ExecutedCommand: row.ExecutedCommand,
+				ErrorMessage:    row.ErrorMessage,
+				GeneratedOutput: row.GeneratedOutput,
+			}
+			if err := oldCipher.openEntry(&entry); err != nil {
+				return err
+			}
+
+			entry = newCipher.sealEntry(entry)
+			if _, err := tx.Exec(
+				"UPDATE logs SET executed_command = ?, error_message = ?, generated_output = ? WHERE id = ?",
+				entry.ExecutedCommand,
+				entry.ErrorMessage,
+				entry.GeneratedOutput,
+				row.Id,
+			); err != nil {
+				return err
+			}
+			lastId = row.Id
+		}
+	}
+
+	if err := rekeyBlobs(tx, oldCipher, newCipher); err != nil {
+		return err
+	}
+
+	// legacy rows store their content inline
+	type fileRow struct {
+		Id      int    `db:"id"`
+		Content []byte `db:"content"`
+	}
+
+	for lastId := 0; ; {
+		var rows []fileRow
+		if err := tx.Select(
+			&rows,
+			"SELECT id, content FROM files WHERE content IS NOT NULL AND id > ? ORDER BY id LIMIT ?",
+			lastId,
+			recryptBatchSize,
+		); err != nil {
+			return err
+		} else if len(rows) == 0 {
+			break
+		}
+
+		for _, row := range rows {
+			content, err := oldCipher.open(row.Content)
+			if err != nil {
+				return err
+			}
+
+			if _, err := tx.Exec("UPDATE files SET content = ? WHERE id = ?", newCipher.seal(content), row.Id); err != nil {
+				return err
+			}
+			lastId = row.Id
+		}
+	}
+
+	return nil
+}
+
+// rekeyBlobs encrypts the blobs with the new cipher. The hashes and the
+// sizes of the blobs depend on the cipher, so they are computed again
+// along with the references of the files and the deltas to them.
+func rekeyBlobs(tx *sqlx.Tx, oldCipher, newCipher *fieldCipher) error {
+	if _, err := tx.Exec("CREATE TEMP TABLE rekeyed_blobs (old_hash TEXT PRIMARY KEY, new_hash TEXT NOT NULL, data BLOB NOT NULL, size INTEGER NOT NULL)"); err != nil {
+		return err
+	}
+	defer tx.Exec("DROP TABLE IF EXISTS temp.rekeyed_blobs")
+
+	type blobRow struct {
+		Hash string `db:"hash"`
+		Data []byte `db:"data"`
+	}
+
+	// the blobs keep their old hashes until all of them are read since
+	// the deltas are resolved through the hashes of their bases
+	for lastHash := ""; ; {
+		var rows []blobRow
+		if err := tx.Select(
+			&rows,
+			"SELECT hash, data FROM blobs WHERE hash > ? ORDER BY hash LIMIT ?",
+			lastHash,
+			recryptBatchSize,
+		); err != nil {
+			return err
+		} else if len(rows) == 0 {
+			break
+		}
+
+		for _, row := range rows {
+			data, err := oldCipher.open(row.Data)
+			if err != nil {
+				return err
+			}
+
+			content, err := readBlob(tx, oldCipher, row.Hash)
+			if err != nil {
+				return err
+			}
+
+			sealed := newCipher.seal(data)
+			size := len(content)
+			if newCipher != nil {
+				size = len(sealed)
+			}
+
+			if _, err := tx.Exec(
+				"INSERT INTO temp.rekeyed_blobs (old_hash, new_hash, data, size) VALUES (?, ?, ?, ?)",
+				row.Hash,
+				newCipher.hashContent(content),
+				sealed,
+				size,
+			); err != nil {
+				return err
+			}
+			lastHash = row.Hash
+		}
+	}
+
+	for _, query := range []string{
+		`UPDATE blobs SET
+			hash = r.new_hash,
+			data = r.data,
+			size = r.size,
+			base_hash = (SELECT base.new_hash FROM temp.rekeyed_blobs base WHERE base.old_hash = blobs.base_hash)
+		FROM temp.rekeyed_blobs r WHERE r.old_hash = blobs.hash`,
+		`UPDATE files SET content_hash = r.new_hash
+		FROM temp.rekeyed_blobs r WHERE r.old_hash = files.content_hash`,
+	} {
+		if _, err := tx.Exec(query); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DecryptTo writes a decrypted copy of the database into the path. The
+// database must be unlocked first. Existing files are not overwritten.
+func (log *Logger) DecryptTo(outPath string) error {
+	if log.db == nil {
+		return ErrUnsupportedStorage
+	} else if log.Locked() {
+		return ErrLocked
+	} else if _, err := os.Stat(outPath); err == nil {
+		return fmt.Errorf("%s already exists", outPath)
+	}
+
+	if _, err := log.db.Exec("VACUUM INTO ?", outPath); err != nil {
+		return err
+	}
+
+	db, err := sqlx.Open("sqlite", outPath)
+	if err != nil {
+		return err
+	}
+
+	decrypted := &Logger{
+		storage: &sqliteStorage{db: db, cipher: log.cipher},
+		db:      db,
+		path:    outPath,
+		cipher:  log.cipher,
+	}
+	defer decrypted.Close()
+
+	return decrypted.Rekey(nil)
+}
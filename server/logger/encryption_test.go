@@ -0,0 +1,352 @@
+package logger_test
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/nedpals/bugbuddy/server/logger"
+)
+
+const secretOutput = "NameError: name 'secret_variable' is not defined"
+
+func newEncryptionFixture(t *testing.T) string {
+	t.Helper()
+
+	dbPath := filepath.Join(t.TempDir(), "logs.db")
+	log, err := logger.NewLoggerFromPath(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+	collectEverything(t, log)
+
+	if err := log.Log(logger.LogEntry{
+		ExecutedCommand: "python3 secret.py",
+		ErrorCode:       1,
+		ErrorType:       "NameError",
+		ErrorMessage:    secretOutput,
+		GeneratedOutput: "# NameError",
+		FilePath:        "secret.py",
+		FileVersion:     1,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := log.WriteVersionedFile("secret.py", []byte("print(secret_variable)"), 1); err != nil {
+		t.Fatal(err)
+	}
+
+	return dbPath
+}
+
+// assertNoPlaintext checks the raw database for the secrets
+func assertNoPlaintext(t *testing.T, dbPath string) {
+	t.Helper()
+
+	db, err := sqlx.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var texts []string
+	if err := db.Select(&texts, "SELECT executed_command || error_message || generated_output FROM logs"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, text := range texts {
+		if strings.Contains(text, "secret") {
+			t.Errorf("expected logs to be encrypted, found %q", text)
+		}
+	}
+
+	var blobs [][]byte
+	if err := db.Select(&blobs, "SELECT data FROM blobs"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, blob := range blobs {
+		if !bytes.HasPrefix(blob, []byte("bbenc1:")) {
+			t.Errorf("expected blob to be encrypted")
+		}
+	}
+}
+
+func assertReadable(t *testing.T, log *logger.Logger) {
+	t.Helper()
+
+	iter, err := log.Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := iter.List()
+	if err != nil {
+		t.Fatal(err)
+	} else if len(entries) != 1 || entries[0].ErrorMessage != secretOutput || entries[0].ExecutedCommand != "python3 secret.py" {
+		t.Fatalf("unexpected entries %+v", entries)
+	}
+
+	content, err := log.OpenVersionedFile("secret.py", 1)
+	if err != nil {
+		t.Fatal(err)
+	} else if string(content) != "print(secret_variable)" {
+		t.Errorf("unexpected content %q", content)
+	}
+}
+
+func TestLogger_Rekey_Passphrase(t *testing.T) {
+	dbPath := newEncryptionFixture(t)
+
+	log, err := logger.NewLoggerFromPath(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := log.Rekey(&logger.EncryptionKey{Passphrase: "correct horse"}); err != nil {
+		t.Fatal(err)
+	} else if !log.Encrypted() || log.Locked() {
+		t.Fatal("expected database to be encrypted and unlocked")
+	}
+
+	// reading and writing stays transparent
+	assertReadable(t, log)
+	log.Close()
+	assertNoPlaintext(t, dbPath)
+
+	log, err = logger.NewLoggerFromPath(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+
+	if !log.Locked() {
+		t.Fatal("expected database to be locked without the passphrase")
+	}
+
+	if err := log.Log(logger.LogEntry{ErrorCode: 1, ErrorMessage: "leak"}); !errors.Is(err, logger.ErrLocked) {
+		t.Errorf("expected writes to be refused while locked, got %v", err)
+	}
+
+	iter, err := log.Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for iter.Next() {
+		if _, err := iter.Value(); !errors.Is(err, logger.ErrLocked) {
+			t.Errorf("expected reads to be refused while locked, got %v", err)
+		}
+	}
+
+	if err := log.Unlock(logger.EncryptionKey{Passphrase: "wrong"}); !errors.Is(err, logger.ErrWrongKey) {
+		t.Errorf("expected wrong passphrase to be rejected, got %v", err)
+	}
+
+	if err := log.Unlock(logger.EncryptionKey{Passphrase: "correct horse"}); err != nil {
+		t.Fatal(err)
+	}
+	assertReadable(t, log)
+}
+
+func TestLogger_Rekey_ContentHashes(t *testing.T) {
+	dbPath := newEncryptionFixture(t)
+
+	log, err := logger.NewLoggerFromPath(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+
+	// the second version is stored as a delta of the first one
+	secondVersion := []byte("print(secret_variable)\nprint(secret_variable)")
+	if _, err := log.Compact(true); err != nil {
+		t.Fatal(err)
+	} else if err := log.WriteVersionedFile("secret.py", secondVersion, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	plaintexts := map[string]int{
+		logger.HashContent([]byte("print(secret_variable)")): len("print(secret_variable)"),
+		logger.HashContent(secondVersion):                    len(secondVersion),
+	}
+
+	type blobRow struct {
+		Hash string `db:"hash"`
+		Size int    `db:"size"`
+	}
+
+	blobRows := func() []blobRow {
+		t.Helper()
+
+		db, err := sqlx.Open("sqlite", dbPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+
+		var rows []blobRow
+		if err := db.Select(&rows, "SELECT hash, size FROM blobs"); err != nil {
+			t.Fatal(err)
+		} else if len(rows) != 2 {
+			t.Fatalf("expected 2 blobs, got %+v", rows)
+		}
+		return rows
+	}
+
+	if err := log.Rekey(&logger.EncryptionKey{Passphrase: "correct horse"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, row := range blobRows() {
+		if _, ok := plaintexts[row.Hash]; ok {
+			t.Errorf("expected the hash of blob %s to be keyed", row.Hash)
+		}
+		for _, size := range plaintexts {
+			if row.Size == size {
+				t.Errorf("expected the size of blob %s to not be the size of the content", row.Hash)
+			}
+		}
+	}
+
+	if problems, err := log.Verify(); err != nil || len(problems) != 0 {
+		t.Fatalf("expected the encrypted logs to be valid, got %v (%v)", problems, err)
+	} else if content, err := log.OpenVersionedFile("secret.py", 2); err != nil || !bytes.Equal(content, secondVersion) {
+		t.Fatalf("expected the delta to be readable, got %q (%v)", content, err)
+	}
+
+	// decrypting brings back the plain hashes
+	if err := log.Rekey(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, row := range blobRows() {
+		if size, ok := plaintexts[row.Hash]; !ok || row.Size != size {
+			t.Errorf("expected the plain hash and size of the content, got %+v", row)
+		}
+	}
+
+	if problems, err := log.Verify(); err != nil || len(problems) != 0 {
+		t.Fatalf("expected the decrypted logs to be valid, got %v (%v)", problems, err)
+	}
+	assertReadable(t, log)
+}
+
+func TestLogger_Rekey_KeyFile(t *testing.T) {
+	dbPath := newEncryptionFixture(t)
+	keyPath := logger.KeyFilePath(dbPath)
+
+	if err := logger.GenerateKeyFile(keyPath); err != nil {
+		t.Fatal(err)
+	} else if err := logger.GenerateKeyFile(keyPath); err == nil {
+		t.Fatal("expected existing key file not to be overwritten")
+	}
+
+	log, err := logger.NewLoggerFromPath(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := log.Rekey(&logger.EncryptionKey{Passphrase: "first"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := log.Rekey(&logger.EncryptionKey{KeyFile: keyPath}); err != nil {
+		t.Fatal(err)
+	}
+	log.Close()
+	assertNoPlaintext(t, dbPath)
+
+	// the key file in the data dir unlocks the database on open
+	log, err = logger.NewLoggerFromPath(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+
+	if log.Locked() {
+		t.Fatal("expected database to be unlocked with the key file")
+	}
+	assertReadable(t, log)
+}
+
+func TestLogger_DecryptTo(t *testing.T) {
+	dbPath := newEncryptionFixture(t)
+
+	log, err := logger.NewLoggerFromPath(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+
+	if err := log.Rekey(&logger.EncryptionKey{Passphrase: "correct horse"}); err != nil {
+		t.Fatal(err)
+	}
+
+	outPath := filepath.Join(t.TempDir(), "plain.db")
+	if err := log.DecryptTo(outPath); err != nil {
+		t.Fatal(err)
+	} else if err := log.DecryptTo(outPath); err == nil {
+		t.Fatal("expected existing output not to be overwritten")
+	}
+
+	plain, err := logger.NewLoggerFromPath(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer plain.Close()
+
+	if plain.Encrypted() {
+		t.Fatal("expected decrypted copy not to be encrypted")
+	}
+	assertReadable(t, plain)
+
+	// the original database stays encrypted
+	if !log.Encrypted() {
+		t.Error("expected original database to stay encrypted")
+	}
+}
+
+func TestLogger_Merge_Encrypted(t *testing.T) {
+	src, err := logger.NewLoggerFromPath(newEncryptionFixture(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+
+	dst := logger.NewMemoryLoggerPanic()
+	defer dst.Close()
+	collectEverything(t, dst)
+
+	if err := dst.Rekey(&logger.EncryptionKey{Passphrase: "correct horse"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := dst.Merge(src, "src.db", logger.MergeOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// duplicates are still detected through the encrypted columns
+	stats, err := dst.Merge(src, "src.db", logger.MergeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	} else if stats.Entries != 0 || stats.Duplicates != 1 {
+		t.Errorf("expected the entry to be skipped, got %+v", stats)
+	}
+
+	iter, err := dst.EntriesByParticipantId(src.ParticipantId())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := iter.List()
+	if err != nil {
+		t.Fatal(err)
+	} else if len(entries) != 1 || entries[0].ErrorMessage != secretOutput {
+		t.Errorf("unexpected merged entries %+v", entries)
+	}
+}
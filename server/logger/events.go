@@ -0,0 +1,294 @@
+package logger
+
+import (
+	"database/sql"
+	"strconv"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+)
+
+// EventKind is the type of the editor activity
+type EventKind string
+
+const (
+	// EventOpen is recorded when a file is opened in the editor
+	EventOpen EventKind = "open"
+	// EventEdit is recorded when a file is changed in the editor
+	EventEdit EventKind = "edit"
+	// EventClose is recorded when a file is closed in the editor
+	EventClose EventKind = "close"
+	// EventSnapshot is recorded when the content of the file is stored
+	// after the participant has stopped editing it
+	EventSnapshot EventKind = "snapshot"
+)
+
+const (
+	EventsSetting           = "collection.events"
+	SnapshotIntervalSetting = "collection.snapshot_interval"
+)
+
+// EventsConfig determines whether the editor activity is recorded.
+// Recording the events is opt-in and is disabled by default.
+type EventsConfig struct {
+	Enabled bool `json:"enabled"`
+	// SnapshotInterval is the duration of inactivity before the content
+	// of an edited file is stored. Zero disables the snapshots.
+	SnapshotInterval time.Duration `json:"snapshot_interval"`
+}
+
+// Snapshots checks if the content of the edited files should be stored
+func (c EventsConfig) Snapshots() bool {
+	return c.Enabled && c.SnapshotInterval > 0
+}
+
+// Event is an activity of the participant in the editor
+type Event struct {
+	Id            int       `db:"id"`
+	ParticipantId string    `db:"participant_id"`
+	SessionId     *int      `db:"session_id"`
+	Kind          EventKind `db:"kind"`
+	FilePath      string    `db:"file_path"`
+	// Size is the number of characters of the file after the event
+	Size          int `db:"size"`
+	CharsInserted int `db:"chars_inserted"`
+	CharsDeleted  int `db:"chars_deleted"`
+	// FileVersion is the version of the stored content of snapshot events
+	FileVersion *int      `db:"file_version"`
+	CreatedAt   *NullTime `db:"created_at"`
+	SourceId    *int      `db:"source_id"`
+}
+
+// EditSize returns the number of characters inserted and deleted
+// to change the old content into the new one. The changed region
+// is the part between the common prefix and suffix of both contents.
+func EditSize(oldContent, newContent string) (inserted int, deleted int) {
+	oldRunes, newRunes := []rune(oldContent), []rune(newContent)
+
+	prefix := 0
+	for prefix < len(oldRunes) && prefix < len(newRunes) && oldRunes[prefix] == newRunes[prefix] {
+		prefix++
+	}
+
+	suffix := 0
+	for suffix < len(oldRunes)-prefix && suffix < len(newRunes)-prefix &&
+		oldRunes[len(oldRunes)-1-suffix] == newRunes[len(newRunes)-1-suffix] {
+		suffix++
+	}
+
+	return len(newRunes) - prefix - suffix, len(oldRunes) - prefix - suffix
+}
+
+// EventsConfig returns whether the editor activity is recorded
+func (log *Logger) EventsConfig() EventsConfig {
+	var config EventsConfig
+
+	rawEnabled, err := log.GetSetting(EventsSetting)
+	if err != nil {
+		return config
+	}
+
+	enabled, err := strconv.ParseBool(rawEnabled)
+	if err != nil {
+		return config
+	}
+	config.Enabled = enabled
+
+	if rawInterval, err := log.GetSetting(SnapshotIntervalSetting); err == nil {
+		if interval, err := time.ParseDuration(rawInterval); err == nil && interval > 0 {
+			config.SnapshotInterval = interval
+		}
+	}
+
+	return config
+}
+
+// SetEventsConfig turns the recording of the editor activity on or off
+func (log *Logger) SetEventsConfig(config EventsConfig) error {
+	return log.storage.SetSettings(map[string]string{
+		EventsSetting:           strconv.FormatBool(config.Enabled),
+		SnapshotIntervalSetting: config.SnapshotInterval.String(),
+	})
+}
+
+// recordsEvents checks if the participant has opted in to the
+// recording of the editor activity
+func (log *Logger) recordsEvents() bool {
+	return log.CollectionLevel() != CollectionOff && log.EventsConfig().Enabled
+}
+
+// LogEvent records the editor activity. Nothing is recorded if the
+// participant has not opted in to it. Use LogSnapshot for snapshots.
+func (log *Logger) LogEvent(event Event) error {
+	if !log.recordsEvents() {
+		return nil
+	}
+
+	if len(event.ParticipantId) == 0 {
+		event.ParticipantId = log.ParticipantId()
+	}
+
+	if event.CreatedAt == nil || !event.CreatedAt.Valid || event.CreatedAt.Time.IsZero() {
+		event.CreatedAt = &NullTime{Time: time.Now(), Valid: true}
+	}
+
+	return log.storage.InsertEvent(event)
+}
+
+func insertEvent(q squirrel.BaseRunner, event Event) error {
+	_, err := squirrel.Insert("events").
+		Columns(
+			"participant_id", "session_id", "kind", "file_path", "size",
+			"chars_inserted", "chars_deleted", "file_version", "created_at", "source_id",
+		).
+		Values(
+			event.ParticipantId, event.SessionId, event.Kind, event.FilePath, event.Size,
+			event.CharsInserted, event.CharsDeleted, event.FileVersion, event.CreatedAt, event.SourceId,
+		).
+		RunWith(q).
+		Exec()
+	return err
+}
+
+// LogSnapshot stores the content of the file as its next version and
+// records it as a snapshot event. Nothing is stored if snapshots are
+// disabled or if the collection level does not store file contents.
+func (log *Logger) LogSnapshot(sessionId *int, filePath string, content []byte) error {
+	return log.LogSnapshotForPID(log.ParticipantId(), sessionId, filePath, content)
+}
+
+// LogSnapshotForPID stores the snapshot of the file of the specified participant
+func (log *Logger) LogSnapshotForPID(pid string, sessionId *int, filePath string, content []byte) error {
+	if !log.CollectionLevel().StoresContent() || !log.EventsConfig().Snapshots() {
+		return nil
+	}
+
+	if log.db == nil {
+		return log.logSnapshot(pid, sessionId, filePath, content)
+	}
+
+	c, err := log.sealer()
+	if err != nil {
+		return err
+	}
+
+	tx, err := log.db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	var maxVersion sql.NullInt64
+	if err := tx.QueryRow(
+		"SELECT MAX(file_version) FROM files WHERE participant_id = ? AND file_path = ?",
+		pid,
+		filePath,
+	).Scan(&maxVersion); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	now := NullTime{Time: time.Now(), Valid: true}
+	fileVersion := int(maxVersion.Int64) + 1
+
+	if err := writeFileVersion(tx, c, fileVersionRow{
+		ParticipantId: pid,
+		FilePath:      filePath,
+		FileVersion:   fileVersion,
+		Content:       content,
+		CreatedAt:     now,
+	}); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := insertEvent(tx, Event{
+		ParticipantId: pid,
+		SessionId:     sessionId,
+		Kind:          EventSnapshot,
+		FilePath:      filePath,
+		Size:          len([]rune(string(content))),
+		FileVersion:   &fileVersion,
+		CreatedAt:     &now,
+	}); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// logSnapshot stores the snapshot through the storage interface. Unlike
+// the SQLite path, the file version and the event are not written in a
+// single transaction.
+func (log *Logger) logSnapshot(pid string, sessionId *int, filePath string, content []byte) error {
+	latest, err := log.storage.LatestFileVersion(pid, filePath)
+	if err != nil {
+		return err
+	}
+
+	now := NullTime{Time: time.Now(), Valid: true}
+	fileVersion := latest + 1
+
+	if err := log.storage.WriteFile(FileVersion{
+		ParticipantId: pid,
+		FilePath:      filePath,
+		FileVersion:   fileVersion,
+		CreatedAt:     &now,
+	}, content); err != nil {
+		return err
+	}
+
+	return log.storage.InsertEvent(Event{
+		ParticipantId: pid,
+		SessionId:     sessionId,
+		Kind:          EventSnapshot,
+		FilePath:      filePath,
+		Size:          len([]rune(string(content))),
+		FileVersion:   &fileVersion,
+		CreatedAt:     &now,
+	})
+}
+
+// EventIterator is a streaming iterator over the recorded events
+type EventIterator struct {
+	cursor EventCursor
+}
+
+func (it *EventIterator) Next() bool {
+	res := it.cursor.Next()
+	if !res {
+		it.cursor.Close()
+	}
+	return res
+}
+
+func (it *EventIterator) Value() (Event, error) {
+	var event Event
+	if err := it.cursor.Scan(&event); err != nil {
+		it.cursor.Close()
+		return Event{}, err
+	}
+	return event, nil
+}
+
+func (it *EventIterator) List() ([]Event, error) {
+	var events []Event
+	for it.Next() {
+		event, err := it.Value()
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// AllEvents returns the events of all participants in the database
+// ordered by participant and creation time
+func (log *Logger) AllEvents() (*EventIterator, error) {
+	cursor, err := log.storage.Events(EventFilter{After: log.After, Before: log.Before})
+	if err != nil {
+		return nil, err
+	}
+	return &EventIterator{cursor: cursor}, nil
+}
@@ -0,0 +1,119 @@
+package logger_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nedpals/bugbuddy/server/logger"
+)
+
+func TestEditSize(t *testing.T) {
+	cases := []struct {
+		name     string
+		old      string
+		new      string
+		inserted int
+		deleted  int
+	}{
+		{"unchanged", "print(a)", "print(a)", 0, 0},
+		{"insert", "print(a)", "print(ab)", 1, 0},
+		{"delete", "a = 1\nprint(a)", "print(a)", 0, 6},
+		{"replace", "print(a)", "print(b)", 1, 1},
+		{"empty", "", "print(a)", 8, 0},
+		{"multibyte", "print('ñ')", "print('ññ')", 1, 0},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			inserted, deleted := logger.EditSize(c.old, c.new)
+			if inserted != c.inserted || deleted != c.deleted {
+				t.Errorf("expected +%d -%d, got +%d -%d", c.inserted, c.deleted, inserted, deleted)
+			}
+		})
+	}
+}
+
+func TestLogger_LogEvent(t *testing.T) {
+	log := logger.NewMemoryLoggerPanic()
+	defer log.Close()
+
+	// events are not recorded unless the participant opted in
+	if err := log.LogEvent(logger.Event{Kind: logger.EventOpen, FilePath: "/hw1/main.py"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := log.SetEventsConfig(logger.EventsConfig{Enabled: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	if config := log.EventsConfig(); !config.Enabled || config.Snapshots() {
+		t.Fatalf("expected events without snapshots, got %+v", config)
+	}
+
+	if err := log.LogEvent(logger.Event{Kind: logger.EventEdit, FilePath: "/hw1/main.py", Size: 9, CharsInserted: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	// snapshots are disabled
+	if err := log.LogSnapshot(nil, "/hw1/main.py", []byte("print(ab)")); err != nil {
+		t.Fatal(err)
+	}
+
+	iter, err := log.AllEvents()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := iter.List()
+	if err != nil {
+		t.Fatal(err)
+	} else if len(events) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(events))
+	}
+
+	if events[0].Kind != logger.EventEdit || events[0].ParticipantId != log.ParticipantId() || events[0].CharsInserted != 1 {
+		t.Errorf("unexpected event %+v", events[0])
+	}
+}
+
+func TestLogger_LogSnapshot(t *testing.T) {
+	log := logger.NewMemoryLoggerPanic()
+	defer log.Close()
+	collectEverything(t, log)
+
+	if err := log.SetEventsConfig(logger.EventsConfig{Enabled: true, SnapshotInterval: 5 * time.Second}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := log.WriteVersionedFile("/hw1/main.py", []byte("print(a)"), 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := log.LogSnapshot(nil, "/hw1/main.py", []byte("a = 1\nprint(a)")); err != nil {
+		t.Fatal(err)
+	}
+
+	iter, err := log.AllEvents()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := iter.List()
+	if err != nil {
+		t.Fatal(err)
+	} else if len(events) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(events))
+	}
+
+	snapshot := events[0]
+	if snapshot.Kind != logger.EventSnapshot || snapshot.FileVersion == nil || *snapshot.FileVersion != 2 {
+		t.Fatalf("expected snapshot of version 2, got %+v", snapshot)
+	}
+
+	content, err := log.OpenVersionedFile("/hw1/main.py", *snapshot.FileVersion)
+	if err != nil {
+		t.Fatal(err)
+	} else if string(content) != "a = 1\nprint(a)" {
+		t.Errorf("unexpected snapshot content %q", content)
+	}
+}
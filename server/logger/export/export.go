@@ -0,0 +1,331 @@
+package export
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nedpals/bugbuddy/server/logger"
+)
+
+// Format is the file format of the exported records
+type Format string
+
+const (
+	JSONL Format = "jsonl"
+	CSV   Format = "csv"
+)
+
+// SupportedFormats lists the formats accepted by NewWriter
+var SupportedFormats = []Format{JSONL, CSV}
+
+// Entry is the exported form of a logger.LogEntry
+type Entry struct {
+	Id              int     `json:"id"`
+	ParticipantId   string  `json:"participant_id"`
+	ExecutedCommand string  `json:"executed_command"`
+	ErrorType       string  `json:"error_type"`
+	ErrorCode       int     `json:"error_code"`
+	ErrorMessage    string  `json:"error_message"`
+	ErrorLine       int     `json:"error_line"`
+	ErrorColumn     int     `json:"error_column"`
+	GeneratedOutput string  `json:"generated_output"`
+	FilePath        string  `json:"file_path"`
+	FileVersion     int     `json:"file_version"`
+	CreatedAt       string  `json:"created_at"`
+	Source          *string `json:"source,omitempty"`
+}
+
+// NewEntry converts the log entry into its exported form
+func NewEntry(entry logger.LogEntry) Entry {
+	return Entry{
+		Id:              entry.Id,
+		ParticipantId:   entry.ParticipantId,
+		ExecutedCommand: entry.ExecutedCommand,
+		ErrorType:       entry.ErrorType,
+		ErrorCode:       entry.ErrorCode,
+		ErrorMessage:    entry.ErrorMessage,
+		ErrorLine:       entry.ErrorLine,
+		ErrorColumn:     entry.ErrorColumn,
+		GeneratedOutput: entry.GeneratedOutput,
+		FilePath:        entry.FilePath,
+		FileVersion:     entry.FileVersion,
+		CreatedAt:       formatTime(entry.CreatedAt),
+	}
+}
+
+// File is the exported form of a logger.FileVersion
+type File struct {
+	ParticipantId string `json:"participant_id"`
+	FilePath      string `json:"file_path"`
+	FileVersion   int    `json:"file_version"`
+	ContentHash   string `json:"content_hash"`
+	CreatedAt     string `json:"created_at"`
+	Content       string `json:"content"`
+}
+
+// Writer writes the exported log entries and file versions
+type Writer interface {
+	WriteEntry(entry Entry) error
+	WriteFile(file File) error
+	// Close flushes the buffered records. It does not close the
+	// underlying writers.
+	Close() error
+}
+
+// NewWriter creates a writer for the specified format. The file versions
+// are discarded if filesOut is nil.
+func NewWriter(format Format, entriesOut io.Writer, filesOut io.Writer, withSource bool) (Writer, error) {
+	switch format {
+	case JSONL:
+		w := &jsonlWriter{entries: json.NewEncoder(entriesOut)}
+		if filesOut != nil {
+			w.files = json.NewEncoder(filesOut)
+		}
+		return w, nil
+	case CSV:
+		w := &csvWriter{entries: csv.NewWriter(entriesOut), withSource: withSource}
+		if filesOut != nil {
+			w.files = csv.NewWriter(filesOut)
+		}
+		return w, nil
+	default:
+		return nil, fmt.Errorf("unsupported export format: %s", format)
+	}
+}
+
+type jsonlWriter struct {
+	entries *json.Encoder
+	files   *json.Encoder
+}
+
+func (w *jsonlWriter) WriteEntry(entry Entry) error {
+	return w.entries.Encode(entry)
+}
+
+func (w *jsonlWriter) WriteFile(file File) error {
+	if w.files == nil {
+		return nil
+	}
+	return w.files.Encode(file)
+}
+
+func (w *jsonlWriter) Close() error {
+	return nil
+}
+
+var entryColumns = []string{
+	"id", "participant_id", "executed_command", "error_type", "error_code",
+	"error_message", "error_line", "error_column", "generated_output",
+	"file_path", "file_version", "created_at",
+}
+
+var fileColumns = []string{
+	"participant_id", "file_path", "file_version", "content_hash", "created_at", "content",
+}
+
+type csvWriter struct {
+	entries          *csv.Writer
+	files            *csv.Writer
+	withSource       bool
+	wroteEntryHeader bool
+	wroteFilesHeader bool
+}
+
+func (w *csvWriter) WriteEntry(entry Entry) error {
+	if !w.wroteEntryHeader {
+		header := entryColumns
+		if w.withSource {
+			header = append(header[:len(header):len(header)], "source")
+		}
+		if err := w.entries.Write(header); err != nil {
+			return err
+		}
+		w.wroteEntryHeader = true
+	}
+
+	record := []string{
+		strconv.Itoa(entry.Id),
+		entry.ParticipantId,
+		entry.ExecutedCommand,
+		entry.ErrorType,
+		strconv.Itoa(entry.ErrorCode),
+		entry.ErrorMessage,
+		strconv.Itoa(entry.ErrorLine),
+		strconv.Itoa(entry.ErrorColumn),
+		entry.GeneratedOutput,
+		entry.FilePath,
+		strconv.Itoa(entry.FileVersion),
+		entry.CreatedAt,
+	}
+
+	if w.withSource {
+		source := ""
+		if entry.Source != nil {
+			source = *entry.Source
+		}
+		record = append(record, source)
+	}
+
+	return w.entries.Write(record)
+}
+
+func (w *csvWriter) WriteFile(file File) error {
+	if w.files == nil {
+		return nil
+	}
+
+	if !w.wroteFilesHeader {
+		if err := w.files.Write(fileColumns); err != nil {
+			return err
+		}
+		w.wroteFilesHeader = true
+	}
+
+	return w.files.Write([]string{
+		file.ParticipantId,
+		file.FilePath,
+		strconv.Itoa(file.FileVersion),
+		file.ContentHash,
+		file.CreatedAt,
+		file.Content,
+	})
+}
+
+func (w *csvWriter) Close() error {
+	w.entries.Flush()
+	if err := w.entries.Error(); err != nil {
+		return err
+	}
+
+	if w.files != nil {
+		w.files.Flush()
+		return w.files.Error()
+	}
+	return nil
+}
+
+// Options filters the records to be exported. The date range is
+// taken from the After and Before fields of the logger.
+type Options struct {
+	// ParticipantId exports only the records of the participant if not empty
+	ParticipantId string
+	// FileGlob exports only the records whose file path matches the pattern.
+	// Patterns without a path separator are matched against the file name.
+	FileGlob string
+	// WithSource includes the snapshot of the file in each log entry
+	WithSource bool
+}
+
+func (o Options) matchFile(filePath string) bool {
+	if len(o.FileGlob) == 0 {
+		return true
+	}
+
+	target := filePath
+	if !strings.Contains(o.FileGlob, "/") {
+		target = path.Base(filePath)
+	}
+
+	matched, _ := path.Match(o.FileGlob, target)
+	return matched
+}
+
+// Stats reports the number of exported records
+type Stats struct {
+	Entries int
+	Files   int
+}
+
+func formatTime(t *logger.NullTime) string {
+	if t == nil || !t.Valid {
+		return ""
+	}
+	return t.Time.Format(time.RFC3339Nano)
+}
+
+// Export streams the log entries and file versions of the logger to the writer
+func Export(lg *logger.Logger, w Writer, opts Options) (Stats, error) {
+	stats := Stats{}
+
+	var iter *logger.LogEntryIterator
+	var err error
+	if len(opts.ParticipantId) != 0 {
+		iter, err = lg.EntriesByParticipantId(opts.ParticipantId)
+	} else {
+		iter, err = lg.AllEntries()
+	}
+	if err != nil {
+		return stats, err
+	}
+
+	for iter.Next() {
+		entry, err := iter.Value()
+		if err != nil {
+			return stats, err
+		}
+
+		if !opts.matchFile(entry.FilePath) {
+			continue
+		}
+
+		record := NewEntry(entry)
+
+		if opts.WithSource && len(entry.FilePath) != 0 {
+			content, err := lg.OpenVersionedFileFromPID(entry.ParticipantId, entry.FilePath, entry.FileVersion)
+			if err == nil {
+				source := string(content)
+				record.Source = &source
+			} else if err != sql.ErrNoRows {
+				return stats, err
+			}
+		}
+
+		if err := w.WriteEntry(record); err != nil {
+			return stats, err
+		}
+		stats.Entries++
+	}
+
+	files, err := lg.FileVersions(opts.ParticipantId)
+	if err != nil {
+		return stats, err
+	}
+	defer files.Close()
+
+	for files.Next() {
+		file, err := files.Value()
+		if err != nil {
+			return stats, err
+		}
+
+		if !opts.matchFile(file.FilePath) {
+			continue
+		}
+
+		content, err := files.Content(file)
+		if err != nil {
+			return stats, err
+		}
+
+		if err := w.WriteFile(File{
+			ParticipantId: file.ParticipantId,
+			FilePath:      file.FilePath,
+			FileVersion:   file.FileVersion,
+			ContentHash:   logger.HashContent(content),
+			CreatedAt:     formatTime(file.CreatedAt),
+			Content:       string(content),
+		}); err != nil {
+			return stats, err
+		}
+		stats.Files++
+	}
+
+	return stats, nil
+}
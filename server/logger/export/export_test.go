@@ -0,0 +1,145 @@
+package export_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"testing"
+
+	"github.com/nedpals/bugbuddy/server/logger"
+	"github.com/nedpals/bugbuddy/server/logger/export"
+)
+
+func setupLogger(t *testing.T) *logger.Logger {
+	log, err := logger.NewMemoryLogger()
+	if err != nil {
+		t.Fatal(err)
+	} else if err := log.SetConsent(logger.CollectionFull, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]string{
+		"/path/to/hello.py":  "print(a)",
+		"/path/to/Main.java": "class Main {}",
+	}
+
+	for filePath, content := range files {
+		if err := log.WriteVersionedFile(filePath, []byte(content), 1); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := log.Log(logger.LogEntry{
+			ExecutedCommand: "run " + filePath,
+			ErrorCode:       1,
+			ErrorType:       "NameError",
+			ErrorMessage:    "name 'a' is not defined",
+			FilePath:        filePath,
+			FileVersion:     1,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// entry from another participant
+	if err := log.Log(logger.LogEntry{
+		ParticipantId: "participant2",
+		ErrorCode:     0,
+		FilePath:      "/path/to/other.py",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	return log
+}
+
+func TestExport_JSONL(t *testing.T) {
+	log := setupLogger(t)
+	defer log.Close()
+
+	var entriesOut, filesOut bytes.Buffer
+	w, err := export.NewWriter(export.JSONL, &entriesOut, &filesOut, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := export.Export(log, w, export.Options{
+		ParticipantId: log.ParticipantId(),
+		FileGlob:      "*.py",
+		WithSource:    true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	} else if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.Entries != 1 || stats.Files != 1 {
+		t.Fatalf("expected 1 entry and 1 file, got %d entries and %d files", stats.Entries, stats.Files)
+	}
+
+	scanner := bufio.NewScanner(&entriesOut)
+	if !scanner.Scan() {
+		t.Fatal("expected an exported entry")
+	}
+
+	var entry export.Entry
+	if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+		t.Fatal(err)
+	}
+
+	if entry.FilePath != "/path/to/hello.py" {
+		t.Errorf("expected file path /path/to/hello.py, got %s", entry.FilePath)
+	}
+
+	if entry.Source == nil || *entry.Source != "print(a)" {
+		t.Errorf("expected the source to be included, got %v", entry.Source)
+	}
+
+	var file export.File
+	if err := json.Unmarshal(filesOut.Bytes(), &file); err != nil {
+		t.Fatal(err)
+	}
+
+	if file.Content != "print(a)" || file.ContentHash != logger.HashContent([]byte("print(a)")) {
+		t.Errorf("unexpected exported file %+v", file)
+	}
+}
+
+func TestExport_CSV(t *testing.T) {
+	log := setupLogger(t)
+	defer log.Close()
+
+	var entriesOut bytes.Buffer
+	w, err := export.NewWriter(export.CSV, &entriesOut, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// export entries from all participants
+	if _, err := export.Export(log, w, export.Options{}); err != nil {
+		t.Fatal(err)
+	} else if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := csv.NewReader(&entriesOut).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// header + 3 entries
+	if len(records) != 4 {
+		t.Fatalf("expected 4 rows, got %d", len(records))
+	}
+
+	if records[0][0] != "id" || records[0][1] != "participant_id" {
+		t.Errorf("unexpected header %v", records[0])
+	}
+}
+
+func TestNewWriter_UnsupportedFormat(t *testing.T) {
+	if _, err := export.NewWriter("xml", &bytes.Buffer{}, nil, false); err == nil {
+		t.Fatal("expected an error for unsupported formats")
+	}
+}
@@ -0,0 +1,59 @@
+package logger
+
+import "database/sql"
+
+// FileVersion is a stored snapshot of a file
+type FileVersion struct {
+	Id            int            `db:"id"`
+	ParticipantId string         `db:"participant_id"`
+	FilePath      string         `db:"file_path"`
+	FileVersion   int            `db:"file_version"`
+	ContentHash   sql.NullString `db:"content_hash"`
+	CreatedAt     *NullTime      `db:"created_at"`
+	content       []byte
+}
+
+// FileVersionIterator streams the file versions stored in the logger
+type FileVersionIterator struct {
+	cursor FileCursor
+}
+
+func (it *FileVersionIterator) Next() bool {
+	res := it.cursor.Next()
+	if !res {
+		it.cursor.Close()
+	}
+	return res
+}
+
+func (it *FileVersionIterator) Value() (FileVersion, error) {
+	var file FileVersion
+	if err := it.cursor.Scan(&file); err != nil {
+		it.cursor.Close()
+		return FileVersion{}, err
+	}
+	return file, nil
+}
+
+// Content resolves the content of the file version returned by Value
+func (it *FileVersionIterator) Content(file FileVersion) ([]byte, error) {
+	return it.cursor.Content(file)
+}
+
+func (it *FileVersionIterator) Close() error {
+	return it.cursor.Close()
+}
+
+// FileVersions returns the file versions of the participant. If the
+// participant id is empty, the files of all participants are returned.
+func (log *Logger) FileVersions(participantId string) (*FileVersionIterator, error) {
+	cursor, err := log.storage.FileVersions(FileFilter{
+		ParticipantId: participantId,
+		After:         log.After,
+		Before:        log.Before,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &FileVersionIterator{cursor: cursor}, nil
+}
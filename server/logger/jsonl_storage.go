@@ -0,0 +1,576 @@
+package logger
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// StorageEnv selects the storage of the default logs. Setting it to
+// "jsonl" stores the logs in the logs directory of the data dir.
+const StorageEnv = "BUGBUDDY_LOGS_STORAGE"
+
+const (
+	jsonlSettingsFile = "settings.jsonl"
+	jsonlLogsFile     = "logs.jsonl"
+	jsonlFilesFile    = "files.jsonl"
+	jsonlSessionsFile = "sessions.jsonl"
+	jsonlEventsFile   = "events.jsonl"
+)
+
+// record operations of the JSONL storage
+const (
+	jsonlOpSet   = "set"
+	jsonlOpUnset = "unset"
+	// participants are registered in the settings file
+	jsonlOpParticipant = "participant"
+	jsonlOpInsert      = "insert"
+	jsonlOpWrite       = "write"
+	jsonlOpRename      = "rename"
+	jsonlOpDelete      = "delete"
+	jsonlOpReset       = "reset"
+	jsonlOpStart       = "start"
+	jsonlOpEnd         = "end"
+	jsonlOpOpen        = "open"
+)
+
+// jsonlRecord is a line of the JSONL storage. Each line records a change
+// and the current state is rebuilt by replaying them in order.
+type jsonlRecord struct {
+	Op            string        `json:"op"`
+	Name          string        `json:"name,omitempty"`
+	Value         string        `json:"value,omitempty"`
+	Entry         *jsonlEntry   `json:"entry,omitempty"`
+	Session       *jsonlSession `json:"session,omitempty"`
+	Event         *jsonlEvent   `json:"event,omitempty"`
+	ParticipantId string        `json:"participant_id,omitempty"`
+	SessionId     int           `json:"session_id,omitempty"`
+	FilePath      string        `json:"file_path,omitempty"`
+	NewPath       string        `json:"new_path,omitempty"`
+	FileVersion   int           `json:"file_version,omitempty"`
+	Content       []byte        `json:"content,omitempty"`
+	Reason        string        `json:"reason,omitempty"`
+	// CreatedAt is also the end time of the ended sessions and the
+	// opening time of the session files
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	After     *time.Time `json:"after,omitempty"`
+}
+
+// jsonlEntry is the log entry stored in the JSONL storage
+type jsonlEntry struct {
+	Id              int       `json:"id"`
+	ParticipantId   string    `json:"participant_id"`
+	ExecutedCommand string    `json:"executed_command"`
+	ErrorType       string    `json:"error_type"`
+	ErrorCode       int       `json:"error_code"`
+	ErrorMessage    string    `json:"error_message"`
+	ErrorLine       int       `json:"error_line"`
+	ErrorColumn     int       `json:"error_column"`
+	GeneratedOutput string    `json:"generated_output"`
+	FilePath        string    `json:"file_path"`
+	FileVersion     int       `json:"file_version"`
+	CreatedAt       time.Time `json:"created_at"`
+	SourceId        *int      `json:"source_id,omitempty"`
+	SessionId       *int      `json:"session_id,omitempty"`
+}
+
+func toJSONLEntry(entry LogEntry) *jsonlEntry {
+	return &jsonlEntry{
+		Id:              entry.Id,
+		ParticipantId:   entry.ParticipantId,
+		ExecutedCommand: entry.ExecutedCommand,
+		ErrorType:       entry.ErrorType,
+		ErrorCode:       entry.ErrorCode,
+		ErrorMessage:    entry.ErrorMessage,
+		ErrorLine:       entry.ErrorLine,
+		ErrorColumn:     entry.ErrorColumn,
+		GeneratedOutput: entry.GeneratedOutput,
+		FilePath:        entry.FilePath,
+		FileVersion:     entry.FileVersion,
+		CreatedAt:       entry.CreatedAt.Time,
+		SourceId:        entry.SourceId,
+		SessionId:       entry.SessionId,
+	}
+}
+
+func (e *jsonlEntry) LogEntry() LogEntry {
+	return LogEntry{
+		Id:              e.Id,
+		ParticipantId:   e.ParticipantId,
+		ExecutedCommand: e.ExecutedCommand,
+		ErrorType:       e.ErrorType,
+		ErrorCode:       e.ErrorCode,
+		ErrorMessage:    e.ErrorMessage,
+		ErrorLine:       e.ErrorLine,
+		ErrorColumn:     e.ErrorColumn,
+		GeneratedOutput: e.GeneratedOutput,
+		FilePath:        e.FilePath,
+		FileVersion:     e.FileVersion,
+		CreatedAt:       &NullTime{Time: e.CreatedAt, Valid: true},
+		SourceId:        e.SourceId,
+		SessionId:       e.SessionId,
+	}
+}
+
+// jsonlSession is the session stored in the JSONL storage. The end of the
+// session is recorded separately.
+type jsonlSession struct {
+	Id            int       `json:"id"`
+	ParticipantId string    `json:"participant_id"`
+	Editor        string    `json:"editor"`
+	StartedAt     time.Time `json:"started_at"`
+	SourceId      *int      `json:"source_id,omitempty"`
+}
+
+// jsonlEvent is the event stored in the JSONL storage
+type jsonlEvent struct {
+	Id            int       `json:"id"`
+	ParticipantId string    `json:"participant_id"`
+	SessionId     *int      `json:"session_id,omitempty"`
+	Kind          EventKind `json:"kind"`
+	FilePath      string    `json:"file_path"`
+	Size          int       `json:"size"`
+	CharsInserted int       `json:"chars_inserted"`
+	CharsDeleted  int       `json:"chars_deleted"`
+	FileVersion   *int      `json:"file_version,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+	SourceId      *int      `json:"source_id,omitempty"`
+}
+
+func toJSONLEvent(event Event) *jsonlEvent {
+	return &jsonlEvent{
+		Id:            event.Id,
+		ParticipantId: event.ParticipantId,
+		SessionId:     event.SessionId,
+		Kind:          event.Kind,
+		FilePath:      event.FilePath,
+		Size:          event.Size,
+		CharsInserted: event.CharsInserted,
+		CharsDeleted:  event.CharsDeleted,
+		FileVersion:   event.FileVersion,
+		CreatedAt:     event.CreatedAt.Time,
+		SourceId:      event.SourceId,
+	}
+}
+
+func (e *jsonlEvent) Event() Event {
+	return Event{
+		Id:            e.Id,
+		ParticipantId: e.ParticipantId,
+		SessionId:     e.SessionId,
+		Kind:          e.Kind,
+		FilePath:      e.FilePath,
+		Size:          e.Size,
+		CharsInserted: e.CharsInserted,
+		CharsDeleted:  e.CharsDeleted,
+		FileVersion:   e.FileVersion,
+		CreatedAt:     &NullTime{Time: e.CreatedAt, Valid: true},
+		SourceId:      e.SourceId,
+	}
+}
+
+// jsonlStorage stores the logs as append-only JSONL files in a directory.
+// The files are replayed into memory when the storage is opened.
+type jsonlStorage struct {
+	*memoryStorage
+	dir string
+	// handles are the files of the storage opened for appending
+	handles map[string]*os.File
+}
+
+// jsonlFiles are the files of the JSONL storage. Storages created before
+// the sessions and events were stored only have the first three.
+var jsonlFiles = []string{jsonlSettingsFile, jsonlLogsFile, jsonlFilesFile, jsonlSessionsFile, jsonlEventsFile}
+
+// IsJSONLStorage checks if the path is a directory of a JSONL storage
+func IsJSONLStorage(path string) bool {
+	info, err := os.Stat(filepath.Join(path, jsonlSettingsFile))
+	return err == nil && !info.IsDir()
+}
+
+// NewJSONLStorage opens the JSONL storage in the directory. The
+// directory is created if it does not exist.
+func NewJSONLStorage(dir string) (Storage, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	storage := &jsonlStorage{
+		memoryStorage: newMemoryStorage(),
+		dir:           dir,
+		handles:       map[string]*os.File{},
+	}
+
+	for _, name := range jsonlFiles {
+		file, err := storage.openFile(name)
+		if err != nil {
+			storage.Close()
+			return nil, err
+		}
+		storage.handles[name] = file
+	}
+
+	// the logs created before the consent keep storing everything, like
+	// the SQLite databases migrated by 0007_collection_level
+	_, hasParticipant := storage.settings["participant_id"]
+	if _, hasLevel := storage.settings[CollectionLevelSetting]; hasParticipant && !hasLevel {
+		if err := storage.SetSettings(map[string]string{CollectionLevelSetting: string(CollectionFull)}); err != nil {
+			storage.Close()
+			return nil, err
+		}
+	}
+
+	return storage, nil
+}
+
+// openFile replays the records of the file and opens it for appending
+func (s *jsonlStorage) openFile(name string) (*os.File, error) {
+	path := filepath.Join(s.dir, name)
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	reader := bufio.NewReader(file)
+	offset := int64(0)
+	for line := 1; ; line++ {
+		raw, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			file.Close()
+			return nil, err
+		}
+
+		if len(raw) != 0 {
+			var record jsonlRecord
+			if jsonErr := json.Unmarshal(raw, &record); jsonErr != nil {
+				if err == io.EOF {
+					// drop the last record if it was not fully written
+					if err := file.Truncate(offset); err != nil {
+						file.Close()
+						return nil, err
+					}
+					break
+				}
+				file.Close()
+				return nil, fmt.Errorf("%s:%d: %w", name, line, jsonErr)
+			}
+
+			if applyErr := s.apply(name, record); applyErr != nil {
+				file.Close()
+				return nil, fmt.Errorf("%s:%d: %w", name, line, applyErr)
+			}
+			offset += int64(len(raw))
+		}
+
+		if err == io.EOF {
+			break
+		}
+	}
+
+	return file, nil
+}
+
+// apply updates the data in memory with the record of the file
+func (s *jsonlStorage) apply(name string, record jsonlRecord) error {
+	switch record.Op {
+	case jsonlOpSet:
+		s.settings[record.Name] = record.Value
+	case jsonlOpUnset:
+		delete(s.settings, record.Name)
+	case jsonlOpParticipant:
+		participant := Participant{Id: record.ParticipantId, Name: record.Name}
+		if record.CreatedAt != nil {
+			participant.CreatedAt = &NullTime{Time: *record.CreatedAt, Valid: true}
+		}
+		s.addParticipant(participant)
+	case jsonlOpInsert:
+		if name == jsonlEventsFile {
+			if record.Event == nil {
+				return errors.New("insert record without an event")
+			}
+			s.insertEvent(record.Event.Event())
+		} else if record.Entry == nil {
+			return errors.New("insert record without an entry")
+		} else {
+			s.insertEntry(record.Entry.LogEntry())
+		}
+	case jsonlOpWrite:
+		file := FileVersion{
+			ParticipantId: record.ParticipantId,
+			FilePath:      record.FilePath,
+			FileVersion:   record.FileVersion,
+		}
+		if record.CreatedAt != nil {
+			file.CreatedAt = &NullTime{Time: *record.CreatedAt, Valid: true}
+		}
+		s.writeFile(file, record.Content)
+	case jsonlOpRename:
+		s.renameFile(record.ParticipantId, record.FilePath, record.NewPath)
+	case jsonlOpDelete:
+		s.deleteFile(record.ParticipantId, record.FilePath)
+	case jsonlOpStart:
+		if record.Session == nil {
+			return errors.New("start record without a session")
+		}
+		s.startSession(Session{
+			Id:            record.Session.Id,
+			ParticipantId: record.Session.ParticipantId,
+			Editor:        record.Session.Editor,
+			StartedAt:     &NullTime{Time: record.Session.StartedAt, Valid: true},
+			SourceId:      record.Session.SourceId,
+		})
+	case jsonlOpEnd:
+		if record.CreatedAt == nil {
+			return errors.New("end record without an end time")
+		}
+		s.endSession(record.SessionId, *record.CreatedAt, record.Reason)
+	case jsonlOpOpen:
+		if record.CreatedAt == nil {
+			return errors.New("open record without an opening time")
+		}
+		s.addSessionFile(record.SessionId, record.FilePath, *record.CreatedAt)
+	case jsonlOpReset:
+		after := time.Time{}
+		if record.After != nil {
+			after = *record.After
+		}
+
+		// the reset is recorded in each of the data files
+		switch name {
+		case jsonlLogsFile:
+			s.resetEntries(record.ParticipantId, after)
+		case jsonlFilesFile:
+			s.resetFiles(record.ParticipantId, after)
+		case jsonlSessionsFile:
+			s.resetSessions(record.ParticipantId, after)
+		case jsonlEventsFile:
+			s.resetEvents(record.ParticipantId, after)
+		}
+	default:
+		return fmt.Errorf("unknown operation: %s", record.Op)
+	}
+	return nil
+}
+
+// write appends the record into the file and applies it. The caller
+// must hold the lock of the storage.
+func (s *jsonlStorage) write(name string, record jsonlRecord) error {
+	raw, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.handles[name].Write(append(raw, '\n')); err != nil {
+		return err
+	}
+	return s.apply(name, record)
+}
+
+func (s *jsonlStorage) SetSettings(settings map[string]string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for name, value := range settings {
+		if err := s.write(jsonlSettingsFile, jsonlRecord{Op: jsonlOpSet, Name: name, Value: value}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *jsonlStorage) DeleteSetting(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.settings[name]; !ok {
+		return nil
+	}
+	return s.write(jsonlSettingsFile, jsonlRecord{Op: jsonlOpUnset, Name: name})
+}
+
+func (s *jsonlStorage) AddParticipant(participant Participant) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.hasParticipant(participant.Id) {
+		return nil
+	}
+
+	createdAt := time.Now()
+	if participant.CreatedAt != nil && participant.CreatedAt.Valid {
+		createdAt = participant.CreatedAt.Time
+	}
+
+	return s.write(jsonlSettingsFile, jsonlRecord{
+		Op:            jsonlOpParticipant,
+		ParticipantId: participant.Id,
+		Name:          participant.Name,
+		CreatedAt:     &createdAt,
+	})
+}
+
+func (s *jsonlStorage) InsertEntry(entry LogEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry.Id = s.lastId + 1
+	if entry.CreatedAt == nil || !entry.CreatedAt.Valid {
+		entry.CreatedAt = &NullTime{Time: time.Now(), Valid: true}
+	}
+
+	return s.write(jsonlLogsFile, jsonlRecord{Op: jsonlOpInsert, Entry: toJSONLEntry(entry)})
+}
+
+func (s *jsonlStorage) WriteFile(file FileVersion, content []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	createdAt := time.Now()
+	if file.CreatedAt != nil && file.CreatedAt.Valid {
+		createdAt = file.CreatedAt.Time
+	}
+
+	return s.write(jsonlFilesFile, jsonlRecord{
+		Op:            jsonlOpWrite,
+		ParticipantId: file.ParticipantId,
+		FilePath:      file.FilePath,
+		FileVersion:   file.FileVersion,
+		Content:       content,
+		CreatedAt:     &createdAt,
+	})
+}
+
+func (s *jsonlStorage) RenameFile(participantId string, oldPath string, newPath string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.write(jsonlFilesFile, jsonlRecord{
+		Op:            jsonlOpRename,
+		ParticipantId: participantId,
+		FilePath:      oldPath,
+		NewPath:       newPath,
+	})
+}
+
+func (s *jsonlStorage) DeleteFile(participantId string, filePath string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.write(jsonlFilesFile, jsonlRecord{
+		Op:            jsonlOpDelete,
+		ParticipantId: participantId,
+		FilePath:      filePath,
+	})
+}
+
+func (s *jsonlStorage) StartSession(session Session) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	startedAt := time.Now()
+	if session.StartedAt != nil && session.StartedAt.Valid {
+		startedAt = session.StartedAt.Time
+	}
+
+	id := s.lastSession + 1
+	if err := s.write(jsonlSessionsFile, jsonlRecord{
+		Op: jsonlOpStart,
+		Session: &jsonlSession{
+			Id:            id,
+			ParticipantId: session.ParticipantId,
+			Editor:        session.Editor,
+			StartedAt:     startedAt,
+			SourceId:      session.SourceId,
+		},
+	}); err != nil {
+		return 0, err
+	}
+
+	// sessions which were imported already ended
+	if session.EndedAt != nil && session.EndedAt.Valid {
+		if err := s.endSessionLocked(id, session.EndedAt.Time, session.EndReason); err != nil {
+			return 0, err
+		}
+	}
+	return id, nil
+}
+
+func (s *jsonlStorage) EndSession(id int, endedAt time.Time, reason string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.endSessionLocked(id, endedAt, reason)
+}
+
+func (s *jsonlStorage) endSessionLocked(id int, endedAt time.Time, reason string) error {
+	if idx := s.findSession(id); idx == -1 || !s.sessions[idx].IsOpen() {
+		return nil
+	}
+
+	return s.write(jsonlSessionsFile, jsonlRecord{
+		Op:        jsonlOpEnd,
+		SessionId: id,
+		Reason:    reason,
+		CreatedAt: &endedAt,
+	})
+}
+
+func (s *jsonlStorage) AddSessionFile(id int, filePath string, openedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, file := range s.sessionFiles {
+		if file.sessionId == id && file.filePath == filePath {
+			return nil
+		}
+	}
+
+	return s.write(jsonlSessionsFile, jsonlRecord{
+		Op:        jsonlOpOpen,
+		SessionId: id,
+		FilePath:  filePath,
+		CreatedAt: &openedAt,
+	})
+}
+
+func (s *jsonlStorage) InsertEvent(event Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	event.Id = s.lastEvent + 1
+	if event.CreatedAt == nil || !event.CreatedAt.Valid {
+		event.CreatedAt = &NullTime{Time: time.Now(), Valid: true}
+	}
+
+	return s.write(jsonlEventsFile, jsonlRecord{Op: jsonlOpInsert, Event: toJSONLEvent(event)})
+}
+
+func (s *jsonlStorage) Reset(participantId string, after time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record := jsonlRecord{Op: jsonlOpReset, ParticipantId: participantId}
+	if !after.IsZero() {
+		record.After = &after
+	}
+
+	for _, name := range jsonlFiles[1:] {
+		if err := s.write(name, record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *jsonlStorage) Close() error {
+	var errs []error
+	for _, file := range s.handles {
+		errs = append(errs, file.Close())
+	}
+	return errors.Join(errs...)
+}
@@ -5,16 +5,16 @@ import (
 	"database/sql/driver"
 	"fmt"
 	"math/rand"
+	"os"
 	"path/filepath"
 	"strconv"
+	"sync/atomic"
 	"time"
 
 	"github.com/Masterminds/squirrel"
 	"github.com/jmoiron/sqlx"
 	"github.com/lucasepe/codename"
 
-	_ "embed"
-
 	"github.com/nedpals/bugbuddy/server/helpers"
 	_ "modernc.org/sqlite"
 )
@@ -26,6 +26,11 @@ type NullTime struct {
 
 // Scan implements the Scanner interface.
 func (nt *NullTime) Scan(value interface{}) error {
+	if value == nil {
+		nt.Time, nt.Valid = time.Time{}, false
+		return nil
+	}
+
 	t, err := time.Parse(time.RFC3339Nano, value.(string))
 	if err != nil {
 		return nil
@@ -44,17 +49,27 @@ func (nt NullTime) Value() (driver.Value, error) {
 	return nt.Time.Format(time.RFC3339Nano), nil
 }
 
-//go:embed init.sql
-var initScript string
-
 type Logger struct {
 	participantId string
 	After         time.Time
-	db            *sqlx.DB
-}
+	Before        time.Time
+	storage       Storage
+	// db is the SQLite database of the storage. It is nil for the other
+	// storage backends, which do not support sessions, events and merging.
+	db *sqlx.DB
+	// path is the path of the database file. It is empty for memory loggers.
+	path string
+	// cipher encrypts the logs. It is nil if the database is not encrypted or locked.
+	cipher *fieldCipher
+}
+
+// memoryLoggerCount is used for naming in-memory databases. Each memory logger
+// uses its own shared-cache database so that all connections in the pool
+// see the same data instead of separate empty databases.
+var memoryLoggerCount atomic.Int64
 
 func NewMemoryLogger() (*Logger, error) {
-	return setupLogger(":memory:")
+	return setupLogger(fmt.Sprintf("file:bugbuddy-memory-%d?mode=memory&cache=shared", memoryLoggerCount.Add(1)))
 }
 
 func NewMemoryLoggerPanic() *Logger {
@@ -65,14 +80,37 @@ func NewMemoryLoggerPanic() *Logger {
 	return logger
 }
 
-func NewLogger() (*Logger, error) {
+// DefaultLogsPath returns the path of the logs database inside the data dir.
+// The logs directory is returned instead if StorageEnv is set to jsonl.
+func DefaultLogsPath() (string, error) {
 	// get or initialize directory
 	dirPath, err := helpers.GetOrInitializeDataDir()
+	if err != nil {
+		return "", err
+	}
+
+	if os.Getenv(StorageEnv) == "jsonl" {
+		logsDir := filepath.Join(dirPath, "logs")
+		if !IsJSONLStorage(logsDir) {
+			// initialize the storage so that the directory is recognized
+			storage, err := NewJSONLStorage(logsDir)
+			if err != nil {
+				return "", err
+			}
+			storage.Close()
+		}
+		return logsDir, nil
+	}
+
+	return filepath.Join(dirPath, "logs.db"), nil
+}
+
+func NewLogger() (*Logger, error) {
+	logsDbPath, err := DefaultLogsPath()
 	if err != nil {
 		return nil, err
 	}
 
-	logsDbPath := filepath.Join(dirPath, "logs.db")
 	return NewLoggerFromPath(logsDbPath)
 }
 
@@ -94,7 +132,31 @@ func NewLoggerFromPath(path string) (*Logger, error) {
 		path = rPath
 	}
 
-	return setupLogger(path)
+	// directories are opened as JSONL storages
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		storage, err := NewJSONLStorage(path)
+		if err != nil {
+			return nil, err
+		}
+
+		logger, err := NewLoggerWithStorage(storage)
+		if err != nil {
+			storage.Close()
+			return nil, err
+		}
+
+		logger.path = path
+		return logger, nil
+	}
+
+	logger, err := setupLogger(path)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.path = path
+	logger.autoUnlock()
+	return logger, nil
 }
 
 func NewLoggerFromPathPanic(path string) *Logger {
@@ -106,36 +168,29 @@ func NewLoggerFromPathPanic(path string) *Logger {
 }
 
 func setupLogger(logsDbPath string) (*Logger, error) {
-	// open database
-	db, err := sqlx.Open("sqlite", logsDbPath)
+	storage, err := openSQLiteStorage(logsDbPath)
 	if err != nil {
 		return nil, err
 	}
 
-	// initialize database
-	db.Exec(initScript)
-	logger := &Logger{db: db}
-
-	if err := logger.Setup(); err != nil {
+	logger, err := NewLoggerWithStorage(storage)
+	if err != nil {
+		storage.Close()
 		return nil, err
 	}
 	return logger, nil
 }
 
 func (log *Logger) GetSetting(key string) (string, error) {
-	var val string
-	err := log.db.QueryRow("SELECT value FROM settings WHERE name = ?", key).Scan(&val)
-	return val, err
+	return log.storage.GetSetting(key)
 }
 
 func (log *Logger) AddSetting(key, value string) error {
-	_, err := log.db.Exec("INSERT OR REPLACE INTO settings (name, value) VALUES (?, ?)", key, value)
-	return err
+	return log.storage.SetSettings(map[string]string{key: value})
 }
 
 func (log *Logger) DeleteSetting(key string) error {
-	_, err := log.db.Exec("DELETE FROM settings WHERE name = ?", key)
-	return err
+	return log.storage.DeleteSetting(key)
 }
 
 func (log *Logger) ParticipantId() string {
@@ -179,14 +234,8 @@ func (log *Logger) GenerateParticipantId() error {
 		return log.GenerateParticipantId()
 	}
 
-	// add participant id
-	err := log.AddSetting("participant_id", participantId)
-	if err != nil {
-		return err
-	}
-
-	log.participantId = ""
-	return nil
+	// register and switch to the participant id
+	return log.SwitchParticipant(participantId)
 }
 
 func (log *Logger) Setup() error {
@@ -195,6 +244,13 @@ func (log *Logger) Setup() error {
 	if len(pId) == 0 {
 		return log.GenerateParticipantId()
 	}
+
+	// register the participant of the logs created before participants were tracked
+	if exists, err := log.HasParticipant(pId); err != nil {
+		return err
+	} else if !exists {
+		return log.AddParticipant(pId, "")
+	}
 	return nil
 }
 
@@ -221,9 +277,19 @@ type LogEntry struct {
 	FilePath        string    `db:"file_path"`
 	FileVersion     int       `db:"file_version"`
 	CreatedAt       *NullTime `db:"created_at,omitempty"`
+	SourceId        *int      `db:"source_id"`
+	SessionId       *int      `db:"session_id"`
 }
 
 func (log *Logger) Log(entry LogEntry) error {
+	level := log.CollectionLevel()
+	if !level.StoresEntry(entry.ErrorCode) {
+		return nil
+	} else if !level.StoresContent() {
+		entry.ErrorMessage = ""
+		entry.GeneratedOutput = ""
+	}
+
 	if len(entry.ParticipantId) == 0 {
 		entry.ParticipantId = log.ParticipantId()
 	}
@@ -232,16 +298,25 @@ func (log *Logger) Log(entry LogEntry) error {
 		entry.CreatedAt = &NullTime{Time: time.Now(), Valid: true}
 	}
 
-	_, err := log.db.NamedExec(`INSERT INTO logs (
+	c, err := log.sealer()
+	if err != nil {
+		return err
+	}
+
+	return log.storage.InsertEntry(c.sealEntry(entry))
+}
+
+func insertLogEntry(q sqlx.Ext, entry LogEntry) error {
+	_, err := sqlx.NamedExec(q, `INSERT INTO logs (
 	participant_id, executed_command, 
 	error_code, error_line, error_column, error_type,
 	error_message, generated_output, file_path, 
-	file_version, created_at
+	file_version, created_at, source_id, session_id
 ) VALUES (
 	:participant_id, :executed_command, 
 	:error_code, :error_line, :error_column, :error_type,
 	:error_message, :generated_output, :file_path, 
-	:file_version, :created_at
+	:file_version, :created_at, :source_id, :session_id
 )`, &entry)
 	return err
 }
@@ -250,26 +325,37 @@ func (log *Logger) Log(entry LogEntry) error {
 // This will allow us to iterate through the log entries without loading all of them into memory
 // This is useful for large logs
 type LogEntryIterator struct {
-	rows *sqlx.Rows
+	cursor EntryCursor
+	cipher *fieldCipher
 }
 
 func (it *LogEntryIterator) Next() bool {
-	res := it.rows.Next()
+	res := it.cursor.Next()
 	if !res {
-		it.rows.Close()
+		it.cursor.Close()
 	}
 	return res
 }
 
 func (it *LogEntryIterator) Value() (LogEntry, error) {
 	var entry LogEntry
-	if err := it.rows.StructScan(&entry); err != nil {
-		it.rows.Close()
+	if err := it.cursor.Scan(&entry); err != nil {
+		it.cursor.Close()
+		return LogEntry{}, err
+	}
+
+	if err := it.cipher.openEntry(&entry); err != nil {
 		return LogEntry{}, err
 	}
 	return entry, nil
 }
 
+// Close releases the cursor of the iterator. It is only needed when the
+// iteration is stopped before Next returns false.
+func (it *LogEntryIterator) Close() error {
+	return it.cursor.Close()
+}
+
 func (it *LogEntryIterator) List() ([]LogEntry, error) {
 	var entries []LogEntry
 	for it.Next() {
@@ -286,74 +372,68 @@ func (log *Logger) Entries() (*LogEntryIterator, error) {
 	return log.EntriesByParticipantId(log.ParticipantId())
 }
 
-// EntriesDescending returns log entries in descending order (latest first)
-func (log *Logger) EntriesDescending() (*LogEntryIterator, error) {
-	query := squirrel.Select("*").From("logs").OrderBy("created_at DESC")
-	if !log.After.IsZero() {
-		query = query.Where(squirrel.GtOrEq{"created_at": log.After})
-	}
+// withDateRange limits the query to the rows created between After and Before
+func (log *Logger) withDateRange(query squirrel.SelectBuilder) squirrel.SelectBuilder {
+	return whereCreatedBetween(query, log.After, log.Before)
+}
 
-	sql, args, err := query.ToSql()
-	if err != nil {
-		return nil, err
-	}
+// AllEntries returns the log entries of all participants in the database
+// ordered by participant and creation time
+func (log *Logger) AllEntries() (*LogEntryIterator, error) {
+	return log.entries(EntryFilter{
+		After:         log.After,
+		Before:        log.Before,
+		ByParticipant: true,
+	})
+}
 
-	rows, err := log.db.Queryx(sql, args...)
+func (log *Logger) entries(filter EntryFilter) (*LogEntryIterator, error) {
+	cursor, err := log.storage.Entries(filter)
 	if err != nil {
-		defer rows.Close()
 		return nil, err
 	}
-	return &LogEntryIterator{rows: rows}, nil
+	return &LogEntryIterator{cursor: cursor, cipher: log.cipher}, nil
 }
 
-func (log *Logger) EntriesByParticipantId(participantId string) (*LogEntryIterator, error) {
-	query := squirrel.Select("*").From("logs").Where(squirrel.Eq{"participant_id": participantId})
-	if !log.After.IsZero() {
-		query = query.Where(squirrel.GtOrEq{"created_at": log.After})
-	}
+// EntriesDescending returns log entries of the participant in descending order (latest first)
+func (log *Logger) EntriesDescending() (*LogEntryIterator, error) {
+	return log.EntriesDescendingForPID(log.ParticipantId())
+}
 
-	sql, args, err := query.ToSql()
-	if err != nil {
-		return nil, err
-	}
+// EntriesDescendingForPID returns log entries of the specified participant
+// in descending order (latest first)
+func (log *Logger) EntriesDescendingForPID(participantId string) (*LogEntryIterator, error) {
+	return log.Query().Participant(participantId).Descending().Entries()
+}
 
-	rows, err := log.db.Queryx(sql, args...)
-	if err != nil {
-		defer rows.Close()
-		return nil, err
-	}
-	return &LogEntryIterator{rows: rows}, nil
+func (log *Logger) EntriesByParticipantId(participantId string) (*LogEntryIterator, error) {
+	return log.Query().Participant(participantId).Entries()
 }
 
 func (log *Logger) Reset() error {
-	// delete logs
-	logQuery := squirrel.Delete("logs").Where(squirrel.Eq{"participant_id": log.ParticipantId()})
-	if !log.After.IsZero() {
-		logQuery = logQuery.Where(squirrel.GtOrEq{"created_at": log.After})
-	}
-
-	if _, err := logQuery.RunWith(log.db).Exec(); err != nil {
-		return err
-	}
-
-	// delete files
-	filesQuery := squirrel.Delete("files").Where(squirrel.Eq{"participant_id": log.ParticipantId()})
-	if !log.After.IsZero() {
-		filesQuery = filesQuery.Where(squirrel.GtOrEq{"created_at": log.After})
-	}
+	return log.ResetForPID(log.ParticipantId())
+}
 
-	if _, err := filesQuery.RunWith(log.db).Exec(); err != nil {
-		return err
+// ResetForPID moves the data of the specified participant into an archive
+// so that it can be restored later. Use PurgeForPID to remove it permanently.
+func (log *Logger) ResetForPID(participantId string) error {
+	if len(log.path) == 0 {
+		// loggers which are not stored in a file do not keep anything once closed
+		return log.PurgeForPID(participantId)
 	}
 
-	return nil
+	_, err := log.ArchiveForPID(participantId)
+	return err
 }
 
 // logger as FS
 func (log *Logger) OpenFile(filepath string) ([]byte, error) {
-	var content []byte
-	err := log.db.QueryRow("SELECT content FROM files WHERE participant_id = ? AND file_path = ?", log.ParticipantId(), filepath).Scan(&content)
-	return content, err
+	return log.OpenFileForPID(log.ParticipantId(), filepath)
+}
+
+// OpenFileForPID returns the earliest version of the file of the specified participant
+func (log *Logger) OpenFileForPID(pid string, filepath string) ([]byte, error) {
+	return log.storage.ReadFile(pid, filepath, 0)
 }
 
 func (log *Logger) OpenVersionedFile(filepath string, file_version int) ([]byte, error) {
@@ -361,91 +441,98 @@ func (log *Logger) OpenVersionedFile(filepath string, file_version int) ([]byte,
 }
 
 func (log *Logger) OpenVersionedFileFromPID(pid string, filepath string, file_version int) ([]byte, error) {
-	var content []byte
-	// get the recent file by file_version
-	err := log.db.QueryRow(
-		"SELECT content FROM files WHERE participant_id = ? AND file_path = ? AND file_version = ?",
-		pid,
-		filepath,
-		file_version).Scan(&content)
-
-	return content, err
+	return log.storage.ReadFile(pid, filepath, file_version)
 }
 
 func (log *Logger) WriteFile(filepath string, content []byte) error {
-	_, err := log.db.Exec(
-		"INSERT OR REPLACE INTO files (participant_id, file_path, content, created_at) VALUES (?, ?, ?, ?)",
-		log.ParticipantId(),
-		filepath,
-		content,
-		time.Now(),
-	)
-	return err
+	return log.WriteFileForPID(log.ParticipantId(), filepath, content)
+}
+
+// WriteFileForPID stores the file of the specified participant as its first version
+func (log *Logger) WriteFileForPID(pid string, filepath string, content []byte) error {
+	return log.WriteVersionedFileForPID(pid, filepath, content, 1)
 }
 
 func (log *Logger) LatestVersionFromFile(filepath string) (int, error) {
-	// get latest file version
-	var maxVersion *int
-
-	err := log.db.QueryRow(
-		"SELECT MAX(file_version) FROM files WHERE participant_id = ? AND file_path = ?",
-		log.ParticipantId(),
-		filepath,
-	).Scan(&maxVersion)
+	return log.LatestVersionFromFileForPID(log.ParticipantId(), filepath)
+}
+
+// LatestVersionFromFileForPID returns the latest version of the file of the specified participant
+func (log *Logger) LatestVersionFromFileForPID(pid string, filepath string) (int, error) {
+	maxVersion, err := log.storage.LatestFileVersion(pid, filepath)
 	if err != nil {
 		return -1, fmt.Errorf("we cannot get the latest file version: %w", err)
 	}
-
-	if maxVersion == nil {
-		return 0, nil
-	}
-
-	return *maxVersion, nil
+	return maxVersion, nil
 }
 
 func (log *Logger) WriteVersionedFile(filepath string, content []byte, file_version int) error {
-	if file_version < 0 {
-		maxVersion, err := log.LatestVersionFromFile(filepath)
+	return log.WriteVersionedFileForPID(log.ParticipantId(), filepath, content, file_version)
+}
+
+// WriteVersionedFileForPID stores the version of the file of the specified participant.
+// Negative versions store the content as the next version of the file.
+func (log *Logger) WriteVersionedFileForPID(pid string, filepath string, content []byte, file_version int) error {
+	if file_version < 0 && log.CollectionLevel().StoresContent() {
+		maxVersion, err := log.LatestVersionFromFileForPID(pid, filepath)
 		if err != nil {
 			return err
 		}
 		file_version = maxVersion + 1
 	}
 
-	_, err := log.db.Exec(
-		"INSERT INTO files (participant_id, file_path, file_version, content, created_at) VALUES (?, ?, ?, ?, ?)",
-		log.ParticipantId(),
-		filepath,
-		file_version,
-		content,
-		time.Now(),
-	)
-	return err
+	return log.writeFile(FileVersion{
+		ParticipantId: pid,
+		FilePath:      filepath,
+		FileVersion:   file_version,
+		CreatedAt:     &NullTime{Time: time.Now(), Valid: true},
+	}, content)
+}
+
+// WriteFileVersion stores the content as the version of the file described
+// by the file version, keeping its creation time. It is used for recording
+// files which were written at an earlier time, such as imported datasets.
+func (log *Logger) WriteFileVersion(file FileVersion, content []byte) error {
+	if file.FileVersion <= 0 {
+		return fmt.Errorf("invalid version %d of %s", file.FileVersion, file.FilePath)
+	} else if file.CreatedAt == nil || !file.CreatedAt.Valid {
+		file.CreatedAt = &NullTime{Time: time.Now(), Valid: true}
+	}
+	return log.writeFile(file, content)
+}
+
+func (log *Logger) writeFile(file FileVersion, content []byte) error {
+	if !log.CollectionLevel().StoresContent() {
+		return nil
+	} else if _, err := log.sealer(); err != nil {
+		return err
+	}
+
+	return log.storage.WriteFile(file, content)
 }
 
 func (log *Logger) RenameFile(oldFilepath, newFilepath string) error {
-	_, err := log.db.Exec(
-		"UPDATE files SET file_path = ? WHERE participant_id = ? AND file_path = ?",
-		newFilepath,
-		log.ParticipantId(),
-		oldFilepath,
-	)
-	return err
+	return log.RenameFileForPID(log.ParticipantId(), oldFilepath, newFilepath)
+}
+
+// RenameFileForPID renames all versions of the file of the specified participant
+func (log *Logger) RenameFileForPID(pid string, oldFilepath, newFilepath string) error {
+	return log.storage.RenameFile(pid, oldFilepath, newFilepath)
 }
 
 func (log *Logger) DeleteFile(filepath string) error {
-	_, err := log.db.Exec(
-		"DELETE FROM files WHERE participant_id = ? AND file_path = ?",
-		log.ParticipantId(),
-		filepath,
-	)
-	return err
+	return log.DeleteFileForPID(log.ParticipantId(), filepath)
+}
+
+// DeleteFileForPID removes all versions of the file of the specified participant
+func (log *Logger) DeleteFileForPID(pid string, filepath string) error {
+	return log.storage.DeleteFile(pid, filepath)
 }
 
 func (log *Logger) Close() error {
 	// add a check to avoid nil pointer dereference
-	if log == nil || log.db == nil {
+	if log == nil || log.storage == nil {
 		return nil
 	}
-	return log.db.Close()
+	return log.storage.Close()
 }
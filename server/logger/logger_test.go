@@ -238,6 +238,7 @@ func TestLogger_OpenFile(t *testing.T) {
 		t.Fatal(err)
 	}
 	defer log.Close()
+	collectEverything(t, log)
 
 	// Generate a random file path
 	filePath := "/path/to/file.go"
@@ -274,6 +275,7 @@ func TestLogger_OpenVersionedFile(t *testing.T) {
 		t.Fatal(err)
 	}
 	defer log.Close()
+	collectEverything(t, log)
 
 	// Generate a random file path
 	filePath := "/path/to/file.go"
@@ -310,6 +312,7 @@ func TestLogger_WriteFile(t *testing.T) {
 		t.Fatal(err)
 	}
 	defer log.Close()
+	collectEverything(t, log)
 
 	// Generate a random file path
 	filePath := "/path/to/file.go"
@@ -346,6 +349,7 @@ func TestLogger_WriteVersionedFile(t *testing.T) {
 		t.Fatal(err)
 	}
 	defer log.Close()
+	collectEverything(t, log)
 
 	// Generate a random file path
 	filePath := "/path/to/file.go"
@@ -399,6 +403,7 @@ func TestLogger_RenameFile(t *testing.T) {
 		t.Fatal(err)
 	}
 	defer log.Close()
+	collectEverything(t, log)
 
 	// Generate a random file path
 	filePath := "/path/to/file.go"
@@ -0,0 +1,667 @@
+package logger
+
+import (
+	"database/sql"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// memoryStorage keeps the logs in memory. It is mostly useful for tests
+// and as the base of the storages that load all of their data at once.
+type memoryStorage struct {
+	mu       sync.RWMutex
+	settings map[string]string
+	// participants are ordered by their registration
+	participants []Participant
+	entries      []LogEntry
+	// files store their content in the unexported content field
+	files    []FileVersion
+	sessions []Session
+	// sessionFiles are the files opened during the sessions
+	sessionFiles []sessionFile
+	events       []Event
+	lastId       int
+	lastFile     int
+	lastSession  int
+	lastEvent    int
+}
+
+type sessionFile struct {
+	sessionId int
+	filePath  string
+	openedAt  time.Time
+}
+
+// NewMemoryStorage creates a storage which keeps the logs in memory
+func NewMemoryStorage() Storage {
+	return newMemoryStorage()
+}
+
+func newMemoryStorage() *memoryStorage {
+	return &memoryStorage{settings: map[string]string{}}
+}
+
+func copyIntPtr(v *int) *int {
+	if v == nil {
+		return nil
+	}
+	copied := *v
+	return &copied
+}
+
+func intOrZero(v *int) int {
+	if v == nil {
+		return 0
+	}
+	return *v
+}
+
+func copyNullTime(v *NullTime) *NullTime {
+	if v == nil {
+		return nil
+	}
+	copied := *v
+	return &copied
+}
+
+// copyEntry copies the entry so that the stored entries cannot be
+// modified through the pointers of the returned ones
+func copyEntry(entry LogEntry) LogEntry {
+	entry.CreatedAt = copyNullTime(entry.CreatedAt)
+	entry.SourceId = copyIntPtr(entry.SourceId)
+	entry.SessionId = copyIntPtr(entry.SessionId)
+	return entry
+}
+
+func (s *memoryStorage) GetSetting(name string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	value, ok := s.settings[name]
+	if !ok {
+		return "", sql.ErrNoRows
+	}
+	return value, nil
+}
+
+func (s *memoryStorage) SetSettings(settings map[string]string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for name, value := range settings {
+		s.settings[name] = value
+	}
+	return nil
+}
+
+func (s *memoryStorage) DeleteSetting(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.settings, name)
+	return nil
+}
+
+func (s *memoryStorage) AddParticipant(participant Participant) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.addParticipant(participant)
+	return nil
+}
+
+func (s *memoryStorage) hasParticipant(id string) bool {
+	for _, participant := range s.participants {
+		if participant.Id == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *memoryStorage) addParticipant(participant Participant) {
+	if s.hasParticipant(participant.Id) {
+		return
+	}
+
+	participant.CreatedAt = copyNullTime(participant.CreatedAt)
+	s.participants = append(s.participants, participant)
+}
+
+func (s *memoryStorage) Participants() ([]Participant, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	participants := make([]Participant, len(s.participants))
+	for i, participant := range s.participants {
+		participant.CreatedAt = copyNullTime(participant.CreatedAt)
+		participants[i] = participant
+	}
+	return participants, nil
+}
+
+func (s *memoryStorage) InsertEntry(entry LogEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.insertEntry(entry)
+	return nil
+}
+
+func (s *memoryStorage) insertEntry(entry LogEntry) LogEntry {
+	if entry.Id <= s.lastId {
+		entry.Id = s.lastId + 1
+	}
+	s.lastId = entry.Id
+
+	if entry.CreatedAt == nil {
+		entry.CreatedAt = &NullTime{Time: time.Now(), Valid: true}
+	}
+
+	entry = copyEntry(entry)
+	s.entries = append(s.entries, entry)
+	return entry
+}
+
+// entryLess compares the entries in the order of the filter
+func entryLess(filter EntryFilter, a, b LogEntry) bool {
+	if (filter.ByParticipant || filter.BySession) && a.ParticipantId != b.ParticipantId {
+		return a.ParticipantId < b.ParticipantId
+	} else if filter.BySession {
+		if aSession, bSession := intOrZero(a.SessionId), intOrZero(b.SessionId); aSession != bSession {
+			return aSession < bSession
+		}
+	}
+
+	var aTime, bTime time.Time
+	if a.CreatedAt != nil {
+		aTime = a.CreatedAt.Time
+	}
+	if b.CreatedAt != nil {
+		bTime = b.CreatedAt.Time
+	}
+
+	if !aTime.Equal(bTime) {
+		return aTime.Before(bTime)
+	}
+	return a.Id < b.Id
+}
+
+func (s *memoryStorage) Entries(filter EntryFilter) (EntryCursor, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var cursorEntry *LogEntry
+	for i := range s.entries {
+		if filter.Cursor > 0 && s.entries[i].Id == filter.Cursor {
+			cursorEntry = &s.entries[i]
+			break
+		}
+	}
+
+	entries := []LogEntry{}
+	for _, entry := range s.entries {
+		if len(filter.ParticipantId) != 0 && entry.ParticipantId != filter.ParticipantId {
+			continue
+		} else if !strings.HasPrefix(entry.FilePath, filter.FilePathPrefix) {
+			continue
+		} else if len(filter.ErrorType) != 0 && entry.ErrorType != filter.ErrorType {
+			continue
+		} else if filter.ExitCode != nil && entry.ErrorCode != *filter.ExitCode {
+			continue
+		} else if !matchesCreatedAt(entry.CreatedAt, filter.After, filter.Before) {
+			continue
+		}
+
+		if filter.Cursor > 0 {
+			// entries after an unknown cursor are not returned
+			if cursorEntry == nil {
+				continue
+			} else if filter.Descending && !entryLess(filter, entry, *cursorEntry) {
+				continue
+			} else if !filter.Descending && !entryLess(filter, *cursorEntry, entry) {
+				continue
+			}
+		}
+
+		entries = append(entries, copyEntry(entry))
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		if filter.Descending {
+			return entryLess(filter, entries[j], entries[i])
+		}
+		return entryLess(filter, entries[i], entries[j])
+	})
+
+	if filter.Limit > 0 && len(entries) > filter.Limit {
+		entries = entries[:filter.Limit]
+	}
+
+	return &sliceEntryCursor{entries: entries}, nil
+}
+
+// findFile returns the index of the file version or -1 if it does not exist
+func (s *memoryStorage) findFile(participantId string, filePath string, version int) int {
+	idx := -1
+	for i, file := range s.files {
+		if file.ParticipantId != participantId || file.FilePath != filePath {
+			continue
+		} else if version > 0 && file.FileVersion == version {
+			return i
+		} else if version <= 0 && (idx == -1 || file.FileVersion < s.files[idx].FileVersion) {
+			idx = i
+		}
+	}
+
+	if version > 0 {
+		return -1
+	}
+	return idx
+}
+
+func (s *memoryStorage) WriteFile(file FileVersion, content []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.writeFile(file, content)
+	return nil
+}
+
+func (s *memoryStorage) writeFile(file FileVersion, content []byte) {
+	if file.CreatedAt == nil || !file.CreatedAt.Valid {
+		file.CreatedAt = &NullTime{Time: time.Now(), Valid: true}
+	}
+
+	s.lastFile++
+	file.Id = s.lastFile
+	file.CreatedAt = copyNullTime(file.CreatedAt)
+	file.ContentHash = sql.NullString{String: HashContent(content), Valid: true}
+
+	file.content = append([]byte{}, content...)
+	if idx := s.findFile(file.ParticipantId, file.FilePath, file.FileVersion); idx != -1 {
+		s.files[idx] = file
+	} else {
+		s.files = append(s.files, file)
+	}
+}
+
+func (s *memoryStorage) ReadFile(participantId string, filePath string, version int) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	idx := s.findFile(participantId, filePath, version)
+	if idx == -1 {
+		return nil, sql.ErrNoRows
+	}
+	return append([]byte{}, s.files[idx].content...), nil
+}
+
+func (s *memoryStorage) LatestFileVersion(participantId string, filePath string) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	latest := 0
+	for _, file := range s.files {
+		if file.ParticipantId == participantId && file.FilePath == filePath && file.FileVersion > latest {
+			latest = file.FileVersion
+		}
+	}
+	return latest, nil
+}
+
+func (s *memoryStorage) RenameFile(participantId string, oldPath string, newPath string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.renameFile(participantId, oldPath, newPath)
+	return nil
+}
+
+func (s *memoryStorage) renameFile(participantId string, oldPath string, newPath string) {
+	for i, file := range s.files {
+		if file.ParticipantId == participantId && file.FilePath == oldPath {
+			s.files[i].FilePath = newPath
+		}
+	}
+}
+
+func (s *memoryStorage) DeleteFile(participantId string, filePath string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.deleteFile(participantId, filePath)
+	return nil
+}
+
+func (s *memoryStorage) deleteFile(participantId string, filePath string) {
+	files := s.files[:0]
+	for _, file := range s.files {
+		if file.ParticipantId != participantId || file.FilePath != filePath {
+			files = append(files, file)
+		}
+	}
+	s.files = files
+}
+
+func (s *memoryStorage) FileVersions(filter FileFilter) (FileCursor, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	files := []FileVersion{}
+	for _, file := range s.files {
+		if len(filter.ParticipantId) != 0 && file.ParticipantId != filter.ParticipantId {
+			continue
+		} else if !matchesCreatedAt(file.CreatedAt, filter.After, filter.Before) {
+			continue
+		}
+
+		file.CreatedAt = copyNullTime(file.CreatedAt)
+		files = append(files, file)
+	}
+
+	sort.SliceStable(files, func(i, j int) bool {
+		a, b := files[i], files[j]
+		if a.ParticipantId != b.ParticipantId {
+			return a.ParticipantId < b.ParticipantId
+		} else if a.FilePath != b.FilePath {
+			return a.FilePath < b.FilePath
+		}
+		return a.FileVersion < b.FileVersion
+	})
+
+	return &memoryFileCursor{files: files}, nil
+}
+
+// memoryFileCursor is a FileCursor over the file versions already in memory
+type memoryFileCursor struct {
+	files []FileVersion
+	idx   int
+}
+
+func (c *memoryFileCursor) Next() bool {
+	c.idx++
+	return c.idx <= len(c.files)
+}
+
+func (c *memoryFileCursor) Scan(file *FileVersion) error {
+	*file = c.files[c.idx-1]
+	return nil
+}
+
+func (c *memoryFileCursor) Content(file FileVersion) ([]byte, error) {
+	return append([]byte{}, file.content...), nil
+}
+
+func (c *memoryFileCursor) Close() error {
+	return nil
+}
+
+func (s *memoryStorage) StartSession(session Session) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.startSession(session), nil
+}
+
+func (s *memoryStorage) startSession(session Session) int {
+	if session.Id <= s.lastSession {
+		session.Id = s.lastSession + 1
+	}
+	s.lastSession = session.Id
+
+	if session.StartedAt == nil || !session.StartedAt.Valid {
+		session.StartedAt = &NullTime{Time: time.Now(), Valid: true}
+	}
+
+	session.StartedAt = copyNullTime(session.StartedAt)
+	session.EndedAt = copyNullTime(session.EndedAt)
+	session.SourceId = copyIntPtr(session.SourceId)
+	session.Files = nil
+	s.sessions = append(s.sessions, session)
+	return session.Id
+}
+
+// findSession returns the index of the session or -1 if it does not exist
+func (s *memoryStorage) findSession(id int) int {
+	for i, session := range s.sessions {
+		if session.Id == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *memoryStorage) EndSession(id int, endedAt time.Time, reason string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.endSession(id, endedAt, reason)
+	return nil
+}
+
+func (s *memoryStorage) endSession(id int, endedAt time.Time, reason string) {
+	if idx := s.findSession(id); idx != -1 && s.sessions[idx].IsOpen() {
+		s.sessions[idx].EndedAt = &NullTime{Time: endedAt, Valid: true}
+		s.sessions[idx].EndReason = reason
+	}
+}
+
+func (s *memoryStorage) AddSessionFile(id int, filePath string, openedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.addSessionFile(id, filePath, openedAt)
+	return nil
+}
+
+func (s *memoryStorage) addSessionFile(id int, filePath string, openedAt time.Time) {
+	for _, file := range s.sessionFiles {
+		if file.sessionId == id && file.filePath == filePath {
+			return
+		}
+	}
+	s.sessionFiles = append(s.sessionFiles, sessionFile{sessionId: id, filePath: filePath, openedAt: openedAt})
+}
+
+func (s *memoryStorage) Session(id int) (Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	idx := s.findSession(id)
+	if idx == -1 {
+		return Session{}, sql.ErrNoRows
+	}
+	return s.session(idx), nil
+}
+
+func (s *memoryStorage) Sessions(participantId string) ([]Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sessions := []Session{}
+	for i, session := range s.sessions {
+		if session.ParticipantId == participantId {
+			sessions = append(sessions, s.session(i))
+		}
+	}
+
+	sort.SliceStable(sessions, func(i, j int) bool { return sessions[i].Id < sessions[j].Id })
+	return sessions, nil
+}
+
+// session returns a copy of the session at the index with its opened files
+func (s *memoryStorage) session(idx int) Session {
+	session := s.sessions[idx]
+	session.StartedAt = copyNullTime(session.StartedAt)
+	session.EndedAt = copyNullTime(session.EndedAt)
+	session.SourceId = copyIntPtr(session.SourceId)
+
+	files := []sessionFile{}
+	for _, file := range s.sessionFiles {
+		if file.sessionId == session.Id {
+			files = append(files, file)
+		}
+	}
+
+	sort.SliceStable(files, func(i, j int) bool {
+		if !files[i].openedAt.Equal(files[j].openedAt) {
+			return files[i].openedAt.Before(files[j].openedAt)
+		}
+		return files[i].filePath < files[j].filePath
+	})
+
+	session.Files = make([]string, len(files))
+	for i, file := range files {
+		session.Files[i] = file.filePath
+	}
+	return session
+}
+
+// copyEvent copies the event so that the stored events cannot be
+// modified through the pointers of the returned ones
+func copyEvent(event Event) Event {
+	event.SessionId = copyIntPtr(event.SessionId)
+	event.FileVersion = copyIntPtr(event.FileVersion)
+	event.CreatedAt = copyNullTime(event.CreatedAt)
+	event.SourceId = copyIntPtr(event.SourceId)
+	return event
+}
+
+func (s *memoryStorage) InsertEvent(event Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.insertEvent(event)
+	return nil
+}
+
+func (s *memoryStorage) insertEvent(event Event) {
+	if event.Id <= s.lastEvent {
+		event.Id = s.lastEvent + 1
+	}
+	s.lastEvent = event.Id
+
+	if event.CreatedAt == nil || !event.CreatedAt.Valid {
+		event.CreatedAt = &NullTime{Time: time.Now(), Valid: true}
+	}
+	s.events = append(s.events, copyEvent(event))
+}
+
+func (s *memoryStorage) Events(filter EventFilter) (EventCursor, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	events := []Event{}
+	for _, event := range s.events {
+		if matchesCreatedAt(event.CreatedAt, filter.After, filter.Before) {
+			events = append(events, copyEvent(event))
+		}
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		a, b := events[i], events[j]
+		if a.ParticipantId != b.ParticipantId {
+			return a.ParticipantId < b.ParticipantId
+		} else if !a.CreatedAt.Time.Equal(b.CreatedAt.Time) {
+			return a.CreatedAt.Time.Before(b.CreatedAt.Time)
+		}
+		return a.Id < b.Id
+	})
+
+	return &memoryEventCursor{events: events}, nil
+}
+
+// memoryEventCursor is an EventCursor over the events already in memory
+type memoryEventCursor struct {
+	events []Event
+	idx    int
+}
+
+func (c *memoryEventCursor) Next() bool {
+	c.idx++
+	return c.idx <= len(c.events)
+}
+
+func (c *memoryEventCursor) Scan(event *Event) error {
+	*event = c.events[c.idx-1]
+	return nil
+}
+
+func (c *memoryEventCursor) Close() error {
+	return nil
+}
+
+func (s *memoryStorage) Reset(participantId string, after time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.reset(participantId, after)
+	return nil
+}
+
+func (s *memoryStorage) reset(participantId string, after time.Time) {
+	s.resetEntries(participantId, after)
+	s.resetFiles(participantId, after)
+	s.resetSessions(participantId, after)
+	s.resetEvents(participantId, after)
+}
+
+// resetRemoves checks if the row is removed by the reset of the participant
+func resetRemoves(participantId string, after time.Time, rowParticipantId string, createdAt *NullTime) bool {
+	return rowParticipantId == participantId && (after.IsZero() || matchesCreatedAt(createdAt, after, time.Time{}))
+}
+
+func (s *memoryStorage) resetEntries(participantId string, after time.Time) {
+	entries := s.entries[:0]
+	for _, entry := range s.entries {
+		if !resetRemoves(participantId, after, entry.ParticipantId, entry.CreatedAt) {
+			entries = append(entries, entry)
+		}
+	}
+	s.entries = entries
+}
+
+func (s *memoryStorage) resetFiles(participantId string, after time.Time) {
+	files := s.files[:0]
+	for _, file := range s.files {
+		if !resetRemoves(participantId, after, file.ParticipantId, file.CreatedAt) {
+			files = append(files, file)
+		}
+	}
+	s.files = files
+}
+
+func (s *memoryStorage) resetSessions(participantId string, after time.Time) {
+	sessions := s.sessions[:0]
+	for _, session := range s.sessions {
+		if !resetRemoves(participantId, after, session.ParticipantId, session.StartedAt) {
+			sessions = append(sessions, session)
+		}
+	}
+	s.sessions = sessions
+
+	files := s.sessionFiles[:0]
+	for _, file := range s.sessionFiles {
+		if s.findSession(file.sessionId) != -1 {
+			files = append(files, file)
+		}
+	}
+	s.sessionFiles = files
+}
+
+func (s *memoryStorage) resetEvents(participantId string, after time.Time) {
+	events := s.events[:0]
+	for _, event := range s.events {
+		if !resetRemoves(participantId, after, event.ParticipantId, event.CreatedAt) {
+			events = append(events, event)
+		}
+	}
+	s.events = events
+}
+
+func (s *memoryStorage) Close() error {
+	return nil
+}
@@ -0,0 +1,515 @@
+package logger
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// MergeOptions controls how the rows of another database are merged
+type MergeOptions struct {
+	// NormalizePaths rewrites the file paths of each participant relative
+	// to their project root (the common directory of all of their files)
+	NormalizePaths bool
+}
+
+// MergeStats reports the rows added by Merge
+type MergeStats struct {
+	Entries    int
+	Duplicates int
+	Files      int
+	Events     int
+}
+
+// toSlash converts both Windows and Unix paths into forward slashes
+func toSlash(filePath string) string {
+	return strings.ReplaceAll(filePath, "\\", "/")
+}
+
+// commonDir returns the deepest directory shared by all of the paths
+func commonDir(paths []string) string {
+	var common []string
+	for i, filePath := range paths {
+		parts := strings.Split(path.Dir(toSlash(filePath)), "/")
+		if i == 0 {
+			common = parts
+			continue
+		}
+
+		n := 0
+		for n < len(common) && n < len(parts) && common[n] == parts[n] {
+			n++
+		}
+		common = common[:n]
+	}
+	return strings.Join(common, "/")
+}
+
+// relativeToRoot returns the file path relative to the project root. Paths
+// outside of the root are returned as is.
+func relativeToRoot(root string, filePath string) string {
+	if len(root) == 0 || root == "/" || root == "." || len(filePath) == 0 {
+		return filePath
+	}
+
+	slashed := toSlash(filePath)
+	if !strings.HasPrefix(slashed, root+"/") {
+		return filePath
+	}
+	return strings.TrimPrefix(slashed, root+"/")
+}
+
+// ProjectRoots returns the project root of each participant in the logger
+func (log *Logger) ProjectRoots() (map[string]string, error) {
+	if log.db == nil {
+		return nil, ErrUnsupportedStorage
+	}
+
+	rows, err := log.db.Queryx(`SELECT participant_id, file_path FROM logs WHERE file_path != ''
+UNION SELECT participant_id, file_path FROM files WHERE file_path != ''`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pathsByParticipant := map[string][]string{}
+	for rows.Next() {
+		var participantId, filePath string
+		if err := rows.Scan(&participantId, &filePath); err != nil {
+			return nil, err
+		}
+		pathsByParticipant[participantId] = append(pathsByParticipant[participantId], filePath)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	roots := make(map[string]string, len(pathsByParticipant))
+	for participantId, paths := range pathsByParticipant {
+		roots[participantId] = commonDir(paths)
+	}
+	return roots, nil
+}
+
+// Merge copies the log entries and file versions of src into the logger.
+// Entries already present in the logger are skipped, and file versions
+// that conflict with existing ones are stored as new versions. The path of
+// src is recorded in the sources table as the provenance of the new rows.
+func (log *Logger) Merge(src *Logger, sourcePath string, opts MergeOptions) (MergeStats, error) {
+	stats := MergeStats{}
+	if log.db == nil || src.db == nil {
+		return stats, ErrUnsupportedStorage
+	}
+
+	roots := map[string]string{}
+	if opts.NormalizePaths {
+		var err error
+		if roots, err = src.ProjectRoots(); err != nil {
+			return stats, err
+		}
+	}
+
+	normalizePath := func(participantId, filePath string) string {
+		return relativeToRoot(roots[participantId], filePath)
+	}
+
+	rawRoots, err := json.Marshal(roots)
+	if err != nil {
+		return stats, err
+	}
+
+	c, err := log.sealer()
+	if err != nil {
+		return stats, err
+	}
+
+	tx, err := log.db.Beginx()
+	if err != nil {
+		return stats, err
+	}
+
+	res, err := tx.Exec(
+		"INSERT INTO sources (path, project_roots, merged_at) VALUES (?, ?, ?)",
+		sourcePath,
+		string(rawRoots),
+		NullTime{Time: time.Now(), Valid: true},
+	)
+	if err != nil {
+		tx.Rollback()
+		return stats, err
+	}
+
+	rawSourceId, err := res.LastInsertId()
+	if err != nil {
+		tx.Rollback()
+		return stats, err
+	}
+	sourceId := int(rawSourceId)
+
+	if err := mergeParticipants(tx, src); err != nil {
+		tx.Rollback()
+		return stats, err
+	}
+
+	// versionMap maps the file versions of src to the merged versions
+	versionMap, err := mergeFiles(tx, c, src, sourceId, normalizePath, &stats)
+	if err != nil {
+		tx.Rollback()
+		return stats, err
+	}
+
+	// sessionMap maps the session ids of src to the merged session ids
+	sessionMap, err := mergeSessions(tx, src, sourceId, normalizePath)
+	if err != nil {
+		tx.Rollback()
+		return stats, err
+	}
+
+	if err := mergeEntries(tx, c, src, sourceId, normalizePath, versionMap, sessionMap, &stats); err != nil {
+		tx.Rollback()
+		return stats, err
+	}
+
+	if err := mergeEvents(tx, src, sourceId, normalizePath, versionMap, sessionMap, &stats); err != nil {
+		tx.Rollback()
+		return stats, err
+	}
+
+	// register the participants of the merged rows which src did not register
+	if _, err := tx.Exec(registerParticipantsQuery); err != nil {
+		tx.Rollback()
+		return stats, err
+	}
+
+	return stats, tx.Commit()
+}
+
+// registerParticipantsQuery registers the participants of the stored rows
+// at the time of their earliest activity
+const registerParticipantsQuery = `INSERT OR IGNORE INTO participants (id, created_at)
+	SELECT participant_id, MIN(created_at) FROM (
+		SELECT participant_id, created_at FROM logs
+		UNION ALL SELECT participant_id, created_at FROM files
+		UNION ALL SELECT participant_id, started_at FROM sessions
+		UNION ALL SELECT participant_id, created_at FROM events
+	) GROUP BY participant_id`
+
+// mergeParticipants registers the participants of src. Participants
+// which are already registered keep their name and registration time.
+func mergeParticipants(tx *sqlx.Tx, src *Logger) error {
+	participants, err := src.Participants()
+	if err != nil {
+		return err
+	}
+
+	for _, participant := range participants {
+		if _, err := tx.Exec(
+			"INSERT OR IGNORE INTO participants (id, name, created_at) VALUES (?, ?, ?)",
+			participant.Id,
+			participant.Name,
+			participant.CreatedAt,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func fileVersionKey(participantId, filePath string, version int) string {
+	return fmt.Sprintf("%s\x00%s\x00%d", participantId, filePath, version)
+}
+
+// mergedFileVersion returns the version to be used for a merged file version.
+// The original version is kept unless it is already taken by a different
+// content, in which case the version with the same content is reused or the
+// content is appended as the latest version. exists reports if the content
+// is already stored under the returned version.
+func mergedFileVersion(tx *sqlx.Tx, participantId, filePath string, version int, hash string) (int, bool, error) {
+	var existingHash sql.NullString
+	err := tx.QueryRow(
+		"SELECT content_hash FROM files WHERE participant_id = ? AND file_path = ? AND file_version = ?",
+		participantId,
+		filePath,
+		version,
+	).Scan(&existingHash)
+	if err == sql.ErrNoRows {
+		return version, false, nil
+	} else if err != nil {
+		return 0, false, err
+	} else if existingHash.String == hash {
+		return version, true, nil
+	}
+
+	var sameVersion int
+	err = tx.QueryRow(
+		"SELECT file_version FROM files WHERE participant_id = ? AND file_path = ? AND content_hash = ? ORDER BY file_version LIMIT 1",
+		participantId,
+		filePath,
+		hash,
+	).Scan(&sameVersion)
+	if err == nil {
+		return sameVersion, true, nil
+	} else if err != sql.ErrNoRows {
+		return 0, false, err
+	}
+
+	var latestVersion int
+	if err := tx.QueryRow(
+		"SELECT MAX(file_version) FROM files WHERE participant_id = ? AND file_path = ?",
+		participantId,
+		filePath,
+	).Scan(&latestVersion); err != nil {
+		return 0, false, err
+	}
+	return latestVersion + 1, false, nil
+}
+
+func mergeFiles(tx *sqlx.Tx, c *fieldCipher, src *Logger, sourceId int, normalizePath func(string, string) string, stats *MergeStats) (map[string]int, error) {
+	versionMap := map[string]int{}
+
+	files, err := src.FileVersions("")
+	if err != nil {
+		return nil, err
+	}
+	defer files.Close()
+
+	for files.Next() {
+		file, err := files.Value()
+		if err != nil {
+			return nil, err
+		}
+
+		content, err := files.Content(file)
+		if err != nil {
+			return nil, err
+		}
+
+		filePath := normalizePath(file.ParticipantId, file.FilePath)
+		key := fileVersionKey(file.ParticipantId, file.FilePath, file.FileVersion)
+
+		version, exists, err := mergedFileVersion(tx, file.ParticipantId, filePath, file.FileVersion, c.hashContent(content))
+		if err != nil {
+			return nil, err
+		}
+
+		versionMap[key] = version
+		if exists {
+			continue
+		}
+
+		createdAt := NullTime{Time: time.Now(), Valid: true}
+		if file.CreatedAt != nil && file.CreatedAt.Valid {
+			createdAt = *file.CreatedAt
+		}
+
+		if err := writeFileVersion(tx, c, fileVersionRow{
+			ParticipantId: file.ParticipantId,
+			FilePath:      filePath,
+			FileVersion:   version,
+			Content:       content,
+			CreatedAt:     createdAt,
+			SourceId:      &sourceId,
+		}); err != nil {
+			return nil, err
+		}
+		stats.Files++
+	}
+
+	return versionMap, nil
+}
+
+func mergeSessions(tx *sqlx.Tx, src *Logger, sourceId int, normalizePath func(string, string) string) (map[int]int, error) {
+	sessionMap := map[int]int{}
+
+	var sessions []Session
+	if err := src.db.Select(
+		&sessions,
+		"SELECT id, participant_id, editor, started_at, ended_at, end_reason, source_id FROM sessions ORDER BY id",
+	); err != nil {
+		return nil, err
+	}
+
+	for _, session := range sessions {
+		// sessions merged from the same database before are reused
+		var existingId int
+		err := tx.QueryRow(
+			"SELECT id FROM sessions WHERE participant_id = ? AND editor = ? AND started_at = ?",
+			session.ParticipantId,
+			session.Editor,
+			session.StartedAt,
+		).Scan(&existingId)
+		if err == nil {
+			sessionMap[session.Id] = existingId
+			continue
+		} else if err != sql.ErrNoRows {
+			return nil, err
+		}
+
+		var endedAt any
+		if !session.IsOpen() {
+			endedAt = session.EndedAt
+		}
+
+		res, err := tx.Exec(
+			"INSERT INTO sessions (participant_id, editor, started_at, ended_at, end_reason, source_id) VALUES (?, ?, ?, ?, ?, ?)",
+			session.ParticipantId,
+			session.Editor,
+			session.StartedAt,
+			endedAt,
+			session.EndReason,
+			sourceId,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		newId, err := res.LastInsertId()
+		if err != nil {
+			return nil, err
+		}
+		sessionMap[session.Id] = int(newId)
+
+		type sessionFile struct {
+			FilePath string `db:"file_path"`
+			OpenedAt string `db:"opened_at"`
+		}
+
+		var files []sessionFile
+		if err := src.db.Select(&files, "SELECT file_path, opened_at FROM session_files WHERE session_id = ?", session.Id); err != nil {
+			return nil, err
+		}
+
+		for _, file := range files {
+			if _, err := tx.Exec(
+				"INSERT OR IGNORE INTO session_files (session_id, file_path, opened_at) VALUES (?, ?, ?)",
+				newId,
+				normalizePath(session.ParticipantId, file.FilePath),
+				file.OpenedAt,
+			); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return sessionMap, nil
+}
+
+func mergeEntries(tx *sqlx.Tx, c *fieldCipher, src *Logger, sourceId int, normalizePath func(string, string) string, versionMap map[string]int, sessionMap map[int]int, stats *MergeStats) error {
+	iter, err := src.AllEntries()
+	if err != nil {
+		return err
+	}
+
+	for iter.Next() {
+		entry, err := iter.Value()
+		if err != nil {
+			return err
+		}
+
+		if version, ok := versionMap[fileVersionKey(entry.ParticipantId, entry.FilePath, entry.FileVersion)]; ok {
+			entry.FileVersion = version
+		}
+		entry.FilePath = normalizePath(entry.ParticipantId, entry.FilePath)
+
+		if entry.CreatedAt == nil || !entry.CreatedAt.Valid {
+			entry.CreatedAt = &NullTime{Time: time.Now(), Valid: true}
+		}
+
+		// equal values have equal ciphertexts so the duplicates can still be found
+		entry = c.sealEntry(entry)
+
+		var exists bool
+		if err := tx.QueryRow(`SELECT COUNT(*) > 0 FROM logs WHERE
+	participant_id = ? AND executed_command = ? AND error_code = ? AND
+	error_type = ? AND error_message = ? AND error_line = ? AND error_column = ? AND
+	file_path = ? AND file_version = ? AND created_at = ?`,
+			entry.ParticipantId,
+			entry.ExecutedCommand,
+			entry.ErrorCode,
+			entry.ErrorType,
+			entry.ErrorMessage,
+			entry.ErrorLine,
+			entry.ErrorColumn,
+			entry.FilePath,
+			entry.FileVersion,
+			entry.CreatedAt,
+		).Scan(&exists); err != nil {
+			return err
+		} else if exists {
+			stats.Duplicates++
+			continue
+		}
+
+		if entry.SessionId != nil {
+			if sessionId, ok := sessionMap[*entry.SessionId]; ok {
+				entry.SessionId = &sessionId
+			} else {
+				entry.SessionId = nil
+			}
+		}
+
+		entry.SourceId = &sourceId
+		if err := insertLogEntry(tx, entry); err != nil {
+			return err
+		}
+		stats.Entries++
+	}
+
+	return nil
+}
+
+func mergeEvents(tx *sqlx.Tx, src *Logger, sourceId int, normalizePath func(string, string) string, versionMap map[string]int, sessionMap map[int]int, stats *MergeStats) error {
+	iter, err := src.AllEvents()
+	if err != nil {
+		return err
+	}
+
+	for iter.Next() {
+		event, err := iter.Value()
+		if err != nil {
+			return err
+		}
+
+		if event.FileVersion != nil {
+			if version, ok := versionMap[fileVersionKey(event.ParticipantId, event.FilePath, *event.FileVersion)]; ok {
+				event.FileVersion = &version
+			}
+		}
+		event.FilePath = normalizePath(event.ParticipantId, event.FilePath)
+
+		var exists bool
+		if err := tx.QueryRow(
+			"SELECT COUNT(*) > 0 FROM events WHERE participant_id = ? AND kind = ? AND file_path = ? AND created_at = ?",
+			event.ParticipantId,
+			event.Kind,
+			event.FilePath,
+			event.CreatedAt,
+		).Scan(&exists); err != nil {
+			return err
+		} else if exists {
+			continue
+		}
+
+		if event.SessionId != nil {
+			if sessionId, ok := sessionMap[*event.SessionId]; ok {
+				event.SessionId = &sessionId
+			} else {
+				event.SessionId = nil
+			}
+		}
+
+		event.SourceId = &sourceId
+		if err := insertEvent(tx, event); err != nil {
+			return err
+		}
+		stats.Events++
+	}
+
+	return nil
+}
@@ -0,0 +1,180 @@
+package logger_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nedpals/bugbuddy/server/logger"
+)
+
+func newParticipantLogger(t *testing.T, dbPath string, participantId string) *logger.Logger {
+	t.Helper()
+
+	log, err := logger.NewLoggerFromPath(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := log.AddSetting("participant_id", participantId); err != nil {
+		t.Fatal(err)
+	}
+	collectEverything(t, log)
+	return log
+}
+
+func logAt(t *testing.T, log *logger.Logger, filePath string, version int, errorType string, createdAt time.Time) {
+	t.Helper()
+
+	if err := log.Log(logger.LogEntry{
+		ExecutedCommand: "python3 " + filePath,
+		ErrorType:       errorType,
+		ErrorCode:       1,
+		FilePath:        filePath,
+		FileVersion:     version,
+		CreatedAt:       &logger.NullTime{Time: createdAt, Valid: true},
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLogger_Merge(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Date(2023, 9, 1, 8, 0, 0, 0, time.UTC)
+
+	first := newParticipantLogger(t, filepath.Join(dir, "first.db"), "first-participant")
+	defer first.Close()
+
+	if err := first.WriteVersionedFile("/home/first/project/main.py", []byte("print(a)"), 1); err != nil {
+		t.Fatal(err)
+	}
+	logAt(t, first, "/home/first/project/main.py", 1, "NameError", start)
+	logAt(t, first, "/home/first/project/lib/util.py", 0, "", start.Add(time.Minute))
+
+	second := newParticipantLogger(t, filepath.Join(dir, "second.db"), "second-participant")
+	defer second.Close()
+
+	if err := second.WriteVersionedFile("C:\\Users\\second\\project\\main.py", []byte("print(b)"), 1); err != nil {
+		t.Fatal(err)
+	}
+	logAt(t, second, "C:\\Users\\second\\project\\main.py", 1, "NameError", start)
+
+	studyPath := filepath.Join(dir, "study.db")
+	study, err := logger.NewLoggerFromPath(studyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer study.Close()
+
+	opts := logger.MergeOptions{NormalizePaths: true}
+
+	stats, err := study.Merge(first, "first.db", opts)
+	if err != nil {
+		t.Fatal(err)
+	} else if stats.Entries != 2 || stats.Files != 1 || stats.Duplicates != 0 {
+		t.Errorf("unexpected stats for first merge: %+v", stats)
+	}
+
+	if _, err := study.Merge(second, "second.db", opts); err != nil {
+		t.Fatal(err)
+	}
+
+	// merging the same database again should not duplicate anything
+	stats, err = study.Merge(first, "first.db", opts)
+	if err != nil {
+		t.Fatal(err)
+	} else if stats.Entries != 0 || stats.Files != 0 || stats.Duplicates != 2 {
+		t.Errorf("unexpected stats for repeated merge: %+v", stats)
+	}
+
+	entries, err := study.EntriesByParticipantId("first-participant")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := entries.List()
+	if err != nil {
+		t.Fatal(err)
+	} else if len(list) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(list))
+	}
+
+	if list[0].FilePath != "main.py" || list[1].FilePath != "lib/util.py" {
+		t.Errorf("expected paths relative to the project root, got %q and %q", list[0].FilePath, list[1].FilePath)
+	}
+
+	if list[0].SourceId == nil {
+		t.Error("expected merged entry to reference its source")
+	}
+
+	content, err := study.OpenVersionedFileFromPID("second-participant", "main.py", 1)
+	if err != nil {
+		t.Fatal(err)
+	} else if string(content) != "print(b)" {
+		t.Errorf("expected normalized windows path to keep its content, got %q", content)
+	}
+
+	if count := countRows(t, studyPath, "SELECT COUNT(*) FROM sources"); count != 3 {
+		t.Errorf("expected 3 sources, got %d", count)
+	}
+
+	if count := countRows(t, studyPath, "SELECT COUNT(*) FROM logs WHERE source_id IS NULL"); count != 0 {
+		t.Errorf("expected all entries to have a source, got %d without", count)
+	}
+}
+
+func TestLogger_Merge_VersionConflict(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Date(2023, 9, 1, 8, 0, 0, 0, time.UTC)
+
+	// the same participant collected on two different machines
+	laptop := newParticipantLogger(t, filepath.Join(dir, "laptop.db"), "participant")
+	defer laptop.Close()
+
+	if err := laptop.WriteVersionedFile("/project/main.py", []byte("print(1)"), 1); err != nil {
+		t.Fatal(err)
+	}
+	logAt(t, laptop, "/project/main.py", 1, "", start)
+
+	lab := newParticipantLogger(t, filepath.Join(dir, "lab.db"), "participant")
+	defer lab.Close()
+
+	if err := lab.WriteVersionedFile("/project/main.py", []byte("print(2)"), 1); err != nil {
+		t.Fatal(err)
+	}
+	logAt(t, lab, "/project/main.py", 1, "", start.Add(time.Hour))
+
+	study, err := logger.NewMemoryLogger()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer study.Close()
+
+	for _, src := range []*logger.Logger{laptop, lab} {
+		if _, err := study.Merge(src, "", logger.MergeOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	iter, err := study.AllEntries()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := iter.List()
+	if err != nil {
+		t.Fatal(err)
+	} else if len(list) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(list))
+	}
+
+	expected := []string{"print(1)", "print(2)"}
+	for i, entry := range list {
+		content, err := study.OpenVersionedFileFromPID(entry.ParticipantId, entry.FilePath, entry.FileVersion)
+		if err != nil {
+			t.Fatal(err)
+		} else if string(content) != expected[i] {
+			t.Errorf("expected entry %d to point to %q, got %q (version %d)", i, expected[i], content, entry.FileVersion)
+		}
+	}
+}
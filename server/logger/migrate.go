@@ -0,0 +1,182 @@
+package logger
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// schemaVersionSetting is the name of the setting that stores the
+// version of the last migration applied to the database
+const schemaVersionSetting = "schema_version"
+
+//go:embed migrations/*.sql
+var migrationsFS embed.FS
+
+// migration is a single schema change. Migrations are stored in the
+// migrations directory and are named as <version>_<name>.sql
+type migration struct {
+	Version int
+	Name    string
+	Script  string
+}
+
+var migrations = mustLoadMigrations()
+
+func mustLoadMigrations() []migration {
+	list, err := loadMigrations()
+	if err != nil {
+		panic(err)
+	}
+	return list
+}
+
+func loadMigrations() ([]migration, error) {
+	entries, err := migrationsFS.ReadDir("migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]migration, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		rawVersion, migrationName, found := strings.Cut(strings.TrimSuffix(name, ".sql"), "_")
+		if !found {
+			return nil, fmt.Errorf("invalid migration file name: %s", name)
+		}
+
+		version, err := strconv.Atoi(rawVersion)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in %s: %w", name, err)
+		}
+
+		script, err := migrationsFS.ReadFile(path.Join("migrations", name))
+		if err != nil {
+			return nil, err
+		}
+
+		list = append(list, migration{
+			Version: version,
+			Name:    migrationName,
+			Script:  string(script),
+		})
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Version < list[j].Version
+	})
+
+	// make sure versions are sequential so that no step gets skipped
+	for i, m := range list {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("migration %04d_%s is out of sequence (expected version %d)", m.Version, m.Name, i+1)
+		}
+	}
+
+	return list, nil
+}
+
+// LatestSchemaVersion returns the schema version of a fully migrated database
+func LatestSchemaVersion() int {
+	return len(migrations)
+}
+
+// schemaVersion returns the schema version of the database. Databases
+// created before versioned migrations were introduced report version 0.
+func schemaVersion(q sqlx.Queryer) (int, error) {
+	var hasSettings bool
+	if err := q.QueryRowx(
+		"SELECT COUNT(*) > 0 FROM sqlite_master WHERE type = 'table' AND name = 'settings'",
+	).Scan(&hasSettings); err != nil {
+		return 0, err
+	} else if !hasSettings {
+		return 0, nil
+	}
+
+	var rawVersion string
+	err := q.QueryRowx("SELECT value FROM settings WHERE name = ?", schemaVersionSetting).Scan(&rawVersion)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	version, err := strconv.Atoi(rawVersion)
+	if err != nil {
+		return 0, fmt.Errorf("invalid schema version %q: %w", rawVersion, err)
+	}
+	return version, nil
+}
+
+// migrate applies all pending migrations to the database. Each step
+// runs in its own transaction together with the schema version bump so
+// that a failing step leaves the database at the previous version.
+func migrate(db *sqlx.DB) (from int, to int, err error) {
+	from, err = schemaVersion(db)
+	if err != nil {
+		return 0, 0, fmt.Errorf("unable to read schema version: %w", err)
+	}
+
+	if from > LatestSchemaVersion() {
+		return from, from, fmt.Errorf("database schema version %d is newer than the supported version %d", from, LatestSchemaVersion())
+	}
+
+	to = from
+	for _, m := range migrations[from:] {
+		if err := applyMigration(db, m); err != nil {
+			return from, to, err
+		}
+		to = m.Version
+	}
+
+	return from, to, nil
+}
+
+func applyMigration(db *sqlx.DB, m migration) error {
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(m.Script); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("migration %04d_%s failed: %w", m.Version, m.Name, err)
+	}
+
+	if _, err := tx.Exec(
+		"INSERT OR REPLACE INTO settings (name, value) VALUES (?, ?)",
+		schemaVersionSetting,
+		strconv.Itoa(m.Version),
+	); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("migration %04d_%s failed: %w", m.Version, m.Name, err)
+	}
+
+	return tx.Commit()
+}
+
+// MigrateFromPath upgrades the database in the specified path to the latest
+// schema version and returns the versions before and after the upgrade.
+func MigrateFromPath(path string) (from int, to int, err error) {
+	db, err := sqlx.Open("sqlite", path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer db.Close()
+
+	return migrate(db)
+}
+
+// SchemaVersion returns the current schema version of the logger's database
+func (log *Logger) SchemaVersion() (int, error) {
+	if log.db == nil {
+		return 0, ErrUnsupportedStorage
+	}
+	return schemaVersion(log.db)
+}
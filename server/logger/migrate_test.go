@@ -0,0 +1,196 @@
+package logger_test
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/nedpals/bugbuddy/server/logger"
+)
+
+// loadFixture creates a new database from a schema fixture
+func loadFixture(t *testing.T, fixturePath string) string {
+	t.Helper()
+
+	script, err := os.ReadFile(fixturePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dbPath := filepath.Join(t.TempDir(), "logs.db")
+	db, err := sqlx.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if _, err := db.Exec(string(script)); err != nil {
+		t.Fatalf("unable to load fixture %s: %v", fixturePath, err)
+	}
+
+	return dbPath
+}
+
+func TestMigrateFromPath_Fixtures(t *testing.T) {
+	fixtures, err := filepath.Glob(filepath.Join("testdata", "schemas", "v*.sql"))
+	if err != nil {
+		t.Fatal(err)
+	} else if len(fixtures) == 0 {
+		t.Fatal("no schema fixtures found")
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(filepath.Base(fixture), func(t *testing.T) {
+			fixtureVersion, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(filepath.Base(fixture), "v"), ".sql"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			dbPath := loadFixture(t, fixture)
+
+			from, to, err := logger.MigrateFromPath(dbPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if from != fixtureVersion {
+				t.Errorf("expected migration to start from version %d, got %d", fixtureVersion, from)
+			}
+
+			if to != logger.LatestSchemaVersion() {
+				t.Errorf("expected migration to end at version %d, got %d", logger.LatestSchemaVersion(), to)
+			}
+
+			// the existing data must still be readable after the upgrade
+			log, err := logger.NewLoggerFromPath(dbPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer log.Close()
+
+			if log.ParticipantId() != "fixture-participant" {
+				t.Errorf("expected participant id to be fixture-participant, got %s", log.ParticipantId())
+			}
+
+			if ids := participantIds(t, log); len(ids) != 1 || ids[0] != "fixture-participant" {
+				t.Errorf("expected fixture-participant to be registered, got %v", ids)
+			}
+
+			// the logs created before the consent keep storing everything
+			if level := log.CollectionLevel(); level != logger.CollectionFull {
+				t.Errorf("expected the collection level to be full, got %s", level)
+			}
+
+			entriesIter, err := log.Entries()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			entries, err := entriesIter.List()
+			if err != nil {
+				t.Fatal(err)
+			} else if len(entries) != 2 {
+				t.Fatalf("expected 2 entries, got %d", len(entries))
+			}
+
+			if entries[0].ErrorType != "NameError" {
+				t.Errorf("expected first entry to be a NameError, got %q", entries[0].ErrorType)
+			}
+
+			content, err := log.OpenVersionedFile("/home/student/hello.py", 2)
+			if err != nil {
+				t.Fatal(err)
+			} else if string(content) != "a = 1\nprint(a)" {
+				t.Errorf("unexpected file content %q", string(content))
+			}
+		})
+	}
+}
+
+func TestMigrateFromPath_UpToDate(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "logs.db")
+
+	if _, to, err := logger.MigrateFromPath(dbPath); err != nil {
+		t.Fatal(err)
+	} else if to != logger.LatestSchemaVersion() {
+		t.Fatalf("expected version %d, got %d", logger.LatestSchemaVersion(), to)
+	}
+
+	// running the migrations again should be a no-op
+	from, to, err := logger.MigrateFromPath(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if from != to || to != logger.LatestSchemaVersion() {
+		t.Errorf("expected no migrations to run, got %d -> %d", from, to)
+	}
+}
+
+func TestNewLoggerFromPath_DefaultCollectionLevel(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "logs.db")
+
+	log, err := logger.NewLoggerFromPath(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	} else if level := log.CollectionLevel(); level != logger.CollectionMetadataOnly {
+		t.Fatalf("expected new logs to only store metadata, got %s", level)
+	}
+	log.Close()
+
+	// reopening the logs does not migrate them to the full collection
+	log, err = logger.NewLoggerFromPath(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+
+	if level := log.CollectionLevel(); level != logger.CollectionMetadataOnly {
+		t.Errorf("expected the default level to stay, got %s", level)
+	}
+}
+
+func TestMigrateFromPath_NewerSchema(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "logs.db")
+	if _, _, err := logger.MigrateFromPath(dbPath); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sqlx.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.Exec("UPDATE settings SET value = '9999' WHERE name = 'schema_version'"); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	if _, _, err := logger.MigrateFromPath(dbPath); err == nil {
+		t.Fatal("expected migrating a newer schema to fail")
+	}
+
+	if _, err := logger.NewLoggerFromPath(dbPath); err == nil {
+		t.Fatal("expected opening a newer schema to fail")
+	}
+}
+
+func TestLogger_SchemaVersion(t *testing.T) {
+	log, err := logger.NewMemoryLogger()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+
+	version, err := log.SchemaVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if version != logger.LatestSchemaVersion() {
+		t.Errorf("expected schema version %d, got %d", logger.LatestSchemaVersion(), version)
+	}
+}
@@ -0,0 +1,32 @@
+-- Create the blobs table for storing file contents by their hash.
+-- Blobs are either zlib-compressed contents or zlib-compressed deltas
+-- against another blob (base_hash).
+CREATE TABLE IF NOT EXISTS blobs (
+    hash TEXT PRIMARY KEY,
+    encoding TEXT NOT NULL,
+    base_hash TEXT,
+    depth INTEGER NOT NULL DEFAULT 0,
+    size INTEGER NOT NULL,
+    data BLOB NOT NULL
+);
+
+-- Rebuild the files table so that contents may be stored as a reference
+-- to a blob instead. Existing contents are kept inline until compacted.
+CREATE TABLE files_new (
+    id INTEGER PRIMARY KEY,
+    participant_id TEXT NOT NULL,
+    file_path TEXT NOT NULL,
+    file_version INTEGER DEFAULT 1,
+    content TEXT,
+    content_hash TEXT,
+    created_at TEXT NOT NULL,
+    UNIQUE(participant_id, file_path, file_version) ON CONFLICT REPLACE
+);
+
+INSERT INTO files_new (id, participant_id, file_path, file_version, content, created_at)
+    SELECT id, participant_id, file_path, file_version, content, created_at FROM files;
+
+DROP TABLE files;
+ALTER TABLE files_new RENAME TO files;
+
+CREATE INDEX IF NOT EXISTS files_content_hash ON files (content_hash);
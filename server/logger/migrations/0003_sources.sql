@@ -0,0 +1,13 @@
+-- Create the sources table for recording the databases merged into this one
+CREATE TABLE IF NOT EXISTS sources (
+    id INTEGER PRIMARY KEY,
+    path TEXT NOT NULL,
+    project_roots TEXT NOT NULL DEFAULT '{}',
+    merged_at TEXT NOT NULL
+);
+
+-- Keep track of the source database of each merged row
+ALTER TABLE logs ADD COLUMN source_id INTEGER REFERENCES sources(id);
+ALTER TABLE files ADD COLUMN source_id INTEGER REFERENCES sources(id);
+
+CREATE INDEX IF NOT EXISTS logs_participant_created_at ON logs (participant_id, created_at);
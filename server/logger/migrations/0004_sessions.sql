@@ -0,0 +1,22 @@
+-- Create the sessions table for recording the editor sessions of the participants
+CREATE TABLE IF NOT EXISTS sessions (
+    id INTEGER PRIMARY KEY,
+    participant_id TEXT NOT NULL,
+    editor TEXT NOT NULL DEFAULT '',
+    started_at TEXT NOT NULL,
+    ended_at TEXT,
+    end_reason TEXT NOT NULL DEFAULT '',
+    source_id INTEGER REFERENCES sources(id)
+);
+
+CREATE TABLE IF NOT EXISTS session_files (
+    session_id INTEGER NOT NULL REFERENCES sessions(id) ON DELETE CASCADE,
+    file_path TEXT NOT NULL,
+    opened_at TEXT NOT NULL,
+    PRIMARY KEY (session_id, file_path)
+);
+
+-- Keep track of the session where each run happened
+ALTER TABLE logs ADD COLUMN session_id INTEGER REFERENCES sessions(id);
+
+CREATE INDEX IF NOT EXISTS logs_session_id ON logs (session_id);
@@ -0,0 +1,16 @@
+-- Create the events table for recording the editor activity between runs
+CREATE TABLE IF NOT EXISTS events (
+    id INTEGER PRIMARY KEY,
+    participant_id TEXT NOT NULL,
+    session_id INTEGER REFERENCES sessions(id),
+    kind TEXT NOT NULL,
+    file_path TEXT NOT NULL,
+    size INTEGER NOT NULL DEFAULT 0,
+    chars_inserted INTEGER NOT NULL DEFAULT 0,
+    chars_deleted INTEGER NOT NULL DEFAULT 0,
+    file_version INTEGER,
+    created_at TEXT NOT NULL,
+    source_id INTEGER REFERENCES sources(id)
+);
+
+CREATE INDEX IF NOT EXISTS events_participant_created_at ON events (participant_id, created_at);
@@ -0,0 +1,19 @@
+-- Create the participants table so that a single database can hold
+-- the logs of several participants sharing the same machine
+CREATE TABLE IF NOT EXISTS participants (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL DEFAULT '',
+    created_at TEXT NOT NULL
+);
+
+-- Register the participants of the existing data
+INSERT OR IGNORE INTO participants (id, created_at)
+    SELECT value, strftime('%Y-%m-%dT%H:%M:%fZ', 'now') FROM settings WHERE name = 'participant_id';
+
+INSERT OR IGNORE INTO participants (id, created_at)
+    SELECT participant_id, MIN(created_at) FROM (
+        SELECT participant_id, created_at FROM logs
+        UNION ALL SELECT participant_id, created_at FROM files
+        UNION ALL SELECT participant_id, started_at FROM sessions
+        UNION ALL SELECT participant_id, created_at FROM events
+    ) GROUP BY participant_id;
@@ -0,0 +1,8 @@
+-- New databases only store metadata until the participant has given their
+-- consent. Keep storing everything in the databases created before the
+-- default changed, which are the ones that already have a participant.
+INSERT OR IGNORE INTO settings (name, value)
+    SELECT 'collection.level', 'full'
+    WHERE EXISTS (SELECT 1 FROM settings WHERE name = 'participant_id')
+        OR EXISTS (SELECT 1 FROM logs)
+        OR EXISTS (SELECT 1 FROM files);
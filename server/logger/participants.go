@@ -0,0 +1,90 @@
+package logger
+
+import (
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/lucasepe/codename"
+)
+
+// Participant is a person whose activity is recorded in the logs. A single
+// logger may hold several participants, such as the students sharing a
+// computer in a laboratory.
+type Participant struct {
+	Id        string    `db:"id"`
+	Name      string    `db:"name"`
+	CreatedAt *NullTime `db:"created_at"`
+}
+
+// Participants returns the participants registered in the logger
+func (log *Logger) Participants() ([]Participant, error) {
+	return log.storage.Participants()
+}
+
+// AddParticipant registers the participant without switching to it
+func (log *Logger) AddParticipant(participantId string, name string) error {
+	if len(participantId) == 0 {
+		return errors.New("participant id must not be empty")
+	}
+
+	return log.storage.AddParticipant(Participant{
+		Id:        participantId,
+		Name:      name,
+		CreatedAt: &NullTime{Time: time.Now(), Valid: true},
+	})
+}
+
+// HasParticipant checks if the participant is registered in the logger
+func (log *Logger) HasParticipant(participantId string) (bool, error) {
+	participants, err := log.Participants()
+	if err != nil {
+		return false, err
+	}
+
+	for _, participant := range participants {
+		if participant.Id == participantId {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// SwitchParticipant makes the participant the active participant of the
+// logger. The participant is registered if it does not exist yet.
+func (log *Logger) SwitchParticipant(participantId string) error {
+	if err := log.AddParticipant(participantId, ""); err != nil {
+		return err
+	}
+
+	if err := log.AddSetting("participant_id", participantId); err != nil {
+		return err
+	}
+
+	// the participant id is read again on the next call to ParticipantId
+	log.participantId = ""
+	return nil
+}
+
+// NewParticipantId generates and registers a participant id which is not
+// used by the other participants. The active participant stays the same.
+func (log *Logger) NewParticipantId() (string, error) {
+	for {
+		seed, err := codename.NewCryptoSeed()
+		if err != nil {
+			return "", err
+		}
+
+		participantId := codename.Generate(rand.New(rand.NewSource(seed)), 4)
+		if exists, err := log.HasParticipant(participantId); err != nil {
+			return "", err
+		} else if exists {
+			continue
+		}
+
+		if err := log.AddParticipant(participantId, ""); err != nil {
+			return "", err
+		}
+		return participantId, nil
+	}
+}
@@ -0,0 +1,140 @@
+package logger_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/nedpals/bugbuddy/server/logger"
+)
+
+func participantIds(t *testing.T, log *logger.Logger) []string {
+	t.Helper()
+
+	participants, err := log.Participants()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids := []string{}
+	for _, participant := range participants {
+		ids = append(ids, participant.Id)
+	}
+	return ids
+}
+
+func TestLogger_SwitchParticipant(t *testing.T) {
+	for name, open := range storageBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			log := newStorageLogger(t, open())
+			defer log.Close()
+
+			first := log.ParticipantId()
+			if ids := participantIds(t, log); len(ids) != 1 || ids[0] != first {
+				t.Fatalf("expected the generated participant to be registered, got %v", ids)
+			}
+
+			if err := log.SwitchParticipant("student-b"); err != nil {
+				t.Fatal(err)
+			} else if log.ParticipantId() != "student-b" {
+				t.Fatalf("expected active participant to be student-b, got %s", log.ParticipantId())
+			}
+
+			// the implicit methods use the active participant
+			if err := log.WriteVersionedFile("main.py", []byte("print(b)"), -1); err != nil {
+				t.Fatal(err)
+			} else if err := log.Log(logger.LogEntry{ErrorCode: 1, FilePath: "main.py", FileVersion: 1}); err != nil {
+				t.Fatal(err)
+			}
+
+			// the explicit variants leave the active participant alone
+			if err := log.WriteVersionedFileForPID(first, "main.py", []byte("print(a)"), -1); err != nil {
+				t.Fatal(err)
+			} else if err := log.WriteVersionedFileForPID(first, "main.py", []byte("print(a + 1)"), -1); err != nil {
+				t.Fatal(err)
+			}
+
+			if version, err := log.LatestVersionFromFileForPID(first, "main.py"); err != nil || version != 2 {
+				t.Fatalf("expected 2 versions for %s, got %d (%v)", first, version, err)
+			} else if version, err := log.LatestVersionFromFile("main.py"); err != nil || version != 1 {
+				t.Fatalf("expected 1 version for student-b, got %d (%v)", version, err)
+			} else if content, err := log.OpenFileForPID(first, "main.py"); err != nil || string(content) != "print(a)" {
+				t.Fatalf("unexpected content %q (%v)", content, err)
+			}
+
+			if err := log.RenameFileForPID(first, "main.py", "app.py"); err != nil {
+				t.Fatal(err)
+			} else if _, err := log.OpenVersionedFile("main.py", 1); err != nil {
+				t.Fatalf("expected the file of student-b to stay, got %v", err)
+			}
+
+			if err := log.ResetForPID("student-b"); err != nil {
+				t.Fatal(err)
+			} else if _, err := log.OpenVersionedFile("main.py", 1); err == nil {
+				t.Fatal("expected the file of student-b to be removed")
+			} else if _, err := log.OpenVersionedFileFromPID(first, "app.py", 2); err != nil {
+				t.Fatalf("expected the files of %s to stay, got %v", first, err)
+			}
+
+			generated, err := log.NewParticipantId()
+			if err != nil {
+				t.Fatal(err)
+			} else if generated == first || generated == "student-b" || log.ParticipantId() != "student-b" {
+				t.Fatalf("expected a new participant without switching, got %s (active %s)", generated, log.ParticipantId())
+			}
+
+			if ids := participantIds(t, log); len(ids) != 3 || ids[0] != first || ids[1] != "student-b" || ids[2] != generated {
+				t.Fatalf("unexpected participants %v", ids)
+			}
+
+			if name == "memory" {
+				return
+			}
+
+			// the participants and the active participant are kept after reopening
+			log.Close()
+			log = newStorageLogger(t, open())
+
+			if log.ParticipantId() != "student-b" {
+				t.Errorf("expected student-b to stay active, got %s", log.ParticipantId())
+			} else if ids := participantIds(t, log); len(ids) != 3 {
+				t.Errorf("expected 3 participants after reopening, got %v", ids)
+			}
+		})
+	}
+}
+
+func TestLogger_Merge_Participants(t *testing.T) {
+	dir := t.TempDir()
+
+	src := newParticipantLogger(t, filepath.Join(dir, "lab.db"), "student-a")
+	defer src.Close()
+
+	if err := src.SwitchParticipant("student-b"); err != nil {
+		t.Fatal(err)
+	} else if err := src.Log(logger.LogEntry{ErrorCode: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	// entries of participants which were never registered
+	if err := src.Log(logger.LogEntry{ParticipantId: "student-c", ErrorCode: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := logger.NewMemoryLoggerPanic()
+	defer dst.Close()
+
+	if _, err := dst.Merge(src, "lab.db", logger.MergeOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	registered := map[string]bool{}
+	for _, id := range participantIds(t, dst) {
+		registered[id] = true
+	}
+
+	for _, id := range []string{"student-b", "student-c"} {
+		if !registered[id] {
+			t.Errorf("expected %s to be registered after merging, got %v", id, registered)
+		}
+	}
+}
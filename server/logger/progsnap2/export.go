@@ -0,0 +1,270 @@
+package progsnap2
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nedpals/bugbuddy/server/logger/export"
+)
+
+// Format is the export format of ProgSnap2 datasets. It is handled
+// separately from export.NewWriter since a dataset is a directory.
+const Format export.Format = "progsnap2"
+
+// Version is the version of the ProgSnap2 specification of the exported datasets
+const Version = "6.0"
+
+// ToolInstance is the tool recorded in the events of exported datasets
+const ToolInstance = "BugBuddy"
+
+// UnknownErrorType is the message type of errors without an error type
+const UnknownErrorType = "UnknownError"
+
+var mainTableColumns = []string{
+	EventTypeColumn,
+	EventIdColumn,
+	OrderColumn,
+	SubjectIdColumn,
+	ToolInstancesColumn,
+	CodeStateIdColumn,
+	CodeStateSectionColumn,
+	ServerTimestampColumn,
+	ServerTimezoneColumn,
+	ParentEventIdColumn,
+	CompileResultColumn,
+	CompileMessageTypeColumn,
+	CompileMessageDataColumn,
+	SourceLocationColumn,
+	ExecutionResultColumn,
+	ProgramOutputColumn,
+}
+
+const timestampLayout = "2006-01-02T15:04:05.000"
+
+// codeStateKey identifies the file version stored in a code state
+type codeStateKey struct {
+	participantId string
+	filePath      string
+	fileVersion   int
+}
+
+// Writer writes the exported log entries and file versions into a
+// ProgSnap2 dataset. The file versions become code states of the
+// Directory representation, and the log entries become the events of the
+// main table, which is written on Close once the code states of the
+// entries are known.
+type Writer struct {
+	// NoCodeStates discards the file versions. The events are written
+	// without code states.
+	NoCodeStates bool
+
+	dir        string
+	entries    []export.Entry
+	codeStates map[codeStateKey]string
+}
+
+// NewWriter creates a writer for the dataset in the directory
+func NewWriter(dir string) (*Writer, error) {
+	if err := os.MkdirAll(filepath.Join(dir, CodeStatesDir), 0755); err != nil {
+		return nil, err
+	}
+	return &Writer{dir: dir, codeStates: map[codeStateKey]string{}}, nil
+}
+
+func (w *Writer) WriteEntry(entry export.Entry) error {
+	// the sources are stored in the code states
+	entry.Source = nil
+	w.entries = append(w.entries, entry)
+	return nil
+}
+
+func (w *Writer) WriteFile(file export.File) error {
+	key := codeStateKey{participantId: file.ParticipantId, filePath: file.FilePath, fileVersion: file.FileVersion}
+	if _, ok := w.codeStates[key]; ok || w.NoCodeStates {
+		return nil
+	}
+
+	codeStateId := strconv.Itoa(len(w.codeStates) + 1)
+	filePath := filepath.Join(w.dir, CodeStatesDir, codeStateId, filepath.FromSlash(codeStateSection(file.FilePath)))
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return err
+	} else if err := os.WriteFile(filePath, []byte(file.Content), 0644); err != nil {
+		return err
+	}
+
+	w.codeStates[key] = codeStateId
+	return nil
+}
+
+// Close writes the main table and the dataset metadata
+func (w *Writer) Close() error {
+	if err := w.writeMainTable(); err != nil {
+		return err
+	}
+	return w.writeMetadata()
+}
+
+// codeStateSection turns the file path into a relative path inside the
+// directory of its code state
+func codeStateSection(filePath string) string {
+	filePath = strings.ReplaceAll(filePath, "\\", "/")
+	if len(filePath) >= 2 && filePath[1] == ':' {
+		// remove the drive letter of Windows paths
+		filePath = filePath[2:]
+	}
+
+	filePath = strings.TrimLeft(path.Clean("/"+filePath), "/")
+	if len(filePath) == 0 {
+		return DefaultFilePath
+	}
+	return filePath
+}
+
+func formatSourceLocation(line int, column int) string {
+	if line <= 0 {
+		return ""
+	} else if column <= 0 {
+		return fmt.Sprintf("Text:%d", line)
+	}
+	return fmt.Sprintf("Text:%d:%d", line, column)
+}
+
+func (w *Writer) writeMainTable() error {
+	file, err := os.Create(filepath.Join(w.dir, MainTableFile))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// the events are ordered globally across the exported databases
+	times := make([]time.Time, len(w.entries))
+	for i, entry := range w.entries {
+		times[i], _ = time.Parse(time.RFC3339Nano, entry.CreatedAt)
+	}
+
+	order := make([]int, len(w.entries))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return times[order[i]].Before(times[order[j]])
+	})
+
+	out := csv.NewWriter(file)
+	if err := out.Write(mainTableColumns); err != nil {
+		return err
+	}
+
+	eventId := 0
+	for _, i := range order {
+		entry := w.entries[i]
+		createdAt := times[i]
+
+		codeStateId, section := "", ""
+		if len(entry.FilePath) != 0 {
+			section = codeStateSection(entry.FilePath)
+			codeStateId = w.codeStates[codeStateKey{participantId: entry.ParticipantId, filePath: entry.FilePath, fileVersion: entry.FileVersion}]
+		}
+
+		messageType := entry.ErrorType
+		if entry.ErrorCode != 0 && len(messageType) == 0 {
+			messageType = UnknownErrorType
+		}
+
+		newEvent := func(eventType string) map[string]string {
+			eventId++
+			event := map[string]string{
+				EventTypeColumn:        eventType,
+				EventIdColumn:          strconv.Itoa(eventId),
+				OrderColumn:            strconv.Itoa(eventId),
+				SubjectIdColumn:        entry.ParticipantId,
+				ToolInstancesColumn:    ToolInstance,
+				CodeStateIdColumn:      codeStateId,
+				CodeStateSectionColumn: section,
+			}
+			if !createdAt.IsZero() {
+				event[ServerTimestampColumn] = createdAt.Format(timestampLayout)
+				event[ServerTimezoneColumn] = createdAt.Format("-0700")
+			}
+			return event
+		}
+
+		events := []map[string]string{}
+		if entry.ExecutedCommand == RunProgramEvent {
+			// runs imported from other datasets stay runs
+			run := newEvent(RunProgramEvent)
+			run[ExecutionResultColumn] = SuccessResult
+			run[ProgramOutputColumn] = entry.GeneratedOutput
+			if entry.ErrorCode != 0 {
+				run[ExecutionResultColumn] = ErrorResult
+				run[CompileMessageTypeColumn] = messageType
+				run[CompileMessageDataColumn] = entry.ErrorMessage
+				run[SourceLocationColumn] = formatSourceLocation(entry.ErrorLine, entry.ErrorColumn)
+			}
+			events = append(events, run)
+		} else {
+			// the errors of the runs are reported like compiler errors,
+			// so each run is a compilation with its error as a child event
+			compile := newEvent(CompileEvent)
+			compile[CompileResultColumn] = SuccessResult
+			events = append(events, compile)
+
+			if entry.ErrorCode != 0 {
+				compile[CompileResultColumn] = ErrorResult
+
+				compileError := newEvent(CompileErrorEvent)
+				compileError[ParentEventIdColumn] = compile[EventIdColumn]
+				compileError[CompileMessageTypeColumn] = messageType
+				compileError[CompileMessageDataColumn] = entry.ErrorMessage
+				compileError[SourceLocationColumn] = formatSourceLocation(entry.ErrorLine, entry.ErrorColumn)
+				events = append(events, compileError)
+			}
+		}
+
+		for _, event := range events {
+			record := make([]string, len(mainTableColumns))
+			for i, column := range mainTableColumns {
+				record[i] = event[column]
+			}
+
+			if err := out.Write(record); err != nil {
+				return err
+			}
+		}
+	}
+
+	out.Flush()
+	return out.Error()
+}
+
+func (w *Writer) writeMetadata() error {
+	file, err := os.Create(filepath.Join(w.dir, DatasetMetadataFile))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	out := csv.NewWriter(file)
+	for _, record := range [][]string{
+		{"Property", "Value"},
+		{"Version", Version},
+		{"IsEventOrderingConsistent", "true"},
+		{"EventOrderScope", "Global"},
+		{"EventOrderScopeColumns", ""},
+		{CodeStateRepresentationProperty, DirectoryRepresentation},
+	} {
+		if err := out.Write(record); err != nil {
+			return err
+		}
+	}
+
+	out.Flush()
+	return out.Error()
+}
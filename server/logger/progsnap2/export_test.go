@@ -0,0 +1,225 @@
+package progsnap2_test
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nedpals/bugbuddy/server/logger"
+	"github.com/nedpals/bugbuddy/server/logger/export"
+	"github.com/nedpals/bugbuddy/server/logger/progsnap2"
+)
+
+func readCSV(t *testing.T, path string) []map[string]string {
+	t.Helper()
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows := []map[string]string{}
+	for _, record := range records[1:] {
+		row := map[string]string{}
+		for i, column := range records[0] {
+			row[column] = record[i]
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func setupExportLogger(t *testing.T) *logger.Logger {
+	t.Helper()
+
+	lg, err := logger.NewLoggerFromPath(filepath.Join(t.TempDir(), "logs.db"))
+	if err != nil {
+		t.Fatal(err)
+	} else if err := lg.SetConsent(logger.CollectionFull, ""); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { lg.Close() })
+
+	start := time.Date(2024, 3, 4, 9, 0, 0, 0, time.UTC)
+	for _, run := range []struct {
+		participantId string
+		filePath      string
+		content       string
+		errorType     string
+		minutes       int
+	}{
+		{"student-a", "/home/a/lab/main.py", "print(a)", "NameError", 0},
+		{"student-a", "/home/a/lab/main.py", "a = 1\nprint(a)", "", 3},
+		{"student-b", "C:\\Users\\b\\lab\\main.py", "print(1 / 0)", "ZeroDivisionError", 1},
+	} {
+		if err := lg.WriteVersionedFileForPID(run.participantId, run.filePath, []byte(run.content), -1); err != nil {
+			t.Fatal(err)
+		}
+
+		version, err := lg.LatestVersionFromFileForPID(run.participantId, run.filePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		entry := logger.LogEntry{
+			ParticipantId:   run.participantId,
+			ExecutedCommand: "python3 main.py",
+			FilePath:        run.filePath,
+			FileVersion:     version,
+			CreatedAt:       &logger.NullTime{Time: start.Add(time.Duration(run.minutes) * time.Minute), Valid: true},
+		}
+
+		if len(run.errorType) != 0 {
+			entry.ErrorCode = 1
+			entry.ErrorType = run.errorType
+			entry.ErrorMessage = run.errorType + ": oops"
+			entry.ErrorLine = 1
+		}
+
+		if err := lg.Log(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return lg
+}
+
+func exportDataset(t *testing.T, lg *logger.Logger) string {
+	t.Helper()
+
+	dir := filepath.Join(t.TempDir(), "dataset")
+	w, err := progsnap2.NewWriter(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := export.Export(lg, w, export.Options{}); err != nil {
+		t.Fatal(err)
+	} else if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestExport(t *testing.T) {
+	lg := setupExportLogger(t)
+	dir := exportDataset(t, lg)
+
+	events := readCSV(t, filepath.Join(dir, progsnap2.MainTableFile))
+
+	counts := map[string]int{}
+	for _, event := range events {
+		counts[event[progsnap2.EventTypeColumn]]++
+	}
+
+	// each run is a compilation and each failed run has an error
+	if counts[progsnap2.CompileEvent] != 3 || counts[progsnap2.CompileErrorEvent] != 2 || len(events) != 5 {
+		t.Fatalf("unexpected events %v", counts)
+	}
+
+	first, firstError := events[0], events[1]
+	if first[progsnap2.SubjectIdColumn] != "student-a" || first[progsnap2.CompileResultColumn] != progsnap2.ErrorResult {
+		t.Errorf("unexpected compilation %v", first)
+	} else if first[progsnap2.ServerTimestampColumn] != "2024-03-04T09:00:00.000" || first[progsnap2.ServerTimezoneColumn] != "+0000" {
+		t.Errorf("unexpected timestamp %v", first)
+	}
+
+	if firstError[progsnap2.ParentEventIdColumn] != first[progsnap2.EventIdColumn] ||
+		firstError[progsnap2.CompileMessageTypeColumn] != "NameError" ||
+		firstError[progsnap2.SourceLocationColumn] != "Text:1" {
+		t.Errorf("unexpected compile error %v", firstError)
+	}
+
+	// the events are ordered by time across participants
+	if events[2][progsnap2.SubjectIdColumn] != "student-b" || events[4][progsnap2.CompileResultColumn] != progsnap2.SuccessResult {
+		t.Errorf("unexpected order of events %v", events)
+	}
+
+	codeStates, err := os.ReadDir(filepath.Join(dir, progsnap2.CodeStatesDir))
+	if err != nil {
+		t.Fatal(err)
+	} else if len(codeStates) != 3 {
+		t.Fatalf("expected 3 code states, got %d", len(codeStates))
+	}
+
+	for _, event := range events {
+		if event[progsnap2.EventTypeColumn] != progsnap2.CompileEvent {
+			continue
+		}
+
+		content, err := os.ReadFile(filepath.Join(dir, progsnap2.CodeStatesDir, event[progsnap2.CodeStateIdColumn], event[progsnap2.CodeStateSectionColumn]))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		iter, err := lg.EntriesByParticipantId(event[progsnap2.SubjectIdColumn])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		entries, err := iter.List()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		found := false
+		for _, entry := range entries {
+			source, err := lg.OpenVersionedFileFromPID(entry.ParticipantId, entry.FilePath, entry.FileVersion)
+			if err != nil {
+				t.Fatal(err)
+			} else if string(source) == string(content) {
+				found = true
+			}
+		}
+
+		if !found {
+			t.Errorf("code state %s does not match the files of %s", event[progsnap2.CodeStateIdColumn], event[progsnap2.SubjectIdColumn])
+		}
+	}
+
+	if section := events[2][progsnap2.CodeStateSectionColumn]; section != "Users/b/lab/main.py" {
+		t.Errorf("expected a relative section for the Windows path, got %q", section)
+	}
+
+	metadata := readCSV(t, filepath.Join(dir, progsnap2.DatasetMetadataFile))
+	properties := map[string]string{}
+	for _, row := range metadata {
+		properties[row["Property"]] = row["Value"]
+	}
+
+	if properties[progsnap2.CodeStateRepresentationProperty] != progsnap2.DirectoryRepresentation {
+		t.Errorf("unexpected metadata %v", properties)
+	}
+}
+
+func TestExport_Import(t *testing.T) {
+	src := setupExportLogger(t)
+	lg, stats := importDataset(t, exportDataset(t, src), progsnap2.ImportOptions{})
+
+	if stats.Entries != 3 || stats.Files != 3 || stats.Participants != 2 {
+		t.Fatalf("unexpected import %+v", stats)
+	}
+
+	iter, err := lg.EntriesByParticipantId("student-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := iter.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 2 || entries[0].ErrorType != "NameError" || entries[0].ErrorMessage != "NameError: oops" || entries[1].ErrorCode != 0 {
+		t.Fatalf("unexpected entries %+v", entries)
+	} else if entries[1].FilePath != "home/a/lab/main.py" || entries[1].FileVersion != 2 {
+		t.Errorf("unexpected file %s (version %d)", entries[1].FilePath, entries[1].FileVersion)
+	}
+}
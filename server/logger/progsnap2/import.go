@@ -0,0 +1,506 @@
+package progsnap2
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nedpals/bugbuddy/server/logger"
+)
+
+// DefaultFilePath is the file path of the code states which are not split
+// into sections
+const DefaultFilePath = "main"
+
+// ImportOptions changes how a dataset is imported
+type ImportOptions struct {
+	// DefaultFilePath is the file path of the code states without a
+	// section. DefaultFilePath is used if it is empty.
+	DefaultFilePath string
+}
+
+// ImportStats reports the number of imported records
+type ImportStats struct {
+	// Events is the number of rows read from the main table
+	Events       int
+	Entries      int
+	Files        int
+	Participants int
+	// Skipped is the number of events which have no log entry counterpart,
+	// such as edits and session events
+	Skipped int
+}
+
+// event is a row of the main table
+type event struct {
+	index     int
+	order     int64
+	hasOrder  bool
+	eventType string
+	eventId   string
+	parentId  string
+	subjectId string
+	createdAt time.Time
+	row       []string
+}
+
+// codeFile is a file of a code state
+type codeFile struct {
+	path    string
+	content []byte
+}
+
+// fileKey identifies the versions of a file of a participant
+type fileKey struct {
+	participantId string
+	filePath      string
+}
+
+// fileHistory is the latest version of an imported file
+type fileHistory struct {
+	version int
+	hash    string
+}
+
+type importer struct {
+	lg          *logger.Logger
+	dir         string
+	opts        ImportOptions
+	main        *table
+	codeStates  *table
+	codeByState map[string]int
+	files       map[fileKey]*fileHistory
+	stats       ImportStats
+}
+
+// Import reads the compile and run events of the ProgSnap2 dataset in the
+// directory into the logger. Compilations and runs become log entries of
+// their subject, with the errors taken from their Compile.Error events,
+// and the code state of each event is stored as a version of its files.
+func Import(lg *logger.Logger, dir string, opts ImportOptions) (ImportStats, error) {
+	if len(opts.DefaultFilePath) == 0 {
+		opts.DefaultFilePath = DefaultFilePath
+	}
+
+	main, err := readTable(filepath.Join(dir, MainTableFile))
+	if err != nil {
+		return ImportStats{}, err
+	}
+
+	for _, column := range []string{EventTypeColumn, SubjectIdColumn} {
+		if !main.has(column) {
+			return ImportStats{}, fmt.Errorf("%s: missing %s column", MainTableFile, column)
+		}
+	}
+
+	if !main.has(ServerTimestampColumn) && !main.has(ClientTimestampColumn) && !main.has(OrderColumn) {
+		return ImportStats{}, fmt.Errorf("%s: missing timestamp or order column", MainTableFile)
+	}
+
+	imp := &importer{lg: lg, dir: dir, opts: opts, main: main, files: map[fileKey]*fileHistory{}}
+	if err := imp.openCodeStates(); err != nil {
+		return ImportStats{}, err
+	}
+
+	events, err := imp.events()
+	if err != nil {
+		return imp.stats, err
+	}
+
+	// the first error of each compilation describes the compilation
+	compileErrors := map[string]*event{}
+	compilations := map[string]bool{}
+	for _, ev := range events {
+		if ev.eventType == CompileEvent && len(ev.eventId) != 0 {
+			compilations[ev.eventId] = true
+		}
+	}
+
+	for _, ev := range events {
+		if ev.eventType == CompileErrorEvent && compilations[ev.parentId] && compileErrors[ev.parentId] == nil {
+			compileErrors[ev.parentId] = ev
+		}
+	}
+
+	participants := map[string]bool{}
+	for _, ev := range events {
+		var entry logger.LogEntry
+		switch ev.eventType {
+		case CompileEvent:
+			entry = imp.compileEntry(ev, compileErrors[ev.eventId])
+		case CompileErrorEvent:
+			if compilations[ev.parentId] {
+				// recorded in the entry of the compilation
+				continue
+			}
+			entry = imp.compileEntry(ev, ev)
+		case RunProgramEvent:
+			entry = imp.runEntry(ev)
+		default:
+			imp.stats.Skipped++
+			continue
+		}
+
+		if !participants[ev.subjectId] {
+			if err := lg.AddParticipant(ev.subjectId, ""); err != nil {
+				return imp.stats, err
+			}
+			participants[ev.subjectId] = true
+			imp.stats.Participants++
+		}
+
+		if err := imp.writeCodeState(ev, &entry); err != nil {
+			return imp.stats, fmt.Errorf("event %s: %w", ev.eventId, err)
+		}
+
+		if err := lg.Log(entry); err != nil {
+			return imp.stats, err
+		}
+		imp.stats.Entries++
+	}
+
+	return imp.stats, nil
+}
+
+// openCodeStates finds how the code states of the dataset are stored
+func (imp *importer) openCodeStates() error {
+	metadata, err := readMetadata(filepath.Join(imp.dir, DatasetMetadataFile))
+	if err != nil {
+		return err
+	}
+
+	tablePath := filepath.Join(imp.dir, CodeStatesDir, CodeStatesFile)
+	representation := metadata[CodeStateRepresentationProperty]
+	if len(representation) == 0 {
+		representation = DirectoryRepresentation
+		if _, err := os.Stat(tablePath); err == nil {
+			representation = TableRepresentation
+		}
+	}
+
+	switch representation {
+	case TableRepresentation:
+		codeStates, err := readTable(tablePath)
+		if os.IsNotExist(err) {
+			// datasets without code states only have the events
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		imp.codeStates = codeStates
+		imp.codeByState = map[string]int{}
+		for i, row := range codeStates.rows {
+			imp.codeByState[codeStates.get(row, CodeStateIdColumn)] = i
+		}
+		return nil
+	case DirectoryRepresentation:
+		return nil
+	default:
+		return fmt.Errorf("unsupported code state representation: %s", representation)
+	}
+}
+
+// events reads the events of the main table in the order they happened
+func (imp *importer) events() ([]*event, error) {
+	events := make([]*event, 0, len(imp.main.rows))
+	for i, row := range imp.main.rows {
+		ev := &event{
+			index:     i,
+			eventType: strings.TrimSpace(imp.main.get(row, EventTypeColumn)),
+			eventId:   imp.main.get(row, EventIdColumn),
+			parentId:  imp.main.get(row, ParentEventIdColumn),
+			subjectId: strings.TrimSpace(imp.main.get(row, SubjectIdColumn)),
+			row:       row,
+		}
+		imp.stats.Events++
+
+		if len(ev.subjectId) == 0 {
+			return nil, fmt.Errorf("%s: row %d has no %s", MainTableFile, i+2, SubjectIdColumn)
+		}
+
+		if rawOrder := imp.main.get(row, OrderColumn); len(rawOrder) != 0 {
+			order, err := strconv.ParseInt(rawOrder, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%s: row %d: invalid order %q", MainTableFile, i+2, rawOrder)
+			}
+			ev.order, ev.hasOrder = order, true
+		}
+
+		createdAt, err := eventTime(imp.main, row)
+		if err != nil {
+			return nil, fmt.Errorf("%s: row %d: %w", MainTableFile, i+2, err)
+		}
+		ev.createdAt = createdAt
+
+		events = append(events, ev)
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		a, b := events[i], events[j]
+		if a.hasOrder && b.hasOrder && a.order != b.order {
+			return a.order < b.order
+		} else if !a.createdAt.IsZero() && !b.createdAt.IsZero() && !a.createdAt.Equal(b.createdAt) {
+			return a.createdAt.Before(b.createdAt)
+		}
+		return a.index < b.index
+	})
+
+	// events without a timestamp are placed after the previous event
+	// since the log entries must have a creation time
+	var last time.Time
+	for _, ev := range events {
+		if ev.createdAt.IsZero() {
+			if last.IsZero() {
+				last = time.Unix(0, 0).UTC()
+			}
+			ev.createdAt = last
+		}
+		last = ev.createdAt
+	}
+
+	return events, nil
+}
+
+var timestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+}
+
+// eventTime returns the server timestamp of the event, or its client
+// timestamp if it has none, in the timezone recorded next to it
+func eventTime(t *table, row []string) (time.Time, error) {
+	for _, columns := range [][2]string{
+		{ServerTimestampColumn, ServerTimezoneColumn},
+		{ClientTimestampColumn, ClientTimezoneColumn},
+	} {
+		raw := strings.TrimSpace(t.get(row, columns[0]))
+		if len(raw) == 0 {
+			continue
+		}
+
+		loc, err := parseTimezone(t.get(row, columns[1]))
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		for _, layout := range timestampLayouts {
+			if createdAt, err := time.ParseInLocation(layout, raw, loc); err == nil {
+				return createdAt, nil
+			}
+		}
+		return time.Time{}, fmt.Errorf("invalid timestamp %q", raw)
+	}
+	return time.Time{}, nil
+}
+
+// parseTimezone parses UTC offsets such as +0800 and -05:00 as well as
+// timezone names such as Europe/London
+func parseTimezone(raw string) (*time.Location, error) {
+	raw = strings.TrimSpace(raw)
+	if len(raw) == 0 || raw == "0" || raw == "Z" || strings.EqualFold(raw, "UTC") {
+		return time.UTC, nil
+	}
+
+	if raw[0] == '+' || raw[0] == '-' {
+		digits := strings.ReplaceAll(raw[1:], ":", "")
+		if len(digits) == 2 {
+			digits += "00"
+		}
+
+		hours, hErr := strconv.Atoi(digits[:min(2, len(digits))])
+		minutes, mErr := strconv.Atoi(digits[min(2, len(digits)):])
+		if len(digits) != 4 || hErr != nil || mErr != nil {
+			return nil, fmt.Errorf("invalid timezone %q", raw)
+		}
+
+		offset := hours*3600 + minutes*60
+		if raw[0] == '-' {
+			offset = -offset
+		}
+		return time.FixedZone(raw, offset), nil
+	}
+
+	loc, err := time.LoadLocation(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %q", raw)
+	}
+	return loc, nil
+}
+
+// parseSourceLocation parses the line and column of locations such as
+// Text:12:4. Locations which are not in the text are ignored.
+func parseSourceLocation(raw string) (line int, column int) {
+	parts := strings.Split(strings.TrimSpace(raw), ":")
+	if len(parts) < 2 || parts[0] != "Text" {
+		return 0, 0
+	}
+
+	line, _ = strconv.Atoi(parts[1])
+	if len(parts) > 2 {
+		column, _ = strconv.Atoi(parts[2])
+	}
+	return line, column
+}
+
+func (imp *importer) newEntry(ev *event) logger.LogEntry {
+	return logger.LogEntry{
+		ParticipantId:   ev.subjectId,
+		ExecutedCommand: ev.eventType,
+		CreatedAt:       &logger.NullTime{Time: ev.createdAt, Valid: true},
+	}
+}
+
+// compileEntry converts the compilation into a log entry. The error
+// details are taken from the errorEvent if it is not nil.
+func (imp *importer) compileEntry(ev *event, errorEvent *event) logger.LogEntry {
+	entry := imp.newEntry(ev)
+	if strings.EqualFold(imp.main.get(ev.row, CompileResultColumn), ErrorResult) || errorEvent != nil {
+		entry.ErrorCode = 1
+	}
+
+	// some datasets record the error on the compilation itself
+	if errorEvent == nil {
+		errorEvent = ev
+	}
+
+	entry.ErrorType = strings.TrimSpace(imp.main.get(errorEvent.row, CompileMessageTypeColumn))
+	entry.ErrorMessage = imp.main.get(errorEvent.row, CompileMessageDataColumn)
+	entry.ErrorLine, entry.ErrorColumn = parseSourceLocation(imp.main.get(errorEvent.row, SourceLocationColumn))
+	entry.GeneratedOutput = entry.ErrorMessage
+	return entry
+}
+
+// runEntry converts the run of the program into a log entry
+func (imp *importer) runEntry(ev *event) logger.LogEntry {
+	entry := imp.newEntry(ev)
+	entry.GeneratedOutput = imp.main.get(ev.row, ProgramOutputColumn)
+
+	switch result := imp.main.get(ev.row, ExecutionResultColumn); {
+	case strings.EqualFold(result, ErrorResult):
+		entry.ErrorCode = 1
+		entry.ErrorType = "RuntimeError"
+	case strings.EqualFold(result, TimeoutResult):
+		entry.ErrorCode = 1
+		entry.ErrorType = TimeoutResult
+	}
+
+	if errorType := strings.TrimSpace(imp.main.get(ev.row, CompileMessageTypeColumn)); len(errorType) != 0 {
+		entry.ErrorType = errorType
+	}
+
+	if errorOutput := imp.main.get(ev.row, ProgramErrorOutputColumn); len(errorOutput) != 0 {
+		entry.ErrorMessage = errorOutput
+		entry.GeneratedOutput += errorOutput
+	}
+
+	entry.ErrorLine, entry.ErrorColumn = parseSourceLocation(imp.main.get(ev.row, SourceLocationColumn))
+	return entry
+}
+
+// codeStateFiles returns the files of the code state of the event
+func (imp *importer) codeStateFiles(ev *event) ([]codeFile, error) {
+	codeStateId := strings.TrimSpace(imp.main.get(ev.row, CodeStateIdColumn))
+	if len(codeStateId) == 0 {
+		return nil, nil
+	}
+
+	section := filepath.ToSlash(strings.TrimSpace(imp.main.get(ev.row, CodeStateSectionColumn)))
+
+	if imp.codeStates != nil {
+		i, ok := imp.codeByState[codeStateId]
+		if !ok {
+			return nil, fmt.Errorf("missing code state %s", codeStateId)
+		}
+
+		path := section
+		if len(path) == 0 {
+			path = imp.opts.DefaultFilePath
+		}
+		return []codeFile{{path: path, content: []byte(imp.codeStates.get(imp.codeStates.rows[i], CodeColumn))}}, nil
+	}
+
+	stateDir := filepath.Join(imp.dir, CodeStatesDir, codeStateId)
+	if len(section) != 0 {
+		content, err := os.ReadFile(filepath.Join(stateDir, filepath.FromSlash(section)))
+		if err != nil {
+			return nil, err
+		}
+		return []codeFile{{path: section, content: content}}, nil
+	}
+
+	// code states without a section include all of their files
+	files := []codeFile{}
+	err := filepath.WalkDir(stateDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(stateDir, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, codeFile{path: filepath.ToSlash(rel), content: content})
+		return nil
+	})
+	return files, err
+}
+
+// writeCodeState stores the files of the code state of the event as new
+// versions of the files if they were changed and points the entry to the
+// version of its file
+func (imp *importer) writeCodeState(ev *event, entry *logger.LogEntry) error {
+	files, err := imp.codeStateFiles(ev)
+	if err != nil {
+		return err
+	}
+
+	for i, file := range files {
+		key := fileKey{participantId: ev.subjectId, filePath: file.path}
+		history := imp.files[key]
+		if history == nil {
+			// continue the versions of files which are already in the logs
+			latest, err := imp.lg.LatestVersionFromFileForPID(ev.subjectId, file.path)
+			if err != nil {
+				return err
+			}
+			history = &fileHistory{version: latest}
+			imp.files[key] = history
+		}
+
+		hash := logger.HashContent(file.content)
+		if history.hash != hash {
+			history.version++
+			history.hash = hash
+
+			if err := imp.lg.WriteFileVersion(logger.FileVersion{
+				ParticipantId: ev.subjectId,
+				FilePath:      file.path,
+				FileVersion:   history.version,
+				CreatedAt:     &logger.NullTime{Time: ev.createdAt, Valid: true},
+			}, file.content); err != nil {
+				return err
+			}
+			imp.stats.Files++
+		}
+
+		// the errors of the compilation are attributed to the first file
+		if i == 0 {
+			entry.FilePath = file.path
+			entry.FileVersion = history.version
+		}
+	}
+	return nil
+}
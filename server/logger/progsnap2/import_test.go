@@ -0,0 +1,186 @@
+package progsnap2_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nedpals/bugbuddy/server/logger"
+	"github.com/nedpals/bugbuddy/server/logger/analyzer"
+	errorquotient "github.com/nedpals/bugbuddy/server/logger/analyzer/error_quotient"
+	red "github.com/nedpals/bugbuddy/server/logger/analyzer/repeated_error_density"
+	timetosolve "github.com/nedpals/bugbuddy/server/logger/analyzer/time_to_solve"
+	"github.com/nedpals/bugbuddy/server/logger/progsnap2"
+)
+
+func importDataset(t *testing.T, dir string, opts progsnap2.ImportOptions) (*logger.Logger, progsnap2.ImportStats) {
+	t.Helper()
+
+	lg, err := logger.NewLoggerFromPath(filepath.Join(t.TempDir(), "study.db"))
+	if err != nil {
+		t.Fatal(err)
+	} else if err := lg.SetConsent(logger.CollectionFull, ""); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { lg.Close() })
+
+	stats, err := progsnap2.Import(lg, dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return lg, stats
+}
+
+func TestImport(t *testing.T) {
+	lg, stats := importDataset(t, filepath.Join("testdata", "blackbox"), progsnap2.ImportOptions{})
+
+	expected := progsnap2.ImportStats{Events: 15, Entries: 7, Files: 5, Participants: 2, Skipped: 3}
+	if stats != expected {
+		t.Fatalf("expected %+v, got %+v", expected, stats)
+	}
+
+	iter, err := lg.EntriesByParticipantId("student-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := iter.List()
+	if err != nil {
+		t.Fatal(err)
+	} else if len(entries) != 4 {
+		t.Fatalf("expected 4 entries of student-a, got %d", len(entries))
+	}
+
+	// the first error of the compilation describes the entry
+	first := entries[0]
+	if first.ExecutedCommand != progsnap2.CompileEvent || first.ErrorCode != 1 || first.ErrorType != "SyntaxError" {
+		t.Errorf("unexpected compilation %+v", first)
+	} else if first.ErrorMessage != "';' expected" || first.ErrorLine != 3 || first.ErrorColumn != 20 {
+		t.Errorf("unexpected error details %+v", first)
+	} else if first.FilePath != "Main.java" || first.FileVersion != 1 {
+		t.Errorf("unexpected file %s (version %d)", first.FilePath, first.FileVersion)
+	}
+
+	expectedTime := time.Date(2019, 2, 13, 2, 1, 0, 0, time.UTC)
+	if !first.CreatedAt.Time.Equal(expectedTime) {
+		t.Errorf("expected the entry to be created at %s, got %s", expectedTime, first.CreatedAt.Time)
+	}
+
+	// the compilation and the run of the same code state share a version
+	if entries[2].ErrorCode != 0 || entries[2].FileVersion != 3 || entries[3].FileVersion != 3 {
+		t.Errorf("unexpected entries %+v", entries[2:])
+	}
+
+	content, err := lg.OpenVersionedFileFromPID("student-a", "Main.java", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedContent, _ := os.ReadFile(filepath.Join("testdata", "blackbox", "CodeStates", "2", "Main.java"))
+	if string(content) != string(expectedContent) {
+		t.Errorf("unexpected content of version 2 %q", content)
+	}
+
+	if version, err := lg.LatestVersionFromFileForPID("student-b", "Main.java"); err != nil || version != 2 {
+		t.Errorf("expected 2 versions of the file of student-b, got %d (%v)", version, err)
+	}
+}
+
+func TestImport_Analyzers(t *testing.T) {
+	lg, _ := importDataset(t, filepath.Join("testdata", "blackbox"), progsnap2.ImportOptions{})
+
+	kv := analyzer.NewDefaultKV()
+	for _, an := range []analyzer.LoggerAnalyzer{
+		analyzer.New[*errorquotient.Analyzer](),
+		analyzer.New[*red.Analyzer](),
+		analyzer.New[*timetosolve.Analyzer](),
+	} {
+		if err := an.Analyze(kv, analyzer.LoadFromExistingLogger(lg)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if tts := kv[timetosolve.KEY]["student-b"]["Main.java"]; tts != 20*time.Minute {
+		t.Errorf("expected a TTS of 20m for student-b, got %v", tts)
+	}
+
+	if density := kv[red.KEY]["student-a"]["Main.java"]; density != 0.5 {
+		t.Errorf("expected a RED of 0.5 for student-a, got %v", density)
+	}
+
+	eq, ok := kv[errorquotient.KEY]["student-a"]["Main.java"].(float64)
+	if !ok || eq <= 0 || eq > 1 {
+		t.Errorf("expected an error quotient for student-a, got %v", kv[errorquotient.KEY]["student-a"])
+	}
+}
+
+func TestImport_CodeStatesTable(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, progsnap2.CodeStatesDir), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	mainTable := `EventType,EventID,SubjectID,CodeStateID,ClientTimestamp,ClientTimezone,Compile.Result,CompileMessageType,CompileMessageData,SourceLocation,ExecutionResult,ProgramErrorOutput
+Run.Program,2,s1,b,2020-03-01 09:30:00,-05:00,,,,Text:1,Error,ZeroDivisionError: division by zero
+Compile,1,s1,a,2020-03-01 09:00:00,-05:00,Error,SyntaxError,invalid syntax,Text:1:7,,
+Run.Program,3,s1,c,2020-03-01T15:00:00Z,,,,,,Success,
+`
+	codeStates := "CodeStateID,Code\na,print(1\nb,print(1/0)\nc,print(1)\n"
+
+	if err := os.WriteFile(filepath.Join(dir, progsnap2.MainTableFile), []byte(mainTable), 0644); err != nil {
+		t.Fatal(err)
+	} else if err := os.WriteFile(filepath.Join(dir, progsnap2.CodeStatesDir, progsnap2.CodeStatesFile), []byte(codeStates), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	lg, stats := importDataset(t, dir, progsnap2.ImportOptions{DefaultFilePath: "main.py"})
+	if stats.Entries != 3 || stats.Files != 3 {
+		t.Fatalf("expected 3 entries and 3 files, got %+v", stats)
+	}
+
+	iter, err := lg.AllEntries()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := iter.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the events are ordered by their timestamps
+	if entries[0].ErrorType != "SyntaxError" || entries[0].FileVersion != 1 || entries[0].FilePath != "main.py" {
+		t.Errorf("unexpected compilation %+v", entries[0])
+	} else if !entries[0].CreatedAt.Time.Equal(time.Date(2020, 3, 1, 14, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected time of compilation %s", entries[0].CreatedAt.Time)
+	}
+
+	if entries[1].ErrorCode != 1 || entries[1].ErrorType != "RuntimeError" || entries[1].ErrorLine != 1 || entries[1].FileVersion != 2 {
+		t.Errorf("unexpected run %+v", entries[1])
+	} else if entries[1].ErrorMessage != "ZeroDivisionError: division by zero" {
+		t.Errorf("unexpected error message %q", entries[1].ErrorMessage)
+	}
+
+	if entries[2].ErrorCode != 0 || entries[2].FileVersion != 3 {
+		t.Errorf("unexpected run %+v", entries[2])
+	}
+
+	if content, err := lg.OpenVersionedFileFromPID("s1", "main.py", 2); err != nil || string(content) != "print(1/0)" {
+		t.Errorf("unexpected content %q (%v)", content, err)
+	}
+}
+
+func TestImport_MissingColumns(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, progsnap2.MainTableFile), []byte("EventType,EventID\nCompile,1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	lg := logger.NewMemoryLoggerPanic()
+	defer lg.Close()
+
+	if _, err := progsnap2.Import(lg, dir, progsnap2.ImportOptions{}); err == nil {
+		t.Fatal("expected an error for the missing SubjectID column")
+	}
+}
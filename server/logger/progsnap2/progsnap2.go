@@ -0,0 +1,144 @@
+// Package progsnap2 converts between the logs of BugBuddy and datasets in
+// the ProgSnap2 format (https://cssplice.github.io/progsnap2/), which is
+// used by datasets such as Blackbox and CodeWorkout.
+package progsnap2
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Files of a ProgSnap2 dataset
+const (
+	MainTableFile       = "MainTable.csv"
+	DatasetMetadataFile = "DatasetMetadata.csv"
+	CodeStatesDir       = "CodeStates"
+	CodeStatesFile      = "CodeStates.csv"
+)
+
+// Columns of the main table
+const (
+	EventTypeColumn          = "EventType"
+	EventIdColumn            = "EventID"
+	ParentEventIdColumn      = "ParentEventID"
+	SubjectIdColumn          = "SubjectID"
+	OrderColumn              = "Order"
+	ToolInstancesColumn      = "ToolInstances"
+	CodeStateIdColumn        = "CodeStateID"
+	CodeStateSectionColumn   = "CodeStateSection"
+	ServerTimestampColumn    = "ServerTimestamp"
+	ServerTimezoneColumn     = "ServerTimezone"
+	ClientTimestampColumn    = "ClientTimestamp"
+	ClientTimezoneColumn     = "ClientTimezone"
+	CompileResultColumn      = "Compile.Result"
+	CompileMessageTypeColumn = "CompileMessageType"
+	CompileMessageDataColumn = "CompileMessageData"
+	SourceLocationColumn     = "SourceLocation"
+	ExecutionResultColumn    = "ExecutionResult"
+	ProgramOutputColumn      = "ProgramOutput"
+	ProgramErrorOutputColumn = "ProgramErrorOutput"
+	CodeColumn               = "Code"
+)
+
+// Event types of the main table which are mapped into log entries
+const (
+	CompileEvent      = "Compile"
+	CompileErrorEvent = "Compile.Error"
+	RunProgramEvent   = "Run.Program"
+)
+
+// Values of the result columns
+const (
+	SuccessResult = "Success"
+	ErrorResult   = "Error"
+	TimeoutResult = "Timeout"
+)
+
+// CodeStateRepresentationProperty is the property of the dataset metadata
+// which tells how the code states are stored
+const CodeStateRepresentationProperty = "CodeStateRepresentation"
+
+// Code state representations
+const (
+	TableRepresentation     = "Table"
+	DirectoryRepresentation = "Directory"
+	GitRepresentation       = "Git"
+)
+
+// table is a CSV file whose columns are looked up by their header
+type table struct {
+	columns map[string]int
+	rows    [][]string
+}
+
+func readTable(path string) (*table, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	// the columns are optional in the rows of some datasets
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("%s: missing header", path)
+	} else if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	t := &table{columns: map[string]int{}}
+	for i, column := range header {
+		// files written by Excel may start with a byte order mark
+		column = strings.TrimPrefix(strings.TrimSpace(column), "\ufeff")
+		t.columns[column] = i
+	}
+
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		t.rows = append(t.rows, row)
+	}
+	return t, nil
+}
+
+func (t *table) has(column string) bool {
+	_, ok := t.columns[column]
+	return ok
+}
+
+// get returns the value of the column in the row. Missing columns are empty.
+func (t *table) get(row []string, column string) string {
+	i, ok := t.columns[column]
+	if !ok || i >= len(row) {
+		return ""
+	}
+	return row[i]
+}
+
+// readMetadata reads the properties of the dataset metadata. A missing
+// metadata file has no properties.
+func readMetadata(path string) (map[string]string, error) {
+	metadata := map[string]string{}
+
+	t, err := readTable(path)
+	if os.IsNotExist(err) {
+		return metadata, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	for _, row := range t.rows {
+		metadata[t.get(row, "Property")] = t.get(row, "Value")
+	}
+	return metadata, nil
+}
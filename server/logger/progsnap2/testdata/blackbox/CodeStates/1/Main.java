@@ -0,0 +1,6 @@
+public class Main {
+  public static void main(String[] args) {
+    int x = 1
+    print(x;
+  }
+}
@@ -0,0 +1,103 @@
+package logger
+
+import "time"
+
+// LogQuery builds a filtered and paginated query over the log entries.
+// Entries are ordered by their creation time.
+type LogQuery struct {
+	log            *Logger
+	participantId  string
+	filePathPrefix string
+	errorType      string
+	exitCode       *int
+	after          time.Time
+	before         time.Time
+	limit          int
+	cursor         int
+	descending     bool
+}
+
+// Query creates a query over the log entries of all participants. The
+// time range defaults to the After and Before fields of the logger.
+func (log *Logger) Query() *LogQuery {
+	return &LogQuery{
+		log:    log,
+		after:  log.After,
+		before: log.Before,
+	}
+}
+
+// Participant limits the entries to the participant
+func (q *LogQuery) Participant(participantId string) *LogQuery {
+	q.participantId = participantId
+	return q
+}
+
+// FilePathPrefix limits the entries to the files under the path prefix
+func (q *LogQuery) FilePathPrefix(prefix string) *LogQuery {
+	q.filePathPrefix = prefix
+	return q
+}
+
+// ErrorType limits the entries to the error type
+func (q *LogQuery) ErrorType(errorType string) *LogQuery {
+	q.errorType = errorType
+	return q
+}
+
+// ExitCode limits the entries to the runs which exited with the code
+func (q *LogQuery) ExitCode(code int) *LogQuery {
+	q.exitCode = &code
+	return q
+}
+
+// After limits the entries to the ones created on or after the time
+func (q *LogQuery) After(t time.Time) *LogQuery {
+	q.after = t
+	return q
+}
+
+// Before limits the entries to the ones created before the time
+func (q *LogQuery) Before(t time.Time) *LogQuery {
+	q.before = t
+	return q
+}
+
+// Limit sets the maximum number of entries to be returned. Zero
+// or negative values return all of the entries.
+func (q *LogQuery) Limit(limit int) *LogQuery {
+	q.limit = limit
+	return q
+}
+
+// Cursor continues the query after the entry with the id, which
+// is usually the last entry of the previous page
+func (q *LogQuery) Cursor(id int) *LogQuery {
+	q.cursor = id
+	return q
+}
+
+// Descending returns the latest entries first
+func (q *LogQuery) Descending() *LogQuery {
+	q.descending = true
+	return q
+}
+
+func (q *LogQuery) filter() EntryFilter {
+	return EntryFilter{
+		ParticipantId:  q.participantId,
+		FilePathPrefix: q.filePathPrefix,
+		ErrorType:      q.errorType,
+		ExitCode:       q.exitCode,
+		After:          q.after,
+		Before:         q.before,
+		Cursor:         q.cursor,
+		Limit:          q.limit,
+		Descending:     q.descending,
+	}
+}
+
+// Entries runs the query and returns an iterator over the matching entries
+func (q *LogQuery) Entries() (*LogEntryIterator, error) {
+	return q.log.entries(q.filter())
+}
@@ -0,0 +1,123 @@
+package logger_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nedpals/bugbuddy/server/logger"
+)
+
+func newQueryFixture(t *testing.T) (*logger.Logger, time.Time) {
+	t.Helper()
+
+	log := logger.NewMemoryLoggerPanic()
+	start := time.Date(2023, 9, 1, 8, 0, 0, 0, time.UTC)
+
+	entries := []logger.LogEntry{
+		{ParticipantId: "a", ErrorCode: 1, ErrorType: "NameError", FilePath: "/hw1/main.py"},
+		{ParticipantId: "a", ErrorCode: 0, FilePath: "/hw1/main.py"},
+		{ParticipantId: "a", ErrorCode: 1, ErrorType: "TypeError", FilePath: "/hw2/main.py"},
+		{ParticipantId: "b", ErrorCode: 1, ErrorType: "NameError", FilePath: "/HW1/main.py"},
+		{ParticipantId: "b", ErrorCode: 2, ErrorType: "SyntaxError", FilePath: "/hw_1/main.py"},
+	}
+
+	for i, entry := range entries {
+		entry.CreatedAt = &logger.NullTime{Time: start.Add(time.Duration(i) * time.Hour), Valid: true}
+		if err := log.Log(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return log, start
+}
+
+func queryIds(t *testing.T, query *logger.LogQuery) []int {
+	t.Helper()
+
+	iter, err := query.Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := iter.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids := []int{}
+	for _, entry := range entries {
+		ids = append(ids, entry.Id)
+	}
+	return ids
+}
+
+func assertIds(t *testing.T, name string, got []int, expected ...int) {
+	t.Helper()
+
+	if len(got) != len(expected) {
+		t.Errorf("%s: expected ids %v, got %v", name, expected, got)
+		return
+	}
+
+	for i := range got {
+		if got[i] != expected[i] {
+			t.Errorf("%s: expected ids %v, got %v", name, expected, got)
+			return
+		}
+	}
+}
+
+func TestLogQuery_Filters(t *testing.T) {
+	log, start := newQueryFixture(t)
+	defer log.Close()
+
+	assertIds(t, "all", queryIds(t, log.Query()), 1, 2, 3, 4, 5)
+	assertIds(t, "participant", queryIds(t, log.Query().Participant("b")), 4, 5)
+	assertIds(t, "error type", queryIds(t, log.Query().ErrorType("NameError")), 1, 4)
+	assertIds(t, "exit code", queryIds(t, log.Query().ExitCode(0)), 2)
+	assertIds(t, "time range", queryIds(t, log.Query().After(start.Add(time.Hour)).Before(start.Add(3*time.Hour))), 2, 3)
+	assertIds(t, "combined", queryIds(t, log.Query().Participant("a").ExitCode(1).FilePathPrefix("/hw1/")), 1)
+
+	// the prefix is matched literally and case-sensitively
+	assertIds(t, "file path prefix", queryIds(t, log.Query().FilePathPrefix("/hw1")), 1, 2)
+	assertIds(t, "file path prefix with wildcard", queryIds(t, log.Query().FilePathPrefix("/hw_")), 5)
+}
+
+func TestLogQuery_Pagination(t *testing.T) {
+	log, _ := newQueryFixture(t)
+	defer log.Close()
+
+	assertIds(t, "first page", queryIds(t, log.Query().Limit(2)), 1, 2)
+	assertIds(t, "second page", queryIds(t, log.Query().Limit(2).Cursor(2)), 3, 4)
+	assertIds(t, "last page", queryIds(t, log.Query().Limit(2).Cursor(4)), 5)
+
+	assertIds(t, "descending", queryIds(t, log.Query().Descending().Limit(2)), 5, 4)
+	assertIds(t, "descending second page", queryIds(t, log.Query().Descending().Limit(2).Cursor(4)), 3, 2)
+}
+
+func TestLogQuery_PaginationOffsets(t *testing.T) {
+	log := logger.NewMemoryLoggerPanic()
+	defer log.Close()
+
+	// the timestamps are stored as text with their offsets, so that their
+	// text is not in the same order as their times
+	manila := time.FixedZone("PHT", 8*60*60)
+	start := time.Date(2023, 9, 1, 8, 0, 0, 0, time.UTC)
+	for _, createdAt := range []time.Time{
+		start.In(manila),
+		start.Add(time.Hour),
+		start.Add(2 * time.Hour).In(manila),
+		start.Add(3 * time.Hour),
+	} {
+		entry := logger.LogEntry{ErrorCode: 1, CreatedAt: &logger.NullTime{Time: createdAt, Valid: true}}
+		if err := log.Log(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	assertIds(t, "all", queryIds(t, log.Query()), 1, 2, 3, 4)
+	assertIds(t, "first page", queryIds(t, log.Query().Limit(2)), 1, 2)
+	assertIds(t, "second page", queryIds(t, log.Query().Limit(2).Cursor(2)), 3, 4)
+	assertIds(t, "descending second page", queryIds(t, log.Query().Descending().Limit(2).Cursor(3)), 2, 1)
+	assertIds(t, "time range", queryIds(t, log.Query().After(start.Add(time.Hour)).Limit(2).Cursor(2)), 3, 4)
+}
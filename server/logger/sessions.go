@@ -0,0 +1,161 @@
+package logger
+
+import (
+	"database/sql"
+	"time"
+)
+
+const (
+	// SessionEndShutdown is the end reason of sessions closed by the editor
+	SessionEndShutdown = "shutdown"
+	// SessionEndIdle is the end reason of sessions closed due to inactivity
+	SessionEndIdle = "idle"
+	// SessionEndSwitch is the end reason of sessions closed because the
+	// editor switched to another participant
+	SessionEndSwitch = "switch"
+)
+
+// Session is a period where the participant worked on the editor
+type Session struct {
+	Id            int       `db:"id"`
+	ParticipantId string    `db:"participant_id"`
+	Editor        string    `db:"editor"`
+	StartedAt     *NullTime `db:"started_at"`
+	EndedAt       *NullTime `db:"ended_at"`
+	EndReason     string    `db:"end_reason"`
+	SourceId      *int      `db:"source_id"`
+	// Files are the paths of the files opened during the session
+	Files []string `db:"-"`
+}
+
+// IsOpen checks if the session has not ended yet
+func (s Session) IsOpen() bool {
+	return s.EndedAt == nil || !s.EndedAt.Valid
+}
+
+// StartSession records a new session of the participant and returns its id.
+// No session is recorded if the collection is turned off.
+func (log *Logger) StartSession(editor string) (int, error) {
+	return log.StartSessionForPID(log.ParticipantId(), editor)
+}
+
+// StartSessionForPID records a new session of the specified participant
+func (log *Logger) StartSessionForPID(pid string, editor string) (int, error) {
+	if log.CollectionLevel() == CollectionOff {
+		return 0, nil
+	}
+
+	return log.storage.StartSession(Session{
+		ParticipantId: pid,
+		Editor:        editor,
+		StartedAt:     &NullTime{Time: time.Now(), Valid: true},
+	})
+}
+
+// EndSession marks the session as ended at the specified time
+func (log *Logger) EndSession(id int, endedAt time.Time, reason string) error {
+	return log.storage.EndSession(id, endedAt, reason)
+}
+
+// AddSessionFile records the file as opened during the session
+func (log *Logger) AddSessionFile(id int, filePath string) error {
+	return log.storage.AddSessionFile(id, filePath, time.Now())
+}
+
+// Session returns the session with the id along with its opened files
+func (log *Logger) Session(id int) (Session, error) {
+	return log.storage.Session(id)
+}
+
+// SessionEntries are the log entries recorded during a session
+type SessionEntries struct {
+	// Session is nil for the entries recorded outside of a session
+	Session *Session
+	Entries []LogEntry
+}
+
+// SessionIterator iterates the log entries grouped by their session
+type SessionIterator struct {
+	log     *Logger
+	entries *LogEntryIterator
+	pending *LogEntry
+	current SessionEntries
+	err     error
+}
+
+// SessionEntries returns an iterator over the log entries of all
+// participants grouped by session. Sessions are ordered by participant
+// and entries without a session come first.
+func (log *Logger) SessionEntries() (*SessionIterator, error) {
+	entries, err := log.entries(EntryFilter{
+		After:     log.After,
+		Before:    log.Before,
+		BySession: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &SessionIterator{log: log, entries: entries}, nil
+}
+
+func sameSession(a, b LogEntry) bool {
+	if a.ParticipantId != b.ParticipantId {
+		return false
+	} else if a.SessionId == nil || b.SessionId == nil {
+		return a.SessionId == nil && b.SessionId == nil
+	}
+	return *a.SessionId == *b.SessionId
+}
+
+func (it *SessionIterator) Next() bool {
+	it.current = SessionEntries{}
+	if it.err != nil {
+		return false
+	}
+
+	if it.pending == nil {
+		if !it.entries.Next() {
+			return false
+		}
+
+		entry, err := it.entries.Value()
+		if err != nil {
+			it.err = err
+			return true
+		}
+		it.pending = &entry
+	}
+
+	first := *it.pending
+	it.pending = nil
+	it.current.Entries = []LogEntry{first}
+
+	for it.entries.Next() {
+		entry, err := it.entries.Value()
+		if err != nil {
+			it.err = err
+			break
+		}
+
+		if !sameSession(first, entry) {
+			it.pending = &entry
+			break
+		}
+		it.current.Entries = append(it.current.Entries, entry)
+	}
+
+	if first.SessionId != nil {
+		session, err := it.log.Session(*first.SessionId)
+		if err == nil {
+			it.current.Session = &session
+		} else if err != sql.ErrNoRows {
+			it.err = err
+		}
+	}
+
+	return true
+}
+
+func (it *SessionIterator) Value() (SessionEntries, error) {
+	return it.current, it.err
+}
@@ -0,0 +1,133 @@
+package logger_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nedpals/bugbuddy/server/logger"
+)
+
+func TestLogger_Sessions(t *testing.T) {
+	log := logger.NewMemoryLoggerPanic()
+	defer log.Close()
+
+	sessionId, err := log.StartSession("vscode 1.85")
+	if err != nil {
+		t.Fatal(err)
+	} else if sessionId == 0 {
+		t.Fatal("expected session to be recorded")
+	}
+
+	for _, filePath := range []string{"/hw1/main.py", "/hw1/utils.py", "/hw1/main.py"} {
+		if err := log.AddSessionFile(sessionId, filePath); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	session, err := log.Session(sessionId)
+	if err != nil {
+		t.Fatal(err)
+	} else if session.Editor != "vscode 1.85" || !session.IsOpen() || session.ParticipantId != log.ParticipantId() {
+		t.Errorf("unexpected session %+v", session)
+	} else if len(session.Files) != 2 {
+		t.Errorf("expected 2 opened files, got %v", session.Files)
+	}
+
+	endedAt := time.Now()
+	if err := log.EndSession(sessionId, endedAt, logger.SessionEndIdle); err != nil {
+		t.Fatal(err)
+	}
+
+	// ending an ended session keeps the original end
+	if err := log.EndSession(sessionId, endedAt.Add(time.Hour), logger.SessionEndShutdown); err != nil {
+		t.Fatal(err)
+	}
+
+	session, err = log.Session(sessionId)
+	if err != nil {
+		t.Fatal(err)
+	} else if session.IsOpen() || session.EndReason != logger.SessionEndIdle || !session.EndedAt.Time.Equal(endedAt) {
+		t.Errorf("expected session to be ended due to inactivity, got %+v", session)
+	}
+}
+
+func TestLogger_StartSession_CollectionOff(t *testing.T) {
+	log := logger.NewMemoryLoggerPanic()
+	defer log.Close()
+
+	if err := log.SetConsent(logger.CollectionOff, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if sessionId, err := log.StartSession("vscode"); err != nil {
+		t.Fatal(err)
+	} else if sessionId != 0 {
+		t.Errorf("expected no session to be recorded, got %d", sessionId)
+	}
+}
+
+func TestLogger_SessionEntries(t *testing.T) {
+	log := logger.NewMemoryLoggerPanic()
+	defer log.Close()
+
+	first, err := log.StartSession("vscode")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := log.StartSession("vim")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2023, 9, 1, 8, 0, 0, 0, time.UTC)
+	sessionIds := []*int{&first, nil, &second, &first}
+	for i, sessionId := range sessionIds {
+		if err := log.Log(logger.LogEntry{
+			ErrorCode: 1,
+			FilePath:  "/hw1/main.py",
+			SessionId: sessionId,
+			CreatedAt: &logger.NullTime{Time: start.Add(time.Duration(i) * time.Minute), Valid: true},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	iter, err := log.SessionEntries()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []struct {
+		sessionId int
+		entries   int
+	}{
+		{sessionId: 0, entries: 1},
+		{sessionId: first, entries: 2},
+		{sessionId: second, entries: 1},
+	}
+
+	i := 0
+	for iter.Next() {
+		group, err := iter.Value()
+		if err != nil {
+			t.Fatal(err)
+		} else if i >= len(expected) {
+			t.Fatalf("expected %d sessions, got more", len(expected))
+		}
+
+		sessionId := 0
+		if group.Session != nil {
+			sessionId = group.Session.Id
+		}
+
+		if sessionId != expected[i].sessionId || len(group.Entries) != expected[i].entries {
+			t.Errorf("expected session %d with %d entries, got session %d with %d entries", expected[i].sessionId, expected[i].entries, sessionId, len(group.Entries))
+		}
+		i++
+	}
+
+	if i != len(expected) {
+		t.Errorf("expected %d sessions, got %d", len(expected), i)
+	}
+}
@@ -0,0 +1,535 @@
+package logger
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+)
+
+// sqliteStorage stores the logs in a SQLite database. Features such as
+// merging and encryption are built on top of it.
+type sqliteStorage struct {
+	db *sqlx.DB
+	// cipher encrypts the stored file contents
+	cipher *fieldCipher
+}
+
+// NewSQLiteStorage opens the SQLite database in the path and
+// upgrades it to the latest schema
+func NewSQLiteStorage(path string) (Storage, error) {
+	return openSQLiteStorage(path)
+}
+
+func openSQLiteStorage(path string) (*sqliteStorage, error) {
+	// the daemon writes to the database from several goroutines, such as
+	// the timers of the snapshots, so wait for the other writers instead of
+	// failing with SQLITE_BUSY
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
+	}
+
+	db, err := sqlx.Open("sqlite", path+separator+"_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, err
+	}
+
+	// initialize or upgrade the database
+	if _, _, err := migrate(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &sqliteStorage{db: db}, nil
+}
+
+func (s *sqliteStorage) GetSetting(name string) (string, error) {
+	var val string
+	err := s.db.QueryRow("SELECT value FROM settings WHERE name = ?", name).Scan(&val)
+	return val, err
+}
+
+func (s *sqliteStorage) SetSettings(settings map[string]string) error {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	for name, value := range settings {
+		if _, err := tx.Exec("INSERT OR REPLACE INTO settings (name, value) VALUES (?, ?)", name, value); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqliteStorage) DeleteSetting(name string) error {
+	_, err := s.db.Exec("DELETE FROM settings WHERE name = ?", name)
+	return err
+}
+
+func (s *sqliteStorage) AddParticipant(participant Participant) error {
+	_, err := s.db.Exec(
+		"INSERT OR IGNORE INTO participants (id, name, created_at) VALUES (?, ?, ?)",
+		participant.Id,
+		participant.Name,
+		participant.CreatedAt,
+	)
+	return err
+}
+
+func (s *sqliteStorage) Participants() ([]Participant, error) {
+	participants := []Participant{}
+	err := s.db.Select(&participants, "SELECT id, name, created_at FROM participants ORDER BY julianday(created_at), rowid")
+	return participants, err
+}
+
+func (s *sqliteStorage) InsertEntry(entry LogEntry) error {
+	return insertLogEntry(s.db, entry)
+}
+
+// whereCreatedBetween compares the dates as julian days since the
+// rows may have been stored with different timezone offsets
+func whereCreatedBetween(query squirrel.SelectBuilder, after time.Time, before time.Time) squirrel.SelectBuilder {
+	if !after.IsZero() {
+		query = query.Where("julianday(created_at) >= julianday(?)", after.Format(time.RFC3339Nano))
+	}
+	if !before.IsZero() {
+		query = query.Where("julianday(created_at) < julianday(?)", before.Format(time.RFC3339Nano))
+	}
+	return query
+}
+
+func entriesQuery(filter EntryFilter) squirrel.SelectBuilder {
+	query := squirrel.Select("*").From("logs")
+
+	if len(filter.ParticipantId) != 0 {
+		query = query.Where(squirrel.Eq{"participant_id": filter.ParticipantId})
+	}
+
+	if len(filter.FilePathPrefix) != 0 {
+		// LIKE is case-insensitive and treats % and _ as wildcards
+		query = query.Where(
+			"substr(file_path, 1, ?) = ?",
+			utf8.RuneCountInString(filter.FilePathPrefix),
+			filter.FilePathPrefix,
+		)
+	}
+
+	if len(filter.ErrorType) != 0 {
+		query = query.Where(squirrel.Eq{"error_type": filter.ErrorType})
+	}
+
+	if filter.ExitCode != nil {
+		query = query.Where(squirrel.Eq{"error_code": *filter.ExitCode})
+	}
+
+	query = whereCreatedBetween(query, filter.After, filter.Before)
+
+	// the entries are ordered and paged by the same julian days as the
+	// date filters, since the timestamps may have different offsets
+	columns := []string{"julianday(created_at)", "id"}
+	if filter.BySession {
+		columns = []string{"participant_id", "COALESCE(session_id, 0)", "julianday(created_at)", "id"}
+	} else if filter.ByParticipant {
+		columns = []string{"participant_id", "julianday(created_at)", "id"}
+	}
+
+	if filter.Cursor > 0 {
+		op := ">"
+		if filter.Descending {
+			op = "<"
+		}
+
+		columnList := strings.Join(columns, ", ")
+		query = query.Where(fmt.Sprintf("(%s) %s (SELECT %s FROM logs WHERE id = ?)", columnList, op, columnList), filter.Cursor)
+	}
+
+	for _, column := range columns {
+		if filter.Descending {
+			column += " DESC"
+		}
+		query = query.OrderBy(column)
+	}
+
+	if filter.Limit > 0 {
+		query = query.Limit(uint64(filter.Limit))
+	}
+
+	return query
+}
+
+func (s *sqliteStorage) Entries(filter EntryFilter) (EntryCursor, error) {
+	sql, args, err := entriesQuery(filter).ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Queryx(sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	return &rowsEntryCursor{rows: rows}, nil
+}
+
+// rowsEntryCursor is an EntryCursor over the rows of the logs table
+type rowsEntryCursor struct {
+	rows *sqlx.Rows
+}
+
+func (c *rowsEntryCursor) Next() bool {
+	return c.rows.Next()
+}
+
+func (c *rowsEntryCursor) Scan(entry *LogEntry) error {
+	return c.rows.StructScan(entry)
+}
+
+func (c *rowsEntryCursor) Close() error {
+	return c.rows.Close()
+}
+
+func (s *sqliteStorage) WriteFile(file FileVersion, content []byte) error {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	createdAt := NullTime{Time: time.Now(), Valid: true}
+	if file.CreatedAt != nil && file.CreatedAt.Valid {
+		createdAt = *file.CreatedAt
+	}
+
+	if err := writeFileVersion(tx, s.cipher, fileVersionRow{
+		ParticipantId: file.ParticipantId,
+		FilePath:      file.FilePath,
+		FileVersion:   file.FileVersion,
+		Content:       content,
+		CreatedAt:     createdAt,
+	}); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// fileVersionRow contains the values of a row to be written into the files table
+type fileVersionRow struct {
+	ParticipantId string
+	FilePath      string
+	FileVersion   int
+	Content       []byte
+	CreatedAt     NullTime
+	SourceId      *int
+}
+
+// writeFileVersion stores the content of the file into the blob store
+// and records it as the specified version of the file
+func writeFileVersion(tx *sqlx.Tx, c *fieldCipher, row fileVersionRow) error {
+	// skip rewriting versions that are already stored with the same content
+	hash := c.hashContent(row.Content)
+	var existingHash sql.NullString
+	err := tx.QueryRow(
+		"SELECT content_hash FROM files WHERE participant_id = ? AND file_path = ? AND file_version = ?",
+		row.ParticipantId,
+		row.FilePath,
+		row.FileVersion,
+	).Scan(&existingHash)
+	if err == nil && existingHash.String == hash {
+		return nil
+	} else if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	// use the previous version of the file as the base of the delta
+	baseHash := ""
+	if deltaStorageEnabled(tx) {
+		var prevHash sql.NullString
+		err := tx.QueryRow(
+			"SELECT content_hash FROM files WHERE participant_id = ? AND file_path = ? AND file_version < ? ORDER BY file_version DESC LIMIT 1",
+			row.ParticipantId,
+			row.FilePath,
+			row.FileVersion,
+		).Scan(&prevHash)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		baseHash = prevHash.String
+	}
+
+	if _, err := storeBlob(tx, c, row.Content, baseHash); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		"INSERT INTO files (participant_id, file_path, file_version, content_hash, created_at, source_id) VALUES (?, ?, ?, ?, ?, ?)",
+		row.ParticipantId,
+		row.FilePath,
+		row.FileVersion,
+		hash,
+		row.CreatedAt,
+		row.SourceId,
+	)
+	return err
+}
+
+func (s *sqliteStorage) ReadFile(participantId string, filePath string, version int) ([]byte, error) {
+	query := squirrel.Select("content", "content_hash").
+		From("files").
+		Where(squirrel.Eq{"participant_id": participantId, "file_path": filePath}).
+		OrderBy("file_version").
+		Limit(1)
+	if version > 0 {
+		query = query.Where(squirrel.Eq{"file_version": version})
+	}
+
+	var content []byte
+	var contentHash sql.NullString
+	if err := query.RunWith(s.db).QueryRow().Scan(&content, &contentHash); err != nil {
+		return nil, err
+	}
+	return fileContent(s.db, s.cipher, content, contentHash)
+}
+
+func (s *sqliteStorage) LatestFileVersion(participantId string, filePath string) (int, error) {
+	var maxVersion *int
+	if err := s.db.QueryRow(
+		"SELECT MAX(file_version) FROM files WHERE participant_id = ? AND file_path = ?",
+		participantId,
+		filePath,
+	).Scan(&maxVersion); err != nil {
+		return -1, err
+	}
+
+	if maxVersion == nil {
+		return 0, nil
+	}
+	return *maxVersion, nil
+}
+
+func (s *sqliteStorage) RenameFile(participantId string, oldPath string, newPath string) error {
+	_, err := s.db.Exec(
+		"UPDATE files SET file_path = ? WHERE participant_id = ? AND file_path = ?",
+		newPath,
+		participantId,
+		oldPath,
+	)
+	return err
+}
+
+func (s *sqliteStorage) DeleteFile(participantId string, filePath string) error {
+	if _, err := s.db.Exec(
+		"DELETE FROM files WHERE participant_id = ? AND file_path = ?",
+		participantId,
+		filePath,
+	); err != nil {
+		return err
+	}
+
+	_, err := pruneBlobs(s.db)
+	return err
+}
+
+func (s *sqliteStorage) FileVersions(filter FileFilter) (FileCursor, error) {
+	query := squirrel.Select("id", "participant_id", "file_path", "file_version", "content", "content_hash", "created_at").
+		From("files").
+		OrderBy("participant_id", "file_path", "file_version")
+	if len(filter.ParticipantId) != 0 {
+		query = query.Where(squirrel.Eq{"participant_id": filter.ParticipantId})
+	}
+
+	sql, args, err := whereCreatedBetween(query, filter.After, filter.Before).ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Queryx(sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	return &rowsFileCursor{storage: s, rows: rows}, nil
+}
+
+// rowsFileCursor is a FileCursor over the rows of the files table
+type rowsFileCursor struct {
+	storage *sqliteStorage
+	rows    *sqlx.Rows
+}
+
+func (c *rowsFileCursor) Next() bool {
+	return c.rows.Next()
+}
+
+func (c *rowsFileCursor) Scan(file *FileVersion) error {
+	return c.rows.Scan(
+		&file.Id,
+		&file.ParticipantId,
+		&file.FilePath,
+		&file.FileVersion,
+		&file.content,
+		&file.ContentHash,
+		&file.CreatedAt,
+	)
+}
+
+func (c *rowsFileCursor) Content(file FileVersion) ([]byte, error) {
+	return fileContent(c.storage.db, c.storage.cipher, file.content, file.ContentHash)
+}
+
+func (c *rowsFileCursor) Close() error {
+	return c.rows.Close()
+}
+
+func (s *sqliteStorage) StartSession(session Session) (int, error) {
+	res, err := s.db.Exec(
+		"INSERT INTO sessions (participant_id, editor, started_at, ended_at, end_reason, source_id) VALUES (?, ?, ?, ?, ?, ?)",
+		session.ParticipantId,
+		session.Editor,
+		session.StartedAt,
+		session.EndedAt,
+		session.EndReason,
+		session.SourceId,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := res.LastInsertId()
+	return int(id), err
+}
+
+func (s *sqliteStorage) EndSession(id int, endedAt time.Time, reason string) error {
+	_, err := s.db.Exec(
+		"UPDATE sessions SET ended_at = ?, end_reason = ? WHERE id = ? AND ended_at IS NULL",
+		NullTime{Time: endedAt, Valid: true},
+		reason,
+		id,
+	)
+	return err
+}
+
+func (s *sqliteStorage) AddSessionFile(id int, filePath string, openedAt time.Time) error {
+	_, err := s.db.Exec(
+		"INSERT OR IGNORE INTO session_files (session_id, file_path, opened_at) VALUES (?, ?, ?)",
+		id,
+		filePath,
+		NullTime{Time: openedAt, Valid: true},
+	)
+	return err
+}
+
+func (s *sqliteStorage) Session(id int) (Session, error) {
+	var session Session
+	if err := s.db.QueryRowx(
+		"SELECT id, participant_id, editor, started_at, ended_at, end_reason, source_id FROM sessions WHERE id = ?",
+		id,
+	).StructScan(&session); err != nil {
+		return session, err
+	}
+
+	session.Files = []string{}
+	if err := s.db.Select(
+		&session.Files,
+		"SELECT file_path FROM session_files WHERE session_id = ? ORDER BY opened_at, file_path",
+		id,
+	); err != nil {
+		return session, err
+	}
+
+	return session, nil
+}
+
+func (s *sqliteStorage) Sessions(participantId string) ([]Session, error) {
+	var ids []int
+	if err := s.db.Select(&ids, "SELECT id FROM sessions WHERE participant_id = ? ORDER BY id", participantId); err != nil {
+		return nil, err
+	}
+
+	sessions := make([]Session, len(ids))
+	for i, id := range ids {
+		session, err := s.Session(id)
+		if err != nil {
+			return nil, err
+		}
+		sessions[i] = session
+	}
+	return sessions, nil
+}
+
+func (s *sqliteStorage) InsertEvent(event Event) error {
+	return insertEvent(s.db, event)
+}
+
+func (s *sqliteStorage) Events(filter EventFilter) (EventCursor, error) {
+	query := whereCreatedBetween(squirrel.Select("*").From("events"), filter.After, filter.Before).
+		OrderBy("participant_id", "julianday(created_at)", "id")
+
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Queryx(sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	return &rowsEventCursor{rows: rows}, nil
+}
+
+// rowsEventCursor is an EventCursor over the rows of the events table
+type rowsEventCursor struct {
+	rows *sqlx.Rows
+}
+
+func (c *rowsEventCursor) Next() bool {
+	return c.rows.Next()
+}
+
+func (c *rowsEventCursor) Scan(event *Event) error {
+	return c.rows.StructScan(event)
+}
+
+func (c *rowsEventCursor) Close() error {
+	return c.rows.Close()
+}
+
+func (s *sqliteStorage) Reset(participantId string, after time.Time) error {
+	for _, table := range []struct {
+		name   string
+		column string
+	}{
+		{"logs", "created_at"},
+		{"files", "created_at"},
+		{"events", "created_at"},
+		{"sessions", "started_at"},
+	} {
+		query := squirrel.Delete(table.name).Where(squirrel.Eq{"participant_id": participantId})
+		if !after.IsZero() {
+			query = query.Where("julianday("+table.column+") >= julianday(?)", after.Format(time.RFC3339Nano))
+		}
+
+		if _, err := query.RunWith(s.db).Exec(); err != nil {
+			return err
+		}
+	}
+
+	if _, err := s.db.Exec("DELETE FROM session_files WHERE session_id NOT IN (SELECT id FROM sessions)"); err != nil {
+		return err
+	}
+
+	// remove the contents of the deleted files
+	_, err := pruneBlobs(s.db)
+	return err
+}
+
+func (s *sqliteStorage) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,170 @@
+package logger
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrUnsupportedStorage is returned by the features which are only
+// available when the logs are stored in SQLite (eg. merging and encryption)
+var ErrUnsupportedStorage = errors.New("operation is not supported by the storage backend")
+
+// Storage is the backend where the logger keeps its settings, log entries,
+// file versions, sessions and events. GetSetting and ReadFile return sql.ErrNoRows if the
+// setting or the file does not exist.
+type Storage interface {
+	GetSetting(name string) (string, error)
+	// SetSettings stores all of the settings at once
+	SetSettings(settings map[string]string) error
+	DeleteSetting(name string) error
+
+	// AddParticipant registers the participant. Participants which
+	// are already registered are left unchanged.
+	AddParticipant(participant Participant) error
+	// Participants returns the participants ordered by their registration
+	Participants() ([]Participant, error)
+
+	InsertEntry(entry LogEntry) error
+	Entries(filter EntryFilter) (EntryCursor, error)
+
+	// WriteFile stores the content as the version of the file,
+	// replacing the version if it already exists
+	WriteFile(file FileVersion, content []byte) error
+	// ReadFile returns the content of the version of the file. Version
+	// zero returns the content of the earliest version.
+	ReadFile(participantId string, filePath string, version int) ([]byte, error)
+	// LatestFileVersion returns zero if the file has no versions
+	LatestFileVersion(participantId string, filePath string) (int, error)
+	RenameFile(participantId string, oldPath string, newPath string) error
+	DeleteFile(participantId string, filePath string) error
+	FileVersions(filter FileFilter) (FileCursor, error)
+
+	// StartSession records the session and returns its id
+	StartSession(session Session) (int, error)
+	// EndSession ends the session unless it has already ended
+	EndSession(id int, endedAt time.Time, reason string) error
+	// AddSessionFile records the file as opened during the session. Files
+	// which are already recorded are left unchanged.
+	AddSessionFile(id int, filePath string, openedAt time.Time) error
+	// Session returns sql.ErrNoRows if the session does not exist
+	Session(id int) (Session, error)
+	// Sessions returns the sessions of the participant ordered by id
+	Sessions(participantId string) ([]Session, error)
+
+	InsertEvent(event Event) error
+	Events(filter EventFilter) (EventCursor, error)
+
+	// Reset removes the data of the participant created on or after the
+	// time. A zero time removes all of the data of the participant.
+	Reset(participantId string, after time.Time) error
+	Close() error
+}
+
+// EntryFilter selects the log entries returned by Storage.Entries
+type EntryFilter struct {
+	ParticipantId  string
+	FilePathPrefix string
+	ErrorType      string
+	ExitCode       *int
+	After          time.Time
+	Before         time.Time
+	// Cursor continues after the entry with the id in the order of the filter
+	Cursor int
+	// Limit of zero returns all of the matching entries
+	Limit      int
+	Descending bool
+	// ByParticipant orders the entries by participant before their creation time
+	ByParticipant bool
+	// BySession orders the entries of each participant by their session.
+	// Entries without a session come first. It implies ByParticipant.
+	BySession bool
+}
+
+// FileFilter selects the file versions returned by Storage.FileVersions.
+// File versions are ordered by participant, file path and version.
+type FileFilter struct {
+	// ParticipantId returns the files of all participants if empty
+	ParticipantId string
+	After         time.Time
+	Before        time.Time
+}
+
+// EventFilter selects the events returned by Storage.Events. Events are
+// ordered by participant and creation time.
+type EventFilter struct {
+	After  time.Time
+	Before time.Time
+}
+
+// EntryCursor streams the log entries from the storage
+type EntryCursor interface {
+	Next() bool
+	Scan(entry *LogEntry) error
+	Close() error
+}
+
+// FileCursor streams the file versions from the storage
+type FileCursor interface {
+	Next() bool
+	Scan(file *FileVersion) error
+	// Content returns the content of the file version returned by Scan
+	Content(file FileVersion) ([]byte, error)
+	Close() error
+}
+
+// EventCursor streams the events from the storage
+type EventCursor interface {
+	Next() bool
+	Scan(event *Event) error
+	Close() error
+}
+
+// NewLoggerWithStorage creates a logger which stores its data in the storage
+func NewLoggerWithStorage(storage Storage) (*Logger, error) {
+	logger := &Logger{storage: storage}
+	if sqlite, ok := storage.(*sqliteStorage); ok {
+		logger.db = sqlite.db
+	}
+
+	if err := logger.Setup(); err != nil {
+		return nil, err
+	}
+	return logger, nil
+}
+
+// setCipher sets the cipher used for encrypting the logs
+func (log *Logger) setCipher(c *fieldCipher) {
+	log.cipher = c
+	if sqlite, ok := log.storage.(*sqliteStorage); ok {
+		sqlite.cipher = c
+	}
+}
+
+// matchesCreatedAt checks if the time is within the range of the filter
+func matchesCreatedAt(createdAt *NullTime, after time.Time, before time.Time) bool {
+	if createdAt == nil || !createdAt.Valid {
+		return after.IsZero() && before.IsZero()
+	}
+	return (after.IsZero() || !createdAt.Time.Before(after)) &&
+		(before.IsZero() || createdAt.Time.Before(before))
+}
+
+// sliceEntryCursor is an EntryCursor over the entries already in memory
+type sliceEntryCursor struct {
+	entries []LogEntry
+	idx     int
+}
+
+func (c *sliceEntryCursor) Next() bool {
+	c.idx++
+	return c.idx <= len(c.entries)
+}
+
+func (c *sliceEntryCursor) Scan(entry *LogEntry) error {
+	*entry = c.entries[c.idx-1]
+	return nil
+}
+
+func (c *sliceEntryCursor) Close() error {
+	return nil
+}
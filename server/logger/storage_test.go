@@ -0,0 +1,402 @@
+package logger_test
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nedpals/bugbuddy/server/logger"
+	"github.com/nedpals/bugbuddy/server/logger/analyzer"
+	timetosolve "github.com/nedpals/bugbuddy/server/logger/analyzer/time_to_solve"
+)
+
+// storageBackends returns a function for opening each storage backend.
+// Calling the function again reopens the same storage.
+func storageBackends(t *testing.T) map[string]func() logger.Storage {
+	dbPath := filepath.Join(t.TempDir(), "logs.db")
+	jsonlDir := filepath.Join(t.TempDir(), "logs")
+	memory := logger.NewMemoryStorage()
+
+	return map[string]func() logger.Storage{
+		"memory": func() logger.Storage {
+			return memory
+		},
+		"sqlite": func() logger.Storage {
+			storage, err := logger.NewSQLiteStorage(dbPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return storage
+		},
+		"jsonl": func() logger.Storage {
+			storage, err := logger.NewJSONLStorage(jsonlDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return storage
+		},
+	}
+}
+
+func newStorageLogger(t *testing.T, storage logger.Storage) *logger.Logger {
+	t.Helper()
+
+	log, err := logger.NewLoggerWithStorage(storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	collectEverything(t, log)
+	return log
+}
+
+func TestStorage_Behavior(t *testing.T) {
+	start := time.Date(2023, 9, 1, 8, 0, 0, 0, time.UTC)
+	at := func(minutes int) *logger.NullTime {
+		return &logger.NullTime{Time: start.Add(time.Duration(minutes) * time.Minute), Valid: true}
+	}
+
+	for name, open := range storageBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			log := newStorageLogger(t, open())
+			defer log.Close()
+
+			participantId := log.ParticipantId()
+			if len(participantId) == 0 {
+				t.Fatal("expected participant id to be generated")
+			}
+
+			// settings
+			if err := log.AddSetting("foo", "bar"); err != nil {
+				t.Fatal(err)
+			} else if value, err := log.GetSetting("foo"); err != nil || value != "bar" {
+				t.Fatalf("expected setting to be stored, got %q (%v)", value, err)
+			} else if err := log.DeleteSetting("foo"); err != nil {
+				t.Fatal(err)
+			} else if _, err := log.GetSetting("foo"); err != sql.ErrNoRows {
+				t.Fatalf("expected sql.ErrNoRows, got %v", err)
+			}
+
+			// entries
+			for _, entry := range []logger.LogEntry{
+				{ErrorCode: 1, ErrorType: "NameError", FilePath: "src/main.py", FileVersion: 1, CreatedAt: at(0)},
+				{ErrorCode: 1, ErrorType: "TypeError", FilePath: "src/main.py", FileVersion: 2, CreatedAt: at(10)},
+				{ErrorCode: 0, FilePath: "src/main.py", FileVersion: 3, CreatedAt: at(20)},
+				{ErrorCode: 1, ErrorType: "NameError", FilePath: "test/other.py", FileVersion: 1, CreatedAt: at(30)},
+				{ParticipantId: "other", ErrorCode: 1, ErrorType: "NameError", FilePath: "src/main.py", CreatedAt: at(5)},
+			} {
+				if err := log.Log(entry); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			assertEntries := func(query *logger.LogQuery, expected ...string) []logger.LogEntry {
+				t.Helper()
+
+				iter, err := query.Entries()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				entries, err := iter.List()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if len(entries) != len(expected) {
+					t.Fatalf("expected %d entries, got %d", len(expected), len(entries))
+				}
+
+				for i, entry := range entries {
+					if got := entry.FilePath + "@" + entry.ErrorType; got != expected[i] {
+						t.Errorf("expected entry %d to be %s, got %s", i, expected[i], got)
+					}
+				}
+				return entries
+			}
+
+			assertEntries(log.Query().Participant(participantId).ErrorType("NameError"), "src/main.py@NameError", "test/other.py@NameError")
+			assertEntries(log.Query().FilePathPrefix("test/"), "test/other.py@NameError")
+			assertEntries(log.Query().ExitCode(0), "src/main.py@")
+			assertEntries(log.Query().After(at(10).Time).Before(at(30).Time), "src/main.py@TypeError", "src/main.py@")
+
+			page := assertEntries(log.Query().Descending().Limit(2), "test/other.py@NameError", "src/main.py@")
+			assertEntries(log.Query().Descending().Cursor(page[1].Id).Limit(2), "src/main.py@TypeError", "src/main.py@NameError")
+
+			iter, err := log.AllEntries()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			entries, err := iter.List()
+			if err != nil {
+				t.Fatal(err)
+			} else if len(entries) != 5 {
+				t.Fatalf("expected 5 entries, got %d", len(entries))
+			}
+
+			for i := 1; i < len(entries); i++ {
+				if entries[i-1].ParticipantId > entries[i].ParticipantId {
+					t.Fatalf("expected entries to be ordered by participant, got %s before %s", entries[i-1].ParticipantId, entries[i].ParticipantId)
+				}
+			}
+
+			// versioned files
+			if err := log.WriteVersionedFile("src/main.py", []byte("a = 1"), -1); err != nil {
+				t.Fatal(err)
+			} else if err := log.WriteVersionedFile("src/main.py", []byte("a = 2"), -1); err != nil {
+				t.Fatal(err)
+			} else if version, err := log.LatestVersionFromFile("src/main.py"); err != nil || version != 2 {
+				t.Fatalf("expected latest version to be 2, got %d (%v)", version, err)
+			} else if content, err := log.OpenVersionedFile("src/main.py", 2); err != nil || string(content) != "a = 2" {
+				t.Fatalf("unexpected content %q (%v)", content, err)
+			} else if content, err := log.OpenFile("src/main.py"); err != nil || string(content) != "a = 1" {
+				t.Fatalf("expected the earliest version, got %q (%v)", content, err)
+			}
+
+			if err := log.RenameFile("src/main.py", "src/app.py"); err != nil {
+				t.Fatal(err)
+			} else if _, err := log.OpenVersionedFile("src/main.py", 1); err != sql.ErrNoRows {
+				t.Fatalf("expected renamed file to be missing, got %v", err)
+			}
+
+			if err := log.WriteFile("notes.txt", []byte("hello")); err != nil {
+				t.Fatal(err)
+			} else if err := log.DeleteFile("notes.txt"); err != nil {
+				t.Fatal(err)
+			}
+
+			files, err := log.FileVersions(participantId)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			versions := []string{}
+			for files.Next() {
+				file, err := files.Value()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				content, err := files.Content(file)
+				if err != nil {
+					t.Fatal(err)
+				}
+				versions = append(versions, file.FilePath+":"+string(content))
+			}
+
+			if len(versions) != 2 || versions[0] != "src/app.py:a = 1" || versions[1] != "src/app.py:a = 2" {
+				t.Fatalf("unexpected file versions %v", versions)
+			}
+
+			// analyzers read the logs through the logger
+			kv := analyzer.NewDefaultKV()
+			if err := analyzer.New[*timetosolve.Analyzer]().Analyze(kv, analyzer.LoadFromExistingLogger(log)); err != nil {
+				t.Fatal(err)
+			} else if tts, ok := kv[timetosolve.KEY][participantId]["src/main.py"].(time.Duration); !ok || tts != 20*time.Minute {
+				t.Fatalf("expected time to solve of 20m, got %v", kv[timetosolve.KEY][participantId])
+			}
+
+			// reset only removes the data of the participant after the time
+			log.After = at(15).Time
+			if err := log.Reset(); err != nil {
+				t.Fatal(err)
+			}
+			log.After = time.Time{}
+
+			assertEntries(log.Query().Participant(participantId), "src/main.py@NameError", "src/main.py@TypeError")
+			assertEntries(log.Query().Participant("other"), "src/main.py@NameError")
+			if _, err := log.OpenVersionedFile("src/app.py", 2); err != sql.ErrNoRows {
+				t.Fatalf("expected files written after the time to be removed, got %v", err)
+			}
+
+			// the data stays the same after reopening the storage
+			if name == "memory" {
+				return
+			}
+
+			log.Close()
+			log = newStorageLogger(t, open())
+
+			if log.ParticipantId() != participantId {
+				t.Errorf("expected participant id %s after reopening, got %s", participantId, log.ParticipantId())
+			}
+
+			assertEntries(log.Query().Participant(participantId), "src/main.py@NameError", "src/main.py@TypeError")
+			if _, err := log.OpenVersionedFile("src/app.py", 2); err != sql.ErrNoRows {
+				t.Fatalf("expected the reset to persist, got %v", err)
+			}
+		})
+	}
+}
+
+func TestStorage_SessionsAndEvents(t *testing.T) {
+	for name, open := range storageBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			log := newStorageLogger(t, open())
+			defer func() { log.Close() }()
+
+			if err := log.SetEventsConfig(logger.EventsConfig{Enabled: true, SnapshotInterval: time.Second}); err != nil {
+				t.Fatal(err)
+			}
+
+			sessionId, err := log.StartSession("vscode")
+			if err != nil {
+				t.Fatal(err)
+			} else if sessionId == 0 {
+				t.Fatal("expected the session to be recorded")
+			}
+
+			for _, filePath := range []string{"main.py", "utils.py", "main.py"} {
+				if err := log.AddSessionFile(sessionId, filePath); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := log.EndSession(sessionId, time.Now(), logger.SessionEndIdle); err != nil {
+				t.Fatal(err)
+			} else if err := log.Log(logger.LogEntry{ErrorCode: 1, FilePath: "main.py", SessionId: &sessionId}); err != nil {
+				t.Fatal(err)
+			} else if err := log.LogEvent(logger.Event{SessionId: &sessionId, Kind: logger.EventEdit, FilePath: "main.py", CharsInserted: 3}); err != nil {
+				t.Fatal(err)
+			} else if err := log.LogSnapshot(&sessionId, "main.py", []byte("a = 1")); err != nil {
+				t.Fatal(err)
+			}
+
+			assertRecorded := func() {
+				t.Helper()
+
+				session, err := log.Session(sessionId)
+				if err != nil {
+					t.Fatal(err)
+				} else if session.Editor != "vscode" || session.IsOpen() || session.EndReason != logger.SessionEndIdle {
+					t.Errorf("unexpected session %+v", session)
+				} else if len(session.Files) != 2 {
+					t.Errorf("expected 2 opened files, got %v", session.Files)
+				}
+
+				iter, err := log.AllEvents()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				events, err := iter.List()
+				if err != nil {
+					t.Fatal(err)
+				} else if len(events) != 2 || events[0].Kind != logger.EventEdit || events[1].Kind != logger.EventSnapshot {
+					t.Fatalf("expected an edit and a snapshot, got %+v", events)
+				} else if events[1].FileVersion == nil || *events[1].FileVersion != 1 {
+					t.Errorf("expected the snapshot to be the first version, got %v", events[1].FileVersion)
+				}
+
+				sessions, err := log.SessionEntries()
+				if err != nil {
+					t.Fatal(err)
+				} else if !sessions.Next() {
+					t.Fatal("expected the entries of the session")
+				} else if group, err := sessions.Value(); err != nil {
+					t.Fatal(err)
+				} else if group.Session == nil || group.Session.Id != sessionId || len(group.Entries) != 1 {
+					t.Errorf("unexpected session entries %+v", group)
+				}
+			}
+
+			assertRecorded()
+			if name != "memory" {
+				// the data stays the same after reopening the storage
+				log.Close()
+				log = newStorageLogger(t, open())
+				assertRecorded()
+			}
+
+			if err := log.Reset(); err != nil {
+				t.Fatal(err)
+			} else if _, err := log.Session(sessionId); err != sql.ErrNoRows {
+				t.Errorf("expected the session to be removed, got %v", err)
+			}
+
+			iter, err := log.AllEvents()
+			if err != nil {
+				t.Fatal(err)
+			} else if events, err := iter.List(); err != nil {
+				t.Fatal(err)
+			} else if len(events) != 0 {
+				t.Errorf("expected the events to be removed, got %+v", events)
+			}
+		})
+	}
+}
+
+func TestJSONLStorage_CollectionLevel(t *testing.T) {
+	dir := t.TempDir()
+	settings := `{"op":"set","name":"participant_id","value":"student-a"}` + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "settings.jsonl"), []byte(settings), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// the logs created before the consent keep storing everything
+	log, err := logger.NewLoggerFromPath(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+
+	if level := log.CollectionLevel(); level != logger.CollectionFull {
+		t.Errorf("expected the existing logs to store everything, got %s", level)
+	}
+
+	fresh, err := logger.NewLoggerFromPath(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fresh.Close()
+
+	if level := fresh.CollectionLevel(); level != logger.CollectionMetadataOnly {
+		t.Errorf("expected new logs to only store metadata, got %s", level)
+	}
+}
+
+func TestJSONLStorage_TruncatedRecord(t *testing.T) {
+	dir := t.TempDir()
+
+	log, err := logger.NewLoggerFromPath(dir)
+	if err != nil {
+		t.Fatal(err)
+	} else if err := log.Log(logger.LogEntry{ErrorCode: 1, FilePath: "main.py"}); err != nil {
+		t.Fatal(err)
+	}
+	log.Close()
+
+	// simulate a crash in the middle of writing a record
+	file, err := os.OpenFile(filepath.Join(dir, "logs.jsonl"), os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	} else if _, err := file.WriteString(`{"op":"insert","entry":{"id":2,`); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	log, err = logger.NewLoggerFromPath(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+
+	if err := log.Log(logger.LogEntry{ErrorCode: 0, FilePath: "main.py"}); err != nil {
+		t.Fatal(err)
+	}
+
+	iter, err := log.Entries()
+	if err != nil {
+		t.Fatal(err)
+	} else if entries, err := iter.List(); err != nil {
+		t.Fatal(err)
+	} else if len(entries) != 2 {
+		t.Fatalf("expected the truncated record to be dropped, got %+v", entries)
+	}
+
+	if _, err := log.Merge(logger.NewMemoryLoggerPanic(), "memory", logger.MergeOptions{}); err != logger.ErrUnsupportedStorage {
+		t.Errorf("expected merging to be unsupported, got %v", err)
+	}
+}
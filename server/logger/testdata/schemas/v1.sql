@@ -0,0 +1,46 @@
+-- Schema version 1: the original init.sql tables tracked by schema_version.
+CREATE TABLE IF NOT EXISTS settings (
+    name TEXT PRIMARY KEY,
+    value TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS files (
+    id INTEGER PRIMARY KEY,
+    participant_id TEXT NOT NULL,
+    file_path TEXT NOT NULL,
+    file_version INTEGER DEFAULT 1,
+    content TEXT NOT NULL,
+    created_at TEXT NOT NULL,
+    UNIQUE(participant_id, file_path, file_version) ON CONFLICT REPLACE
+);
+
+CREATE TABLE IF NOT EXISTS logs (
+    id INTEGER PRIMARY KEY,
+    participant_id TEXT NOT NULL,
+    executed_command TEXT NOT NULL,
+    error_code INTEGER NOT NULL,
+    error_message TEXT NOT NULL,
+    generated_output TEXT NOT NULL,
+    error_type TEXT NOT NULL,
+    error_line INTEGER NOT NULL,
+    error_column INTEGER NOT NULL,
+    file_path TEXT NOT NULL,
+    file_version INTEGER NOT NULL,
+    created_at TEXT NOT NULL
+);
+
+INSERT INTO settings (name, value) VALUES ('participant_id', 'fixture-participant');
+INSERT INTO settings (name, value) VALUES ('_seed', '12121111');
+INSERT INTO settings (name, value) VALUES ('schema_version', '1');
+
+INSERT INTO files (participant_id, file_path, file_version, content, created_at) VALUES
+    ('fixture-participant', '/home/student/hello.py', 1, 'print(a)', '2023-09-01T08:00:00Z'),
+    ('fixture-participant', '/home/student/hello.py', 2, 'a = 1
+print(a)', '2023-09-01T08:05:00Z');
+
+INSERT INTO logs (
+    participant_id, executed_command, error_code, error_message, generated_output,
+    error_type, error_line, error_column, file_path, file_version, created_at
+) VALUES
+    ('fixture-participant', 'python3 hello.py', 1, 'NameError: name ''a'' is not defined', '# NameError', 'NameError', 1, 6, '/home/student/hello.py', 1, '2023-09-01T08:00:00Z'),
+    ('fixture-participant', 'python3 hello.py', 0, '', '', '', 0, 0, '/home/student/hello.py', 2, '2023-09-01T08:05:00Z');
@@ -0,0 +1,60 @@
+-- Schema version 2: file contents may be stored in the blobs table.
+CREATE TABLE IF NOT EXISTS settings (
+    name TEXT PRIMARY KEY,
+    value TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS blobs (
+    hash TEXT PRIMARY KEY,
+    encoding TEXT NOT NULL,
+    base_hash TEXT,
+    depth INTEGER NOT NULL DEFAULT 0,
+    size INTEGER NOT NULL,
+    data BLOB NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS files (
+    id INTEGER PRIMARY KEY,
+    participant_id TEXT NOT NULL,
+    file_path TEXT NOT NULL,
+    file_version INTEGER DEFAULT 1,
+    content TEXT,
+    content_hash TEXT,
+    created_at TEXT NOT NULL,
+    UNIQUE(participant_id, file_path, file_version) ON CONFLICT REPLACE
+);
+
+CREATE INDEX IF NOT EXISTS files_content_hash ON files (content_hash);
+
+CREATE TABLE IF NOT EXISTS logs (
+    id INTEGER PRIMARY KEY,
+    participant_id TEXT NOT NULL,
+    executed_command TEXT NOT NULL,
+    error_code INTEGER NOT NULL,
+    error_message TEXT NOT NULL,
+    generated_output TEXT NOT NULL,
+    error_type TEXT NOT NULL,
+    error_line INTEGER NOT NULL,
+    error_column INTEGER NOT NULL,
+    file_path TEXT NOT NULL,
+    file_version INTEGER NOT NULL,
+    created_at TEXT NOT NULL
+);
+
+INSERT INTO settings (name, value) VALUES ('participant_id', 'fixture-participant');
+INSERT INTO settings (name, value) VALUES ('_seed', '12121111');
+INSERT INTO settings (name, value) VALUES ('schema_version', '2');
+
+INSERT INTO files (participant_id, file_path, file_version, content, content_hash, created_at) VALUES
+    ('fixture-participant', '/home/student/hello.py', 1, 'print(a)', NULL, '2023-09-01T08:00:00Z'),
+    ('fixture-participant', '/home/student/hello.py', 2, NULL, '3fc984d090689e3368bac05291ee81e32e5939cd1448a54302506a00add33a17', '2023-09-01T08:05:00Z');
+
+INSERT INTO blobs (hash, encoding, base_hash, depth, size, data) VALUES
+    ('3fc984d090689e3368bac05291ee81e32e5939cd1448a54302506a00add33a17', 'zlib', NULL, 0, 14, X'789C4B54B05530E42A28CACC2BD148D404001BE903F9');
+
+INSERT INTO logs (
+    participant_id, executed_command, error_code, error_message, generated_output,
+    error_type, error_line, error_column, file_path, file_version, created_at
+) VALUES
+    ('fixture-participant', 'python3 hello.py', 1, 'NameError: name ''a'' is not defined', '# NameError', 'NameError', 1, 6, '/home/student/hello.py', 1, '2023-09-01T08:00:00Z'),
+    ('fixture-participant', 'python3 hello.py', 0, '', '', '', 0, 0, '/home/student/hello.py', 2, '2023-09-01T08:05:00Z');
@@ -0,0 +1,117 @@
+package logger
+
+import (
+	"fmt"
+)
+
+// VerifyProblem is an inconsistency found while verifying the logs
+type VerifyProblem struct {
+	// Check is the name of the check which found the problem
+	Check   string `json:"check"`
+	Message string `json:"message"`
+}
+
+// referentialCheck finds the rows referring to missing rows. The query
+// returns the description of each problem.
+type referentialCheck struct {
+	name  string
+	query string
+}
+
+var referentialChecks = []referentialCheck{
+	{
+		name: "log_files",
+		query: `SELECT printf('log entry %d refers to missing file %s (version %d) of %s', l.id, l.file_path, l.file_version, l.participant_id)
+			FROM logs l
+			WHERE l.file_path != '' AND l.file_version > 0 AND NOT EXISTS (
+				SELECT 1 FROM files f
+				WHERE f.participant_id = l.participant_id AND f.file_path = l.file_path AND f.file_version = l.file_version
+			)
+			ORDER BY l.id`,
+	},
+	{
+		name: "file_blobs",
+		query: `SELECT printf('file %s (version %d) of %s refers to missing blob %s', f.file_path, f.file_version, f.participant_id, f.content_hash)
+			FROM files f
+			WHERE f.content_hash IS NOT NULL AND NOT EXISTS (SELECT 1 FROM blobs b WHERE b.hash = f.content_hash)
+			ORDER BY f.id`,
+	},
+	{
+		name: "blob_bases",
+		query: `SELECT printf('blob %s is a delta of missing blob %s', b.hash, b.base_hash)
+			FROM blobs b
+			WHERE b.base_hash IS NOT NULL AND NOT EXISTS (SELECT 1 FROM blobs base WHERE base.hash = b.base_hash)
+			ORDER BY b.hash`,
+	},
+	{
+		name: "log_sessions",
+		query: `SELECT printf('log entry %d refers to missing session %d', l.id, l.session_id)
+			FROM logs l
+			WHERE l.session_id IS NOT NULL AND NOT EXISTS (SELECT 1 FROM sessions s WHERE s.id = l.session_id)
+			ORDER BY l.id`,
+	},
+	{
+		name: "event_sessions",
+		query: `SELECT printf('event %d refers to missing session %d', e.id, e.session_id)
+			FROM events e
+			WHERE e.session_id IS NOT NULL AND NOT EXISTS (SELECT 1 FROM sessions s WHERE s.id = e.session_id)
+			ORDER BY e.id`,
+	},
+	{
+		name: "session_files",
+		query: `SELECT printf('file %s was opened in missing session %d', sf.file_path, sf.session_id)
+			FROM session_files sf
+			WHERE NOT EXISTS (SELECT 1 FROM sessions s WHERE s.id = sf.session_id)
+			ORDER BY sf.session_id, sf.file_path`,
+	},
+	{
+		name: "event_files",
+		query: `SELECT printf('snapshot event %d refers to missing file %s (version %d) of %s', e.id, e.file_path, e.file_version, e.participant_id)
+			FROM events e
+			WHERE e.file_version IS NOT NULL AND NOT EXISTS (
+				SELECT 1 FROM files f
+				WHERE f.participant_id = e.participant_id AND f.file_path = e.file_path AND f.file_version = e.file_version
+			)
+			ORDER BY e.id`,
+	},
+}
+
+// Verify checks the database for corruption with SQLite's integrity check
+// and checks that the rows only refer to existing rows, such as the file
+// version of each log entry. It returns the problems found.
+func (log *Logger) Verify() ([]VerifyProblem, error) {
+	if log.db == nil {
+		return nil, ErrUnsupportedStorage
+	}
+
+	problems := []VerifyProblem{}
+
+	integrity := []string{}
+	if err := log.db.Select(&integrity, "PRAGMA integrity_check"); err != nil {
+		return nil, err
+	}
+
+	for _, message := range integrity {
+		if message != "ok" {
+			problems = append(problems, VerifyProblem{Check: "integrity", Message: message})
+		}
+	}
+
+	// the referential checks are not reliable on a corrupted database
+	if len(problems) != 0 {
+		return problems, nil
+	}
+
+	for _, check := range referentialChecks {
+		messages := []string{}
+		if err := log.db.Select(&messages, check.query); err != nil {
+			return nil, fmt.Errorf("%s: %w", check.name, err)
+		}
+
+		for _, message := range messages {
+			problems = append(problems, VerifyProblem{Check: check.name, Message: message})
+		}
+	}
+
+	return problems, nil
+}
@@ -8,6 +8,7 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strings"
 	"syscall"
 
 	"github.com/nedpals/bugbuddy/server/daemon"
@@ -32,6 +33,15 @@ type FetchRunCommandPayload struct {
 
 type GenerateParticipantIdPayload struct {
 	Confirm bool `json:"confirm"`
+	// Reset archives the logs of the current participant before the new
+	// participant id is generated. The logs are never removed permanently
+	// and can be restored with "bugbuddy logs restore".
+	Reset bool `json:"reset"`
+}
+
+type SwitchParticipantPayload struct {
+	// ParticipantId is generated if it is empty
+	ParticipantId string `json:"participant_id"`
 }
 
 type LspServer struct {
@@ -97,6 +107,11 @@ func (s *LspServer) Handle(ctx context.Context, c *jsonrpc2.Conn, r *jsonrpc2.Re
 			s.daemonClient = daemonClient
 		}
 
+		// the editor is recorded in the sessions of the participant
+		if payload != nil && payload.ClientInfo != nil {
+			s.daemonClient.Editor = strings.TrimSpace(payload.ClientInfo.Name + " " + payload.ClientInfo.Version)
+		}
+
 		// connect to the daemon
 		if err := s.daemonClient.Connect(); err != nil && err.Error() != "already connected" {
 			c.ReplyWithError(ctx, r.ID, &jsonrpc2.Error{
@@ -215,6 +230,16 @@ func (s *LspServer) Handle(ctx context.Context, c *jsonrpc2.Conn, r *jsonrpc2.Re
 			return
 		}
 
+		if payload.Reset {
+			if err := s.daemonClient.ResetLogger(); err != nil {
+				c.ReplyWithError(ctx, r.ID, &jsonrpc2.Error{
+					Code:    -32002,
+					Message: fmt.Sprintf("Unable to archive the logs: %s", err.Error()),
+				})
+				return
+			}
+		}
+
 		newPId, err := s.daemonClient.GenerateParticipantId()
 		if err != nil {
 			c.ReplyWithError(ctx, r.ID, &jsonrpc2.Error{
@@ -223,7 +248,100 @@ func (s *LspServer) Handle(ctx context.Context, c *jsonrpc2.Conn, r *jsonrpc2.Re
 			})
 			return
 		}
-		c.Reply(ctx, r.ID, map[string]string{"participant_id": newPId})
+		c.Reply(ctx, r.ID, map[string]any{"participant_id": newPId, "archived": payload.Reset})
+		return
+	case "$/participant/switch":
+		payload := mustDecodePayload[SwitchParticipantPayload](ctx, c, r)
+		if payload == nil {
+			return
+		}
+
+		// only the participant of this editor is switched
+		participantId, err := s.daemonClient.SwitchParticipant(payload.ParticipantId, true)
+		if err != nil {
+			c.ReplyWithError(ctx, r.ID, &jsonrpc2.Error{
+				Code:    -32002,
+				Message: fmt.Sprintf("Unable to switch participant: %s", err.Error()),
+			})
+			return
+		}
+		c.Reply(ctx, r.ID, map[string]string{"participant_id": participantId})
+		return
+	case "$/participants":
+		participants, err := s.daemonClient.ListParticipants()
+		if err != nil {
+			c.ReplyWithError(ctx, r.ID, &jsonrpc2.Error{
+				Code:    -32002,
+				Message: fmt.Sprintf("Unable to retrieve participants: %s", err.Error()),
+			})
+			return
+		}
+		c.Reply(ctx, r.ID, participants)
+		return
+	case "$/consent":
+		consent, err := s.daemonClient.RetrieveConsent()
+		if err != nil {
+			c.ReplyWithError(ctx, r.ID, &jsonrpc2.Error{
+				Code:    -32002,
+				Message: fmt.Sprintf("Unable to retrieve consent: %s", err.Error()),
+			})
+			return
+		}
+
+		c.Reply(ctx, r.ID, consent)
+		return
+	case "$/consent/set":
+		payload := mustDecodePayload[daemonTypes.ConsentPayload](ctx, c, r)
+		if payload == nil {
+			return
+		}
+
+		if err := s.daemonClient.SetConsent(payload.Level, payload.StudyId); err != nil {
+			c.ReplyWithError(ctx, r.ID, &jsonrpc2.Error{
+				Code:    -32002,
+				Message: fmt.Sprintf("Unable to set consent: %s", err.Error()),
+			})
+			return
+		}
+
+		consent, err := s.daemonClient.RetrieveConsent()
+		if err != nil {
+			c.ReplyWithError(ctx, r.ID, &jsonrpc2.Error{
+				Code:    -32002,
+				Message: fmt.Sprintf("Unable to retrieve consent: %s", err.Error()),
+			})
+			return
+		}
+
+		c.Reply(ctx, r.ID, consent)
+		return
+	case "$/events":
+		config, err := s.daemonClient.RetrieveEventsConfig()
+		if err != nil {
+			c.ReplyWithError(ctx, r.ID, &jsonrpc2.Error{
+				Code:    -32002,
+				Message: fmt.Sprintf("Unable to retrieve events config: %s", err.Error()),
+			})
+			return
+		}
+
+		c.Reply(ctx, r.ID, config)
+		return
+	case "$/events/set":
+		payload := mustDecodePayload[daemonTypes.EventsPayload](ctx, c, r)
+		if payload == nil {
+			return
+		}
+
+		if err := s.daemonClient.SetEventsConfig(payload.Enabled, payload.SnapshotInterval); err != nil {
+			c.ReplyWithError(ctx, r.ID, &jsonrpc2.Error{
+				Code:    -32002,
+				Message: fmt.Sprintf("Unable to set events config: %s", err.Error()),
+			})
+			return
+		}
+
+		c.Reply(ctx, r.ID, payload)
 		return
 	case "$/status":
 		var participantId string
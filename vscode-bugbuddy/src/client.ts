@@ -315,12 +315,19 @@ export async function getParticipantId() {
 }
 
 export async function generateParticipantId() {
-    const resp = await window.showInformationMessage('Are you sure you want to generate a new participant ID?', 'Yes', 'No');
+    const resp = await window.showInformationMessage(
+        'Are you sure you want to generate a new participant ID? Your logs can also be archived and restored later with "bugbuddy logs restore".',
+        'Yes',
+        'Yes, archive my logs',
+        'No'
+    );
+
+    const reset = resp === 'Yes, archive my logs';
 
     // eslint-disable-next-line @typescript-eslint/naming-convention
-    const got = await getClient().sendRequest<{ participant_id: string }>('$/participantId/generate', { confirm: resp === 'Yes' });
+    const got = await getClient().sendRequest<{ participant_id: string }>('$/participantId/generate', { confirm: resp === 'Yes' || reset, reset });
     setConnectionStatus(ConnectionStatus.connected, { participantId: got.participant_id });
-    window.showInformationMessage('A new participant ID has been generated.');
+    window.showInformationMessage(reset ? 'Your logs have been archived and a new participant ID has been generated.' : 'A new participant ID has been generated.');
 }
 
 export async function copyParticipantId() {